@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/mail"
+	"splay/pkg/anomaly"
+	"splay/pkg/schedule"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/cron"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Alert is a bucket health event, sent to the alert channels of the bucket and its realtime subscribers.
+type Alert struct {
+	Event    string         `json:"event"`
+	Bucket   string         `json:"bucket"`
+	Slug     string         `json:"slug"`
+	Message  string         `json:"message"`
+	Incident string         `json:"incident,omitempty"`
+	At       time.Time      `json:"at"`
+	Details  map[string]any `json:"details,omitempty"`
+}
+
+// SendAlert broadcasts an alert on "users/<user>/buckets/<bucket>/alerts" and delivers it to the
+// alert webhook and email of the bucket.
+func SendAlert(app *App, bucket Bucket, alert Alert) error {
+	data, err := json.Marshal(alert)
+	if err != nil {
+		return errors.Join(ErrSendingAlert, err)
+	}
+
+	Broadcast(app, bucket.UserID, "users/"+bucket.UserID+"/buckets/"+bucket.ID+"/alerts", data)
+	Emit(app, bucket.UserID, bucket.ID, alert.Event, alert)
+
+	subject := fmt.Sprintf("%s on bucket %s", alert.Event, bucket.Name)
+	if err = NotifyChannels(app, bucket.AlertWebhookURL, bucket.AlertEmail, alert.Event, subject, alert.Message+"\n\n"+string(data), data); err != nil {
+		return errors.Join(ErrSendingAlert, err)
+	}
+
+	return nil
+}
+
+// NotifyChannels posts data to a webhook and mails text to an address, an empty webhook or address is skipped.
+func NotifyChannels(app *App, webhookURL, email, event, subject, text string, data []byte) error {
+	var errs []error
+	if webhookURL != "" {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, webhookURL, bytes.NewReader(data))
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Splay-Event", event)
+
+			resp, err := publicClient.Do(req)
+			if err != nil {
+				errs = append(errs, err)
+			} else {
+				resp.Body.Close()
+			}
+		}
+	}
+
+	if email != "" && app.Settings().SMTP.Enabled {
+		meta := app.Settings().Meta
+		err := app.NewMailClient().Send(&mailer.Message{
+			From:    mail.Address{Name: meta.SenderName, Address: meta.SenderAddress},
+			To:      []mail.Address{{Address: email}},
+			Subject: subject,
+			Text:    text,
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateBucketSilence checks the silence cron expression of a bucket.
+func ValidateBucketSilence(e *core.RecordRequestEvent) error {
+	if expr := e.Record.GetString("silence_cron"); expr != "" {
+		if _, err := schedule.Parse(expr); err != nil {
+			return e.BadRequestError("invalid silence cron", validation.Errors{
+				"silence_cron": validation.NewError("validation_invalid_cron", err.Error()),
+			})
+		}
+	}
+
+	return e.Next()
+}
+
+// CheckSilentBuckets marks every monitored bucket that missed its expected cadence as silent.
+func CheckSilentBuckets(app *App, now time.Time) {
+	buckets := []Bucket{}
+	err := app.DB().
+		Select(bucketColumns...).
+		From("buckets").
+		Where(dbx.NewExp("silent = FALSE AND (silence_after > 0 OR silence_cron != '')")).
+		All(&buckets)
+	if err != nil {
+		app.Logger().Warn("Fetching monitored buckets failed", "error", errors.Join(ErrFetchingBucket, err).Error())
+		return
+	}
+
+	for _, bucket := range buckets {
+		missed, last, err := MissedCadence(app, bucket, now)
+		if err != nil {
+			app.Logger().Warn("Checking bucket cadence failed", "bucket", bucket.ID, "error", err.Error())
+			continue
+		}
+
+		if !missed {
+			continue
+		}
+
+		if err = MarkSilent(app, bucket, last, now); err != nil {
+			app.Logger().Warn("Marking bucket silent failed", "bucket", bucket.ID, "error", err.Error())
+		}
+	}
+}
+
+// MissedCadence reports whether a bucket went without events for longer than silence_after minutes, or
+// through a whole window of its silence cron, along with the time of its last event. Buckets that never
+// received an event count from their creation.
+func MissedCadence(app *App, bucket Bucket, now time.Time) (bool, time.Time, error) {
+	var lastRaw string
+	err := app.DB().
+		NewQuery("SELECT COALESCE((SELECT MAX(created) FROM bucket_receive_logs WHERE bucket = {:bucket}), (SELECT created FROM buckets WHERE id = {:bucket}))").
+		Bind(dbx.Params{"bucket": bucket.ID}).
+		Row(&lastRaw)
+	if err != nil {
+		return false, time.Time{}, errors.Join(ErrCheckingSilence, err)
+	}
+
+	last, err := types.ParseDateTime(lastRaw)
+	if err != nil {
+		return false, time.Time{}, errors.Join(ErrCheckingSilence, err)
+	}
+
+	if bucket.SilenceAfter > 0 && now.Sub(last.Time()) >= time.Duration(bucket.SilenceAfter)*time.Minute {
+		return true, last.Time(), nil
+	}
+
+	if bucket.SilenceCron == "" {
+		return false, last.Time(), nil
+	}
+
+	s, err := schedule.Parse(bucket.SilenceCron)
+	if err != nil {
+		return false, time.Time{}, errors.Join(ErrCheckingSilence, err)
+	}
+
+	// Windows close on the ticks of the cron, the last one must have seen at least one event.
+	now = now.UTC()
+	if !s.IsDue(cron.NewMoment(now)) {
+		return false, last.Time(), nil
+	}
+
+	start, ok := schedule.Prev(s, now)
+	if !ok {
+		return false, last.Time(), nil
+	}
+
+	return last.Time().Before(start), last.Time(), nil
+}
+
+// MarkSilent flags a bucket as silent, opens a silence incident and alerts about it.
+func MarkSilent(app *App, bucket Bucket, last, now time.Time) error {
+	incidentID := core.GenerateDefaultRandomId()
+	since := types.NowDateTime()
+	if dt, err := types.ParseDateTime(last); err == nil {
+		since = dt
+	}
+
+	details := map[string]any{
+		"last_event":    since.String(),
+		"silence_after": bucket.SilenceAfter,
+		"silence_cron":  bucket.SilenceCron,
+	}
+
+	marked := false
+	err := app.RunInTransaction(func(txApp core.App) error {
+		res, err := txApp.DB().NewQuery(markBucketSilent).Bind(dbx.Params{
+			"id":           bucket.ID,
+			"silent_since": since.String(),
+		}).Execute()
+		if err != nil {
+			return err
+		}
+
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		marked = true
+
+		detailBytes, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+
+		created := types.NowDateTime().String()
+		_, err = txApp.DB().NewQuery(insertBucketIncident).Bind(dbx.Params{
+			"id":              incidentID,
+			"bucket":          bucket.ID,
+			"kind":            IncidentSilence,
+			"forward_setting": "",
+			"started":         created,
+			"details":         string(detailBytes),
+			"created":         created,
+			"updated":         created,
+		}).Execute()
+
+		return err
+	})
+	if err != nil || !marked {
+		return err
+	}
+
+	return SendAlert(app, bucket, Alert{
+		Event:    AlertBucketSilent,
+		Bucket:   bucket.ID,
+		Slug:     bucket.Slug,
+		Message:  fmt.Sprintf("Bucket %s received no events since %s.", bucket.Slug, since.Time().Format(time.RFC3339)),
+		Incident: incidentID,
+		At:       now.UTC(),
+		Details:  details,
+	})
+}
+
+// RecoverBucket clears the silence of a bucket that received an event, resolves the open silence
+// incident and alerts about the recovery.
+func RecoverBucket(app *App, bucket Bucket, now time.Time) error {
+	incident := struct {
+		ID      string `db:"id"`
+		Started string `db:"started"`
+	}{}
+	resolved := types.NowDateTime().String()
+
+	recovered := false
+	err := app.RunInTransaction(func(txApp core.App) error {
+		res, err := txApp.DB().NewQuery(clearBucketSilent).Bind(dbx.Params{"id": bucket.ID}).Execute()
+		if err != nil {
+			return err
+		}
+
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		recovered = true
+
+		err = txApp.DB().
+			Select("id", "started").
+			From("bucket_incidents").
+			Where(dbx.HashExp{"bucket": bucket.ID, "kind": IncidentSilence, "resolved": ""}).
+			OrderBy("started DESC").
+			Limit(1).
+			One(&incident)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = txApp.DB().NewQuery(resolveBucketIncident).Bind(dbx.Params{
+			"id":       incident.ID,
+			"resolved": resolved,
+			"updated":  resolved,
+		}).Execute()
+
+		return err
+	})
+	if err != nil || !recovered {
+		return err
+	}
+
+	details := map[string]any{"silent_since": bucket.SilentSince.String()}
+	if !bucket.SilentSince.IsZero() {
+		details["silent_for"] = now.Sub(bucket.SilentSince.Time()).Round(time.Second).String()
+	}
+
+	return SendAlert(app, bucket, Alert{
+		Event:    AlertBucketRecovered,
+		Bucket:   bucket.ID,
+		Slug:     bucket.Slug,
+		Message:  fmt.Sprintf("Bucket %s is receiving events again.", bucket.Slug),
+		Incident: incident.ID,
+		At:       now.UTC(),
+		Details:  details,
+	})
+}
+
+// CheckVolumes closes the anomaly window once it ran for AnomalyWindow minutes and alerts about buckets
+// whose volume spiked or forward settings whose failure rate crossed the threshold of their bucket.
+func CheckVolumes(app *App, now time.Time) {
+	// The slack keeps cron jitter from stretching a window by a whole tick.
+	if !volumes.Due(now, time.Duration(max(config.AnomalyWindow, 1))*time.Minute-pollSlack) {
+		return
+	}
+
+	buckets := []Bucket{}
+	err := app.DB().
+		Select(bucketColumns...).
+		From("buckets").
+		Where(dbx.NewExp("volume_alert_factor > 0 OR failure_alert_rate > 0")).
+		All(&buckets)
+	if err != nil {
+		app.Logger().Warn("Fetching monitored buckets failed", "error", errors.Join(ErrFetchingBucket, err).Error())
+		return
+	}
+
+	monitored := make(map[string]Bucket, len(buckets))
+	for _, bucket := range buckets {
+		monitored[bucket.ID] = bucket
+	}
+
+	anomalies := volumes.Roll(now, func(key anomaly.Key) anomaly.Thresholds {
+		bucket := monitored[key.Bucket]
+		return anomaly.Thresholds{Factor: bucket.VolumeAlertFactor, FailureRate: bucket.FailureAlertRate}
+	})
+
+	for _, a := range anomalies {
+		if err := ReportAnomaly(app, monitored[a.Bucket], a, now); err != nil {
+			app.Logger().Warn("Reporting anomaly failed", "bucket", a.Bucket, "kind", a.Kind, "error", err.Error())
+		}
+	}
+}
+
+// ReportAnomaly opens an incident for an anomaly, or resolves the open one once it is over, and alerts about it.
+func ReportAnomaly(app *App, bucket Bucket, a anomaly.Anomaly, now time.Time) error {
+	details := map[string]any{
+		"events":              a.Events,
+		"baseline":            math.Round(a.Baseline*100) / 100,
+		"volume_alert_factor": bucket.VolumeAlertFactor,
+	}
+
+	event, message := AlertVolumeSpike, fmt.Sprintf("Bucket %s received %d events in a %d minute window, about %.1f times its usual volume.", bucket.Slug, a.Events, config.AnomalyWindow, float64(a.Events)/max(a.Baseline, 1))
+	if a.Resolved {
+		event, message = AlertVolumeNormal, fmt.Sprintf("Bucket %s is back to its usual volume.", bucket.Slug)
+	}
+
+	if a.Kind == anomaly.FailureRate {
+		forward := ForwardSetting{}
+		err := app.DB().
+			Select("id", "name", "url").
+			From("forward_settings").
+			Where(dbx.HashExp{"id": a.Forward}).
+			One(&forward)
+		if err != nil {
+			return errors.Join(ErrFetchingForwardSettings, err)
+		}
+
+		details = map[string]any{
+			"forward_setting":    forward.ID,
+			"destination_url":    forward.URL,
+			"deliveries":         a.Events,
+			"failures":           a.Failures,
+			"failure_rate":       math.Round(a.Rate*1000) / 1000,
+			"failure_alert_rate": bucket.FailureAlertRate,
+		}
+
+		event, message = AlertForwardFailing, fmt.Sprintf("%.0f%% of deliveries of bucket %s to %s failed in the last %d minute window.", a.Rate*100, bucket.Slug, forward.URL, config.AnomalyWindow)
+		if a.Resolved {
+			event, message = AlertForwardRecovered, fmt.Sprintf("Deliveries of bucket %s to %s are succeeding again.", bucket.Slug, forward.URL)
+		}
+	}
+
+	incidentID := ""
+	stamp := types.NowDateTime().String()
+	if a.Resolved {
+		err := app.DB().
+			Select("id").
+			From("bucket_incidents").
+			Where(dbx.HashExp{"bucket": bucket.ID, "kind": a.Kind, "forward_setting": a.Forward, "resolved": ""}).
+			OrderBy("started DESC").
+			Limit(1).
+			Row(&incidentID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		if incidentID != "" {
+			_, err = app.DB().NewQuery(resolveBucketIncident).Bind(dbx.Params{
+				"id":       incidentID,
+				"resolved": stamp,
+				"updated":  stamp,
+			}).Execute()
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		detailBytes, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+
+		incidentID = core.GenerateDefaultRandomId()
+		_, err = app.DB().NewQuery(insertBucketIncident).Bind(dbx.Params{
+			"id":              incidentID,
+			"bucket":          bucket.ID,
+			"kind":            a.Kind,
+			"forward_setting": a.Forward,
+			"started":         stamp,
+			"details":         string(detailBytes),
+			"created":         stamp,
+			"updated":         stamp,
+		}).Execute()
+		if err != nil {
+			return err
+		}
+	}
+
+	return SendAlert(app, bucket, Alert{
+		Event:    event,
+		Bucket:   bucket.ID,
+		Slug:     bucket.Slug,
+		Message:  message,
+		Incident: incidentID,
+		At:       now.UTC(),
+		Details:  details,
+	})
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// APIToken is a personal token automation authenticates as its user with, limited to its scopes.
+// Only the hash of the token is stored, the token itself is shown once when it is created.
+type APIToken struct {
+	ID       string                  `json:"id" db:"id"`
+	User     string                  `json:"user" db:"user"`
+	Name     string                  `json:"name" db:"name"`
+	Prefix   string                  `json:"prefix" db:"prefix"`
+	Scopes   types.JSONArray[string] `json:"scopes" db:"scopes"`
+	Expires  types.DateTime          `json:"expires" db:"expires"`
+	LastUsed types.DateTime          `json:"last_used" db:"last_used"`
+	Revoked  types.DateTime          `json:"revoked" db:"revoked"`
+	Created  string                  `json:"created" db:"created"`
+}
+
+// Active reports whether the token is neither revoked nor expired at now.
+func (t APIToken) Active(now time.Time) bool {
+	return t.Revoked.IsZero() && (t.Expires.IsZero() || now.Before(t.Expires.Time()))
+}
+
+// Allows reports whether one of the scopes of the token is among scopes.
+func (t APIToken) Allows(scopes []string) bool {
+	for _, scope := range t.Scopes {
+		if slices.Contains(scopes, scope) {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	apiTokenScopes = []string{ScopeRead, ScopeBuckets, ScopeForwards, ScopeLogs}
+	bucketScopes   = []string{ScopeRead, ScopeBuckets}
+
+	// apiTokenRoutes are the custom routes API tokens may call and the scopes allowing them.
+	apiTokenRoutes = map[string][]string{
+		"GET /api/splay/me":                     apiTokenScopes,
+		"GET /api/splay/providers":              apiTokenScopes,
+		"GET /api/splay/usage":                  bucketScopes,
+		"POST /api/splay/domains/{id}/verify":   {ScopeBuckets},
+		"GET /api/splay/buckets/{id}/tail":      {ScopeLogs},
+		"GET /api/splay/logs/{id}/body":         {ScopeLogs},
+		"GET /api/splay/logs/{id}/files/{file}": {ScopeLogs},
+		"POST /api/splay/logs/{id}/forwards":    {ScopeForwards},
+	}
+
+	// apiTokenCollections are the collections API tokens may use through the records API, and the
+	// scopes allowing to read and to write them. Every other collection, including the tokens, is off limits.
+	apiTokenCollections = map[string]struct{ Read, Write []string }{
+		"buckets":             {Read: apiTokenScopes, Write: []string{ScopeBuckets}},
+		"forward_settings":    {Read: []string{ScopeRead, ScopeBuckets, ScopeForwards}, Write: []string{ScopeForwards}},
+		"bucket_schemas":      {Read: bucketScopes, Write: []string{ScopeBuckets}},
+		"bucket_domains":      {Read: bucketScopes, Write: []string{ScopeBuckets}},
+		"bucket_sources":      {Read: bucketScopes, Write: []string{ScopeBuckets}},
+		"bucket_schedules":    {Read: bucketScopes, Write: []string{ScopeBuckets}},
+		"bucket_incidents":    {Read: bucketScopes},
+		"bucket_usage":        {Read: bucketScopes},
+		"bucket_receive_logs": {Read: []string{ScopeLogs}},
+		"bucket_forward_logs": {Read: []string{ScopeLogs}},
+		"meta_webhooks":       {Read: []string{ScopeRead}},
+	}
+
+	// apiTokenHiddenFields are the secrets API tokens never see, a leaked token must not allow signing
+	// events as a provider or as a meta webhook. Filters and sorts on them are refused too.
+	apiTokenHiddenFields = map[string][]string{
+		"buckets":       {"provider_secret"},
+		"meta_webhooks": {"secret"},
+	}
+)
+
+// APITokenAllows reports whether an API token may make a request, by the route pattern it matched.
+func APITokenAllows(app core.App, token APIToken, r *http.Request) bool {
+	if scopes, ok := apiTokenRoutes[r.Pattern]; ok {
+		return token.Allows(scopes)
+	}
+
+	method, route, _ := strings.Cut(r.Pattern, " ")
+	if route != "/api/collections/{collection}/records" && route != "/api/collections/{collection}/records/{id}" {
+		return false
+	}
+
+	collection, err := app.FindCachedCollectionByNameOrId(r.PathValue("collection"))
+	if err != nil {
+		return false
+	}
+
+	access, ok := apiTokenCollections[collection.Name]
+	if !ok {
+		return false
+	}
+
+	// Relations allow filtering on the fields of other collections, any hidden field is refused.
+	query := r.URL.Query()
+	for _, fields := range apiTokenHiddenFields {
+		for _, field := range fields {
+			if strings.Contains(query.Get("filter"), field) || strings.Contains(query.Get("sort"), field) {
+				return false
+			}
+		}
+	}
+
+	if method == http.MethodGet {
+		return token.Allows(access.Read)
+	}
+
+	return token.Allows(access.Write)
+}
+
+// HideAPITokenFields hides the secrets of records served to requests authenticated with an API token,
+// including the records they expand.
+func HideAPITokenFields(e *core.RecordEnrichEvent) error {
+	if e.RequestInfo != nil && strings.HasPrefix(strings.TrimPrefix(e.RequestInfo.Headers["authorization"], "Bearer "), APITokenPrefix) {
+		e.Record.Hide(apiTokenHiddenFields[e.Record.Collection().Name]...)
+	}
+
+	return e.Next()
+}
+
+// HashAPIToken returns the stored hash of a token.
+func HashAPIToken(token string) string {
+	return security.SHA256(token)
+}
+
+// CreateAPIToken creates a token of a user and returns it with the token itself, which is not stored.
+func CreateAPIToken(app core.App, userID, name string, scopes []string, expires time.Time) (APIToken, string, error) {
+	collection, err := app.FindCachedCollectionByNameOrId("api_tokens")
+	if err != nil {
+		return APIToken{}, "", errors.Join(ErrCreatingAPIToken, err)
+	}
+
+	token := APITokenPrefix + security.RandomString(apiTokenLength)
+
+	record := core.NewRecord(collection)
+	record.Set("user", userID)
+	record.Set("name", name)
+	record.Set("token_hash", HashAPIToken(token))
+	record.Set("prefix", token[:len(APITokenPrefix)+6])
+	record.Set("scopes", scopes)
+	if !expires.IsZero() {
+		record.Set("expires", expires)
+	}
+
+	if err = app.Save(record); err != nil {
+		return APIToken{}, "", err
+	}
+
+	created, err := FindAPITokenByID(app, record.Id)
+
+	return created, token, err
+}
+
+// FindAPITokenByID returns a token by its record id.
+func FindAPITokenByID(app core.App, id string) (APIToken, error) {
+	token := APIToken{}
+	err := app.DB().
+		Select("id", "user", "name", "prefix", "scopes", "expires", "last_used", "revoked", "created").
+		From("api_tokens").
+		Where(dbx.HashExp{"id": id}).
+		One(&token)
+	if err != nil {
+		return token, errors.Join(ErrAPITokenNotFound, err)
+	}
+
+	return token, nil
+}
+
+// FindAPIToken returns the active token matching a presented token.
+func FindAPIToken(app core.App, presented string, now time.Time) (APIToken, error) {
+	token := APIToken{}
+	err := app.DB().
+		Select("id", "user", "name", "prefix", "scopes", "expires", "last_used", "revoked", "created").
+		From("api_tokens").
+		Where(dbx.HashExp{"token_hash": HashAPIToken(presented)}).
+		One(&token)
+	if err != nil {
+		return token, errors.Join(ErrInvalidAPIToken, err)
+	}
+
+	if !token.Active(now) {
+		return token, ErrInvalidAPIToken
+	}
+
+	return token, nil
+}
+
+// RevokeAPIToken revokes a token, of the user unless userID is empty, and returns it. Revoking twice keeps
+// the first revocation time.
+func RevokeAPIToken(app core.App, userID, id string, now time.Time) (APIToken, error) {
+	token, err := FindAPITokenByID(app, id)
+	if err != nil || (userID != "" && token.User != userID) {
+		return token, ErrAPITokenNotFound
+	}
+
+	if !token.Revoked.IsZero() {
+		return token, nil
+	}
+
+	revoked, _ := types.ParseDateTime(now)
+	_, err = app.DB().Update("api_tokens", dbx.Params{"revoked": revoked.String(), "updated": revoked.String()}, dbx.HashExp{"id": id}).Execute()
+	if err != nil {
+		return token, err
+	}
+	token.Revoked = revoked
+
+	return token, nil
+}
+
+// TouchAPIToken records when a token was last used, at most once per tokenUseInterval.
+func TouchAPIToken(app core.App, id string, now time.Time) {
+	if !tokenUses.Add(id, struct{}{}, tokenUseInterval) {
+		return
+	}
+
+	used, _ := types.ParseDateTime(now)
+	_, err := app.DB().Update("api_tokens", dbx.Params{"last_used": used.String()}, dbx.HashExp{"id": id}).Execute()
+	if err != nil {
+		app.Logger().Warn("Recording API token use failed", "id", id, "error", err.Error())
+	}
+}
+
+// LoadAPIToken authenticates API requests carrying an API token as the user owning it, before
+// the auth token middleware, and rejects requests outside of the scopes of the token.
+func LoadAPIToken(app *App) *hook.Handler[*core.RequestEvent] {
+	return &hook.Handler[*core.RequestEvent]{
+		Id:       "splayLoadAPIToken",
+		Priority: apis.DefaultLoadAuthTokenMiddlewarePriority - 1,
+		Func: func(e *core.RequestEvent) error {
+			presented := strings.TrimPrefix(e.Request.Header.Get("Authorization"), "Bearer ")
+			if !strings.HasPrefix(presented, APITokenPrefix) || !strings.HasPrefix(e.Request.URL.Path, "/api/") {
+				return e.Next()
+			}
+
+			now := time.Now()
+			token, err := FindAPIToken(app, presented, now)
+			if err != nil {
+				return e.UnauthorizedError("invalid, expired or revoked api token", nil)
+			}
+
+			if !APITokenAllows(app, token, e.Request) {
+				return e.ForbiddenError("the api token does not allow this request", nil)
+			}
+
+			user, err := app.FindRecordById("users", token.User)
+			if err != nil {
+				return e.UnauthorizedError("invalid, expired or revoked api token", nil)
+			}
+
+			e.Auth = user
+			e.Set(apiTokenContextKey, token)
+			TouchAPIToken(app, token.ID, now)
+
+			return e.Next()
+		},
+	}
+}
+
+// APITokenParams are the fields of a token to create.
+type APITokenParams struct {
+	Name    string         `json:"name"`
+	Scopes  []string       `json:"scopes"`
+	Expires types.DateTime `json:"expires"`
+}
+
+// Validate checks the params of a token created at now.
+func (p APITokenParams) Validate(now time.Time) error {
+	errs := validation.Errors{}
+	if strings.TrimSpace(p.Name) == "" {
+		errs["name"] = validation.NewError("validation_required", "Cannot be blank.")
+	}
+
+	if len(p.Scopes) == 0 {
+		errs["scopes"] = validation.NewError("validation_required", "Cannot be blank.")
+	}
+	for _, scope := range p.Scopes {
+		if !slices.Contains(apiTokenScopes, scope) {
+			errs["scopes"] = validation.NewError("validation_invalid_scope", "Must be read, buckets, forwards or logs.")
+		}
+	}
+
+	if !p.Expires.IsZero() && !p.Expires.Time().After(now) {
+		errs["expires"] = validation.NewError("validation_invalid_expires", "Must be in the future.")
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// HandleCreateAPIToken creates a token of the authenticated user, the response is the only time the token is shown.
+func HandleCreateAPIToken(app *App) RequestFunc {
+	return func(e *core.RequestEvent) error {
+		params := APITokenParams{}
+		if err := e.BindBody(&params); err != nil {
+			return e.BadRequestError("invalid api token", err)
+		}
+
+		now := time.Now()
+		if err := params.Validate(now); err != nil {
+			return e.BadRequestError("invalid api token", err)
+		}
+
+		token, secret, err := CreateAPIToken(app, e.Auth.Id, params.Name, params.Scopes, params.Expires.Time())
+		if err != nil {
+			return e.BadRequestError("could not create api token", err)
+		}
+
+		return e.JSON(http.StatusCreated, map[string]any{"token": secret, "record": token})
+	}
+}
+
+// HandleRevokeAPIToken revokes a token of the authenticated user.
+func HandleRevokeAPIToken(app *App) RequestFunc {
+	return func(e *core.RequestEvent) error {
+		token, err := RevokeAPIToken(app, e.Auth.Id, e.Request.PathValue("id"), time.Now())
+		if err != nil {
+			return e.NotFoundError("api token not found", err)
+		}
+
+		tokenUses.Delete(token.ID)
+
+		return e.JSON(http.StatusOK, token)
+	}
+}
+
+// HandleMe returns the authenticated user, and the scopes of the API token it authenticated with.
+func HandleMe() RequestFunc {
+	return func(e *core.RequestEvent) error {
+		me := map[string]any{
+			"id":         e.Auth.Id,
+			"email":      e.Auth.Email(),
+			"collection": e.Auth.Collection().Name,
+		}
+
+		if token, ok := e.Get(apiTokenContextKey).(APIToken); ok {
+			me["scopes"] = token.Scopes
+		}
+
+		return e.JSON(http.StatusOK, me)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// collectionsApp serves collections built in memory, the migrations are not run.
+type collectionsApp struct {
+	core.App
+	collections map[string]*core.Collection
+}
+
+func (app collectionsApp) FindCachedCollectionByNameOrId(name string) (*core.Collection, error) {
+	if collection, ok := app.collections[name]; ok {
+		return collection, nil
+	}
+
+	return nil, errors.New("missing collection")
+}
+
+func newCollectionsApp(fields map[string][]string) collectionsApp {
+	app := collectionsApp{collections: map[string]*core.Collection{}}
+	for name, names := range fields {
+		collection := core.NewBaseCollection(name)
+		for _, field := range names {
+			collection.Fields.Add(&core.TextField{Name: field})
+		}
+		app.collections[name] = collection
+	}
+
+	return app
+}
+
+func TestAPITokenAllows(t *testing.T) {
+	app := newCollectionsApp(map[string][]string{})
+	for name := range apiTokenCollections {
+		app.collections[name] = core.NewBaseCollection(name)
+	}
+	app.collections["users"] = core.NewAuthCollection("users")
+	app.collections["api_tokens"] = core.NewBaseCollection("api_tokens")
+
+	tests := []struct {
+		name       string
+		scope      string
+		pattern    string
+		collection string
+		query      string
+		want       bool
+	}{
+		{"me with any scope", ScopeLogs, "GET /api/splay/me", "", "", true},
+		{"usage with read", ScopeRead, "GET /api/splay/usage", "", "", true},
+		{"usage with logs", ScopeLogs, "GET /api/splay/usage", "", "", false},
+		{"verify domain with buckets", ScopeBuckets, "POST /api/splay/domains/{id}/verify", "", "", true},
+		{"verify domain with read", ScopeRead, "POST /api/splay/domains/{id}/verify", "", "", false},
+		{"tail with logs", ScopeLogs, "GET /api/splay/buckets/{id}/tail", "", "", true},
+		{"tail with read", ScopeRead, "GET /api/splay/buckets/{id}/tail", "", "", false},
+		{"log body with logs", ScopeLogs, "GET /api/splay/logs/{id}/body", "", "", true},
+		{"log file with buckets", ScopeBuckets, "GET /api/splay/logs/{id}/files/{file}", "", "", false},
+		{"report forward with forwards", ScopeForwards, "POST /api/splay/logs/{id}/forwards", "", "", true},
+		{"report forward with logs", ScopeLogs, "POST /api/splay/logs/{id}/forwards", "", "", false},
+		{"create token", ScopeBuckets, "POST /api/splay/tokens", "", "", false},
+		{"settings", ScopeRead, "GET /api/settings", "", "", false},
+		{"list buckets with read", ScopeRead, "GET /api/collections/{collection}/records", "buckets", "", true},
+		{"view bucket with forwards", ScopeForwards, "GET /api/collections/{collection}/records/{id}", "buckets", "", true},
+		{"create bucket with buckets", ScopeBuckets, "POST /api/collections/{collection}/records", "buckets", "", true},
+		{"create bucket with read", ScopeRead, "POST /api/collections/{collection}/records", "buckets", "", false},
+		{"update forward with forwards", ScopeForwards, "PATCH /api/collections/{collection}/records/{id}", "forward_settings", "", true},
+		{"update forward with buckets", ScopeBuckets, "PATCH /api/collections/{collection}/records/{id}", "forward_settings", "", false},
+		{"list receive logs with logs", ScopeLogs, "GET /api/collections/{collection}/records", "bucket_receive_logs", "", true},
+		{"list receive logs with read", ScopeRead, "GET /api/collections/{collection}/records", "bucket_receive_logs", "", false},
+		{"delete receive log with logs", ScopeLogs, "DELETE /api/collections/{collection}/records/{id}", "bucket_receive_logs", "", false},
+		{"list meta webhooks with read", ScopeRead, "GET /api/collections/{collection}/records", "meta_webhooks", "", true},
+		{"list tokens", ScopeRead, "GET /api/collections/{collection}/records", "api_tokens", "", false},
+		{"list users", ScopeRead, "GET /api/collections/{collection}/records", "users", "", false},
+		{"unknown collection", ScopeRead, "GET /api/collections/{collection}/records", "missing", "", false},
+		{"auth refresh", ScopeRead, "POST /api/collections/{collection}/auth-refresh", "users", "", false},
+		{"filter on a secret", ScopeRead, "GET /api/collections/{collection}/records", "meta_webhooks", "filter=secret~'a%25'", false},
+		{"sort on a secret", ScopeRead, "GET /api/collections/{collection}/records", "buckets", "sort=provider_secret", false},
+		{"filter on a related secret", ScopeRead, "GET /api/collections/{collection}/records", "forward_settings", "filter=bucket.provider_secret~'a%25'", false},
+		{"filter on other fields", ScopeRead, "GET /api/collections/{collection}/records", "buckets", "filter=slug='a'", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method, path, _ := strings.Cut(tt.pattern, " ")
+			r := httptest.NewRequest(method, strings.ReplaceAll(path, "{", "")+"?"+tt.query, nil)
+			r.Pattern = tt.pattern
+			r.SetPathValue("collection", tt.collection)
+
+			token := APIToken{Scopes: []string{tt.scope}}
+			if got := APITokenAllows(app, token, r); got != tt.want {
+				t.Fatalf("APITokenAllows(%s, %s) = %v, want %v", tt.scope, tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHideAPITokenFields(t *testing.T) {
+	app := newCollectionsApp(map[string][]string{
+		"buckets":       {"slug", "provider_secret"},
+		"meta_webhooks": {"url", "secret"},
+	})
+
+	tests := []struct {
+		collection    string
+		field         string
+		authorization string
+		hidden        bool
+	}{
+		{"buckets", "provider_secret", "Bearer " + APITokenPrefix + "abc", true},
+		{"buckets", "provider_secret", APITokenPrefix + "abc", true},
+		{"buckets", "provider_secret", "Bearer session", false},
+		{"meta_webhooks", "secret", "Bearer " + APITokenPrefix + "abc", true},
+		{"meta_webhooks", "secret", "", false},
+	}
+
+	for _, tt := range tests {
+		collection, err := app.FindCachedCollectionByNameOrId(tt.collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		record := core.NewRecord(collection)
+		record.Set(tt.field, "value")
+
+		e := &core.RecordEnrichEvent{
+			App:         app,
+			RequestInfo: &core.RequestInfo{Headers: map[string]string{"authorization": tt.authorization}},
+		}
+		e.Record = record
+		if err = HideAPITokenFields(e); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fields := map[string]any{}
+		_ = json.Unmarshal(data, &fields)
+		if _, ok := fields[tt.field]; ok == tt.hidden {
+			t.Fatalf("%s of %s with %q in the response = %v, want %v", tt.field, tt.collection, tt.authorization, ok, !tt.hidden)
+		}
+	}
+
+	// Requests outside of the API, like cron jobs, see everything.
+	collection, _ := app.FindCachedCollectionByNameOrId("buckets")
+	record := core.NewRecord(collection)
+	e := &core.RecordEnrichEvent{App: app}
+	e.Record = record
+	if err := HideAPITokenFields(e); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := json.Marshal(record); !strings.Contains(string(data), "provider_secret") {
+		t.Fatal("provider_secret hidden without a request")
+	}
+}
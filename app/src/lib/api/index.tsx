@@ -1,5 +1,5 @@
 import { CommonOptions, ListResult, RecordListOptions, RecordOptions, TypedPocketBase } from "../pocketbase";
-import { User, Bucket, BucketParams, ForwardSetting, ForwardSettingParams, BucketForwardLog, BucketReceiveLog, Log } from '@/lib/models';
+import { User, Bucket, BucketParams, ForwardSetting, ForwardSettingParams, BucketForwardLog, BucketReceiveLog, Log, LogsMessage } from '@/lib/models';
 import { Start, End, NowString, OneDayAgo } from "@/lib/datetime";
 export * from "@/lib/models";
 
@@ -247,15 +247,27 @@ export class API implements APIInterface {
     })
   }
 
-  subUserBucketNotifications(user: User, bucket: Bucket, cb: (data: any) => void) {
-    return this.pb.collection('users').subscribe(this.userBucketTopic(user, bucket), cb)
+  // the logs topic carries a LogsMessage rather than a record event, so it is subscribed to directly
+  subUserBucketNotifications(user: User, bucket: Bucket, cb: (message: LogsMessage) => void) {
+    return this.pb.realtime.subscribe(this.userBucketTopic(user, bucket), (data: unknown) => {
+      cb(parseLogsMessage(data))
+    })
   }
 
   unsubUserBucketNotifications(user: User, bucket: Bucket) {
-    return this.pb.collection('users').unsubscribe(this.userBucketTopic(user, bucket))
+    return this.pb.realtime.unsubscribe(this.userBucketTopic(user, bucket))
   }
 
   private userBucketTopic(user: User, bucket: Bucket) {
-    return `${user.id}/buckets/${bucket.id}/logs`
+    return `users/${user.id}/buckets/${bucket.id}/logs`
+  }
+}
+
+export function parseLogsMessage(data: unknown): LogsMessage {
+  const message = (data && typeof data === 'object' ? data : {}) as Partial<LogsMessage>;
+
+  return {
+    logs: Array.isArray(message.logs) ? message.logs : [],
+    forwards: Array.isArray(message.forwards) ? message.forwards : [],
   }
 }
@@ -17,6 +17,37 @@ export interface Bucket extends Base {
   name: string;
   user: string;
   description: string;
+  provider?: string;
+  provider_secret?: string;
+  schema?: Record<string, any> | null;
+  schema_mode?: 'reject' | 'flag' | 'hold' | '';
+  drift_webhook_url?: string;
+  drift_email?: string;
+  redaction_rules?: RedactionRule[] | null;
+  forward_original?: boolean;
+  max_body_size?: number;
+  attachment_types?: string[] | null;
+  max_attachment_size?: number;
+  ip_allowlist?: string[] | null;
+  ip_denylist?: string[] | null;
+  rate_limit?: number;
+  rate_burst?: number;
+  monthly_quota?: number;
+  accept_email?: boolean;
+  silence_after?: number;
+  silence_cron?: string;
+  alert_webhook_url?: string;
+  alert_email?: string;
+  silent?: boolean;
+  silent_since?: string;
+  volume_alert_factor?: number;
+  failure_alert_rate?: number;
+}
+
+export interface RedactionRule {
+  kind: 'path' | 'header' | 'pattern';
+  target: string;
+  mode: 'mask' | 'hash' | 'drop';
 }
 
 export type BucketParams = Omit<Bucket, 'id' | 'created' | 'updated'>;
@@ -26,15 +57,32 @@ export interface ForwardSetting extends Base {
   bucket: string;
   name: string;
   url: string;
+  content_encoding?: 'gzip' | 'deflate' | 'br' | 'zstd' | '';
 }
 
 export type ForwardSettingParams = Omit<ForwardSetting, 'id' | 'created' | 'updated'>;
 
 export interface BucketReceiveLog extends Base {
   bucket: string;
-  body: Record<string, any>;
+  body: Record<string, any> | null;
+  body_file?: string;
+  body_size?: number;
+  files?: string[];
+  attachments?: Attachment[] | null;
   headers: Record<string, any>;
   ip: string;
+  event_type?: string;
+  delivery_id?: string;
+  schema_status?: 'valid' | 'flagged' | 'held' | '';
+  schema_errors?: { instance_location: string; keyword_location: string; message: string }[] | null;
+}
+
+export interface Attachment {
+  field: string;
+  filename: string;
+  content_type: string;
+  size: number;
+  file: string;
 }
 
 export interface BucketForwardLog extends Base {
@@ -49,3 +97,174 @@ export interface BucketForwardLog extends Base {
 export interface Log extends BucketReceiveLog {
   forward_logs: BucketForwardLog[];
 }
+
+export type LogSummary = Pick<BucketReceiveLog, 'id' | 'event_type' | 'delivery_id' | 'schema_status' | 'ip' | 'created'> & {
+  body_size: number;
+};
+
+export type ForwardSummary = Pick<BucketForwardLog, 'id' | 'bucket_receive_log' | 'destination_url' | 'status_code' | 'created'>;
+
+export interface LogsMessage {
+  logs: LogSummary[];
+  forwards: ForwardSummary[];
+}
+
+export interface TailEvent {
+  kind: 'receive' | 'forward';
+  id: string;
+  bucket: string;
+  bucket_receive_log?: string;
+  event_type?: string;
+  delivery_id?: string;
+  schema_status?: string;
+  ip?: string;
+  destination_url?: string;
+  status_code?: number;
+  headers?: Record<string, string[]>;
+  body?: unknown;
+  created: string;
+}
+
+export interface BucketSchema extends Base {
+  bucket: string;
+  event_type: string;
+  version: number;
+  shape: Record<string, any>;
+  json_schema: Record<string, any> | null;
+  drift: { added?: string[]; removed?: string[]; retyped?: { path: string; from: string[]; to: string }[] } | null;
+}
+
+export interface BucketUsage extends Base {
+  bucket: string;
+  user: string;
+  period: string;
+  events: number;
+}
+
+export interface Usage {
+  bucket?: string;
+  slug?: string;
+  events: number;
+  monthly_quota: number;
+  rate_limit: number;
+  rate_burst: number;
+}
+
+export interface UsageSummary {
+  period: string;
+  reset_at: string;
+  user: Usage;
+  buckets: Usage[];
+}
+
+export interface BucketDomain extends Base {
+  bucket: string;
+  domain: string;
+  token: string;
+  verified: boolean;
+  verified_at: string;
+}
+
+export interface DomainVerification {
+  verified: boolean;
+  name: string;
+  value: string;
+}
+
+export interface BucketSource extends Base {
+  bucket: string;
+  name: string;
+  type: 'json' | 'feed';
+  url: string;
+  headers?: Record<string, string> | null;
+  interval: number;
+  items_path: string;
+  item_key: string;
+  enabled: boolean;
+  last_polled: string;
+  last_error: string;
+}
+
+export interface BucketSchedule extends Base {
+  bucket: string;
+  name: string;
+  cron: string;
+  payload: Record<string, any> | null;
+  enabled: boolean;
+  last_run: string;
+  last_error: string;
+  next_run: string;
+}
+
+export interface BucketIncident extends Base {
+  bucket: string;
+  kind: 'silence' | 'volume_spike' | 'failure_rate';
+  forward_setting: string;
+  started: string;
+  resolved: string;
+  details: Record<string, any> | null;
+}
+
+export type AlertEvent =
+  | 'bucket.silent'
+  | 'bucket.recovered'
+  | 'bucket.volume_spike'
+  | 'bucket.volume_normal'
+  | 'forward.failing'
+  | 'forward.recovered';
+
+export interface Alert {
+  event: AlertEvent;
+  bucket: string;
+  slug: string;
+  message: string;
+  incident?: string;
+  at: string;
+  details?: Record<string, any>;
+}
+
+export type MetaEventType =
+  | 'bucket.created'
+  | 'bucket.deleted'
+  | 'delivery.failed'
+  | 'quota.exceeded'
+  | 'schema.drift'
+  | AlertEvent;
+
+export interface MetaWebhook extends Base {
+  user: string;
+  bucket: string;
+  name: string;
+  url: string;
+  events: MetaEventType[];
+  secret: string;
+  enabled: boolean;
+  last_status: number;
+  last_error: string;
+  last_delivered: string;
+}
+
+export interface MetaEvent {
+  id: string;
+  type: MetaEventType;
+  created: string;
+  bucket?: string;
+  data: any;
+}
+
+export type ApiTokenScope = 'read' | 'buckets' | 'forwards' | 'logs';
+
+export interface ApiToken extends Base {
+  user: string;
+  name: string;
+  prefix: string;
+  scopes: ApiTokenScope[];
+  expires: string;
+  last_used: string;
+  revoked: string;
+}
+
+export interface ApiTokenCreated {
+  token: string;
+  record: ApiToken;
+}
@@ -260,8 +260,8 @@ function ListLogs({ user, bucket }: ListLogsParams) {
   useEffect(() => {
     api.unsubUserBucketNotifications(user, bucket)
     if (live) {
-      api.subUserBucketNotifications(user, bucket, (_) => {
-        refetch()
+      api.subUserBucketNotifications(user, bucket, ({ logs, forwards }) => {
+        if (logs.length > 0 || forwards.length > 0) refetch()
       })
     }
 
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"splay/pkg/sse"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// RemoteError is a response of a Splay server other than 2xx.
+type RemoteError struct {
+	Status  int
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("server responded %d: %s", e.Status, cmp.Or(e.Message, http.StatusText(e.Status)))
+}
+
+// Remote is an authenticated client of a running Splay server.
+type Remote struct {
+	Server string
+	Token  string
+	// Log receives reconnection notices of Tail.
+	Log io.Writer
+
+	client *http.Client
+}
+
+// RemoteFlags are the server and credentials of the commands that talk to a running Splay.
+type RemoteFlags struct {
+	Server   string
+	Token    string
+	Email    string
+	Password string
+}
+
+// Bind registers the remote flags on a command and its subcommands.
+func (f *RemoteFlags) Bind(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&f.Server, "server", "", "url of the Splay server, SPLAY_SERVER or "+defaultServer+" by default")
+	cmd.PersistentFlags().StringVar(&f.Token, "token", "", "auth or API token, SPLAY_TOKEN by default")
+	cmd.PersistentFlags().StringVar(&f.Email, "email", "", "email to authenticate with when no token is given, SPLAY_EMAIL by default")
+	cmd.PersistentFlags().StringVar(&f.Password, "password", "", "password to authenticate with, SPLAY_PASSWORD by default")
+}
+
+// Connect returns a client of the server, authenticating with the password when no token is set.
+func (f RemoteFlags) Connect(ctx context.Context, log io.Writer) (*Remote, error) {
+	r := &Remote{
+		Server: strings.TrimRight(cmp.Or(f.Server, os.Getenv("SPLAY_SERVER"), defaultServer), "/"),
+		Token:  cmp.Or(f.Token, os.Getenv("SPLAY_TOKEN")),
+		Log:    log,
+		client: &http.Client{},
+	}
+	if r.Token != "" {
+		return r, nil
+	}
+
+	email, password := cmp.Or(f.Email, os.Getenv("SPLAY_EMAIL")), cmp.Or(f.Password, os.Getenv("SPLAY_PASSWORD"))
+	if email == "" || password == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	auth := struct {
+		Token string `json:"token"`
+	}{}
+	credentials := map[string]string{"identity": email, "password": password}
+	if err := r.Do(ctx, http.MethodPost, "/api/collections/users/auth-with-password", credentials, &auth); err != nil {
+		return nil, err
+	}
+	r.Token = auth.Token
+
+	return r, nil
+}
+
+// Do sends in as JSON and decodes the JSON response into out, either may be nil.
+func (r *Remote) Do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, r.Server+path, body)
+	if err != nil {
+		return errors.Join(ErrCreatingRequest, err)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if r.Token != "" {
+		req.Header.Set("Authorization", r.Token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err = checkRemoteResponse(resp); err != nil {
+		return err
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func checkRemoteResponse(resp *http.Response) error {
+	if resp.StatusCode >= StatusOkBot && resp.StatusCode < StatusOkTop {
+		return nil
+	}
+
+	apiErr := struct {
+		Message string `json:"message"`
+	}{}
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&apiErr)
+
+	return &RemoteError{Status: resp.StatusCode, Message: apiErr.Message}
+}
+
+var bucketRefPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// FindBucket returns the bucket with the id or slug, among the buckets the caller can view.
+func (r *Remote) FindBucket(ctx context.Context, ref string) (Bucket, error) {
+	if !bucketRefPattern.MatchString(ref) {
+		return Bucket{}, ErrInvalidBucketRef
+	}
+
+	query := url.Values{
+		"filter":  {fmt.Sprintf("id = '%s' || slug = '%s'", ref, ref)},
+		"perPage": {"1"},
+	}
+	list := struct {
+		Items []Bucket `json:"items"`
+	}{}
+	if err := r.Do(ctx, http.MethodGet, "/api/collections/buckets/records?"+query.Encode(), nil, &list); err != nil {
+		return Bucket{}, err
+	}
+
+	if len(list.Items) == 0 {
+		return Bucket{}, fmt.Errorf("%w: %s", ErrBucketNotFound, ref)
+	}
+
+	return list.Items[0], nil
+}
+
+// Tail calls fn with the events of a bucket in order until ctx is done or fn fails. It reconnects
+// after lost connections and server errors, resuming after the last event, which the server never
+// sends again.
+func (r *Remote) Tail(ctx context.Context, bucketID string, query url.Values, lastID string, fn func(TailEvent) error) error {
+	retry := tailRetry
+	for {
+		var fnErr error
+		err := r.tail(ctx, bucketID, query, &lastID, &retry, func(ev TailEvent) error {
+			fnErr = fn(ev)
+			return fnErr
+		})
+		if fnErr != nil {
+			return fnErr
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		var remoteErr *RemoteError
+		if errors.As(err, &remoteErr) && remoteErr.Status < http.StatusInternalServerError {
+			return err
+		}
+
+		if r.Log != nil {
+			fmt.Fprintf(r.Log, "Connection lost (%v), reconnecting in %s\n", err, retry)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retry):
+		}
+	}
+}
+
+func (r *Remote) tail(ctx context.Context, bucketID string, query url.Values, lastID *string, retry *time.Duration, fn func(TailEvent) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.Server+"/api/splay/buckets/"+bucketID+"/tail?"+query.Encode(), nil)
+	if err != nil {
+		return errors.Join(ErrCreatingRequest, err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Authorization", r.Token)
+	if *lastID != "" {
+		req.Header.Set("Last-Event-ID", *lastID)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err = checkRemoteResponse(resp); err != nil {
+		return err
+	}
+
+	events := sse.NewReader(resp.Body)
+	for {
+		msg, err := events.Next()
+		if delay := events.Retry(); delay > 0 {
+			*retry = delay
+		}
+		if err != nil {
+			return err
+		}
+
+		ev := TailEvent{}
+		if err = json.Unmarshal([]byte(msg.Data), &ev); err != nil {
+			return err
+		}
+
+		if err = fn(ev); err != nil {
+			return err
+		}
+		*lastID = msg.ID
+	}
+}
+
+// TailFlags are the filters and resume point of the tail and listen commands.
+type TailFlags struct {
+	EventType   string
+	Status      string
+	Match       []string
+	LastEventID string
+}
+
+// Bind registers the filter flags on a command.
+func (f *TailFlags) Bind(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.EventType, "event-type", "", "only events of this event type")
+	cmd.Flags().StringVar(&f.Status, "status", "", "only forwards with this status code, class like 5xx, ok or failed, or receives with this schema status")
+	cmd.Flags().StringArrayVar(&f.Match, "match", nil, "only events whose receive body has path=value, repeatable")
+	cmd.Flags().StringVar(&f.LastEventID, "last-event-id", "", "resume after this event id instead of starting now")
+}
+
+// Query returns the tail endpoint parameters of the filters.
+func (f TailFlags) Query() url.Values {
+	query := url.Values{}
+	if f.EventType != "" {
+		query.Set("event_type", f.EventType)
+	}
+	if f.Status != "" {
+		query.Set("status", f.Status)
+	}
+	for _, m := range f.Match {
+		query.Add("match", m)
+	}
+
+	return query
+}
+
+// FormatTailEvent returns a one line description of an event.
+func FormatTailEvent(ev TailEvent) string {
+	if ev.Kind == TailForward {
+		return fmt.Sprintf("%s  forward  %s  %d  %s", ev.Created, ev.BucketReceiveLog, ev.StatusCode, ev.DestinationURL)
+	}
+
+	size := fmt.Sprintf("%d bytes", len(ev.Body))
+	if ev.BodyOmitted {
+		size = "body omitted"
+	}
+
+	return fmt.Sprintf("%s  receive  %s  %s  %s  %s", ev.Created, ev.ID, cmp.Or(ev.EventType, "-"), ev.IP, size)
+}
+
+// NewTailCommand prints the events of a bucket of a running server as they arrive.
+func NewTailCommand() *cobra.Command {
+	remote := RemoteFlags{}
+	filter := TailFlags{}
+	var kind string
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:          "tail <bucket>",
+		Short:        "Print the receive and forward events of a bucket as they arrive",
+		Args:         cobra.ExactArgs(1),
+		Annotations:  map[string]string{ClientCommand: "true"},
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			r, err := remote.Connect(ctx, cmd.OutOrStderr())
+			if err != nil {
+				return err
+			}
+
+			bucket, err := r.FindBucket(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			query := filter.Query()
+			if kind != "" {
+				query.Set("kind", kind)
+			}
+
+			fmt.Fprintf(cmd.OutOrStderr(), "Tailing %s, press Ctrl+C to stop\n", bucket.Slug)
+
+			out := cmd.OutOrStdout()
+			return r.Tail(ctx, bucket.ID, query, filter.LastEventID, func(ev TailEvent) error {
+				if !asJSON {
+					_, err := fmt.Fprintln(out, FormatTailEvent(ev))
+					return err
+				}
+
+				data, err := json.Marshal(ev)
+				if err != nil {
+					return err
+				}
+				_, err = fmt.Fprintln(out, string(data))
+				return err
+			})
+		},
+	}
+	remote.Bind(cmd)
+	filter.Bind(cmd)
+	cmd.Flags().StringVar(&kind, "kind", "", "only receive or forward events")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print every event as a line of JSON")
+
+	return cmd
+}
+
+// LogBody streams the stored body of a receive log.
+func (r *Remote) LogBody(ctx context.Context, id string) BodySource {
+	return func() (io.ReadCloser, int64, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.Server+"/api/splay/logs/"+id+"/body", nil)
+		if err != nil {
+			return nil, 0, errors.Join(ErrCreatingRequest, err)
+		}
+		req.Header.Set("Authorization", r.Token)
+
+		resp, err := r.client.Do(req)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if err = checkRemoteResponse(resp); err != nil {
+			resp.Body.Close()
+			return nil, 0, err
+		}
+
+		return resp.Body, resp.ContentLength, nil
+	}
+}
+
+// Replay re-issues a received event with its body against a URL, like the server forwards it, and
+// returns the response status.
+func Replay(url string, ev TailEvent, body BodySource) (int, error) {
+	header := make(http.Header)
+	if len(ev.Headers) > 0 {
+		if err := json.Unmarshal(ev.Headers, &header); err != nil {
+			return 0, errors.Join(ErrDecodingHeaders, err)
+		}
+	}
+	if ev.IP != "" {
+		header.Add(XForwardedFor, ev.IP)
+	}
+
+	resp, err := Post(url, "", header, body)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return resp.StatusCode, nil
+}
+
+// NewListenCommand replays the events of a bucket of a running server against a local URL, reporting
+// every response back as a forward log.
+func NewListenCommand() *cobra.Command {
+	remote := RemoteFlags{}
+	filter := TailFlags{}
+	var to string
+
+	cmd := &cobra.Command{
+		Use:          "listen <bucket>",
+		Short:        "Replay the events of a bucket against a local URL and report the responses as forward logs",
+		Args:         cobra.ExactArgs(1),
+		Annotations:  map[string]string{ClientCommand: "true"},
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := url.ParseRequestURI(to); err != nil {
+				return fmt.Errorf("invalid --to url: %w", err)
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			r, err := remote.Connect(ctx, cmd.OutOrStderr())
+			if err != nil {
+				return err
+			}
+
+			bucket, err := r.FindBucket(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			query := filter.Query()
+			query.Set("kind", TailReceive)
+
+			fmt.Fprintf(cmd.OutOrStderr(), "Forwarding %s to %s, press Ctrl+C to stop\n", bucket.Slug, to)
+
+			out, errOut := cmd.OutOrStdout(), cmd.OutOrStderr()
+			return r.Tail(ctx, bucket.ID, query, filter.LastEventID, func(ev TailEvent) error {
+				// Events leave out large bodies, they are streamed from the server instead.
+				body := BytesSource(ev.Body)
+				if ev.BodyOmitted {
+					body = r.LogBody(ctx, ev.ID)
+				}
+
+				status, err := Replay(to, ev, body)
+				if err != nil {
+					// Like server side forwards, deliveries without a response leave no forward log.
+					fmt.Fprintf(errOut, "%s  %s  %s  failed: %v\n", ev.Created, ev.ID, cmp.Or(ev.EventType, "-"), err)
+					return nil
+				}
+
+				fmt.Fprintf(out, "%s  %s  %s  %d\n", ev.Created, ev.ID, cmp.Or(ev.EventType, "-"), status)
+
+				report := ForwardReport{DestinationURL: to, StatusCode: status}
+				if err = r.Do(ctx, http.MethodPost, "/api/splay/logs/"+ev.ID+"/forwards", report, nil); err != nil && ctx.Err() == nil {
+					fmt.Fprintf(errOut, "Reporting the forward of %s failed: %v\n", ev.ID, err)
+				}
+
+				return nil
+			})
+		},
+	}
+	remote.Bind(cmd)
+	filter.Bind(cmd)
+	cmd.Flags().StringVar(&to, "to", "", "local url to replay events against, like http://localhost:3000/hook")
+	_ = cmd.MarkFlagRequired("to")
+
+	return cmd
+}
+
+// IsClientCommand reports whether a command or one of its parents is a client command, which runs
+// without bootstrapping the app.
+func IsClientCommand(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		if c.Annotations[ClientCommand] != "" {
+			return true
+		}
+	}
+
+	return false
+}
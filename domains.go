@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"splay/pkg/hostroute"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// FindSlugByHost returns the slug of the bucket a host points at, subdomains of the bucket domain
+// win over custom domains and only verified custom domains are routed.
+func FindSlugByHost(app *App, host string) (string, error) {
+	if slug, ok := hostroute.Subdomain(host, config.BucketDomain); ok {
+		return slug, nil
+	}
+
+	var slug string
+	err := app.DB().
+		Select("buckets.slug").
+		From("bucket_domains").
+		InnerJoin("buckets", dbx.NewExp("buckets.id = bucket_domains.bucket")).
+		Where(dbx.HashExp{"bucket_domains.domain": hostroute.Normalize(host), "bucket_domains.verified": true}).
+		Row(&slug)
+
+	return slug, err
+}
+
+// ValidateBucketDomain normalizes a custom domain and refuses the domains Splay itself answers on.
+func ValidateBucketDomain(e *core.RecordRequestEvent) error {
+	domain, err := hostroute.ParseDomain(e.Record.GetString("domain"))
+	if err != nil {
+		return e.BadRequestError("invalid domain", validation.Errors{
+			"domain": validation.NewError("validation_invalid_domain", err.Error()),
+		})
+	}
+
+	appHost := hostroute.Normalize(e.App.Settings().Meta.AppURL)
+	if u, err := url.Parse(e.App.Settings().Meta.AppURL); err == nil && u.Host != "" {
+		appHost = hostroute.Normalize(u.Host)
+	}
+
+	bucketDomain := hostroute.Normalize(config.BucketDomain)
+	if domain == appHost || (bucketDomain != "" && (domain == bucketDomain || strings.HasSuffix(domain, "."+bucketDomain))) {
+		return e.BadRequestError("invalid domain", validation.Errors{
+			"domain": validation.NewError("validation_reserved_domain", "The domain is reserved."),
+		})
+	}
+
+	e.Record.Set("domain", domain)
+
+	return e.Next()
+}
+
+// HandleVerifyDomain looks up the verification TXT record of a custom domain and marks it verified,
+// the expected record is returned either way so it can be shown to the user.
+func HandleVerifyDomain(app *App) RequestFunc {
+	return func(e *core.RequestEvent) error {
+		record, err := app.FindRecordById("bucket_domains", e.Request.PathValue("id"))
+		if err != nil {
+			return e.NotFoundError("domain not found", err)
+		}
+
+		info, err := e.RequestInfo()
+		if err != nil {
+			return e.BadRequestError("", err)
+		}
+
+		if ok, err := app.CanAccessRecord(record, info, record.Collection().ViewRule); !ok || err != nil {
+			return e.NotFoundError("domain not found", err)
+		}
+
+		domain, token := record.GetString("domain"), record.GetString("token")
+		name, value := hostroute.Record(domain, token)
+
+		ctx, cancel := context.WithTimeout(e.Request.Context(), timeout)
+		defer cancel()
+
+		if err = hostroute.Verify(ctx, net.DefaultResolver, domain, token); err != nil {
+			app.Logger().Debug("Domain verification failed", "domain", domain, "error", err.Error())
+			return e.JSON(http.StatusUnprocessableEntity, map[string]any{
+				"verified": false,
+				"name":     name,
+				"value":    value,
+			})
+		}
+
+		if !record.GetBool("verified") {
+			// Other users may have pending claims on the domain, the first one to verify it owns it.
+			taken, err := app.CountRecords("bucket_domains",
+				dbx.HashExp{"domain": domain, "verified": true},
+				dbx.Not(dbx.HashExp{"id": record.Id}),
+			)
+			if err != nil {
+				return e.InternalServerError("could not verify domain", errors.Join(ErrVerifyingDomain, err))
+			}
+
+			if taken > 0 {
+				return e.Error(http.StatusConflict, "domain verified for another bucket", ErrDomainTaken)
+			}
+
+			record.Set("verified", true)
+			record.Set("verified_at", types.NowDateTime())
+			if err = app.Save(record); err != nil {
+				return e.InternalServerError("could not save domain", errors.Join(ErrVerifyingDomain, err))
+			}
+		}
+
+		return e.JSON(http.StatusOK, map[string]any{
+			"verified": true,
+			"name":     name,
+			"value":    value,
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"splay/pkg/compression"
+	"splay/pkg/spool"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Post sends a body to a destination with the given headers, compressed when encoding is set.
+// The caller closes the response body.
+func Post(url, encoding string, header http.Header, body BodySource) (*http.Response, error) {
+	return PostWith(httpClient, url, encoding, header, body)
+}
+
+// PostWith is Post through the given client.
+func PostWith(client *http.Client, url, encoding string, header http.Header, body BodySource) (*http.Response, error) {
+	if encoding != "" {
+		body = CompressedSource(body, encoding)
+	}
+
+	reader, size, err := body()
+	if err != nil {
+		return nil, errors.Join(ErrOpeningBody, err)
+	}
+	defer reader.Close()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, reader)
+	if err != nil {
+		return nil, errors.Join(ErrCreatingRequest, err)
+	}
+	req.ContentLength = size
+	req.Header = header
+
+	// Bodies are stored decoded, only announce a coding applied for this destination.
+	req.Header.Del("Content-Encoding")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Join(ErrForwardingRequest, err)
+	}
+
+	return resp, nil
+}
+
+// ForwardQuery  *dbx.Query
+func ForwardLog(app *App, forwardQuery *dbx.Query, e *core.RequestEvent, brl *BucketReceiveLog, url, encoding, ip string, headers []byte, body BodySource) error {
+	header := make(http.Header)
+	if err := json.Unmarshal(headers, &header); err != nil {
+		return errors.Join(ErrDecodingHeaders, err)
+	}
+	header.Add(XForwardedFor, ip)
+
+	resp, err := Post(url, encoding, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	statusOK := resp.StatusCode >= StatusOkBot && resp.StatusCode < StatusOkTop
+	if !statusOK {
+		app.Logger().Debug("Forwarding request failed", "status_code", resp.StatusCode)
+	}
+
+	if _, err = RecordForward(forwardQuery, brl, url, resp.StatusCode); err != nil {
+		return err
+	}
+
+	if !statusOK {
+		return errors.Join(ErrDestinationStatus, fmt.Errorf("status code %d", resp.StatusCode))
+	}
+
+	return nil
+}
+
+// RecordForward inserts the forward log of a delivery of a receive log and returns its id.
+func RecordForward(forwardQuery *dbx.Query, brl *BucketReceiveLog, url string, statusCode int) (string, error) {
+	id := core.GenerateDefaultRandomId()
+	created := time.Now().UTC().Format(time.DateTime)
+	p := dbx.Params{
+		"id":                 id,
+		"bucket":             brl.Bucket,
+		"bucket_receive_log": brl.ID,
+		"destination_url":    url,
+		"body":               brl.Body,
+		"headers":            brl.Headers,
+		"status_code":        statusCode,
+		"created":            created,
+		"updated":            created,
+	}
+
+	if _, err := forwardQuery.Bind(p).Execute(); err != nil {
+		return "", errors.Join(ErrInsertingForwardLog, err)
+	}
+
+	feed.AddForward(brl.Bucket, ForwardSummary{
+		ID:               id,
+		BucketReceiveLog: brl.ID,
+		DestinationURL:   url,
+		StatusCode:       statusCode,
+		Created:          created,
+	})
+
+	return id, nil
+}
+
+// BodySource opens a body to forward, every destination gets its own reader.
+type BodySource func() (io.ReadCloser, int64, error)
+
+// BytesSource forwards a body held in memory.
+func BytesSource(body []byte) BodySource {
+	return func() (io.ReadCloser, int64, error) {
+		return io.NopCloser(bytes.NewReader(body)), int64(len(body)), nil
+	}
+}
+
+// SpoolSource reads a body back from the spool it was received into, until the spool is closed.
+func SpoolSource(b *spool.Buffer) BodySource {
+	return func() (io.ReadCloser, int64, error) {
+		r, err := b.Open()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return r, b.Size(), nil
+	}
+}
+
+// StorageSource streams a body from file storage.
+func StorageSource(app *App, key string) BodySource {
+	return func() (io.ReadCloser, int64, error) {
+		fsys, err := app.NewFilesystem()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		r, err := fsys.GetFile(key)
+		if err != nil {
+			fsys.Close()
+			return nil, 0, err
+		}
+
+		return &storageReader{ReadCloser: r, close: fsys.Close}, r.Size(), nil
+	}
+}
+
+// CompressedSource encodes a body for a destination while it is being sent.
+func CompressedSource(source BodySource, encoding string) BodySource {
+	return func() (io.ReadCloser, int64, error) {
+		r, _, err := source()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		pr, pw := io.Pipe()
+		go func() {
+			defer r.Close()
+
+			w, err := compression.NewWriter(encoding, pw)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+
+			if _, err = io.Copy(w, r); err != nil {
+				w.Close()
+				pw.CloseWithError(err)
+				return
+			}
+
+			pw.CloseWithError(w.Close())
+		}()
+
+		// The encoded size is unknown up front, the request is sent chunked.
+		return pr, -1, nil
+	}
+}
+
+// storageReader releases what it reads from, like the filesystem, together with the file.
+type storageReader struct {
+	io.ReadCloser
+	close func() error
+}
+
+func (r *storageReader) Close() error {
+	return errors.Join(r.ReadCloser.Close(), r.close())
+}
@@ -0,0 +1,817 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"splay/pkg/anomaly"
+	"splay/pkg/compression"
+	"splay/pkg/envelope"
+	"splay/pkg/formdata"
+	"splay/pkg/priorityqueue"
+	"splay/pkg/providers"
+	"splay/pkg/redact"
+	"splay/pkg/schema"
+	"strings"
+	"sync"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func HandleBucketReceive(app *App, pq *priorityqueue.Scheduler[Notification]) RequestFunc {
+	return func(e *core.RequestEvent) error {
+		admission, err := AdmitRequest(app, e)
+		if err != nil {
+			return err
+		}
+		defer admission.Body.Close()
+		bucket, ip, now, rawBody := admission.Bucket, admission.IP, admission.Now, admission.Body
+
+		// Form fields are captured as a JSON body, multipart files are stored on the log as attachments.
+		var jsonBody []byte
+		var form *formdata.Form
+		contentType := e.Request.Header.Get("Content-Type")
+		if strings.HasPrefix(strings.ToLower(contentType), "multipart/form-data") {
+			reader, err := rawBody.Open()
+			if err != nil {
+				return e.InternalServerError("could not read body", errors.Join(ErrReadingBody, err))
+			}
+			defer reader.Close()
+
+			form, err = formdata.Parse(contentType, reader, AttachmentLimits(bucket))
+			switch {
+			case errors.Is(err, formdata.ErrFileTooLarge), errors.Is(err, formdata.ErrTooManyFiles):
+				return e.Error(http.StatusRequestEntityTooLarge, "attachments too large", errors.Join(ErrParsingForm, err))
+			case errors.Is(err, formdata.ErrFileTypeRefused):
+				return e.Error(http.StatusUnsupportedMediaType, "attachment type not allowed", errors.Join(ErrParsingForm, err))
+			case err != nil:
+				return e.BadRequestError("could not parse multipart form", errors.Join(ErrParsingForm, err))
+			}
+
+			if jsonBody, err = json.Marshal(form.Fields); err != nil {
+				return e.InternalServerError("err marshalling form fields", err)
+			}
+		} else if formdata.IsURLEncoded(contentType) {
+			raw, err := rawBody.Bytes()
+			if err != nil {
+				return e.InternalServerError("could not read body", errors.Join(ErrReadingBody, err))
+			}
+
+			if form, err = formdata.ParseURLEncoded(contentType, raw); err != nil {
+				return e.BadRequestError("could not parse url encoded form", errors.Join(ErrParsingForm, err))
+			}
+
+			if jsonBody, err = json.Marshal(form.Fields); err != nil {
+				return e.InternalServerError("err marshalling form fields", err)
+			}
+		}
+
+		// JSON bodies are decoded and validated straight from the spool.
+		openJSON := func() (io.ReadCloser, error) {
+			if jsonBody != nil {
+				return io.NopCloser(bytes.NewReader(jsonBody)), nil
+			}
+			return rawBody.Open()
+		}
+
+		reader, err := openJSON()
+		if err != nil {
+			return e.InternalServerError("could not read body", errors.Join(ErrReadingBody, err))
+		}
+
+		var body map[string]any
+		err = DecodeJSON(reader, &body)
+		reader.Close()
+		if err != nil {
+			return e.BadRequestError("body is not json", errors.Join(ErrDecodingBody, err))
+		}
+
+		preq := &providers.Request{
+			URL:    RequestURL(e.Request),
+			Header: e.Request.Header,
+			JSON:   body,
+			Now:    time.Now(),
+		}
+		if form != nil {
+			preq.Form = form.Values
+		}
+
+		// Bearer tokens were checked on admission, provider buckets are verified here.
+		var provider providers.Provider
+		if bucket.Provider != "" {
+			provider, err = providers.Get(bucket.Provider)
+			if err != nil {
+				return e.InternalServerError("unknown bucket provider", errors.Join(ErrVerifyingProvider, err))
+			}
+
+			// Signatures cover the exact bytes received, only provider buckets read them back into memory.
+			if preq.Body, err = rawBody.Bytes(); err != nil {
+				return e.InternalServerError("could not read body", errors.Join(ErrReadingBody, err))
+			}
+
+			if err = provider.Verify(bucket.ProviderSecret, preq); err != nil {
+				return e.UnauthorizedError("unauthorized", errors.Join(ErrVerifyingProvider, err))
+			}
+
+			if handshake := provider.Handshake(preq); handshake != nil {
+				return e.JSON(handshake.Status, handshake.Body)
+			}
+		}
+
+		// Only authenticated requests spend rate limit tokens and quota, the event is given back
+		// unless it ends up stored.
+		if _, err = ReserveRequest(app, e, admission, 1); err != nil {
+			return err
+		}
+		stored := false
+		defer func() {
+			if !stored {
+				ReleaseUsage(app, bucket, now, 1)
+			}
+		}()
+
+		var report *schema.Report
+		if !schema.IsEmpty(bucket.Schema) {
+			reader, err := openJSON()
+			if err != nil {
+				return e.InternalServerError("could not read body", errors.Join(ErrReadingBody, err))
+			}
+
+			report, err = ValidateBody(bucket, reader)
+			reader.Close()
+			if err != nil {
+				return e.InternalServerError("could not validate body", errors.Join(ErrValidatingSchema, err))
+			}
+		}
+
+		if Rejected(bucket, report) {
+			return e.JSON(http.StatusUnprocessableEntity, map[string]any{
+				"success": "false",
+				"message": "body does not match bucket schema",
+				"report":  report,
+			})
+		}
+
+		var raw BodySource
+		if jsonBody == nil {
+			raw = SpoolSource(rawBody)
+		}
+
+		ingest, err := PrepareIngest(app, bucket, Received{
+			Body:       body,
+			Raw:        raw,
+			Header:     e.Request.Header,
+			Form:       form,
+			Report:     report,
+			Size:       int(rawBody.Size()),
+			IP:         ip,
+			EventType:  provider.EventType.Extract(preq),
+			DeliveryID: provider.DeliveryID.Extract(preq),
+		})
+		if err != nil {
+			return e.InternalServerError("could not store request", err)
+		}
+
+		brls, err := InsertIngests(app.DB(), []*Ingest{ingest})
+		if err != nil {
+			DiscardIngests(app, []*Ingest{ingest})
+			return e.InternalServerError("could not insert bucket receive log", err)
+		}
+		stored = true
+
+		if err = Deliver(app, pq, e, bucket, []*Ingest{ingest}, brls, ip); err != nil {
+			return e.InternalServerError("could not fetch forward settings", err)
+		}
+
+		return e.JSON(http.StatusOK, map[string]string{"success": "true"})
+	}
+}
+
+// BatchResult is the outcome of a single element of a batch.
+type BatchResult struct {
+	Index        int            `json:"index"`
+	ID           string         `json:"id,omitempty"`
+	SchemaStatus string         `json:"schema_status,omitempty"`
+	Error        string         `json:"error,omitempty"`
+	Report       *schema.Report `json:"report,omitempty"`
+}
+
+// HandleBucketBatch receives a JSON array or NDJSON stream of events, storing every valid element
+// as its own receive log in a single transaction. Invalid elements are reported without failing the batch.
+func HandleBucketBatch(app *App, pq *priorityqueue.Scheduler[Notification]) RequestFunc {
+	return func(e *core.RequestEvent) error {
+		admission, err := AdmitRequest(app, e)
+		if err != nil {
+			return err
+		}
+		defer admission.Body.Close()
+		bucket := admission.Bucket
+
+		// Batches come from our own services, provider signatures only cover single deliveries.
+		if !BearerAuthorized(e.Request) {
+			return e.UnauthorizedError("unauthorized", nil)
+		}
+
+		reader, err := admission.Body.Open()
+		if err != nil {
+			return e.InternalServerError("could not read body", errors.Join(ErrReadingBody, err))
+		}
+		defer reader.Close()
+
+		items, err := SplitBatch(reader)
+		if err != nil {
+			return e.BadRequestError("body is not a json array or ndjson", errors.Join(ErrDecodingBody, err))
+		}
+
+		if len(items) > config.MaxBatchSize {
+			return e.Error(http.StatusRequestEntityTooLarge, fmt.Sprintf("batch exceeds %d items", config.MaxBatchSize), nil)
+		}
+
+		var provider providers.Provider
+		if bucket.Provider != "" {
+			if provider, err = providers.Get(bucket.Provider); err != nil {
+				return e.InternalServerError("unknown bucket provider", errors.Join(ErrVerifyingProvider, err))
+			}
+		}
+
+		// Quota is reserved for the whole batch up front, events that are not stored are given back.
+		reserved, err := ReserveRequest(app, e, admission, len(items))
+		if err != nil {
+			return err
+		}
+
+		results := make([]BatchResult, len(items))
+		ingests := []*Ingest{}
+		stored := []int{}
+		accepted := 0
+		defer func() {
+			if accepted == 0 {
+				DiscardIngests(app, ingests)
+			}
+			ReleaseUsage(app, bucket, admission.Now, reserved-accepted)
+		}()
+		for i, item := range items {
+			results[i].Index = i
+
+			var body map[string]any
+			if err := json.Unmarshal(item, &body); err != nil || body == nil {
+				results[i].Error = "item is not a json object"
+				continue
+			}
+
+			if len(ingests) >= reserved {
+				results[i].Error = "monthly quota exceeded"
+				continue
+			}
+
+			report, err := ValidateBody(bucket, bytes.NewReader(item))
+			if err != nil {
+				results[i].Error = errors.Join(ErrValidatingSchema, err).Error()
+				continue
+			}
+
+			if Rejected(bucket, report) {
+				results[i].Error = "body does not match bucket schema"
+				results[i].Report = report
+				continue
+			}
+
+			preq := &providers.Request{URL: RequestURL(e.Request), Header: e.Request.Header, Body: item, JSON: body, Now: admission.Now}
+			ingest, err := PrepareIngest(app, bucket, Received{
+				Body:       body,
+				Raw:        BytesSource(item),
+				Header:     e.Request.Header,
+				Report:     report,
+				Size:       len(item),
+				IP:         admission.IP,
+				EventType:  provider.EventType.Extract(preq),
+				DeliveryID: provider.DeliveryID.Extract(preq),
+			})
+			if err != nil {
+				return e.InternalServerError("could not store request", err)
+			}
+
+			ingests = append(ingests, ingest)
+			stored = append(stored, i)
+		}
+
+		brls := []BucketReceiveLog{}
+		err = app.RunInTransaction(func(txApp core.App) error {
+			brls, err = InsertIngests(txApp.DB(), ingests)
+			return err
+		})
+		if err != nil {
+			return e.InternalServerError("could not insert bucket receive logs", err)
+		}
+		accepted = len(ingests)
+
+		for n, i := range stored {
+			results[i].ID = brls[n].ID
+			results[i].SchemaStatus = brls[n].SchemaStatus
+		}
+
+		if len(ingests) > 0 {
+			if err = Deliver(app, pq, e, bucket, ingests, brls, admission.IP); err != nil {
+				return e.InternalServerError("could not fetch forward settings", err)
+			}
+		}
+
+		return e.JSON(http.StatusOK, map[string]any{
+			"success":  "true",
+			"accepted": len(ingests),
+			"rejected": len(items) - len(ingests),
+			"results":  results,
+		})
+	}
+}
+
+// SplitBatch splits a batch body into its raw elements, a body starting with "[" is a JSON array
+// and anything else NDJSON with one element per line.
+func SplitBatch(body io.Reader) ([]json.RawMessage, error) {
+	reader := bufio.NewReader(body)
+	for {
+		b, err := reader.ReadByte()
+		if err == io.EOF {
+			return []json.RawMessage{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+			continue
+		}
+
+		reader.UnreadByte()
+		if b != '[' {
+			return splitLines(reader)
+		}
+		break
+	}
+
+	decoder := json.NewDecoder(reader)
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	items := []json.RawMessage{}
+	for decoder.More() {
+		var item json.RawMessage
+		if err := decoder.Decode(&item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the batch array")
+	}
+
+	return items, nil
+}
+
+// splitLines reads an NDJSON stream line by line, skipping blank lines.
+func splitLines(reader *bufio.Reader) ([]json.RawMessage, error) {
+	items := []json.RawMessage{}
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			items = append(items, json.RawMessage(line))
+		}
+
+		if err == io.EOF {
+			return items, nil
+		}
+	}
+}
+
+// HandleHostReceive routes receive requests by their Host header, so buckets can be targeted as
+// "<slug>.<BucketDomain>" or through a verified custom domain with any path.
+func HandleHostReceive(app *App, pq *priorityqueue.Scheduler[Notification]) RequestFunc {
+	receive := HandleBucketReceive(app, pq)
+	batch := HandleBucketBatch(app, pq)
+
+	return func(e *core.RequestEvent) error {
+		slug, err := FindSlugByHost(app, e.Request.Host)
+		if err != nil {
+			return e.NotFoundError("bucket not found", errors.Join(ErrResolvingHost, err))
+		}
+
+		e.Request.SetPathValue("slug", slug)
+		if e.Request.PathValue(StaticWildcardParam) == "batch" {
+			return batch(e)
+		}
+
+		return receive(e)
+	}
+}
+
+// Received is a single event as it arrived, before it is prepared for storage.
+type Received struct {
+	Body map[string]any
+	// Raw is the JSON body as it was received, it is stored instead of Body when nothing in it is
+	// redacted. Bodies built by Splay, like from a form or an email, have none.
+	Raw        BodySource
+	Header     http.Header
+	Form       *formdata.Form
+	Report     *schema.Report
+	Size       int
+	IP         string
+	EventType  string
+	DeliveryID string
+}
+
+// Ingest is a received event prepared for storage and forwarding.
+type Ingest struct {
+	Params    dbx.Params
+	Body      map[string]any
+	EventType string
+	Held      bool
+	// Headers and Source are what destinations receive, redacted unless the bucket forwards the original.
+	Headers []byte
+	Source  BodySource
+	// Files are the body and attachment files written to storage, removed by DiscardIngests when
+	// the receive log is not inserted.
+	Files *StagedFiles
+}
+
+// DiscardIngests removes the stored files of prepared events whose receive logs were not inserted.
+func DiscardIngests(app *App, ingests []*Ingest) {
+	for _, ingest := range ingests {
+		ingest.Files.Rollback(app, nil)
+	}
+}
+
+// ValidateBody validates a JSON body against the bucket schema, the report is nil without a schema.
+func ValidateBody(bucket Bucket, jsonBody io.Reader) (*schema.Report, error) {
+	if schema.IsEmpty(bucket.Schema) {
+		return nil, nil
+	}
+
+	return schemas.Validate(bucket.Schema, jsonBody)
+}
+
+// DecodeJSON decodes a single JSON document from r, like json.Unmarshal does for a byte slice.
+func DecodeJSON(r io.Reader, v any) error {
+	decoder := json.NewDecoder(r)
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("unexpected data after the json document")
+	}
+
+	return nil
+}
+
+// Rejected reports whether a body must be refused because of its validation report.
+func Rejected(bucket Bucket, report *schema.Report) bool {
+	return report != nil && !report.Valid && schema.Mode(bucket.SchemaMode) == schema.ModeReject
+}
+
+// PrepareIngest redacts, compresses and encrypts a received event into the params of a receive
+// log. Bodies are kept as received unless redacted, those larger than the inline size are copied
+// and encrypted straight into file storage, destinations then stream the stored copy back instead
+// of keeping the body in memory.
+func PrepareIngest(app *App, bucket Bucket, r Received) (*Ingest, error) {
+	staged := &StagedFiles{}
+	ingest, err := prepareIngest(app, bucket, r, staged)
+	if err != nil {
+		staged.Rollback(app, nil)
+		return nil, err
+	}
+
+	return ingest, nil
+}
+
+func prepareIngest(app *App, bucket Bucket, r Received, staged *StagedFiles) (*Ingest, error) {
+	// Only the redacted request is ever persisted, forwarding may opt in to the original.
+	storedBody, storedHeader := r.Body, r.Header
+	redactor, err := BucketRedactor(bucket)
+	if err != nil {
+		return nil, errors.Join(ErrRedacting, err)
+	}
+
+	if !redactor.Empty() {
+		storedBody, storedHeader = redactor.Body(r.Body), redactor.Headers(r.Header)
+	}
+
+	// Encoding Body again would lose the key order and number formatting of the original.
+	raw := r.Raw
+	if !redactor.Empty() {
+		raw = nil
+	}
+
+	forwardsStored := redactor.Empty() || !bucket.ForwardOriginal
+	forwardBody, forwardHeader := r.Body, r.Header
+	if forwardsStored {
+		forwardBody, forwardHeader = storedBody, storedHeader
+	}
+
+	headerBytes, err := json.Marshal(forwardHeader)
+	if err != nil {
+		return nil, errors.Join(ErrDecodingHeaders, err)
+	}
+
+	storedHeaders, err := json.Marshal(storedHeader)
+	if err != nil {
+		return nil, errors.Join(ErrDecodingHeaders, err)
+	}
+
+	dataKey, err := BucketDataKey(app, bucket.ID)
+	if err != nil {
+		return nil, errors.Join(ErrEncrypting, err)
+	}
+
+	var inline []byte
+	if int64(r.Size) <= config.InlineBodySize {
+		if raw != nil {
+			inline, err = readSource(raw)
+		} else {
+			inline, err = json.Marshal(storedBody)
+		}
+		if err != nil {
+			return nil, errors.Join(ErrDecodingBody, err)
+		}
+	}
+	inlined := inline != nil && int64(len(inline)) <= config.InlineBodySize
+
+	// Bodies headed for file storage stay uncompressed so destinations can stream them.
+	if config.CompressStorage && inlined {
+		if storedHeaders, err = compression.CompressJSON(storedHeaders); err != nil {
+			return nil, errors.Join(ErrCompressing, err)
+		}
+	}
+
+	if dataKey != nil {
+		if storedHeaders, err = envelope.EncryptJSON(dataKey, []byte(bucket.ID), storedHeaders); err != nil {
+			return nil, errors.Join(ErrEncrypting, err)
+		}
+	}
+
+	created := time.Now().UTC()
+	id := core.GenerateDefaultRandomId()
+	p := dbx.Params{
+		"id":          id,
+		"body":        nil,
+		"body_file":   "",
+		"body_size":   r.Size,
+		"ip":          r.IP,
+		"files":       "[]",
+		"attachments": nil,
+		"headers":     string(storedHeaders),
+		"bucket":      bucket.ID,
+		"event_type":  r.EventType,
+		"delivery_id": r.DeliveryID,
+		"created":     created.Format(time.DateTime),
+		"updated":     created.Format(time.DateTime),
+	}
+
+	p["schema_status"], p["schema_errors"] = SchemaStatus(bucket, r.Report)
+
+	var source BodySource
+	if inlined {
+		source = BytesSource(inline)
+		if !forwardsStored {
+			source = JSONSource(forwardBody)
+		}
+
+		body := inline
+		if config.CompressStorage {
+			if body, err = compression.CompressJSON(body); err != nil {
+				return nil, errors.Join(ErrCompressing, err)
+			}
+		}
+
+		if dataKey != nil {
+			if body, err = envelope.EncryptJSON(dataKey, []byte(bucket.ID), body); err != nil {
+				return nil, errors.Join(ErrEncrypting, err)
+			}
+		}
+		p["body"] = string(body)
+	} else {
+		var key string
+		if raw != nil {
+			key, err = StoreRawBody(app, id, bucket.ID, dataKey, raw)
+		} else {
+			key, err = StoreBody(app, id, bucket.ID, dataKey, storedBody)
+		}
+		if err != nil {
+			return nil, errors.Join(ErrStoringBody, err)
+		}
+		staged.Written(key)
+		p["body_file"] = path.Base(key)
+
+		source = LogFileSource(app, id, bucket.ID, path.Base(key))
+		if !forwardsStored {
+			source = JSONSource(forwardBody)
+		}
+	}
+
+	if r.Form != nil {
+		attachments, err := StoreAttachments(app, staged, id, bucket.ID, dataKey, r.Form.Files)
+		if err != nil {
+			return nil, errors.Join(ErrStoringAttachment, err)
+		}
+
+		files := make([]string, 0, len(attachments))
+		for _, a := range attachments {
+			files = append(files, a.File)
+		}
+
+		filesBytes, err := json.Marshal(files)
+		if err != nil {
+			return nil, errors.Join(ErrStoringAttachment, err)
+		}
+		p["files"] = string(filesBytes)
+
+		if len(attachments) > 0 {
+			attachmentBytes, err := json.Marshal(attachments)
+			if err != nil {
+				return nil, errors.Join(ErrStoringAttachment, err)
+			}
+			p["attachments"] = string(attachmentBytes)
+		}
+
+		// Destinations receive the form rebuilt from the captured fields and stored files, files
+		// without a form like email attachments are only kept on the log.
+		if r.Form.Boundary != "" || r.Form.Values != nil {
+			fields, err := json.Marshal(forwardBody)
+			if err != nil {
+				return nil, errors.Join(ErrDecodingBody, err)
+			}
+
+			if r.Form.Boundary != "" {
+				source = MultipartSource(app, id, bucket.ID, r.Form.Boundary, fields, attachments)
+			} else {
+				source = URLEncodedSource(fields)
+			}
+		}
+	}
+
+	return &Ingest{
+		Params:    p,
+		Body:      r.Body,
+		EventType: r.EventType,
+		Held:      p["schema_status"] == SchemaStatusHeld,
+		Headers:   headerBytes,
+		Source:    source,
+		Files:     staged,
+	}, nil
+}
+
+func readSource(source BodySource) ([]byte, error) {
+	r, _, err := source()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// InsertIngests inserts a receive log per prepared event, db may be a transaction.
+func InsertIngests(db dbx.Builder, ingests []*Ingest) ([]BucketReceiveLog, error) {
+	receivedQuery := db.NewQuery(insertBucketReceiveLog)
+	receivedQuery.Prepare()
+	defer receivedQuery.Close()
+
+	brls := make([]BucketReceiveLog, len(ingests))
+	for i, ingest := range ingests {
+		if err := receivedQuery.Bind(ingest.Params).One(&brls[i]); err != nil {
+			return nil, errors.Join(ErrInsertingReceiveLog, err)
+		}
+	}
+
+	return brls, nil
+}
+
+// Deliver forwards stored events to the bucket destinations in the background, learns their
+// schemas and notifies subscribers once.
+func Deliver(app *App, pq *priorityqueue.Scheduler[Notification], e *core.RequestEvent, bucket Bucket, ingests []*Ingest, brls []BucketReceiveLog, ip string) error {
+	forwardSetting := []ForwardSetting{}
+	if slices.ContainsFunc(ingests, func(i *Ingest) bool { return !i.Held }) {
+		err := app.DB().
+			Select("id", "name", "url", "bucket", "content_encoding").
+			From("forward_settings").
+			Where(dbx.NewExp("bucket = {:bucket}", dbx.Params{"bucket": bucket.ID})).
+			All(&forwardSetting)
+		if err != nil {
+			return errors.Join(ErrFetchingForwardSettings, err)
+		}
+	}
+
+	go func() {
+		forwardQuery := app.DB().NewQuery(insertBucketForwardLog)
+		forwardQuery.Prepare()
+		defer forwardQuery.Close()
+
+		notification := Notification{UserID: bucket.UserID, BucketID: bucket.ID}
+		feed.AddLogs(bucket.ID, brls)
+		pq.Schedule(notification, notificationTTL)
+
+		volumes.Add(anomaly.Key{Bucket: bucket.ID}, len(ingests), 0)
+
+		var wg sync.WaitGroup
+		for i, ingest := range ingests {
+			if ingest.Held {
+				continue
+			}
+
+			for _, f := range forwardSetting {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					// Running ForwardLog in a goroutine to avoid blocking the request, errors only count as failed deliveries
+					failed := 0
+					if err := ForwardLog(app, forwardQuery, e, &brls[i], f.URL, f.ContentEncoding, ip, ingest.Headers, ingest.Source); err != nil {
+						failed = 1
+						Emit(app, bucket.UserID, bucket.ID, MetaDeliveryFailed, map[string]any{
+							"forward_setting":    f.ID,
+							"destination_url":    f.URL,
+							"bucket_receive_log": brls[i].ID,
+							"error":              err.Error(),
+						})
+					}
+					volumes.Add(anomaly.Key{Bucket: bucket.ID, Forward: f.ID}, 1, failed)
+					pq.Schedule(notification, notificationTTL)
+				}()
+			}
+		}
+		wg.Wait()
+
+		// Held bodies failed validation, they must not shape the learned schema.
+		for _, ingest := range ingests {
+			if ingest.Held {
+				continue
+			}
+
+			if err := LearnSchema(app, bucket, ingest.EventType, ingest.Body); err != nil {
+				app.Logger().Warn("Learning bucket schema failed", "error", err.Error())
+			}
+		}
+
+		if bucket.Silent {
+			if err := RecoverBucket(app, bucket, time.Now()); err != nil {
+				app.Logger().Warn("Recovering silent bucket failed", "bucket", bucket.ID, "error", err.Error())
+			}
+		}
+	}()
+
+	return nil
+}
+
+// ValidateBucketRedaction rejects bucket writes carrying redaction rules that do not compile.
+func ValidateBucketRedaction(e *core.RecordRequestEvent) error {
+	bucket := Bucket{ID: e.Record.Id, RedactionRules: types.JSONRaw(e.Record.GetString("redaction_rules"))}
+	if _, err := BucketRedactor(bucket); err != nil {
+		return e.BadRequestError("invalid redaction rules", validation.Errors{"redaction_rules": validation.NewError("validation_invalid_redaction_rules", err.Error())})
+	}
+
+	return e.Next()
+}
+
+// BucketRedactor compiles the redaction rules of a bucket, hashes are keyed per bucket.
+func BucketRedactor(bucket Bucket) (*redact.Redactor, error) {
+	rules := []redact.Rule{}
+	if !schema.IsEmpty(bucket.RedactionRules) {
+		if err := json.Unmarshal(bucket.RedactionRules, &rules); err != nil {
+			return nil, err
+		}
+	}
+
+	// Every bucket hashes with its own key so equal values do not correlate across buckets.
+	var key []byte
+	if redactionKey != nil {
+		key = envelope.DeriveKey(redactionKey, bucket.ID)
+	}
+
+	return redact.New(rules, key)
+}
+
+// BodyLimit returns the maximum request body size accepted by a bucket.
+func BodyLimit(bucket Bucket) int64 {
+	if bucket.MaxBodySize > 0 && bucket.MaxBodySize < config.MaxBodySize {
+		return bucket.MaxBodySize
+	}
+
+	return config.MaxBodySize
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"splay/pkg/compression"
+	"splay/pkg/envelope"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/spf13/cobra"
+)
+
+// BucketDataKey returns the data key of a bucket, generating one on first use.
+// It returns nil when encryption at rest is disabled.
+func BucketDataKey(app *App, bucketID string) ([]byte, error) {
+	if masterKey == nil {
+		return nil, nil
+	}
+
+	if key, ok := dataKeys.Load(bucketID); ok {
+		return key.([]byte), nil
+	}
+
+	dataKeyMu.Lock()
+	defer dataKeyMu.Unlock()
+
+	if key, ok := dataKeys.Load(bucketID); ok {
+		return key.([]byte), nil
+	}
+
+	var wrapped string
+	err := app.DB().
+		Select("wrapped_key").
+		From("bucket_keys").
+		Where(dbx.HashExp{"bucket": bucketID}).
+		Row(&wrapped)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.Join(ErrFetchingDataKey, err)
+	}
+
+	var key []byte
+	if wrapped != "" {
+		if key, err = envelope.Unwrap(masterKey, wrapped); err != nil {
+			return nil, errors.Join(ErrFetchingDataKey, err)
+		}
+
+		dataKeys.Store(bucketID, key)
+
+		return key, nil
+	}
+
+	if key, err = envelope.NewKey(); err != nil {
+		return nil, errors.Join(ErrSavingDataKey, err)
+	}
+
+	if wrapped, err = envelope.Wrap(masterKey, key); err != nil {
+		return nil, errors.Join(ErrSavingDataKey, err)
+	}
+
+	now := time.Now().UTC().Format(time.DateTime)
+	_, err = app.DB().Insert("bucket_keys", dbx.Params{
+		"bucket":      bucketID,
+		"wrapped_key": wrapped,
+		"created":     now,
+		"updated":     now,
+	}).Execute()
+	if err != nil {
+		return nil, errors.Join(ErrSavingDataKey, err)
+	}
+
+	dataKeys.Store(bucketID, key)
+
+	return key, nil
+}
+
+// DecodeColumn decrypts and decompresses a body or headers column of a log.
+func DecodeColumn(app *App, bucketID string, raw []byte) ([]byte, error) {
+	plaintext, err := DecryptColumn(app, bucketID, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return compression.DecompressJSON(plaintext)
+}
+
+// DecryptColumn decrypts a body or headers column of a log, plaintext columns are returned as is.
+func DecryptColumn(app *App, bucketID string, raw []byte) ([]byte, error) {
+	if !envelope.IsEncryptedJSON(raw) {
+		return raw, nil
+	}
+
+	if masterKey == nil {
+		return nil, ErrMissingMasterKey
+	}
+
+	key, err := BucketDataKey(app, bucketID)
+	if err != nil {
+		return nil, errors.Join(ErrDecrypting, err)
+	}
+
+	plaintext, err := envelope.DecryptJSON(key, []byte(bucketID), raw)
+	if err != nil {
+		return nil, errors.Join(ErrDecrypting, err)
+	}
+
+	return plaintext, nil
+}
+
+// DecodeLogRecord decrypts and decompresses the body and headers of log records before they are sent to clients.
+func DecodeLogRecord(app *App) func(e *core.RecordEnrichEvent) error {
+	return func(e *core.RecordEnrichEvent) error {
+		for _, field := range []string{"body", "headers"} {
+			plaintext, err := DecodeColumn(app, e.Record.GetString("bucket"), []byte(e.Record.GetString(field)))
+			if err != nil {
+				app.Logger().Warn("Decoding log failed", "id", e.Record.Id, "error", err.Error())
+				continue
+			}
+
+			e.Record.Set(field, types.JSONRaw(plaintext))
+		}
+
+		return e.Next()
+	}
+}
+
+// NewKeysCommand manages the master key used for encryption at rest.
+func NewKeysCommand(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "Manage the encryption at rest master key",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "generate",
+		Short: "Print a new random master key",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, err := envelope.NewKey()
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), envelope.EncodeKey(key))
+
+			return nil
+		},
+	})
+
+	var newKey string
+	rotate := &cobra.Command{
+		Use:   "rotate",
+		Short: "Re-encrypt every log with new data keys wrapped by a new master key",
+		Long:  "Re-encrypt every log with new data keys wrapped by a new master key. The current key is read from SPLAY_MASTER_KEY, plaintext logs are encrypted as well. Stop the server first, it caches data keys and would keep writing with the old ones. Set SPLAY_MASTER_KEY to the new key once the command succeeds, then start the server again.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			next, err := envelope.ParseKey(newKey)
+			if err != nil {
+				return err
+			}
+
+			rows, err := RotateMasterKey(app, masterKey, next)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Re-encrypted %d log rows\n", rows)
+
+			return nil
+		},
+	}
+	rotate.Flags().StringVar(&newKey, "new-master-key", "", "the new master key, base64 or hex encoded")
+	_ = rotate.MarkFlagRequired("new-master-key")
+	cmd.AddCommand(rotate)
+
+	return cmd
+}
+
+// RotateMasterKey replaces every bucket data key and re-encrypts all logs. Rows are rewritten in a
+// single transaction, stored files are re-encrypted to new files the rows point to once it commits,
+// the old files are only deleted after the commit so a failed rotation leaves every log readable.
+// The server caches data keys, so it must be stopped while rotating.
+func RotateMasterKey(app *App, current, next []byte) (int, error) {
+	const pageSize = 500
+
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return 0, errors.Join(ErrRotatingMasterKey, err)
+	}
+	defer fsys.Close()
+
+	staged := &StagedFiles{}
+	total := 0
+	err = app.RunInTransaction(func(txApp core.App) error {
+		buckets := []string{}
+		if err := txApp.DB().Select("id").From("buckets").Column(&buckets); err != nil {
+			return errors.Join(ErrRotatingMasterKey, err)
+		}
+
+		for _, bucketID := range buckets {
+			var wrapped string
+			err := txApp.DB().
+				Select("wrapped_key").
+				From("bucket_keys").
+				Where(dbx.HashExp{"bucket": bucketID}).
+				Row(&wrapped)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return errors.Join(ErrRotatingMasterKey, err)
+			}
+
+			var oldKey []byte
+			if wrapped != "" {
+				if current == nil {
+					return errors.Join(ErrRotatingMasterKey, ErrMissingMasterKey)
+				}
+
+				if oldKey, err = envelope.Unwrap(current, wrapped); err != nil {
+					return errors.Join(ErrRotatingMasterKey, err)
+				}
+			}
+
+			newKey, err := envelope.NewKey()
+			if err != nil {
+				return errors.Join(ErrRotatingMasterKey, err)
+			}
+
+			aad := []byte(bucketID)
+			for _, table := range []string{"bucket_receive_logs", "bucket_forward_logs"} {
+				columns := []string{"id", "body", "headers"}
+				if table == "bucket_receive_logs" {
+					columns = append(columns, "body_file", "files", "attachments")
+				}
+
+				after := ""
+				for {
+					rows := []struct {
+						ID          string        `db:"id"`
+						Body        types.JSONRaw `db:"body"`
+						Headers     types.JSONRaw `db:"headers"`
+						BodyFile    string        `db:"body_file"`
+						Files       types.JSONRaw `db:"files"`
+						Attachments types.JSONRaw `db:"attachments"`
+					}{}
+					err := txApp.DB().
+						Select(columns...).
+						From(table).
+						Where(dbx.NewExp("bucket = {:bucket} AND id > {:after}", dbx.Params{"bucket": bucketID, "after": after})).
+						OrderBy("id").
+						Limit(pageSize).
+						All(&rows)
+					if err != nil {
+						return errors.Join(ErrRotatingMasterKey, err)
+					}
+
+					for _, row := range rows {
+						params := dbx.Params{}
+						for column, raw := range map[string][]byte{"body": row.Body, "headers": row.Headers} {
+							if len(raw) == 0 {
+								continue
+							}
+
+							if envelope.IsEncryptedJSON(raw) {
+								if oldKey == nil {
+									return errors.Join(ErrRotatingMasterKey, ErrMissingMasterKey)
+								}
+
+								if raw, err = envelope.DecryptJSON(oldKey, aad, raw); err != nil {
+									return errors.Join(ErrRotatingMasterKey, err)
+								}
+							}
+
+							encrypted, err := envelope.EncryptJSON(newKey, aad, raw)
+							if err != nil {
+								return errors.Join(ErrRotatingMasterKey, err)
+							}
+							params[column] = string(encrypted)
+						}
+
+						// Files are written under new names, the row only points to them once the rotation commits.
+						renamed := map[string]string{}
+						rotate := func(file string) (string, error) {
+							newFile := RenameLogFile(file)
+							if err := RotateLogFile(txApp, fsys, staged, row.ID, file, newFile, oldKey, newKey, aad); err != nil {
+								return "", err
+							}
+							renamed[file] = newFile
+
+							return newFile, nil
+						}
+
+						if row.BodyFile != "" {
+							if params["body_file"], err = rotate(row.BodyFile); err != nil {
+								return errors.Join(ErrRotatingMasterKey, err)
+							}
+						}
+
+						files := []string{}
+						if len(row.Files) > 0 {
+							if err = json.Unmarshal(row.Files, &files); err != nil {
+								return errors.Join(ErrRotatingMasterKey, err)
+							}
+						}
+						if len(files) > 0 {
+							for i, file := range files {
+								if files[i], err = rotate(file); err != nil {
+									return errors.Join(ErrRotatingMasterKey, err)
+								}
+							}
+
+							attachments := []Attachment{}
+							if len(row.Attachments) > 0 {
+								if err = json.Unmarshal(row.Attachments, &attachments); err != nil {
+									return errors.Join(ErrRotatingMasterKey, err)
+								}
+							}
+							for i, a := range attachments {
+								if newFile, ok := renamed[a.File]; ok {
+									attachments[i].File = newFile
+								}
+							}
+
+							filesBytes, err := json.Marshal(files)
+							if err != nil {
+								return errors.Join(ErrRotatingMasterKey, err)
+							}
+							params["files"] = string(filesBytes)
+
+							if len(attachments) > 0 {
+								attachmentBytes, err := json.Marshal(attachments)
+								if err != nil {
+									return errors.Join(ErrRotatingMasterKey, err)
+								}
+								params["attachments"] = string(attachmentBytes)
+							}
+						}
+
+						if len(params) > 0 {
+							if _, err = txApp.DB().Update(table, params, dbx.HashExp{"id": row.ID}).Execute(); err != nil {
+								return errors.Join(ErrRotatingMasterKey, err)
+							}
+						}
+						total++
+					}
+
+					if len(rows) < pageSize {
+						break
+					}
+					after = rows[len(rows)-1].ID
+				}
+			}
+
+			rewrapped, err := envelope.Wrap(next, newKey)
+			if err != nil {
+				return errors.Join(ErrRotatingMasterKey, err)
+			}
+
+			now := time.Now().UTC().Format(time.DateTime)
+			if wrapped == "" {
+				_, err = txApp.DB().Insert("bucket_keys", dbx.Params{
+					"bucket":      bucketID,
+					"wrapped_key": rewrapped,
+					"created":     now,
+					"updated":     now,
+				}).Execute()
+			} else {
+				_, err = txApp.DB().Update("bucket_keys", dbx.Params{
+					"wrapped_key": rewrapped,
+					"updated":     now,
+				}, dbx.HashExp{"bucket": bucketID}).Execute()
+			}
+			if err != nil {
+				return errors.Join(ErrRotatingMasterKey, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		staged.Rollback(app, fsys)
+		return 0, err
+	}
+
+	staged.Commit(app, fsys)
+	dataKeys.Clear()
+
+	return total, nil
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/netip"
+	"splay/pkg/compression"
+	"splay/pkg/ipfilter"
+	"splay/pkg/ratelimit"
+	"splay/pkg/schema"
+	"splay/pkg/spool"
+	"strconv"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Admission is a receive request that passed the network checks of its bucket, its credentials
+// are checked before any rate limit token or quota is spent on it.
+type Admission struct {
+	Bucket Bucket
+	IP     string
+	Now    time.Time
+	// Body is the request body with its content encoding removed, spilled to disk when it is large.
+	// The handler closes it.
+	Body *spool.Buffer
+}
+
+// AdmitAddr applies the IP lists of a bucket to an event sent from addr.
+func AdmitAddr(bucket Bucket, addr netip.Addr) error {
+	ipList, err := BucketIPList(bucket)
+	if err != nil {
+		return errors.Join(ErrCompilingIPLists, err)
+	}
+
+	if !ipList.Allowed(addr) {
+		return ErrIPNotAllowed
+	}
+
+	return nil
+}
+
+// AdmitBucket applies the IP lists, rate limits and quotas of a bucket to an event sent from addr,
+// for senders that cannot authenticate. It returns how long to wait when the event is refused.
+func AdmitBucket(app *App, bucket Bucket, addr netip.Addr, now time.Time) (time.Duration, error) {
+	if err := AdmitAddr(bucket, addr); err != nil {
+		return 0, err
+	}
+
+	userLimits, err := FindUserLimits(app, bucket.UserID)
+	if err != nil {
+		return 0, errors.Join(ErrFetchingUserLimits, err)
+	}
+
+	reservation, wait := limiters.Reserve(now,
+		[]string{"bucket:" + bucket.ID, "user:" + bucket.UserID},
+		[]ratelimit.Limit{BucketRateLimit(bucket), userLimits.Limit()},
+	)
+	if reservation == nil {
+		return wait, ErrRateLimited
+	}
+
+	remaining, err := QuotaRemaining(app, bucket, userLimits, now)
+	if err != nil {
+		reservation.Cancel()
+		return 0, errors.Join(ErrFetchingUsage, err)
+	}
+
+	if remaining == 0 {
+		reservation.Cancel()
+		AnnounceQuotaExceeded(app, bucket, now)
+		return ratelimit.NextPeriod(now).Sub(now), ErrQuotaExceeded
+	}
+
+	return 0, nil
+}
+
+// ReserveEvents takes a rate limit token per event of the bucket and its user and reserves up to
+// events against their monthly quotas. It returns how many events were reserved, or how long to wait
+// when none was. More events than a burst are refused with ErrBatchOverBurst, waiting would not help. Reserved events that end up not being stored are given back with ReleaseUsage.
+func ReserveEvents(app *App, bucket Bucket, now time.Time, events int) (int, time.Duration, error) {
+	userLimits, err := FindUserLimits(app, bucket.UserID)
+	if err != nil {
+		return 0, 0, errors.Join(ErrFetchingUserLimits, err)
+	}
+
+	reservation, wait := limiters.ReserveN(now,
+		[]string{"bucket:" + bucket.ID, "user:" + bucket.UserID},
+		[]ratelimit.Limit{BucketRateLimit(bucket), userLimits.Limit()},
+		events,
+	)
+	if reservation == nil && wait == ratelimit.Never {
+		return 0, 0, ErrBatchOverBurst
+	}
+
+	if reservation == nil {
+		return 0, wait, ErrRateLimited
+	}
+
+	reserved, err := ReserveUsage(app, bucket, userLimits, now, events)
+	if err != nil {
+		reservation.Cancel()
+		return 0, 0, err
+	}
+
+	if reserved == 0 && events > 0 {
+		reservation.Cancel()
+		AnnounceQuotaExceeded(app, bucket, now)
+		return 0, ratelimit.NextPeriod(now).Sub(now), ErrQuotaExceeded
+	}
+
+	return reserved, 0, nil
+}
+
+// AdmitRequest finds the bucket of a receive request, applies its IP lists and checks the bearer
+// token of buckets without a provider before reading the body. The returned error is the response to send.
+func AdmitRequest(app *App, e *core.RequestEvent) (*Admission, error) {
+	slug := e.Request.PathValue("slug")
+
+	bucket := Bucket{}
+	err := app.DB().
+		Select(bucketColumns...).
+		From("buckets").
+		Where(dbx.NewExp("slug = {:slug}", dbx.Params{"slug": slug})).
+		One(&bucket)
+	if err != nil {
+		return nil, e.NotFoundError("bucket not found", errors.Join(ErrFetchingBucket, err))
+	}
+
+	addr, err := GetIP(e.Request)
+	if err != nil {
+		return nil, e.BadRequestError("could not resolve client ip", errors.Join(ErrResolvingIP, err))
+	}
+
+	// Network restrictions apply before any credential is looked at.
+	err = AdmitAddr(bucket, addr)
+	switch {
+	case errors.Is(err, ErrIPNotAllowed):
+		return nil, e.ForbiddenError("ip not allowed", nil)
+	case err != nil:
+		return nil, e.InternalServerError("could not admit request", err)
+	}
+
+	// Provider signatures cover the body, those buckets are verified by the handler once it is read.
+	if bucket.Provider == "" && !BearerAuthorized(e.Request) {
+		return nil, e.UnauthorizedError("unauthorized", nil)
+	}
+
+	now := time.Now()
+	// The body is decoded while it is read and spooled, large bodies never sit in memory as a whole.
+	decoded, err := compression.NewDecoder(e.Request.Header.Get("Content-Encoding"), http.MaxBytesReader(e.Response, e.Request.Body, BodyLimit(bucket)), compression.Limits{
+		MaxSize:  BodyLimit(bucket),
+		MaxRatio: config.MaxCompressionRatio,
+	})
+	if err != nil {
+		if errors.Is(err, compression.ErrUnsupportedEncoding) {
+			return nil, e.Error(http.StatusUnsupportedMediaType, "unsupported content encoding", errors.Join(ErrDecompressing, err))
+		}
+
+		return nil, e.BadRequestError("could not decompress body", errors.Join(ErrDecompressing, err))
+	}
+	defer decoded.Close()
+
+	body := spool.New(spoolMemory)
+	if _, err = io.Copy(body, decoded); err != nil {
+		body.Close()
+
+		var maxErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxErr):
+			return nil, e.Error(http.StatusRequestEntityTooLarge, "body too large", errors.Join(ErrBodyTooLarge, err))
+		case errors.Is(err, compression.ErrTooLarge), errors.Is(err, compression.ErrTooCompressed):
+			return nil, e.Error(http.StatusRequestEntityTooLarge, "decompressed body too large", errors.Join(ErrDecompressing, err))
+		case errors.Is(err, compression.ErrCorrupt):
+			return nil, e.BadRequestError("could not decompress body", errors.Join(ErrDecompressing, err))
+		default:
+			return nil, e.BadRequestError("could not read body", errors.Join(ErrReadingBody, err))
+		}
+	}
+
+	return &Admission{Bucket: bucket, IP: addr.String(), Now: now, Body: body}, nil
+}
+
+// BearerAuthorized reports whether a request carries the bearer token of the instance.
+func BearerAuthorized(r *http.Request) bool {
+	auth := strings.Split(r.Header.Get("Authorization"), "Bearer ")
+	return len(auth) >= 2 && auth[1] == config.Authorization
+}
+
+// ReserveRequest spends rate limit tokens and up to events of quota on an authenticated request,
+// it returns how many events were reserved. The returned error is the response to send.
+func ReserveRequest(app *App, e *core.RequestEvent, admission *Admission, events int) (int, error) {
+	reserved, wait, err := ReserveEvents(app, admission.Bucket, admission.Now, events)
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		e.Response.Header().Set("Retry-After", strconv.Itoa(ratelimit.RetryAfter(wait)))
+		return 0, e.TooManyRequestsError("rate limit exceeded", nil)
+	case errors.Is(err, ErrBatchOverBurst):
+		return 0, e.Error(http.StatusRequestEntityTooLarge, "batch exceeds the rate limit burst", err)
+	case errors.Is(err, ErrQuotaExceeded):
+		e.Response.Header().Set("Retry-After", strconv.Itoa(ratelimit.RetryAfter(wait)))
+		return 0, e.TooManyRequestsError("monthly quota exceeded", nil)
+	case err != nil:
+		return 0, e.InternalServerError("could not admit request", err)
+	}
+
+	return reserved, nil
+}
+
+// BucketRateLimit returns the request rate limit of a bucket. Like BodyLimit, a bucket may only
+// tighten the configured limit, owners edit their buckets.
+func BucketRateLimit(bucket Bucket) ratelimit.Limit {
+	limit := ratelimit.Limit{Rate: config.BucketRateLimit, Burst: config.BucketRateBurst}
+	if bucket.RateLimit > 0 && (!limit.Enabled() || bucket.RateLimit < limit.Rate) {
+		limit.Rate = bucket.RateLimit
+	}
+
+	if bucket.RateBurst > 0 && (limit.Burst <= 0 || bucket.RateBurst < limit.Burst) {
+		limit.Burst = bucket.RateBurst
+	}
+
+	return limit
+}
+
+// BucketMonthlyQuota returns the monthly event quota of a bucket, zero is unlimited. A bucket may
+// only lower the configured quota.
+func BucketMonthlyQuota(bucket Bucket) int64 {
+	if bucket.MonthlyQuota > 0 && (config.BucketMonthlyQuota <= 0 || bucket.MonthlyQuota < config.BucketMonthlyQuota) {
+		return bucket.MonthlyQuota
+	}
+
+	return config.BucketMonthlyQuota
+}
+
+func (l UserLimits) Limit() ratelimit.Limit {
+	return ratelimit.Limit{Rate: l.RateLimit, Burst: l.RateBurst}
+}
+
+// FindUserLimits returns the limits of a user, falling back to the configured defaults.
+func FindUserLimits(app *App, userID string) (UserLimits, error) {
+	limits := UserLimits{}
+	err := app.DB().
+		Select("rate_limit", "rate_burst", "monthly_quota").
+		From("user_limits").
+		Where(dbx.HashExp{"user": userID}).
+		One(&limits)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return limits, err
+	}
+
+	if limits.RateLimit <= 0 {
+		limits.RateLimit, limits.RateBurst = config.UserRateLimit, config.UserRateBurst
+	}
+
+	if limits.MonthlyQuota <= 0 {
+		limits.MonthlyQuota = config.UserMonthlyQuota
+	}
+
+	return limits, nil
+}
+
+// QuotaRemaining returns how many events the bucket and its user may still receive this month,
+// math.MaxInt64 when neither has a quota.
+func QuotaRemaining(app *App, bucket Bucket, userLimits UserLimits, now time.Time) (int64, error) {
+	period := ratelimit.Period(now)
+	remaining := int64(math.MaxInt64)
+	if quota := BucketMonthlyQuota(bucket); quota > 0 {
+		events, err := UsageEvents(app, dbx.HashExp{"bucket": bucket.ID, "period": period})
+		if err != nil {
+			return 0, err
+		}
+		remaining = min(remaining, quota-events)
+	}
+
+	if userLimits.MonthlyQuota > 0 {
+		events, err := UsageEvents(app, dbx.HashExp{"user": bucket.UserID, "period": period})
+		if err != nil {
+			return 0, err
+		}
+		remaining = min(remaining, userLimits.MonthlyQuota-events)
+	}
+
+	return max(remaining, 0), nil
+}
+
+// UsageEvents sums the events of the usage rows matching exp.
+func UsageEvents(app *App, exp dbx.Expression) (int64, error) {
+	var events int64
+	err := app.DB().
+		Select("COALESCE(SUM(events), 0)").
+		From("bucket_usage").
+		Where(exp).
+		Row(&events)
+
+	return events, err
+}
+
+// reserveAttempts bounds how often ReserveUsage retries after losing a race for the last events of a quota.
+const reserveAttempts = 3
+
+// ReserveUsage records up to events against the bucket for the current period, as many as the
+// monthly quotas of the bucket and its user still allow. The quotas are checked by the same statement
+// that records the events, so concurrent requests cannot overrun them. It returns how many were recorded.
+func ReserveUsage(app *App, bucket Bucket, userLimits UserLimits, now time.Time, events int) (int, error) {
+	for range reserveAttempts {
+		remaining, err := QuotaRemaining(app, bucket, userLimits, now)
+		if err != nil {
+			return 0, errors.Join(ErrFetchingUsage, err)
+		}
+
+		reserved := int(min(int64(events), remaining))
+		if reserved <= 0 {
+			return 0, nil
+		}
+
+		result, err := app.DB().NewQuery(reserveBucketUsage).Bind(dbx.Params{
+			"bucket":       bucket.ID,
+			"user":         bucket.UserID,
+			"period":       ratelimit.Period(now),
+			"events":       reserved,
+			"bucket_quota": BucketMonthlyQuota(bucket),
+			"user_quota":   userLimits.MonthlyQuota,
+			"now":          now.UTC().Format(time.DateTime),
+		}).Execute()
+		if err != nil {
+			return 0, errors.Join(ErrRecordingUsage, err)
+		}
+
+		if n, err := result.RowsAffected(); err == nil && n > 0 {
+			return reserved, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// ReleaseUsage gives back reserved events that were not stored.
+func ReleaseUsage(app *App, bucket Bucket, now time.Time, events int) {
+	if events <= 0 {
+		return
+	}
+
+	if err := RecordUsage(app.DB(), bucket, now, -events); err != nil {
+		app.Logger().Warn("Releasing usage failed", "bucket", bucket.ID, "error", err.Error())
+	}
+}
+
+// RecordUsage counts events against the bucket for the current period, negative events give
+// reserved ones back. db may be a transaction.
+func RecordUsage(db dbx.Builder, bucket Bucket, now time.Time, events int) error {
+	_, err := db.NewQuery(upsertBucketUsage).Bind(dbx.Params{
+		"bucket": bucket.ID,
+		"user":   bucket.UserID,
+		"period": ratelimit.Period(now),
+		"events": events,
+		"now":    now.UTC().Format(time.DateTime),
+	}).Execute()
+	if err != nil {
+		return errors.Join(ErrRecordingUsage, err)
+	}
+
+	return nil
+}
+
+// HandleUsage returns the usage and limits of the authenticated user and each of their buckets,
+// for the current period or the one given as ?period=YYYY-MM.
+func HandleUsage(app *App) RequestFunc {
+	return func(e *core.RequestEvent) error {
+		now := time.Now()
+		period := e.Request.URL.Query().Get("period")
+		if period == "" {
+			period = ratelimit.Period(now)
+		} else if _, err := time.Parse("2006-01", period); err != nil {
+			return e.BadRequestError("period must be formatted as YYYY-MM", err)
+		}
+
+		userID := e.Auth.Id
+		limits, err := FindUserLimits(app, userID)
+		if err != nil {
+			return e.InternalServerError("could not fetch limits", errors.Join(ErrFetchingUserLimits, err))
+		}
+
+		buckets := []Bucket{}
+		err = app.DB().
+			Select(bucketColumns...).
+			From("buckets").
+			Where(dbx.HashExp{"user": userID}).
+			OrderBy("slug").
+			All(&buckets)
+		if err != nil {
+			return e.InternalServerError("could not fetch buckets", errors.Join(ErrFetchingBucket, err))
+		}
+
+		// Usage of deleted buckets keeps counting towards the user.
+		events, err := UsageEvents(app, dbx.HashExp{"user": userID, "period": period})
+		if err != nil {
+			return e.InternalServerError("could not fetch usage", errors.Join(ErrFetchingUsage, err))
+		}
+
+		user := Usage{Events: events, MonthlyQuota: limits.MonthlyQuota, RateLimit: limits.RateLimit, RateBurst: limits.RateBurst}
+		bucketUsage := make([]Usage, 0, len(buckets))
+		for _, bucket := range buckets {
+			events, err := UsageEvents(app, dbx.HashExp{"bucket": bucket.ID, "period": period})
+			if err != nil {
+				return e.InternalServerError("could not fetch usage", errors.Join(ErrFetchingUsage, err))
+			}
+
+			limit := BucketRateLimit(bucket)
+			bucketUsage = append(bucketUsage, Usage{
+				Bucket:       bucket.ID,
+				Slug:         bucket.Slug,
+				Events:       events,
+				MonthlyQuota: BucketMonthlyQuota(bucket),
+				RateLimit:    limit.Rate,
+				RateBurst:    limit.Burst,
+			})
+		}
+
+		return e.JSON(http.StatusOK, map[string]any{
+			"period":   period,
+			"reset_at": ratelimit.NextPeriod(now),
+			"user":     user,
+			"buckets":  bucketUsage,
+		})
+	}
+}
+
+// ValidateBucketIPLists rejects bucket writes carrying IP lists that do not parse.
+func ValidateBucketIPLists(e *core.RecordRequestEvent) error {
+	errs := validation.Errors{}
+	if _, err := BucketIPList(Bucket{IPAllowlist: types.JSONRaw(e.Record.GetString("ip_allowlist"))}); err != nil {
+		errs["ip_allowlist"] = validation.NewError("validation_invalid_ip_list", err.Error())
+	}
+
+	if _, err := BucketIPList(Bucket{IPDenylist: types.JSONRaw(e.Record.GetString("ip_denylist"))}); err != nil {
+		errs["ip_denylist"] = validation.NewError("validation_invalid_ip_list", err.Error())
+	}
+
+	if len(errs) > 0 {
+		return e.BadRequestError("invalid ip lists", errs)
+	}
+
+	return e.Next()
+}
+
+// BucketIPList compiles the allow and deny lists of a bucket.
+func BucketIPList(bucket Bucket) (*ipfilter.List, error) {
+	allow, deny := []string{}, []string{}
+	if !schema.IsEmpty(bucket.IPAllowlist) {
+		if err := json.Unmarshal(bucket.IPAllowlist, &allow); err != nil {
+			return nil, err
+		}
+	}
+
+	if !schema.IsEmpty(bucket.IPDenylist) {
+		if err := json.Unmarshal(bucket.IPDenylist, &deny); err != nil {
+			return nil, err
+		}
+	}
+
+	return ipfilter.NewList(allow, deny, providerRanges)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"splay/pkg/ratelimit"
+	"testing"
+)
+
+func TestBucketLimits(t *testing.T) {
+	defer func(saved Config) { config = saved }(config)
+
+	tests := []struct {
+		name   string
+		config Config
+		bucket Bucket
+		limit  ratelimit.Limit
+		quota  int64
+	}{
+		{"defaults", Config{BucketRateLimit: 10, BucketRateBurst: 20, BucketMonthlyQuota: 1000}, Bucket{}, ratelimit.Limit{Rate: 10, Burst: 20}, 1000},
+		{"lowered", Config{BucketRateLimit: 10, BucketRateBurst: 20, BucketMonthlyQuota: 1000}, Bucket{RateLimit: 1, RateBurst: 2, MonthlyQuota: 10}, ratelimit.Limit{Rate: 1, Burst: 2}, 10},
+		{"raised", Config{BucketRateLimit: 10, BucketRateBurst: 20, BucketMonthlyQuota: 1000}, Bucket{RateLimit: 100, RateBurst: 200, MonthlyQuota: 100000}, ratelimit.Limit{Rate: 10, Burst: 20}, 1000},
+		{"set when unlimited", Config{}, Bucket{RateLimit: 5, RateBurst: 5, MonthlyQuota: 50}, ratelimit.Limit{Rate: 5, Burst: 5}, 50},
+		{"unlimited", Config{}, Bucket{}, ratelimit.Limit{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config = tt.config
+			if got := BucketRateLimit(tt.bucket); got != tt.limit {
+				t.Fatalf("BucketRateLimit() = %+v, want %+v", got, tt.limit)
+			}
+
+			if got := BucketMonthlyQuota(tt.bucket); got != tt.quota {
+				t.Fatalf("BucketMonthlyQuota() = %d, want %d", got, tt.quota)
+			}
+		})
+	}
+}
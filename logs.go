@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// FindAccessibleLog finds the receive log of the request path, applying the view rule of the collection.
+func FindAccessibleLog(app *App, e *core.RequestEvent) (*core.Record, error) {
+	record, err := app.FindRecordById("bucket_receive_logs", e.Request.PathValue("id"))
+	if err != nil {
+		return nil, e.NotFoundError("log not found", err)
+	}
+
+	info, err := e.RequestInfo()
+	if err != nil {
+		return nil, e.BadRequestError("", err)
+	}
+
+	if ok, err := app.CanAccessRecord(record, info, record.Collection().ViewRule); !ok || err != nil {
+		return nil, e.NotFoundError("log not found", err)
+	}
+
+	return record, nil
+}
+
+// HandleLogFile serves a decrypted multipart attachment of a receive log.
+func HandleLogFile(app *App) RequestFunc {
+	return func(e *core.RequestEvent) error {
+		record, err := FindAccessibleLog(app, e)
+		if err != nil {
+			return err
+		}
+
+		attachments := []Attachment{}
+		if raw := record.GetString("attachments"); raw != "" {
+			if err = json.Unmarshal([]byte(raw), &attachments); err != nil {
+				return e.InternalServerError("could not decode attachments", err)
+			}
+		}
+
+		name := e.Request.PathValue("file")
+		i := slices.IndexFunc(attachments, func(a Attachment) bool { return a.File == name })
+		if i < 0 {
+			return e.NotFoundError("file not found", nil)
+		}
+
+		r, err := OpenLogFile(app, record.Id, record.GetString("bucket"), name)
+		if err != nil {
+			return e.InternalServerError("could not open file", errors.Join(ErrOpeningBody, err))
+		}
+		defer r.Close()
+
+		e.Response.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachments[i].Filename}))
+
+		return e.Stream(http.StatusOK, attachments[i].ContentType, r)
+	}
+}
+
+// HandleLogBody streams the decrypted body of a receive log, whether it is stored inline or in file storage.
+func HandleLogBody(app *App) RequestFunc {
+	return func(e *core.RequestEvent) error {
+		record, err := FindAccessibleLog(app, e)
+		if err != nil {
+			return err
+		}
+
+		bucketID := record.GetString("bucket")
+		e.Response.Header().Set("Content-Type", "application/json")
+
+		file := record.GetString("body_file")
+		if file == "" {
+			body, err := DecodeColumn(app, bucketID, []byte(record.GetString("body")))
+			if err != nil {
+				return e.InternalServerError("could not decode body", err)
+			}
+
+			return e.Blob(http.StatusOK, "application/json", body)
+		}
+
+		reader, err := OpenLogFile(app, record.Id, bucketID, file)
+		if err != nil {
+			return e.InternalServerError("could not open body", errors.Join(ErrOpeningBody, err))
+		}
+		defer reader.Close()
+
+		return e.Stream(http.StatusOK, "application/json", reader)
+	}
+}
+
+// ForwardReport is the outcome of a delivery made outside of the server, like by splay listen.
+type ForwardReport struct {
+	DestinationURL string `json:"destination_url"`
+	StatusCode     int    `json:"status_code"`
+}
+
+// HandleReportForward records a delivery of a receive log made by a client as a forward log.
+func HandleReportForward(app *App) RequestFunc {
+	return func(e *core.RequestEvent) error {
+		record, err := FindAccessibleLog(app, e)
+		if err != nil {
+			return err
+		}
+
+		report := ForwardReport{}
+		if err = e.BindBody(&report); err != nil {
+			return e.BadRequestError("invalid forward report", err)
+		}
+
+		errs := validation.Errors{}
+		if _, err := url.ParseRequestURI(report.DestinationURL); err != nil {
+			errs["destination_url"] = validation.NewError("validation_invalid_url", "Must be a valid url.")
+		}
+		if report.StatusCode < 100 || report.StatusCode > 599 {
+			errs["status_code"] = validation.NewError("validation_invalid_status_code", "Must be a HTTP status code.")
+		}
+		if len(errs) > 0 {
+			return e.BadRequestError("invalid forward report", errs)
+		}
+
+		brl := BucketReceiveLog{}
+		err = app.DB().
+			Select("id", "bucket", "body", "headers").
+			From("bucket_receive_logs").
+			Where(dbx.HashExp{"id": record.Id}).
+			One(&brl)
+		if err != nil {
+			return e.InternalServerError("could not load log", errors.Join(ErrFetchingLogs, err))
+		}
+
+		id, err := RecordForward(app.DB().NewQuery(insertBucketForwardLog), &brl, report.DestinationURL, report.StatusCode)
+		if err != nil {
+			return e.InternalServerError("could not record forward", err)
+		}
+
+		return e.JSON(http.StatusCreated, map[string]string{"id": id})
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"splay/pkg/formdata"
+	"splay/pkg/mailparse"
+	"splay/pkg/priorityqueue"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-smtp"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// StartMailServer receives bucket events by email on addr until the app terminates.
+func StartMailServer(app *App, pq *priorityqueue.Scheduler[Notification], addr string) error {
+	server := smtp.NewServer(&MailBackend{app: app, pq: pq})
+	server.Addr = addr
+	server.Domain = cmp.Or(config.MailDomain, "localhost")
+	server.MaxMessageBytes = int(config.MaxBodySize)
+	server.MaxRecipients = maxMailRecipients
+	server.ReadTimeout = mailTimeout
+	server.WriteTimeout = mailTimeout
+	server.AuthDisabled = true
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Join(ErrStartingMailServer, err)
+	}
+
+	go func() {
+		slog.Info("Starting smtp server", "addr", listener.Addr().String())
+		if err := server.Serve(listener); err != nil {
+			app.Logger().Error("Smtp server stopped", "error", err.Error())
+		}
+	}()
+
+	app.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
+		server.Close()
+		return e.Next()
+	})
+
+	return nil
+}
+
+// MailBackend accepts mail for buckets that opted into email, without authentication.
+type MailBackend struct {
+	app *App
+	pq  *priorityqueue.Scheduler[Notification]
+}
+
+func (b *MailBackend) Login(state *smtp.ConnectionState, username, password string) (smtp.Session, error) {
+	return nil, smtp.ErrAuthUnsupported
+}
+
+func (b *MailBackend) AnonymousLogin(state *smtp.ConnectionState) (smtp.Session, error) {
+	addr, err := netip.ParseAddrPort(state.RemoteAddr.String())
+	if err != nil {
+		return nil, errors.Join(ErrResolvingIP, err)
+	}
+
+	return &MailSession{backend: b, ip: addr.Addr().Unmap()}, nil
+}
+
+// MailEvent is the body of a receive log created from an email.
+type MailEvent struct {
+	*mailparse.Message
+	Envelope MailEnvelope `json:"envelope"`
+}
+
+// MailEnvelope holds the smtp sender and recipients, which may differ from the message headers.
+type MailEnvelope struct {
+	From string   `json:"from"`
+	To   []string `json:"to"`
+}
+
+// MailSession is a single smtp transaction, every recipient is a bucket admitted when it is added.
+type MailSession struct {
+	backend *MailBackend
+	ip      netip.Addr
+	from    string
+	to      []string
+	buckets []Bucket
+	limit   int64
+}
+
+func (s *MailSession) Reset() {
+	s.from, s.to, s.buckets, s.limit = "", nil, nil, 0
+}
+
+func (s *MailSession) Logout() error {
+	return nil
+}
+
+func (s *MailSession) Mail(from string, opts smtp.MailOptions) error {
+	if int64(opts.Size) > config.MaxBodySize {
+		return &smtp.SMTPError{Code: 552, EnhancedCode: smtp.EnhancedCode{5, 3, 4}, Message: "Message too large"}
+	}
+
+	s.from = from
+	s.limit = config.MaxBodySize
+
+	return nil
+}
+
+func (s *MailSession) Rcpt(to string) error {
+	slug, domain, ok := strings.Cut(strings.ToLower(to), "@")
+	if !ok || (config.MailDomain != "" && domain != strings.ToLower(config.MailDomain)) {
+		return &smtp.SMTPError{Code: 550, EnhancedCode: smtp.EnhancedCode{5, 1, 2}, Message: "Domain not handled here"}
+	}
+
+	bucket := Bucket{}
+	err := s.backend.app.DB().
+		Select(bucketColumns...).
+		From("buckets").
+		Where(dbx.HashExp{"slug": slug}).
+		One(&bucket)
+	if err != nil || !bucket.AcceptEmail {
+		return &smtp.SMTPError{Code: 550, EnhancedCode: smtp.EnhancedCode{5, 1, 1}, Message: "No such bucket"}
+	}
+
+	_, err = AdmitBucket(s.backend.app, bucket, s.ip, time.Now())
+	switch {
+	case errors.Is(err, ErrIPNotAllowed):
+		return &smtp.SMTPError{Code: 550, EnhancedCode: smtp.EnhancedCode{5, 7, 1}, Message: "IP not allowed"}
+	case errors.Is(err, ErrRateLimited):
+		return &smtp.SMTPError{Code: 451, EnhancedCode: smtp.EnhancedCode{4, 7, 0}, Message: "Rate limit exceeded, try again later"}
+	case errors.Is(err, ErrQuotaExceeded):
+		return &smtp.SMTPError{Code: 452, EnhancedCode: smtp.EnhancedCode{4, 2, 2}, Message: "Monthly quota exceeded"}
+	case err != nil:
+		s.backend.app.Logger().Warn("Admitting email failed", "bucket", bucket.ID, "error", err.Error())
+		return &smtp.SMTPError{Code: 451, EnhancedCode: smtp.EnhancedCode{4, 3, 0}, Message: "Temporary failure, try again later"}
+	}
+
+	s.to = append(s.to, to)
+	s.buckets = append(s.buckets, bucket)
+	s.limit = min(s.limit, BodyLimit(bucket))
+
+	return nil
+}
+
+func (s *MailSession) Data(r io.Reader) error {
+	raw, err := io.ReadAll(io.LimitReader(r, s.limit+1))
+	if err != nil {
+		return err
+	}
+
+	if int64(len(raw)) > s.limit {
+		return &smtp.SMTPError{Code: 552, EnhancedCode: smtp.EnhancedCode{5, 3, 4}, Message: "Message too large"}
+	}
+
+	// A message to several buckets is stored once per bucket, either in all of them or in none so
+	// that the retry of a refused message does not store it twice.
+	app := s.backend.app
+	now := time.Now()
+	ingests := make([]*Ingest, 0, len(s.buckets))
+	release := func() {
+		DiscardIngests(app, ingests)
+		for _, bucket := range s.buckets[:len(ingests)] {
+			ReleaseUsage(app, bucket, now, 1)
+		}
+	}
+
+	for i, bucket := range s.buckets {
+		ingest, err := s.prepare(bucket, s.to[i], raw, now)
+		if err != nil {
+			release()
+			return err
+		}
+		ingests = append(ingests, ingest)
+	}
+
+	brls := []BucketReceiveLog{}
+	err = app.RunInTransaction(func(txApp core.App) error {
+		brls, err = InsertIngests(txApp.DB(), ingests)
+		return err
+	})
+	if err != nil {
+		release()
+		return err
+	}
+
+	for i, bucket := range s.buckets {
+		// The message is stored, refusing it now would only have it sent again.
+		if err = Deliver(app, s.backend.pq, nil, bucket, ingests[i:i+1], brls[i:i+1], s.ip.String()); err != nil {
+			app.Logger().Warn("Delivering email failed", "bucket", bucket.ID, "error", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// prepare parses and validates a message for the bucket the recipient to resolved to and reserves
+// its quota, nothing is stored yet.
+func (s *MailSession) prepare(bucket Bucket, to string, raw []byte, now time.Time) (*Ingest, error) {
+	app := s.backend.app
+	msg, err := mailparse.Parse(raw, AttachmentLimits(bucket))
+	switch {
+	case errors.Is(err, formdata.ErrFileTooLarge), errors.Is(err, formdata.ErrTooManyFiles):
+		return nil, &smtp.SMTPError{Code: 552, EnhancedCode: smtp.EnhancedCode{5, 3, 4}, Message: "Attachments too large"}
+	case errors.Is(err, formdata.ErrFileTypeRefused):
+		return nil, &smtp.SMTPError{Code: 554, EnhancedCode: smtp.EnhancedCode{5, 6, 0}, Message: "Attachment type not allowed"}
+	case err != nil:
+		app.Logger().Debug("Parsing email failed", "bucket", bucket.ID, "error", errors.Join(ErrParsingMail, err).Error())
+		return nil, &smtp.SMTPError{Code: 554, EnhancedCode: smtp.EnhancedCode{5, 6, 0}, Message: "Invalid message"}
+	}
+
+	// Only the recipient of this bucket is recorded, the others are none of its business.
+	jsonBody, err := json.Marshal(MailEvent{Message: msg, Envelope: MailEnvelope{From: s.from, To: []string{to}}})
+	if err != nil {
+		return nil, errors.Join(ErrDecodingBody, err)
+	}
+
+	var body map[string]any
+	if err = json.Unmarshal(jsonBody, &body); err != nil {
+		return nil, errors.Join(ErrDecodingBody, err)
+	}
+
+	report, err := ValidateBody(bucket, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, errors.Join(ErrValidatingSchema, err)
+	}
+
+	if Rejected(bucket, report) {
+		return nil, &smtp.SMTPError{Code: 550, EnhancedCode: smtp.EnhancedCode{5, 7, 1}, Message: "Message does not match bucket schema"}
+	}
+
+	// The quota was only looked at on RCPT, it is taken now that the message is stored.
+	userLimits, err := FindUserLimits(app, bucket.UserID)
+	if err != nil {
+		return nil, errors.Join(ErrFetchingUserLimits, err)
+	}
+
+	reserved, err := ReserveUsage(app, bucket, userLimits, now, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if reserved == 0 {
+		AnnounceQuotaExceeded(app, bucket, now)
+		return nil, &smtp.SMTPError{Code: 452, EnhancedCode: smtp.EnhancedCode{4, 2, 2}, Message: "Monthly quota exceeded"}
+	}
+
+	// Mail is forwarded as a JSON webhook, attachments stay on the log as files.
+	ingest, err := PrepareIngest(app, bucket, Received{
+		Body:       body,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Form:       &formdata.Form{Fields: map[string]any{}, Files: msg.Files},
+		Report:     report,
+		Size:       len(raw),
+		IP:         s.ip.String(),
+		EventType:  MailEventType,
+		DeliveryID: msg.MessageID,
+	})
+	if err != nil {
+		ReleaseUsage(app, bucket, now, reserved)
+		return nil, err
+	}
+
+	return ingest, nil
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"embed"
 	"encoding/json"
@@ -11,10 +10,17 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"slices"
+	"splay/pkg/anomaly"
+	"splay/pkg/envelope"
+	"splay/pkg/ipfilter"
 	"splay/pkg/priorityqueue"
-	"strings"
+	"splay/pkg/providers"
+	"splay/pkg/ratelimit"
+	"splay/pkg/schema"
 	"sync"
 	"syscall"
 	"time"
@@ -22,12 +28,10 @@ import (
 	_ "splay/migrations"
 
 	"github.com/kelseyhightower/envconfig"
-	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/plugins/migratecmd"
-	"github.com/pocketbase/pocketbase/tools/subscriptions"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -37,24 +41,123 @@ import (
 var AppDist embed.FS
 
 const (
-	pqSleepSeconds         = 1
 	earlyExitCode          = 2
 	notificationTTL        = time.Second * 5
 	StaticWildcardParam    = "path"
 	timeout                = 10 * time.Second
 	XForwardedFor          = "X-Forwarded-For"
+	MailEventType          = "email"
+	maxMailRecipients      = 50
+	mailTimeout            = time.Minute
+	defaultPollInterval    = 5
+	pollSlack              = 30 * time.Second
+	defaultItemKey         = "id"
+	ScheduleEventType      = "schedule"
+	IncidentSilence        = "silence"
+	AlertBucketSilent      = "bucket.silent"
+	AlertBucketRecovered   = "bucket.recovered"
+	AlertVolumeSpike       = "bucket.volume_spike"
+	AlertVolumeNormal      = "bucket.volume_normal"
+	AlertForwardFailing    = "forward.failing"
+	AlertForwardRecovered  = "forward.recovered"
+	MetaBucketCreated      = "bucket.created"
+	MetaBucketDeleted      = "bucket.deleted"
+	MetaDeliveryFailed     = "delivery.failed"
+	MetaQuotaExceeded      = "quota.exceeded"
+	MetaSchemaDrift        = "schema.drift"
+	TailReceive            = "receive"
+	TailForward            = "forward"
+	tailBatchSize          = 500
+	tailBodyLimit          = 1 << 20
+	tailKeepAlive          = 15 * time.Second
+	tailRetry              = 3 * time.Second
+	defaultServer          = "http://127.0.0.1:8090"
+	ClientCommand          = "splay.client"
+	OutputTable            = "table"
+	OutputJSON             = "json"
+	APITokenPrefix         = "splay_"
+	ScopeRead              = "read"
+	ScopeBuckets           = "buckets"
+	ScopeForwards          = "forwards"
+	ScopeLogs              = "logs"
+	apiTokenLength         = 40
+	apiTokenContextKey     = "splayAPIToken"
+	tokenUseInterval       = time.Minute
+	spoolMemory            = 1 << 20
+	logFileSuffixLength    = 10
+	logFileSuffixAlphabet  = "abcdefghijklmnopqrstuvwxyz0123456789"
 	maxRetries             = 4
 	minSleepSeconds        = 1
 	maxSleepSeconds        = 20
 	NoStatus               = ""
+	SchemaStatusValid      = "valid"
+	SchemaStatusFlagged    = "flagged"
+	SchemaStatusHeld       = "held"
 	StatusOkBot            = 200
 	StatusOkTop            = 300
-	insertBucketReceiveLog = "INSERT INTO bucket_receive_logs(bucket, body, headers, ip, created, updated) VALUES ({:bucket}, {:body}, {:headers}, {:ip}, {:created}, {:updated}) RETURNING *"
-	insertBucketForwardLog = "INSERT INTO bucket_forward_logs(bucket, bucket_receive_log, destination_url, body, headers, status_code, created, updated) VALUES ({:bucket}, {:bucket_receive_log}, {:destination_url}, {:body}, {:headers}, {:status_code}, {:created}, {:updated})"
+	upsertBucketUsage      = "INSERT INTO bucket_usage(bucket, user, period, events, created, updated) VALUES ({:bucket}, {:user}, {:period}, {:events}, {:now}, {:now}) ON CONFLICT(bucket, period) WHERE bucket != '' DO UPDATE SET events = events + {:events}, updated = {:now}"
+	reserveBucketUsage     = "INSERT INTO bucket_usage(bucket, user, period, events, created, updated) SELECT {:bucket}, {:user}, {:period}, {:events}, {:now}, {:now} WHERE ({:bucket_quota} <= 0 OR (SELECT COALESCE(SUM(events), 0) FROM bucket_usage WHERE bucket = {:bucket} AND period = {:period}) + {:events} <= {:bucket_quota}) AND ({:user_quota} <= 0 OR (SELECT COALESCE(SUM(events), 0) FROM bucket_usage WHERE user = {:user} AND period = {:period}) + {:events} <= {:user_quota}) ON CONFLICT(bucket, period) WHERE bucket != '' DO UPDATE SET events = events + {:events}, updated = {:now}"
+	insertBucketReceiveLog = "INSERT INTO bucket_receive_logs(id, bucket, body, body_file, body_size, files, attachments, headers, ip, event_type, delivery_id, schema_status, schema_errors, created, updated) VALUES ({:id}, {:bucket}, {:body}, {:body_file}, {:body_size}, {:files}, {:attachments}, {:headers}, {:ip}, {:event_type}, {:delivery_id}, {:schema_status}, {:schema_errors}, {:created}, {:updated}) RETURNING *"
+	minDriftSamples        = 10
+	insertBucketSchema     = "INSERT INTO bucket_schemas(bucket, event_type, version, shape, json_schema, drift, created, updated) VALUES ({:bucket}, {:event_type}, {:version}, {:shape}, {:json_schema}, {:drift}, {:created}, {:updated})"
+	updateBucketSchema     = "UPDATE bucket_schemas SET shape = {:shape}, json_schema = {:json_schema}, updated = {:updated} WHERE id = {:id}"
+	insertBucketSourceItem = "INSERT INTO bucket_source_items(source, key, created) VALUES ({:source}, {:key}, {:created}) ON CONFLICT(source, key) DO NOTHING"
+	updateBucketSourcePoll = "UPDATE bucket_sources SET etag = {:etag}, last_modified = {:last_modified}, last_polled = {:last_polled}, last_error = {:last_error} WHERE id = {:id}"
+	updateBucketSchedule   = "UPDATE bucket_schedules SET last_run = {:last_run}, last_error = {:last_error} WHERE id = {:id}"
+	updateMetaWebhook      = "UPDATE meta_webhooks SET last_status = {:last_status}, last_error = {:last_error}, last_delivered = {:last_delivered} WHERE id = {:id}"
+	markBucketSilent       = "UPDATE buckets SET silent = TRUE, silent_since = {:silent_since} WHERE id = {:id} AND silent = FALSE"
+	clearBucketSilent      = "UPDATE buckets SET silent = FALSE, silent_since = '' WHERE id = {:id} AND silent = TRUE"
+	insertBucketIncident   = "INSERT INTO bucket_incidents(id, bucket, kind, forward_setting, started, resolved, details, created, updated) VALUES ({:id}, {:bucket}, {:kind}, {:forward_setting}, {:started}, '', {:details}, {:created}, {:updated})"
+	resolveBucketIncident  = "UPDATE bucket_incidents SET resolved = {:resolved}, updated = {:updated} WHERE id = {:id}"
+	insertBucketForwardLog = "INSERT INTO bucket_forward_logs(id, bucket, bucket_receive_log, destination_url, body, headers, status_code, created, updated) VALUES ({:id}, {:bucket}, {:bucket_receive_log}, {:destination_url}, {:body}, {:headers}, {:status_code}, {:created}, {:updated})"
 )
 
 var (
 	ErrFetchingBucket          = errors.New("Error fetching bucket")
+	ErrReadingBody             = errors.New("Error reading request body")
+	ErrVerifyingProvider       = errors.New("Error verifying provider signature")
+	ErrValidatingSchema        = errors.New("Error validating body against bucket schema")
+	ErrFetchingSchema          = errors.New("Error fetching learned bucket schema")
+	ErrDecodingSchema          = errors.New("Error decoding learned bucket schema")
+	ErrSavingSchema            = errors.New("Error saving learned bucket schema")
+	ErrNotifyingDrift          = errors.New("Error notifying schema drift")
+	ErrRedacting               = errors.New("Error redacting request")
+	ErrFetchingDataKey         = errors.New("Error fetching bucket data key")
+	ErrSavingDataKey           = errors.New("Error saving bucket data key")
+	ErrMissingMasterKey        = errors.New("Master key is not configured")
+	ErrEncrypting              = errors.New("Error encrypting log")
+	ErrDecrypting              = errors.New("Error decrypting log")
+	ErrRotatingMasterKey       = errors.New("Error rotating master key")
+	ErrBodyTooLarge            = errors.New("Request body exceeds the bucket limit")
+	ErrStoringBody             = errors.New("Error storing body in file storage")
+	ErrOpeningBody             = errors.New("Error opening stored body")
+	ErrDecompressing           = errors.New("Error decompressing request body")
+	ErrCompressing             = errors.New("Error compressing stored request")
+	ErrParsingForm             = errors.New("Error parsing multipart form")
+	ErrStoringAttachment       = errors.New("Error storing attachment in file storage")
+	ErrResolvingIP             = errors.New("Error resolving client IP")
+	ErrResolvingHost           = errors.New("Error resolving bucket for host")
+	ErrVerifyingDomain         = errors.New("Error verifying custom domain")
+	ErrDomainTaken             = errors.New("Domain verified for another bucket")
+	ErrParsingMail             = errors.New("Error parsing email message")
+	ErrStartingMailServer      = errors.New("Error starting smtp server")
+	ErrFetchingSource          = errors.New("Error fetching bucket source")
+	ErrFetchingSchedule        = errors.New("Error fetching bucket schedule")
+	ErrPayloadNotObject        = errors.New("Schedule payload must be a JSON object")
+	ErrPayloadRejected         = errors.New("Schedule payload does not match bucket schema")
+	ErrCheckingSilence         = errors.New("Error checking bucket cadence")
+	ErrSendingAlert            = errors.New("Error sending bucket alert")
+	ErrDestinationStatus       = errors.New("Destination responded with an error status")
+	ErrFetchingMetaWebhooks    = errors.New("Error fetching meta webhooks")
+	ErrFetchingLogs            = errors.New("Error fetching bucket logs")
+	ErrCompilingIPLists        = errors.New("Error compiling bucket IP lists")
+	ErrIPNotAllowed            = errors.New("IP not allowed")
+	ErrRateLimited             = errors.New("Rate limit exceeded")
+	ErrBatchOverBurst          = errors.New("Batch has more events than the rate limit burst")
+	ErrQuotaExceeded           = errors.New("Monthly quota exceeded")
+	ErrFetchingUsage           = errors.New("Error fetching usage")
+	ErrRecordingUsage          = errors.New("Error recording usage")
+	ErrFetchingUserLimits      = errors.New("Error fetching user limits")
 	ErrInsertingReceiveLog     = errors.New("Error inserting bucket receive log")
 	ErrInsertingForwardLog     = errors.New("Error inserting bucket forward log")
 	ErrDecodingBody            = errors.New("Error decoding request body into json")
@@ -62,35 +165,76 @@ var (
 	ErrFetchingForwardSettings = errors.New("Error fetching forward settings")
 	ErrCreatingRequest         = errors.New("Error creating request")
 	ErrForwardingRequest       = errors.New("Error forwarding request")
+	ErrMissingCredentials      = errors.New("Missing credentials, pass --token or --email and --password")
+	ErrInvalidBucketRef        = errors.New("Bucket must be an id or slug")
+	ErrBucketNotFound          = errors.New("Bucket not found")
+	ErrMissingBucketUser       = errors.New("Missing bucket owner, pass --user")
+	ErrUserNotFound            = errors.New("User not found")
+	ErrLogNotFound             = errors.New("Log not found")
+	ErrCreatingAPIToken        = errors.New("Error creating API token")
+	ErrInvalidAPIToken         = errors.New("Invalid, expired or revoked API token")
+	ErrAPITokenNotFound        = errors.New("API token not found")
+	ErrMissingTokenUser        = errors.New("Missing token owner, pass --user")
 )
 
-type Notification struct {
-	UserID   string
-	BucketID string
-}
-
-func (f Notification) ID() string {
-	return f.UserID + "/" + f.BucketID
-}
-
-func (f Notification) Subscription() string {
-	return "users/" + f.UserID + "/buckets/" + f.BucketID + "/logs"
-}
-
-type User struct {
-}
-
 var (
 	httpClient = &http.Client{
 		Timeout: timeout,
 	}
+	// publicClient fetches URLs supplied by users, it refuses to connect to local and private addresses.
+	// It does not use a proxy, the dialer has to see the address of the destination itself.
+	publicClient = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         (&net.Dialer{Control: ipfilter.DialControl}).DialContext,
+			ForceAttemptHTTP2:   true,
+			TLSHandshakeTimeout: 10 * time.Second,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
 
 	// Commit is the git commit hash.
 	Commit string
 	config Config
 	static fs.FS
 
-	pq = priorityqueue.NewPriorityQueue[Notification]()
+	pq      = priorityqueue.NewScheduler[Notification]()
+	schemas = schema.NewValidator()
+	// schemaLocks holds a mutex per bucket id, schemas of a bucket are learned one body at a time.
+	schemaLocks sync.Map
+
+	// masterKey wraps the per-bucket data keys, encryption at rest is disabled without it.
+	masterKey []byte
+	// redactionKey keys the hashes of hash redaction rules, such rules are refused without it.
+	redactionKey []byte
+	dataKeys     sync.Map
+	dataKeyMu    sync.Mutex
+
+	clientIPs      = &ipfilter.Resolver{}
+	providerRanges = ipfilter.Ranges{}
+	limiters       = ratelimit.New()
+
+	// feed holds the log summaries pushed with the next notification of every bucket.
+	feed = NewLogFeed()
+
+	// volumes counts the events of buckets and the deliveries of forward settings per anomaly window.
+	volumes *anomaly.Detector
+
+	// quotaAnnounced holds the buckets whose exhausted quota was announced until their quota resets.
+	quotaAnnounced = priorityqueue.NewCache[struct{}](100000)
+
+	// tokenUses holds the API tokens whose last use was recorded within tokenUseInterval.
+	tokenUses = priorityqueue.NewCache[struct{}](100000)
+
+	// polling holds the ids of sources with a poll in flight.
+	polling sync.Map
+
+	// smtpAddr is set by the --smtp-addr flag, the smtp server only runs when it is set.
+	smtpAddr string
+
+	sourceColumns   = []string{"id", "bucket", "name", "type", "url", "headers", "interval", "items_path", "item_key", "etag", "last_modified", "last_polled"}
+	scheduleColumns = []string{"id", "bucket", "name", "cron", "payload", "enabled"}
+	bucketColumns   = []string{"id", "slug", "name", "description", "user", "provider", "provider_secret", "schema", "schema_mode", "drift_webhook_url", "drift_email", "redaction_rules", "forward_original", "max_body_size", "attachment_types", "max_attachment_size", "ip_allowlist", "ip_denylist", "rate_limit", "rate_burst", "monthly_quota", "accept_email", "silence_after", "silence_cron", "alert_webhook_url", "alert_email", "silent", "silent_since", "volume_alert_factor", "failure_alert_rate"}
 )
 
 type App struct {
@@ -103,30 +247,54 @@ type Config struct {
 	Commit        string `default:"" required:"false"`
 	Authorization string `default:"" required:"false"`
 	Secret        string `default:"" required:"false"`
+	MasterKey     string `default:"" required:"false" split_words:"true"`
+	// RedactionKey keys redaction hashes, it is derived from the master key when unset. Changing either
+	// changes the hash of every value, so set it to keep hashes stable across master key rotations.
+	RedactionKey string `default:"" required:"false" split_words:"true"`
+	// MaxBodySize caps every request body, buckets may only lower it.
+	MaxBodySize int64 `default:"10485760" split_words:"true"`
+	// InlineBodySize is the largest stored body kept in the database, larger ones go to file storage.
+	InlineBodySize int64 `default:"262144" split_words:"true"`
+	// MaxCompressionRatio guards decompression of encoded request bodies, decoded bodies are capped
+	// at the body limit of their bucket.
+	MaxCompressionRatio int64 `default:"100" split_words:"true"`
+	// CompressStorage stores log bodies and headers compressed in the database.
+	CompressStorage bool `default:"true" split_words:"true"`
+	// MaxAttachmentSize and MaxAttachments limit the files of multipart requests, buckets may only lower the size.
+	MaxAttachmentSize int64 `default:"10485760" split_words:"true"`
+	MaxAttachments    int   `default:"20" split_words:"true"`
+	// MaxBatchSize is the most events a single batch request may carry.
+	MaxBatchSize int `default:"1000" split_words:"true"`
+	// MailDomain is the domain inbound mail is addressed to as "<slug>@<domain>", empty accepts any domain.
+	MailDomain string `default:"" required:"false" split_words:"true"`
+	// BucketDomain is the wildcard domain buckets are reachable under as "<slug>.<domain>", empty disables it.
+	BucketDomain string `default:"" required:"false" split_words:"true"`
+	// TrustedProxies are the CIDR ranges whose forwarding headers are believed when resolving client IPs.
+	TrustedProxies []string `default:"" split_words:"true"`
+	// ProxyHeader is the forwarding header the trusted proxies set, X-Forwarded-For or Forwarded.
+	// Only that header is read, a proxy passes the other one on as the client sent it.
+	ProxyHeader string `default:"X-Forwarded-For" split_words:"true"`
+	// ProviderRangesFile is a JSON file of provider published IP ranges, like {"github": ["192.30.252.0/22"]}.
+	ProviderRangesFile string `default:"" required:"false" split_words:"true"`
+	// Default ingest limits, zero means unlimited. Buckets and users may override them, see user_limits.
+	BucketRateLimit    float64 `default:"0" split_words:"true"`
+	BucketRateBurst    int     `default:"0" split_words:"true"`
+	BucketMonthlyQuota int64   `default:"0" split_words:"true"`
+	UserRateLimit      float64 `default:"0" split_words:"true"`
+	UserRateBurst      int     `default:"0" split_words:"true"`
+	UserMonthlyQuota   int64   `default:"0" split_words:"true"`
+	// AnomalyWindow in minutes is how long volume and failure counters run before they are compared to their
+	// baseline, an exponential moving average weighted by AnomalySmoothing. Windows with fewer than
+	// AnomalyMinEvents never alert, and volume spikes only alert after AnomalyWarmup windows.
+	AnomalyWindow    int     `default:"5" split_words:"true"`
+	AnomalySmoothing float64 `default:"0.2" split_words:"true"`
+	AnomalyMinEvents int64   `default:"20" split_words:"true"`
+	AnomalyWarmup    int     `default:"6" split_words:"true"`
 }
 
 type BoundFunc = func(e *core.ServeEvent) error
+
 type RequestFunc = func(e *core.RequestEvent) error
-type BucketReceiveLog struct {
-	ID      string `json:"id,omitempty" db:"id"`
-	Bucket  string `json:"bucket,omitempty" db:"bucket"`
-	Body    string `json:"body,omitempty" db:"body"`
-	Headers string `json:"headers,omitempty" db:"headers"`
-	IP      string `json:"ip,omitempty" db:"ip"`
-	Created string `json:"created,omitempty" db:"created"`
-	Updated string `json:"updated,omitempty" db:"updated"`
-}
-type BucketForwardLog struct {
-	ID               string    `json:"id,omitempty" db:"id"`
-	Bucket           string    `json:"bucket,omitempty" db:"bucket"`
-	BucketReceiveLog string    `json:"bucket_receive_log,omitempty" db:"bucket_receive_log"`
-	DestinationURL   string    `json:"destination_url,omitempty" db:"destination_url"`
-	Headers          string    `json:"headers,omitempty" db:"headers"`
-	Body             string    `json:"body,omitempty" db:"body"`
-	StatusCode       int       `json:"status_code,omitempty" db:"status_code"`
-	Created          time.Time `json:"created,omitempty" db:"created"`
-	Updated          time.Time `json:"updated,omitempty" db:"updated"`
-}
 
 func init() {
 	err := envconfig.Process("splay", &config)
@@ -137,6 +305,44 @@ func init() {
 
 	config.Commit = Commit
 
+	if config.MasterKey != "" {
+		masterKey, err = envelope.ParseKey(config.MasterKey)
+		if err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	switch {
+	case config.RedactionKey != "":
+		if redactionKey, err = envelope.ParseKey(config.RedactionKey); err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+	case masterKey != nil:
+		redactionKey = envelope.DeriveKey(masterKey, "redaction")
+	}
+
+	if clientIPs.Trusted, err = ipfilter.ParsePrefixes(config.TrustedProxies); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
+	if clientIPs.Header, err = ipfilter.ParseHeader(config.ProxyHeader); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
+	if config.ProviderRangesFile != "" {
+		providerRanges, err = ipfilter.LoadRanges(config.ProviderRangesFile)
+		if err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	volumes = anomaly.New(config.AnomalySmoothing, config.AnomalyMinEvents, config.AnomalyWarmup)
+
 	var level slog.Level = slog.LevelInfo
 	if config.Debug {
 		level = slog.LevelDebug
@@ -145,7 +351,7 @@ func init() {
 	h := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})
 	l := slog.New(h)
 	slog.SetDefault(l)
-	slog.Debug("Config", fmt.Sprintf("%+v", config))
+	slog.Debug("Config", "config", fmt.Sprintf("%+v", config))
 
 	static, err = fs.Sub(AppDist, "app/dist")
 	if err != nil {
@@ -153,6 +359,7 @@ func init() {
 		os.Exit(1)
 	}
 }
+
 func main() {
 	app := NewApp()
 	app.OnServe().BindFunc(BindServerEvent(app, config))
@@ -165,6 +372,42 @@ func main() {
 		return e.Next()
 	})
 
+	app.OnRecordCreateRequest("buckets").BindFunc(ValidateBucketSchema)
+	app.OnRecordUpdateRequest("buckets").BindFunc(ValidateBucketSchema)
+	app.OnRecordCreateRequest("buckets").BindFunc(ValidateBucketRedaction)
+	app.OnRecordUpdateRequest("buckets").BindFunc(ValidateBucketRedaction)
+	app.OnRecordCreateRequest("buckets").BindFunc(ValidateBucketIPLists)
+	app.OnRecordUpdateRequest("buckets").BindFunc(ValidateBucketIPLists)
+	app.OnRecordCreateRequest("buckets").BindFunc(ValidateBucketSilence)
+	app.OnRecordUpdateRequest("buckets").BindFunc(ValidateBucketSilence)
+	app.OnRecordCreateRequest("bucket_domains").BindFunc(ValidateBucketDomain)
+	app.OnRecordCreateRequest("bucket_sources").BindFunc(ValidateBucketSource)
+	app.OnRecordUpdateRequest("bucket_sources").BindFunc(ValidateBucketSource)
+	app.OnRecordCreateRequest("bucket_schedules").BindFunc(ValidateBucketSchedule)
+	app.OnRecordUpdateRequest("bucket_schedules").BindFunc(ValidateBucketSchedule)
+	app.OnRecordAfterCreateSuccess("bucket_schedules").BindFunc(SyncSchedule(app, pq))
+	app.OnRecordAfterUpdateSuccess("bucket_schedules").BindFunc(SyncSchedule(app, pq))
+	app.OnRecordAfterDeleteSuccess("bucket_schedules").BindFunc(UnregisterSchedule(app))
+	app.OnRecordEnrich("bucket_schedules").BindFunc(EnrichSchedule)
+	app.OnRecordAfterCreateSuccess("buckets").BindFunc(EmitBucketEvent(app, MetaBucketCreated))
+	app.OnRecordAfterDeleteSuccess("buckets").BindFunc(EmitBucketEvent(app, MetaBucketDeleted))
+	app.OnRecordEnrich("bucket_receive_logs", "bucket_forward_logs").BindFunc(DecodeLogRecord(app))
+	app.OnRecordEnrich("buckets", "meta_webhooks").BindFunc(HideAPITokenFields)
+
+	app.RootCmd.AddCommand(NewKeysCommand(app))
+	app.RootCmd.AddCommand(NewTailCommand(), NewListenCommand())
+	app.RootCmd.AddCommand(NewBucketsCommand(app), NewForwardsCommand(app), NewLogsCommand(app), NewTokensCommand(app))
+	app.Cron().MustAdd("pollBucketSources", "* * * * *", func() {
+		PollSources(app, pq)
+	})
+	app.Cron().MustAdd("checkSilentBuckets", "* * * * *", func() {
+		CheckSilentBuckets(app, time.Now())
+	})
+	app.Cron().MustAdd("checkBucketVolumes", "* * * * *", func() {
+		CheckVolumes(app, time.Now())
+	})
+	app.RootCmd.PersistentFlags().StringVar(&smtpAddr, "smtp-addr", "", "address to receive bucket events by email on, like 127.0.0.1:2525")
+
 	migratecmd.MustRegister(app, app.RootCmd, migratecmd.Config{
 		Automigrate: config.Env == "development",
 	})
@@ -176,49 +419,48 @@ func main() {
 	signal.Notify(interrupt, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	defer signal.Stop(interrupt)
 
+	// Client commands bootstrap the app themselves, only when they work on the local data dir.
+	if cmd, _, err := app.RootCmd.Find(os.Args[1:]); err == nil && IsClientCommand(cmd) {
+		if err := app.RootCmd.Execute(); err != nil {
+			os.Exit(earlyExitCode)
+		}
+		return
+	}
+
 	group, ctx := errgroup.WithContext(ctx)
 	group.Go(app.Start)
 
 	if len(os.Args) > 1 && os.Args[1] == "serve" {
 		slog.Info("Starting priority queue")
 		group.Go(func() error {
-			for {
-				select {
-				case <-ctx.Done():
-					return nil
-				default:
-					<-time.After(time.Second * time.Duration(pqSleepSeconds))
-					if pq.Len() == 0 {
-						continue
-					}
-
-					clients := app.SubscriptionsBroker().Clients()
-					for notification := range pq.Items() {
-						app.Logger().Debug("Priority Queue Item: " + fmt.Sprintf("%+v", notification))
-
-						for key, client := range clients {
-							app.Logger().Debug("Priority Queue Length " + fmt.Sprintf("%+v", pq.Len()))
-							user, ok := client.Get(apis.RealtimeClientAuthKey).(*core.Record)
-							if !ok {
-								app.Logger().Warn("client could not be converted to record")
-								continue
-							}
-
-							app.Logger().Debug("client key " + key + "/" + user.Email() + "/" + user.Id)
-							subscription := notification.Subscription()
-							if !client.HasSubscription(subscription) || notification.UserID != user.Id {
-								continue
-							}
-
-							client.Send(subscriptions.Message{
-								Name: subscription,
-								Data: []byte("Refresh logs page"),
-							})
-						}
-					}
+			// Notifications are debounced, a bucket is notified once per notificationTTL however many logs landed.
+			pq.Run(ctx, func(notification Notification) {
+				app.Logger().Debug("Priority Queue Item: " + fmt.Sprintf("%+v", notification))
 
+				message, ok := feed.Take(notification.BucketID)
+				if !ok {
+					return
 				}
-			}
+
+				data, err := json.Marshal(message)
+				if err != nil {
+					app.Logger().Warn("Encoding logs message failed", "error", err.Error())
+					return
+				}
+
+				Broadcast(app, notification.UserID, notification.Subscription(), data)
+			})
+			return nil
+		})
+
+		// Expired entries are dropped as they expire instead of piling up until the caches are full.
+		group.Go(func() error {
+			quotaAnnounced.Run(ctx)
+			return nil
+		})
+		group.Go(func() error {
+			tokenUses.Run(ctx)
+			return nil
 		})
 
 		select {
@@ -248,6 +490,7 @@ func NewApp() *App {
 
 func BindServerEvent(app *App, c Config) BoundFunc {
 	return func(se *core.ServeEvent) error {
+		se.Router.Bind(LoadAPIToken(app))
 		se.Router.GET("/{path...}", apis.Static(static, true)).BindFunc(func(e *core.RequestEvent) error {
 			// ignore root path
 			if e.Request.PathValue(StaticWildcardParam) != "" {
@@ -261,171 +504,76 @@ func BindServerEvent(app *App, c Config) BoundFunc {
 			return e.Next()
 		}).Bind(apis.Gzip())
 
-		se.Router.POST("/buckets/{slug}", HandleBucketReceive(app, pq))
+		// The body limit is enforced per bucket by the handler.
+		se.Router.POST("/buckets/{slug}", HandleBucketReceive(app, pq)).Unbind(apis.DefaultBodyLimitMiddlewareId)
+		se.Router.POST("/buckets/{slug}/batch", HandleBucketBatch(app, pq)).Unbind(apis.DefaultBodyLimitMiddlewareId)
+		se.Router.GET("/api/splay/logs/{id}/body", HandleLogBody(app))
+		se.Router.GET("/api/splay/logs/{id}/files/{file}", HandleLogFile(app))
+		se.Router.POST("/api/splay/logs/{id}/forwards", HandleReportForward(app)).Bind(apis.RequireAuth())
+		se.Router.GET("/api/splay/providers", HandleListProviders(app))
+		se.Router.GET("/api/splay/usage", HandleUsage(app)).Bind(apis.RequireAuth())
+		se.Router.GET("/api/splay/buckets/{id}/tail", HandleTail(app)).Bind(apis.RequireAuth())
+		se.Router.GET("/api/splay/me", HandleMe()).Bind(apis.RequireAuth())
+		se.Router.POST("/api/splay/tokens", HandleCreateAPIToken(app)).Bind(apis.RequireAuth("users"))
+		se.Router.POST("/api/splay/tokens/{id}/revoke", HandleRevokeAPIToken(app)).Bind(apis.RequireAuth("users"))
+		se.Router.POST("/api/splay/domains/{id}/verify", HandleVerifyDomain(app)).Bind(apis.RequireAuth())
+		// Any other POST is matched against bucket subdomains and custom domains.
+		se.Router.POST("/{path...}", HandleHostReceive(app, pq)).Unbind(apis.DefaultBodyLimitMiddlewareId)
+
+		if err := RegisterSchedules(app, pq); err != nil {
+			return err
+		}
+
+		if smtpAddr != "" {
+			if err := StartMailServer(app, pq, smtpAddr); err != nil {
+				return err
+			}
+		}
 
 		return se.Next()
 	}
 }
 
-type Bucket struct {
-	ID          string `json:"id,omitempty" db:"id"`
-	Slug        string `json:"slug,omitempty" db:"slug"`
-	Name        string `json:"name,omitempty" db:"name"`
-	Description string `json:"description,omitempty" db:"description"`
-	UserID      string `json:"user_id,omitempty" db:"user"`
-}
-
-type ForwardSetting struct {
-	ID       string `json:"id,omitempty" db:"id"`
-	Name     string `json:"name,omitempty" db:"name"`
-	URL      string `json:"url,omitempty" db:"url"`
-	BucketID string `json:"bucket_id,omitempty" db:"bucket"`
-}
-
-func HandleBucketReceive(app *App, pq *priorityqueue.ThreadSafeQueue[Notification]) RequestFunc {
+// HandleListProviders lists the provider presets a bucket can be created with, registered providers
+// the provider field of buckets does not accept are left out.
+func HandleListProviders(app *App) RequestFunc {
 	return func(e *core.RequestEvent) error {
-		slug := e.Request.PathValue("slug")
-		auth := strings.Split(e.Request.Header.Get("Authorization"), "Bearer ")
-		if len(auth) < 2 || auth[1] != config.Authorization {
-			return e.UnauthorizedError("unauthorized", nil)
-		}
-
-		bucket := Bucket{}
-		err := app.DB().
-			Select("id", "slug", "name", "description", "user").
-			From("buckets").
-			Where(dbx.NewExp("slug = {:slug}", dbx.Params{"slug": slug})).
-			One(&bucket)
+		buckets, err := app.FindCachedCollectionByNameOrId("buckets")
 		if err != nil {
-			return e.NotFoundError("bucket not found", errors.Join(ErrFetchingBucket, err))
-		}
-
-		decoder := json.NewDecoder(e.Request.Body)
-		var body map[string]any
-		if err = decoder.Decode(&body); err != nil {
-			return e.BadRequestError("body is not json", errors.Join(ErrDecodingBody, err))
-		}
-
-		bodyBytes, err := json.Marshal(body)
-		if err != nil {
-			return e.InternalServerError("err marshalling json body", err)
-		}
-
-		headerBytes, err := json.Marshal(e.Request.Header)
-		if err != nil {
-			return e.InternalServerError("err marshalling json headers", err)
-		}
-
-		created := time.Now().UTC()
-		p := dbx.Params{
-			"body":    string(bodyBytes),
-			"headers": string(headerBytes),
-			"bucket":  bucket.ID,
-			"created": created.Format(time.DateTime),
-			"updated": created.Format(time.DateTime),
+			return e.InternalServerError("could not fetch buckets collection", err)
 		}
 
-		ip, err := GetIP(e.Request)
-		if err == nil {
-			p["ip"] = ip
+		allowed := []string{}
+		if field, ok := buckets.Fields.GetByName("provider").(*core.SelectField); ok {
+			allowed = field.Values
 		}
 
-		brl := BucketReceiveLog{}
-		receivedQuery := app.DB().NewQuery(insertBucketReceiveLog)
-		receivedQuery.Prepare()
-		defer receivedQuery.Close()
-
-		err = receivedQuery.Bind(p).One(&brl)
-		if err != nil {
-			return e.InternalServerError("could not insert bucket receive log", errors.Join(ErrInsertingReceiveLog, err))
-		}
+		list := []map[string]string{}
+		for _, name := range providers.Names() {
+			if !slices.Contains(allowed, name) {
+				continue
+			}
 
-		forwardSetting := []ForwardSetting{}
-		err = app.DB().
-			Select("id", "name", "url", "bucket").
-			From("forward_settings").
-			Where(dbx.NewExp("bucket = {:bucket}", dbx.Params{"bucket": bucket.ID})).
-			All(&forwardSetting)
-		if err != nil {
-			return e.InternalServerError("could not fetch forward settings", errors.Join(ErrFetchingForwardSettings, err))
+			p, _ := providers.Get(name)
+			list = append(list, map[string]string{"name": p.Name, "label": p.Label})
 		}
 
-		go func() {
-			forwardQuery := app.DB().NewQuery(insertBucketForwardLog)
-			forwardQuery.Prepare()
-			defer forwardQuery.Close()
-
-			var wg sync.WaitGroup
-			for _, f := range forwardSetting {
-				wg.Add(1)
-				go func() {
-					defer wg.Done()
-					// Running ForwardLog in a goroutine to avoid blocking the request and avoiding the error
-					_ = ForwardLog(app, forwardQuery, e, &brl, f.URL, ip, headerBytes, bodyBytes)
-				}()
-			}
-			wg.Wait()
-			pq.Push(Notification{UserID: bucket.UserID, BucketID: bucket.ID}, notificationTTL)
-		}()
-
-		return e.JSON(http.StatusOK, map[string]string{"success": "true"})
+		return e.JSON(http.StatusOK, list)
 	}
 }
 
-// ForwardQuery  *dbx.Query
-func ForwardLog(app *App, forwardQuery *dbx.Query, e *core.RequestEvent, brl *BucketReceiveLog, url, ip string, headers, body []byte) error {
-	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(body))
-	if err != nil {
-		return errors.Join(ErrCreatingRequest, err)
-	}
-
-	req.Header = make(http.Header)
-	if err = json.Unmarshal(headers, &req.Header); err != nil {
-		return errors.Join(ErrDecodingHeaders, err)
-	}
-
-	req.Header.Add(XForwardedFor, ip)
-
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return errors.Join(ErrForwardingRequest, err)
-	}
-	defer resp.Body.Close()
-
-	statusOK := resp.StatusCode >= StatusOkBot && resp.StatusCode < StatusOkTop
-	if !statusOK {
-		app.Logger().Debug("Forwarding request failed", fmt.Sprintf("status code: %d", resp.StatusCode))
+// RequestURL rebuilds the absolute URL the sender used, providers sign over it. The forwarded scheme
+// is only believed from trusted proxies.
+func RequestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || (clientIPs.FromProxy(r) && r.Header.Get("X-Forwarded-Proto") == "https") {
+		scheme = "https"
 	}
 
-	created := time.Now().UTC().Format(time.DateTime)
-	p := dbx.Params{
-		"bucket":             brl.Bucket,
-		"bucket_receive_log": brl.ID,
-		"destination_url":    url,
-		"body":               string(body),
-		"headers":            string(headers),
-		"status_code":        resp.StatusCode,
-		"created":            created,
-		"updated":            created,
-	}
-
-	if _, err = forwardQuery.Bind(p).Execute(); err != nil {
-		return errors.Join(ErrInsertingForwardLog, err)
-	}
-
-	return nil
+	return scheme + "://" + r.Host + r.URL.RequestURI()
 }
 
-func GetIP(r *http.Request) (string, error) {
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		return forwarded, nil
-	}
-
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return "", err
-	}
-
-	return ip, nil
+// GetIP returns the client IP of a request, forwarding headers are only trusted from the configured proxies.
+func GetIP(r *http.Request) (netip.Addr, error) {
+	return clientIPs.ClientIP(r)
 }
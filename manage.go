@@ -0,0 +1,992 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/spf13/cobra"
+)
+
+// BucketRow is a bucket as listed by the management commands.
+type BucketRow struct {
+	ID          string `json:"id" db:"id"`
+	Slug        string `json:"slug" db:"slug"`
+	Name        string `json:"name" db:"name"`
+	Description string `json:"description,omitempty" db:"description"`
+	User        string `json:"user" db:"user"`
+	Created     string `json:"created" db:"created"`
+}
+
+// ForwardRow is a forward setting as listed by the management commands.
+type ForwardRow struct {
+	ID              string `json:"id" db:"id"`
+	Bucket          string `json:"bucket" db:"bucket"`
+	Name            string `json:"name" db:"name"`
+	URL             string `json:"url" db:"url"`
+	ContentEncoding string `json:"content_encoding,omitempty" db:"content_encoding"`
+	Created         string `json:"created" db:"created"`
+}
+
+// LogDetail is a receive log with its decoded body and headers, and the forwards it led to when shown.
+type LogDetail struct {
+	ID           string           `json:"id" db:"id"`
+	Bucket       string           `json:"bucket" db:"bucket"`
+	EventType    string           `json:"event_type,omitempty" db:"event_type"`
+	DeliveryID   string           `json:"delivery_id,omitempty" db:"delivery_id"`
+	SchemaStatus string           `json:"schema_status,omitempty" db:"schema_status"`
+	IP           string           `json:"ip,omitempty" db:"ip"`
+	BodySize     int64            `json:"body_size" db:"body_size"`
+	BodyFile     string           `json:"body_file,omitempty" db:"body_file"`
+	Headers      types.JSONRaw    `json:"headers,omitempty" db:"headers"`
+	Body         types.JSONRaw    `json:"body,omitempty" db:"body"`
+	Created      string           `json:"created" db:"created"`
+	Forwards     []ForwardSummary `json:"forwards,omitempty" db:"-"`
+}
+
+// LogQuery selects the receive logs of a bucket, newest first unless Oldest is set.
+type LogQuery struct {
+	EventType string
+	Since     string
+	Limit     int
+	Oldest    bool
+	// Decode loads the bodies and headers of the logs.
+	Decode bool
+}
+
+// Manager is what the management commands work on, the local data dir or a remote server.
+type Manager interface {
+	Buckets(ctx context.Context) ([]BucketRow, error)
+	CreateBucket(ctx context.Context, bucket BucketRow) (BucketRow, error)
+	DeleteBucket(ctx context.Context, ref string) error
+	Forwards(ctx context.Context, bucketRef string) ([]ForwardRow, error)
+	AddForward(ctx context.Context, bucketRef string, forward ForwardRow) (ForwardRow, error)
+	RemoveForward(ctx context.Context, id string) error
+	Logs(ctx context.Context, bucketRef string, query LogQuery, fn func(LogDetail) error) error
+	Log(ctx context.Context, id string) (LogDetail, error)
+	Tokens(ctx context.Context, user string) ([]APIToken, error)
+	CreateToken(ctx context.Context, user string, params APITokenParams) (APIToken, string, error)
+	RevokeToken(ctx context.Context, id string) (APIToken, error)
+}
+
+// LocalManager manages the local data dir directly, bypassing API rules.
+type LocalManager struct {
+	app *App
+}
+
+func (m *LocalManager) findBucket(ref string) (*core.Record, error) {
+	records, err := m.app.FindRecordsByFilter("buckets", "id = {:ref} || slug = {:ref}", "", 1, 0, dbx.Params{"ref": ref})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrBucketNotFound, ref)
+	}
+
+	return records[0], nil
+}
+
+func (m *LocalManager) findUser(ref string) (*core.Record, error) {
+	user, err := m.app.FindAuthRecordByEmail("users", ref)
+	if err != nil {
+		if user, err = m.app.FindRecordById("users", ref); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrUserNotFound, ref)
+		}
+	}
+
+	return user, nil
+}
+
+func (m *LocalManager) Buckets(ctx context.Context) ([]BucketRow, error) {
+	rows := []BucketRow{}
+	err := m.app.DB().
+		Select("id", "slug", "name", "description", "user", "created").
+		From("buckets").
+		OrderBy("slug").
+		WithContext(ctx).
+		All(&rows)
+
+	return rows, err
+}
+
+func (m *LocalManager) CreateBucket(ctx context.Context, bucket BucketRow) (BucketRow, error) {
+	if bucket.User == "" {
+		return bucket, ErrMissingBucketUser
+	}
+
+	user, err := m.findUser(bucket.User)
+	if err != nil {
+		return bucket, err
+	}
+
+	collection, err := m.app.FindCachedCollectionByNameOrId("buckets")
+	if err != nil {
+		return bucket, err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("slug", bucket.Slug)
+	record.Set("name", bucket.Name)
+	record.Set("description", bucket.Description)
+	record.Set("user", user.Id)
+	if err = m.app.SaveWithContext(ctx, record); err != nil {
+		return bucket, err
+	}
+
+	return BucketRow{
+		ID:          record.Id,
+		Slug:        record.GetString("slug"),
+		Name:        record.GetString("name"),
+		Description: record.GetString("description"),
+		User:        user.Id,
+		Created:     record.GetString("created"),
+	}, nil
+}
+
+func (m *LocalManager) DeleteBucket(ctx context.Context, ref string) error {
+	record, err := m.findBucket(ref)
+	if err != nil {
+		return err
+	}
+
+	return m.app.DeleteWithContext(ctx, record)
+}
+
+func (m *LocalManager) Forwards(ctx context.Context, bucketRef string) ([]ForwardRow, error) {
+	bucket, err := m.findBucket(bucketRef)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []ForwardRow{}
+	err = m.app.DB().
+		Select("id", "bucket", "name", "url", "content_encoding", "created").
+		From("forward_settings").
+		Where(dbx.HashExp{"bucket": bucket.Id}).
+		OrderBy("created").
+		WithContext(ctx).
+		All(&rows)
+
+	return rows, err
+}
+
+func (m *LocalManager) AddForward(ctx context.Context, bucketRef string, forward ForwardRow) (ForwardRow, error) {
+	bucket, err := m.findBucket(bucketRef)
+	if err != nil {
+		return forward, err
+	}
+
+	collection, err := m.app.FindCachedCollectionByNameOrId("forward_settings")
+	if err != nil {
+		return forward, err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("bucket", bucket.Id)
+	record.Set("name", forward.Name)
+	record.Set("url", forward.URL)
+	record.Set("content_encoding", forward.ContentEncoding)
+	if err = m.app.SaveWithContext(ctx, record); err != nil {
+		return forward, err
+	}
+
+	forward.ID, forward.Bucket, forward.Created = record.Id, bucket.Id, record.GetString("created")
+
+	return forward, nil
+}
+
+func (m *LocalManager) RemoveForward(ctx context.Context, id string) error {
+	record, err := m.app.FindRecordById("forward_settings", id)
+	if err != nil {
+		return err
+	}
+
+	return m.app.DeleteWithContext(ctx, record)
+}
+
+func (m *LocalManager) Logs(ctx context.Context, bucketRef string, query LogQuery, fn func(LogDetail) error) error {
+	bucket, err := m.findBucket(bucketRef)
+	if err != nil {
+		return err
+	}
+
+	where := dbx.And(dbx.HashExp{"bucket": bucket.Id})
+	if query.EventType != "" {
+		where = dbx.And(where, dbx.HashExp{"event_type": query.EventType})
+	}
+	if query.Since != "" {
+		where = dbx.And(where, dbx.NewExp("created >= {:since}", dbx.Params{"since": query.Since}))
+	}
+
+	order := []string{"created DESC", "id DESC"}
+	if query.Oldest {
+		order = []string{"created", "id"}
+	}
+
+	columns := []string{"id", "bucket", "event_type", "delivery_id", "schema_status", "ip", "body_size", "body_file", "created"}
+	if query.Decode {
+		columns = append(columns, "headers", "body")
+	}
+
+	// Pages keep exports of large buckets from loading every body at once.
+	const pageSize = 200
+	for offset := 0; query.Limit <= 0 || offset < query.Limit; offset += pageSize {
+		limit := pageSize
+		if query.Limit > 0 {
+			limit = min(pageSize, query.Limit-offset)
+		}
+
+		rows := []LogDetail{}
+		err = m.app.DB().
+			Select(columns...).
+			From("bucket_receive_logs").
+			Where(where).
+			OrderBy(order...).
+			Offset(int64(offset)).
+			Limit(int64(limit)).
+			WithContext(ctx).
+			All(&rows)
+		if err != nil {
+			return errors.Join(ErrFetchingLogs, err)
+		}
+
+		for _, row := range rows {
+			if query.Decode {
+				if row, err = m.decode(row); err != nil {
+					return err
+				}
+			}
+
+			if err = fn(row); err != nil {
+				return err
+			}
+		}
+
+		if len(rows) < limit {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (m *LocalManager) decode(row LogDetail) (LogDetail, error) {
+	body, _, err := ReadReceiveBody(m.app, row.Bucket, row.ID, row.Body, row.BodyFile, 0)
+	if err != nil {
+		return row, err
+	}
+
+	headers, err := DecodeColumn(m.app, row.Bucket, row.Headers)
+	if err != nil {
+		return row, err
+	}
+
+	row.Body, row.Headers = body, headers
+
+	return row, nil
+}
+
+func (m *LocalManager) Log(ctx context.Context, id string) (LogDetail, error) {
+	row := LogDetail{}
+	err := m.app.DB().
+		Select("id", "bucket", "event_type", "delivery_id", "schema_status", "ip", "body_size", "body_file", "headers", "body", "created").
+		From("bucket_receive_logs").
+		Where(dbx.HashExp{"id": id}).
+		WithContext(ctx).
+		One(&row)
+	if err != nil {
+		return row, errors.Join(ErrLogNotFound, err)
+	}
+
+	if row, err = m.decode(row); err != nil {
+		return row, err
+	}
+
+	row.Forwards = []ForwardSummary{}
+	err = m.app.DB().
+		Select("id", "bucket_receive_log", "destination_url", "status_code", "created").
+		From("bucket_forward_logs").
+		Where(dbx.HashExp{"bucket_receive_log": id}).
+		OrderBy("created").
+		WithContext(ctx).
+		All(&row.Forwards)
+
+	return row, err
+}
+
+func (m *LocalManager) Tokens(ctx context.Context, user string) ([]APIToken, error) {
+	where := dbx.NewExp("1=1")
+	if user != "" {
+		record, err := m.findUser(user)
+		if err != nil {
+			return nil, err
+		}
+		where = dbx.HashExp{"user": record.Id}
+	}
+
+	tokens := []APIToken{}
+	err := m.app.DB().
+		Select("id", "user", "name", "prefix", "scopes", "expires", "last_used", "revoked", "created").
+		From("api_tokens").
+		Where(where).
+		OrderBy("created DESC").
+		WithContext(ctx).
+		All(&tokens)
+
+	return tokens, err
+}
+
+func (m *LocalManager) CreateToken(ctx context.Context, user string, params APITokenParams) (APIToken, string, error) {
+	if user == "" {
+		return APIToken{}, "", ErrMissingTokenUser
+	}
+
+	record, err := m.findUser(user)
+	if err != nil {
+		return APIToken{}, "", err
+	}
+
+	if err = params.Validate(time.Now()); err != nil {
+		return APIToken{}, "", err
+	}
+
+	return CreateAPIToken(m.app, record.Id, params.Name, params.Scopes, params.Expires.Time())
+}
+
+func (m *LocalManager) RevokeToken(ctx context.Context, id string) (APIToken, error) {
+	return RevokeAPIToken(m.app, "", id, time.Now())
+}
+
+// RemoteManager manages a server through its API, as the authenticated user.
+type RemoteManager struct {
+	remote *Remote
+}
+
+// RemoteRecords calls fn with the records of a collection matching the query, page by page.
+// A positive limit stops after that many records.
+func RemoteRecords[T any](ctx context.Context, r *Remote, collection string, query url.Values, limit int, fn func(T) error) error {
+	const pageSize = 200
+
+	seen := 0
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		query.Set("perPage", strconv.Itoa(pageSize))
+		query.Set("skipTotal", "true")
+
+		list := struct {
+			Items []T `json:"items"`
+		}{}
+		if err := r.Do(ctx, http.MethodGet, "/api/collections/"+collection+"/records?"+query.Encode(), nil, &list); err != nil {
+			return err
+		}
+
+		for _, item := range list.Items {
+			if limit > 0 && seen == limit {
+				return nil
+			}
+			seen++
+
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+
+		if len(list.Items) < pageSize {
+			return nil
+		}
+	}
+}
+
+// filterValue quotes a value for a PocketBase filter.
+func filterValue(value string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(value, `\`, `\\`), "'", `\'`) + "'"
+}
+
+func (m *RemoteManager) Buckets(ctx context.Context) ([]BucketRow, error) {
+	rows := []BucketRow{}
+	err := RemoteRecords(ctx, m.remote, "buckets", url.Values{"sort": {"slug"}}, 0, func(row BucketRow) error {
+		rows = append(rows, row)
+		return nil
+	})
+
+	return rows, err
+}
+
+func (m *RemoteManager) CreateBucket(ctx context.Context, bucket BucketRow) (BucketRow, error) {
+	if bucket.User == "" {
+		me := struct {
+			ID string `json:"id"`
+		}{}
+		if err := m.remote.Do(ctx, http.MethodGet, "/api/splay/me", nil, &me); err != nil {
+			return bucket, err
+		}
+		bucket.User = me.ID
+	}
+
+	created := BucketRow{}
+	params := map[string]string{"slug": bucket.Slug, "name": bucket.Name, "description": bucket.Description, "user": bucket.User}
+	err := m.remote.Do(ctx, http.MethodPost, "/api/collections/buckets/records", params, &created)
+
+	return created, err
+}
+
+func (m *RemoteManager) DeleteBucket(ctx context.Context, ref string) error {
+	bucket, err := m.remote.FindBucket(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	return m.remote.Do(ctx, http.MethodDelete, "/api/collections/buckets/records/"+bucket.ID, nil, nil)
+}
+
+func (m *RemoteManager) Forwards(ctx context.Context, bucketRef string) ([]ForwardRow, error) {
+	bucket, err := m.remote.FindBucket(ctx, bucketRef)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []ForwardRow{}
+	query := url.Values{"filter": {"bucket = " + filterValue(bucket.ID)}, "sort": {"created"}}
+	err = RemoteRecords(ctx, m.remote, "forward_settings", query, 0, func(row ForwardRow) error {
+		rows = append(rows, row)
+		return nil
+	})
+
+	return rows, err
+}
+
+func (m *RemoteManager) AddForward(ctx context.Context, bucketRef string, forward ForwardRow) (ForwardRow, error) {
+	bucket, err := m.remote.FindBucket(ctx, bucketRef)
+	if err != nil {
+		return forward, err
+	}
+
+	forward.Bucket = bucket.ID
+	created := ForwardRow{}
+	err = m.remote.Do(ctx, http.MethodPost, "/api/collections/forward_settings/records", forward, &created)
+
+	return created, err
+}
+
+func (m *RemoteManager) RemoveForward(ctx context.Context, id string) error {
+	return m.remote.Do(ctx, http.MethodDelete, "/api/collections/forward_settings/records/"+url.PathEscape(id), nil, nil)
+}
+
+func (m *RemoteManager) Logs(ctx context.Context, bucketRef string, query LogQuery, fn func(LogDetail) error) error {
+	bucket, err := m.remote.FindBucket(ctx, bucketRef)
+	if err != nil {
+		return err
+	}
+
+	filter := "bucket = " + filterValue(bucket.ID)
+	if query.EventType != "" {
+		filter += " && event_type = " + filterValue(query.EventType)
+	}
+	if query.Since != "" {
+		filter += " && created >= " + filterValue(query.Since)
+	}
+
+	params := url.Values{"filter": {filter}, "sort": {"-created,-id"}}
+	if query.Oldest {
+		params.Set("sort", "created,id")
+	}
+	if !query.Decode {
+		params.Set("fields", "id,bucket,event_type,delivery_id,schema_status,ip,body_size,body_file,created")
+	}
+
+	return RemoteRecords(ctx, m.remote, "bucket_receive_logs", params, query.Limit, func(row LogDetail) error {
+		if query.Decode {
+			if row, err = m.loadBody(ctx, row); err != nil {
+				return err
+			}
+		}
+
+		return fn(row)
+	})
+}
+
+// loadBody fetches the body of a log stored in file storage, inline bodies come decoded with the record.
+func (m *RemoteManager) loadBody(ctx context.Context, row LogDetail) (LogDetail, error) {
+	if row.BodyFile == "" {
+		return row, nil
+	}
+
+	body := json.RawMessage{}
+	if err := m.remote.Do(ctx, http.MethodGet, "/api/splay/logs/"+url.PathEscape(row.ID)+"/body", nil, &body); err != nil {
+		return row, err
+	}
+	row.Body = types.JSONRaw(body)
+
+	return row, nil
+}
+
+func (m *RemoteManager) Log(ctx context.Context, id string) (LogDetail, error) {
+	row := LogDetail{}
+	if err := m.remote.Do(ctx, http.MethodGet, "/api/collections/bucket_receive_logs/records/"+url.PathEscape(id), nil, &row); err != nil {
+		return row, err
+	}
+
+	row, err := m.loadBody(ctx, row)
+	if err != nil {
+		return row, err
+	}
+
+	row.Forwards = []ForwardSummary{}
+	query := url.Values{
+		"filter": {"bucket_receive_log = " + filterValue(id)},
+		"sort":   {"created"},
+		"fields": {"id,bucket_receive_log,destination_url,status_code,created"},
+	}
+	err = RemoteRecords(ctx, m.remote, "bucket_forward_logs", query, 0, func(f ForwardSummary) error {
+		row.Forwards = append(row.Forwards, f)
+		return nil
+	})
+
+	return row, err
+}
+
+func (m *RemoteManager) Tokens(ctx context.Context, user string) ([]APIToken, error) {
+	tokens := []APIToken{}
+	err := RemoteRecords(ctx, m.remote, "api_tokens", url.Values{"sort": {"-created"}}, 0, func(token APIToken) error {
+		tokens = append(tokens, token)
+		return nil
+	})
+
+	return tokens, err
+}
+
+func (m *RemoteManager) CreateToken(ctx context.Context, user string, params APITokenParams) (APIToken, string, error) {
+	created := struct {
+		Token  string   `json:"token"`
+		Record APIToken `json:"record"`
+	}{}
+	err := m.remote.Do(ctx, http.MethodPost, "/api/splay/tokens", params, &created)
+
+	return created.Record, created.Token, err
+}
+
+func (m *RemoteManager) RevokeToken(ctx context.Context, id string) (APIToken, error) {
+	token := APIToken{}
+	err := m.remote.Do(ctx, http.MethodPost, "/api/splay/tokens/"+url.PathEscape(id)+"/revoke", nil, &token)
+
+	return token, err
+}
+
+// ManageFlags select where the management commands work and how they print results.
+type ManageFlags struct {
+	RemoteFlags
+	Output string
+}
+
+// Bind registers the flags on a command group.
+func (f *ManageFlags) Bind(cmd *cobra.Command) {
+	f.RemoteFlags.Bind(cmd)
+	cmd.PersistentFlags().Lookup("server").Usage = "manage the Splay server at this url instead of the local data dir, SPLAY_SERVER by default"
+	cmd.PersistentFlags().StringVarP(&f.Output, "output", "o", OutputTable, "output format, table or json")
+}
+
+// Run wraps a management command, handing it the local or remote manager.
+func (f *ManageFlags) Run(app *App, run func(ctx context.Context, m Manager, cmd *cobra.Command, args []string) error) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if f.Output != OutputTable && f.Output != OutputJSON {
+			return fmt.Errorf("unknown output format %q", f.Output)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if f.Server == "" && os.Getenv("SPLAY_SERVER") == "" {
+			if err := app.Bootstrap(); err != nil {
+				return err
+			}
+			defer app.ResetBootstrapState()
+
+			return run(ctx, &LocalManager{app: app}, cmd, args)
+		}
+
+		remote, err := f.Connect(ctx, cmd.OutOrStderr())
+		if err != nil {
+			return err
+		}
+
+		return run(ctx, &RemoteManager{remote: remote}, cmd, args)
+	}
+}
+
+// Print writes rows as indented JSON or as a table of the columns.
+func Print[T any](w io.Writer, output string, rows []T, columns []string, cells func(T) []string) error {
+	if output == OutputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, strings.Join(columns, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(table, strings.Join(cells(row), "\t"))
+	}
+
+	return table.Flush()
+}
+
+func newManageCommand(use, short string, args cobra.PositionalArgs) *cobra.Command {
+	return &cobra.Command{
+		Use:          use,
+		Short:        short,
+		Args:         args,
+		SilenceUsage: true,
+	}
+}
+
+func bucketCells(b BucketRow) []string {
+	return []string{b.ID, b.Slug, b.Name, b.User, b.Created}
+}
+
+func forwardCells(f ForwardRow) []string {
+	return []string{f.ID, f.Name, f.URL, cmp.Or(f.ContentEncoding, "-"), f.Created}
+}
+
+var (
+	bucketColumnNames  = []string{"ID", "SLUG", "NAME", "USER", "CREATED"}
+	forwardColumnNames = []string{"ID", "NAME", "URL", "ENCODING", "CREATED"}
+	logColumnNames     = []string{"ID", "CREATED", "EVENT TYPE", "SCHEMA", "IP", "SIZE"}
+	tokenColumnNames   = []string{"ID", "NAME", "PREFIX", "SCOPES", "EXPIRES", "LAST USED", "REVOKED"}
+)
+
+func tokenCells(t APIToken) []string {
+	return []string{
+		t.ID,
+		t.Name,
+		t.Prefix,
+		strings.Join(t.Scopes, ","),
+		cmp.Or(t.Expires.String(), "never"),
+		cmp.Or(t.LastUsed.String(), "never"),
+		cmp.Or(t.Revoked.String(), "-"),
+	}
+}
+
+// ParseExpiry returns the expiry of a token created at now valid for d, a duration like 720h or
+// a number of days like 30d. Empty is no expiry.
+func ParseExpiry(d string, now time.Time) (types.DateTime, error) {
+	if d == "" {
+		return types.DateTime{}, nil
+	}
+
+	if days, ok := strings.CutSuffix(d, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return types.DateTime{}, fmt.Errorf("invalid expiry %q", d)
+		}
+
+		return types.ParseDateTime(now.AddDate(0, 0, n))
+	}
+
+	duration, err := time.ParseDuration(d)
+	if err != nil || duration <= 0 {
+		return types.DateTime{}, fmt.Errorf("invalid expiry %q", d)
+	}
+
+	return types.ParseDateTime(now.Add(duration))
+}
+
+// NewBucketsCommand lists, creates and deletes buckets.
+func NewBucketsCommand(app *App) *cobra.Command {
+	flags := ManageFlags{}
+	cmd := &cobra.Command{
+		Use:         "buckets",
+		Short:       "Manage buckets locally or on a remote server",
+		Annotations: map[string]string{ClientCommand: "true"},
+	}
+	flags.Bind(cmd)
+
+	list := newManageCommand("list", "List buckets", cobra.NoArgs)
+	list.RunE = flags.Run(app, func(ctx context.Context, m Manager, cmd *cobra.Command, args []string) error {
+		rows, err := m.Buckets(ctx)
+		if err != nil {
+			return err
+		}
+
+		return Print(cmd.OutOrStdout(), flags.Output, rows, bucketColumnNames, bucketCells)
+	})
+
+	var name, description, user string
+	create := newManageCommand("create <slug>", "Create a bucket", cobra.ExactArgs(1))
+	create.Flags().StringVar(&name, "name", "", "name of the bucket, the slug by default")
+	create.Flags().StringVar(&description, "description", "", "description of the bucket")
+	create.Flags().StringVar(&user, "user", "", "email or id of the owner, required locally, the authenticated user remotely")
+	create.RunE = flags.Run(app, func(ctx context.Context, m Manager, cmd *cobra.Command, args []string) error {
+		bucket, err := m.CreateBucket(ctx, BucketRow{Slug: args[0], Name: cmp.Or(name, args[0]), Description: description, User: user})
+		if err != nil {
+			return err
+		}
+
+		return Print(cmd.OutOrStdout(), flags.Output, []BucketRow{bucket}, bucketColumnNames, bucketCells)
+	})
+
+	remove := newManageCommand("delete <bucket>", "Delete a bucket with its logs and settings", cobra.ExactArgs(1))
+	remove.RunE = flags.Run(app, func(ctx context.Context, m Manager, cmd *cobra.Command, args []string) error {
+		if err := m.DeleteBucket(ctx, args[0]); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStderr(), "Deleted bucket %s\n", args[0])
+		return nil
+	})
+
+	cmd.AddCommand(list, create, remove)
+
+	return cmd
+}
+
+// NewForwardsCommand lists, adds and removes the forward settings of buckets.
+func NewForwardsCommand(app *App) *cobra.Command {
+	flags := ManageFlags{}
+	cmd := &cobra.Command{
+		Use:         "forwards",
+		Short:       "Manage the forward settings of buckets locally or on a remote server",
+		Annotations: map[string]string{ClientCommand: "true"},
+	}
+	flags.Bind(cmd)
+
+	list := newManageCommand("list <bucket>", "List the forward settings of a bucket", cobra.ExactArgs(1))
+	list.RunE = flags.Run(app, func(ctx context.Context, m Manager, cmd *cobra.Command, args []string) error {
+		rows, err := m.Forwards(ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		return Print(cmd.OutOrStdout(), flags.Output, rows, forwardColumnNames, forwardCells)
+	})
+
+	var name, encoding string
+	add := newManageCommand("add <bucket> <url>", "Forward the events of a bucket to a url", cobra.ExactArgs(2))
+	add.Flags().StringVar(&name, "name", "", "name of the forward setting, the url host by default")
+	add.Flags().StringVar(&encoding, "content-encoding", "", "compress forwarded bodies with gzip, deflate, br or zstd")
+	add.RunE = flags.Run(app, func(ctx context.Context, m Manager, cmd *cobra.Command, args []string) error {
+		target, err := url.ParseRequestURI(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid url: %w", err)
+		}
+
+		forward, err := m.AddForward(ctx, args[0], ForwardRow{Name: cmp.Or(name, target.Host), URL: args[1], ContentEncoding: encoding})
+		if err != nil {
+			return err
+		}
+
+		return Print(cmd.OutOrStdout(), flags.Output, []ForwardRow{forward}, forwardColumnNames, forwardCells)
+	})
+
+	remove := newManageCommand("remove <id>", "Remove a forward setting", cobra.ExactArgs(1))
+	remove.RunE = flags.Run(app, func(ctx context.Context, m Manager, cmd *cobra.Command, args []string) error {
+		if err := m.RemoveForward(ctx, args[0]); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStderr(), "Removed forward setting %s\n", args[0])
+		return nil
+	})
+
+	cmd.AddCommand(list, add, remove)
+
+	return cmd
+}
+
+// NewLogsCommand lists, shows and exports the receive logs of buckets.
+func NewLogsCommand(app *App) *cobra.Command {
+	flags := ManageFlags{}
+	cmd := &cobra.Command{
+		Use:         "logs",
+		Short:       "Inspect and export the receive logs of buckets locally or on a remote server",
+		Annotations: map[string]string{ClientCommand: "true"},
+	}
+	flags.Bind(cmd)
+
+	query := LogQuery{}
+	list := newManageCommand("list <bucket>", "List the newest receive logs of a bucket", cobra.ExactArgs(1))
+	list.Flags().IntVar(&query.Limit, "limit", 20, "number of logs to list, zero lists all")
+	list.Flags().StringVar(&query.EventType, "event-type", "", "only logs of this event type")
+	list.Flags().StringVar(&query.Since, "since", "", "only logs created at or after this UTC time, like 2025-01-31 or 2025-01-31 12:00:00")
+	list.RunE = flags.Run(app, func(ctx context.Context, m Manager, cmd *cobra.Command, args []string) error {
+		rows := []LogDetail{}
+		err := m.Logs(ctx, args[0], query, func(row LogDetail) error {
+			rows = append(rows, row)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return Print(cmd.OutOrStdout(), flags.Output, rows, logColumnNames, func(l LogDetail) []string {
+			return []string{l.ID, l.Created, cmp.Or(l.EventType, "-"), cmp.Or(l.SchemaStatus, "-"), l.IP, strconv.FormatInt(l.BodySize, 10)}
+		})
+	})
+
+	show := newManageCommand("show <id>", "Show a receive log with its body, headers and forwards", cobra.ExactArgs(1))
+	show.RunE = flags.Run(app, func(ctx context.Context, m Manager, cmd *cobra.Command, args []string) error {
+		row, err := m.Log(ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if flags.Output == OutputJSON {
+			encoder := json.NewEncoder(out)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(row)
+		}
+
+		if err = Print(out, OutputTable, []LogDetail{row}, logColumnNames, func(l LogDetail) []string {
+			return []string{l.ID, l.Created, cmp.Or(l.EventType, "-"), cmp.Or(l.SchemaStatus, "-"), l.IP, strconv.FormatInt(l.BodySize, 10)}
+		}); err != nil {
+			return err
+		}
+
+		for _, part := range []struct {
+			title string
+			raw   types.JSONRaw
+		}{{"Headers", row.Headers}, {"Body", row.Body}} {
+			indented := bytes.Buffer{}
+			if json.Indent(&indented, part.raw, "", "  ") != nil {
+				indented.Reset()
+				indented.Write(part.raw)
+			}
+			fmt.Fprintf(out, "\n%s:\n%s\n", part.title, indented.String())
+		}
+
+		fmt.Fprintln(out, "\nForwards:")
+		return Print(out, OutputTable, row.Forwards, []string{"ID", "CREATED", "STATUS", "DESTINATION"}, func(f ForwardSummary) []string {
+			return []string{f.ID, f.Created, strconv.Itoa(f.StatusCode), f.DestinationURL}
+		})
+	})
+
+	export := LogQuery{Oldest: true, Decode: true}
+	var file string
+	exportCmd := newManageCommand("export <bucket>", "Export the receive logs of a bucket as JSON lines, oldest first", cobra.ExactArgs(1))
+	exportCmd.Flags().StringVar(&export.EventType, "event-type", "", "only logs of this event type")
+	exportCmd.Flags().StringVar(&export.Since, "since", "", "only logs created at or after this UTC time, like 2025-01-31 or 2025-01-31 12:00:00")
+	exportCmd.Flags().StringVar(&file, "file", "", "file to write to instead of stdout")
+	exportCmd.RunE = flags.Run(app, func(ctx context.Context, m Manager, cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+		if file != "" {
+			f, err := os.Create(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+
+		buffered := bufio.NewWriter(out)
+		encoder := json.NewEncoder(buffered)
+		count := 0
+		err := m.Logs(ctx, args[0], export, func(row LogDetail) error {
+			row.BodyFile = ""
+			count++
+			return encoder.Encode(row)
+		})
+		if err != nil {
+			return err
+		}
+
+		if err = buffered.Flush(); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStderr(), "Exported %d logs\n", count)
+		return nil
+	})
+
+	cmd.AddCommand(list, show, exportCmd)
+
+	return cmd
+}
+
+// NewTokensCommand lists, creates and revokes personal API tokens.
+func NewTokensCommand(app *App) *cobra.Command {
+	flags := ManageFlags{}
+	cmd := &cobra.Command{
+		Use:         "tokens",
+		Short:       "Manage personal API tokens locally or on a remote server",
+		Long:        "Manage personal API tokens locally or on a remote server. Remotely tokens are managed as the user signed in with --email and --password or a user auth token, API tokens cannot manage tokens.",
+		Annotations: map[string]string{ClientCommand: "true"},
+	}
+	flags.Bind(cmd)
+
+	var user string
+	list := newManageCommand("list", "List API tokens", cobra.NoArgs)
+	list.Flags().StringVar(&user, "user", "", "email or id of the owner, locally all tokens are listed by default")
+	list.RunE = flags.Run(app, func(ctx context.Context, m Manager, cmd *cobra.Command, args []string) error {
+		tokens, err := m.Tokens(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		return Print(cmd.OutOrStdout(), flags.Output, tokens, tokenColumnNames, tokenCells)
+	})
+
+	var scopes []string
+	var expires string
+	create := newManageCommand("create <name>", "Create an API token, it is printed once", cobra.ExactArgs(1))
+	create.Flags().StringVar(&user, "user", "", "email or id of the owner, required locally")
+	create.Flags().StringSliceVar(&scopes, "scope", []string{ScopeRead}, "scopes of the token: read, buckets, forwards or logs, repeatable")
+	create.Flags().StringVar(&expires, "expires", "", "lifetime of the token like 30d or 12h, no expiry by default")
+	create.RunE = flags.Run(app, func(ctx context.Context, m Manager, cmd *cobra.Command, args []string) error {
+		expiry, err := ParseExpiry(expires, time.Now())
+		if err != nil {
+			return err
+		}
+
+		token, secret, err := m.CreateToken(ctx, user, APITokenParams{Name: args[0], Scopes: scopes, Expires: expiry})
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if flags.Output == OutputJSON {
+			encoder := json.NewEncoder(out)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(map[string]any{"token": secret, "record": token})
+		}
+
+		if err = Print(out, OutputTable, []APIToken{token}, tokenColumnNames, tokenCells); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "\n%s\n", secret)
+		fmt.Fprintln(cmd.OutOrStderr(), "\nStore the token now, it is not shown again.")
+		return nil
+	})
+
+	revoke := newManageCommand("revoke <id>", "Revoke an API token", cobra.ExactArgs(1))
+	revoke.RunE = flags.Run(app, func(ctx context.Context, m Manager, cmd *cobra.Command, args []string) error {
+		token, err := m.RevokeToken(ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		return Print(cmd.OutOrStdout(), flags.Output, []APIToken{token}, tokenColumnNames, tokenCells)
+	})
+
+	cmd.AddCommand(list, create, revoke)
+
+	return cmd
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"splay/pkg/providers"
+	"splay/pkg/ratelimit"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// MetaWebhook is a subscription of a user to the lifecycle events of Splay, scoped to one bucket when set.
+type MetaWebhook struct {
+	ID     string `json:"id,omitempty" db:"id"`
+	URL    string `json:"url,omitempty" db:"url"`
+	Secret string `json:"-" db:"secret"`
+}
+
+// MetaEvent is the body of a meta-webhook delivery.
+type MetaEvent struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	Created time.Time `json:"created"`
+	Bucket  string    `json:"bucket,omitempty"`
+	Data    any       `json:"data"`
+}
+
+// Emit delivers an event to the enabled meta-webhooks of a user subscribed to it in the background.
+// Every delivery is signed with the secret of its webhook, see providers.SplaySignature.
+func Emit(app *App, userID, bucketID, event string, data any) {
+	hooks := []MetaWebhook{}
+	err := app.DB().
+		Select("id", "url", "secret").
+		From("meta_webhooks").
+		Where(dbx.NewExp("user = {:user} AND enabled = TRUE AND (bucket = '' OR bucket = {:bucket}) AND EXISTS (SELECT 1 FROM json_each(events) WHERE value = {:event})", dbx.Params{
+			"user":   userID,
+			"bucket": bucketID,
+			"event":  event,
+		})).
+		All(&hooks)
+	if err != nil {
+		app.Logger().Warn("Fetching meta webhooks failed", "event", event, "error", errors.Join(ErrFetchingMetaWebhooks, err).Error())
+		return
+	}
+
+	if len(hooks) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(MetaEvent{
+		ID:      core.GenerateDefaultRandomId(),
+		Type:    event,
+		Created: time.Now().UTC(),
+		Bucket:  bucketID,
+		Data:    data,
+	})
+	if err != nil {
+		app.Logger().Warn("Encoding meta event failed", "event", event, "error", err.Error())
+		return
+	}
+
+	for _, hook := range hooks {
+		go DeliverMetaEvent(app, hook, event, payload)
+	}
+}
+
+// DeliverMetaEvent posts an event to a meta-webhook and records the outcome on it.
+func DeliverMetaEvent(app *App, hook MetaWebhook, event string, payload []byte) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set(providers.SplayEventHeader, event)
+	header.Set(providers.SplayDeliveryHeader, core.GenerateDefaultRandomId())
+	header.Set(providers.SplaySignatureHeader, providers.SplaySignature(hook.Secret, time.Now(), payload))
+
+	status, lastError := 0, ""
+	resp, err := PostWith(publicClient, hook.URL, "", header, BytesSource(payload))
+	if err != nil {
+		lastError = err.Error()
+	} else {
+		resp.Body.Close()
+		status = resp.StatusCode
+		if status < StatusOkBot || status >= StatusOkTop {
+			lastError = http.StatusText(status)
+		}
+	}
+
+	_, err = app.DB().NewQuery(updateMetaWebhook).Bind(dbx.Params{
+		"id":             hook.ID,
+		"last_status":    status,
+		"last_error":     lastError,
+		"last_delivered": types.NowDateTime().String(),
+	}).Execute()
+	if err != nil {
+		app.Logger().Warn("Recording meta webhook delivery failed", "webhook", hook.ID, "error", err.Error())
+	}
+}
+
+// EmitBucketEvent announces the creation or deletion of a bucket.
+func EmitBucketEvent(app *App, event string) func(e *core.RecordEvent) error {
+	return func(e *core.RecordEvent) error {
+		Emit(app, e.Record.GetString("user"), e.Record.Id, event, map[string]any{
+			"id":   e.Record.Id,
+			"slug": e.Record.GetString("slug"),
+			"name": e.Record.GetString("name"),
+		})
+
+		return e.Next()
+	}
+}
+
+// AnnounceQuotaExceeded emits the first refusal of a bucket for its monthly quota in every period.
+func AnnounceQuotaExceeded(app *App, bucket Bucket, now time.Time) {
+	if !quotaAnnounced.Add(bucket.ID, struct{}{}, ratelimit.NextPeriod(now).Sub(now)) {
+		return
+	}
+
+	Emit(app, bucket.UserID, bucket.ID, MetaQuotaExceeded, map[string]any{
+		"slug":          bucket.Slug,
+		"period":        ratelimit.Period(now),
+		"monthly_quota": BucketMonthlyQuota(bucket),
+		"resets_at":     ratelimit.NextPeriod(now).UTC(),
+	})
+}
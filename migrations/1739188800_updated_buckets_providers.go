@@ -0,0 +1,150 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3037694218")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(6, []byte(`{
+			"hidden": false,
+			"id": "select2462348188",
+			"maxSelect": 1,
+			"name": "provider",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "select",
+			"values": [
+				"github",
+				"stripe",
+				"shopify",
+				"twilio",
+				"slack"
+			]
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(7, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text1574812785",
+			"max": 512,
+			"min": 0,
+			"name": "provider_secret",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		collection, err = app.FindCollectionByNameOrId("pbc_4043953918")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"indexes": [
+				"CREATE INDEX `+"`"+`idx_KUqQgjgiGZ`+"`"+` ON `+"`"+`bucket_receive_logs`+"`"+` (`+"`"+`bucket`+"`"+`)",
+				"CREATE INDEX `+"`"+`idx_Rk2mXw8ePt`+"`"+` ON `+"`"+`bucket_receive_logs`+"`"+` (\n  `+"`"+`bucket`+"`"+`,\n  `+"`"+`event_type`+"`"+`\n)"
+			]
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(4, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text1001261735",
+			"max": 255,
+			"min": 0,
+			"name": "event_type",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(5, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text2390521366",
+			"max": 255,
+			"min": 0,
+			"name": "delivery_id",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3037694218")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("select2462348188")
+
+		// remove field
+		collection.Fields.RemoveById("text1574812785")
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		collection, err = app.FindCollectionByNameOrId("pbc_4043953918")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"indexes": [
+				"CREATE INDEX `+"`"+`idx_KUqQgjgiGZ`+"`"+` ON `+"`"+`bucket_receive_logs`+"`"+` (`+"`"+`bucket`+"`"+`)"
+			]
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("text1001261735")
+
+		// remove field
+		collection.Fields.RemoveById("text2390521366")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,200 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		jsonData := `{
+			"createRule": null,
+			"deleteRule": null,
+			"fields": [
+				{
+					"autogeneratePattern": "[a-z0-9]{15}",
+					"hidden": false,
+					"id": "text3208210256",
+					"max": 15,
+					"min": 15,
+					"name": "id",
+					"pattern": "^[a-z0-9]+$",
+					"presentable": false,
+					"primaryKey": true,
+					"required": true,
+					"system": true,
+					"type": "text"
+				},
+				{
+					"cascadeDelete": true,
+					"collectionId": "pbc_3037694218",
+					"hidden": false,
+					"id": "relation3879679654",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "bucket",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text1001261735",
+					"max": 255,
+					"min": 0,
+					"name": "event_type",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": false,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"hidden": false,
+					"id": "number2212852470",
+					"max": null,
+					"min": 1,
+					"name": "version",
+					"onlyInt": true,
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "number"
+				},
+				{
+					"hidden": false,
+					"id": "json3284395839",
+					"maxSize": 0,
+					"name": "shape",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "json"
+				},
+				{
+					"hidden": false,
+					"id": "json1669367546",
+					"maxSize": 0,
+					"name": "json_schema",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "json"
+				},
+				{
+					"hidden": false,
+					"id": "json2737469165",
+					"maxSize": 0,
+					"name": "drift",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "json"
+				},
+				{
+					"hidden": false,
+					"id": "autodate2990389176",
+					"name": "created",
+					"onCreate": true,
+					"onUpdate": false,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				},
+				{
+					"hidden": false,
+					"id": "autodate3332085495",
+					"name": "updated",
+					"onCreate": true,
+					"onUpdate": true,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				}
+			],
+			"id": "pbc_1894431716",
+			"indexes": [
+				"CREATE UNIQUE INDEX ` + "`" + `idx_T7hVqZ3kLs` + "`" + ` ON ` + "`" + `bucket_schemas` + "`" + ` (\n  ` + "`" + `bucket` + "`" + `,\n  ` + "`" + `event_type` + "`" + `,\n  ` + "`" + `version` + "`" + `\n)"
+			],
+			"listRule": "@request.auth.id = bucket.user.id",
+			"name": "bucket_schemas",
+			"system": false,
+			"type": "base",
+			"updateRule": null,
+			"viewRule": "@request.auth.id = bucket.user.id"
+		}`
+
+		collection := &core.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		collection, err := app.FindCollectionByNameOrId("pbc_3037694218")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(10, []byte(`{
+			"exceptDomains": [],
+			"hidden": false,
+			"id": "url2036473162",
+			"name": "drift_webhook_url",
+			"onlyDomains": [],
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "url"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(11, []byte(`{
+			"exceptDomains": [],
+			"hidden": false,
+			"id": "email1513735913",
+			"name": "drift_email",
+			"onlyDomains": [],
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "email"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3037694218")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("url2036473162")
+
+		// remove field
+		collection.Fields.RemoveById("email1513735913")
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		collection, err = app.FindCollectionByNameOrId("pbc_1894431716")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,129 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		logs, err := app.FindCollectionByNameOrId("pbc_4043953918")
+		if err != nil {
+			return err
+		}
+
+		// update field
+		if err := logs.Fields.AddMarshaledJSONAt(2, []byte(`{
+			"hidden": false,
+			"id": "json3685223346",
+			"maxSize": 0,
+			"name": "body",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "json"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := logs.Fields.AddMarshaledJSON([]byte(`{
+			"hidden": false,
+			"id": "file2426843125",
+			"maxSelect": 1,
+			"maxSize": 1073741824,
+			"mimeTypes": [],
+			"name": "body_file",
+			"presentable": false,
+			"protected": true,
+			"required": false,
+			"system": false,
+			"thumbs": [],
+			"type": "file"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := logs.Fields.AddMarshaledJSON([]byte(`{
+			"hidden": false,
+			"id": "number3148593458",
+			"max": null,
+			"min": 0,
+			"name": "body_size",
+			"onlyInt": true,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := app.Save(logs); err != nil {
+			return err
+		}
+
+		buckets, err := app.FindCollectionByNameOrId("pbc_3037694218")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := buckets.Fields.AddMarshaledJSONAt(14, []byte(`{
+			"hidden": false,
+			"id": "number2881357418",
+			"max": null,
+			"min": 0,
+			"name": "max_body_size",
+			"onlyInt": true,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(buckets)
+	}, func(app core.App) error {
+		logs, err := app.FindCollectionByNameOrId("pbc_4043953918")
+		if err != nil {
+			return err
+		}
+
+		// update field
+		if err := logs.Fields.AddMarshaledJSONAt(2, []byte(`{
+			"hidden": false,
+			"id": "json3685223346",
+			"maxSize": 0,
+			"name": "body",
+			"presentable": false,
+			"required": true,
+			"system": false,
+			"type": "json"
+		}`)); err != nil {
+			return err
+		}
+
+		// remove field
+		logs.Fields.RemoveById("file2426843125")
+
+		// remove field
+		logs.Fields.RemoveById("number3148593458")
+
+		if err := app.Save(logs); err != nil {
+			return err
+		}
+
+		buckets, err := app.FindCollectionByNameOrId("pbc_3037694218")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		buckets.Fields.RemoveById("number2881357418")
+
+		return app.Save(buckets)
+	})
+}
@@ -0,0 +1,116 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		logs, err := app.FindCollectionByNameOrId("pbc_4043953918")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := logs.Fields.AddMarshaledJSON([]byte(`{
+			"hidden": false,
+			"id": "file2683508278",
+			"maxSelect": 99,
+			"maxSize": 1073741824,
+			"mimeTypes": [],
+			"name": "files",
+			"presentable": false,
+			"protected": true,
+			"required": false,
+			"system": false,
+			"thumbs": [],
+			"type": "file"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := logs.Fields.AddMarshaledJSON([]byte(`{
+			"hidden": false,
+			"id": "json1207355262",
+			"maxSize": 0,
+			"name": "attachments",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "json"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := app.Save(logs); err != nil {
+			return err
+		}
+
+		buckets, err := app.FindCollectionByNameOrId("pbc_3037694218")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := buckets.Fields.AddMarshaledJSONAt(15, []byte(`{
+			"hidden": false,
+			"id": "json2139536094",
+			"maxSize": 0,
+			"name": "attachment_types",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "json"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := buckets.Fields.AddMarshaledJSONAt(16, []byte(`{
+			"hidden": false,
+			"id": "number1692781945",
+			"max": null,
+			"min": 0,
+			"name": "max_attachment_size",
+			"onlyInt": true,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(buckets)
+	}, func(app core.App) error {
+		logs, err := app.FindCollectionByNameOrId("pbc_4043953918")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		logs.Fields.RemoveById("file2683508278")
+
+		// remove field
+		logs.Fields.RemoveById("json1207355262")
+
+		if err := app.Save(logs); err != nil {
+			return err
+		}
+
+		buckets, err := app.FindCollectionByNameOrId("pbc_3037694218")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		buckets.Fields.RemoveById("json2139536094")
+
+		// remove field
+		buckets.Fields.RemoveById("number1692781945")
+
+		return app.Save(buckets)
+	})
+}
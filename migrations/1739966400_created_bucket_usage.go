@@ -0,0 +1,309 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		usageData := `{
+			"createRule": null,
+			"deleteRule": null,
+			"fields": [
+				{
+					"autogeneratePattern": "[a-z0-9]{15}",
+					"hidden": false,
+					"id": "text3208210256",
+					"max": 15,
+					"min": 15,
+					"name": "id",
+					"pattern": "^[a-z0-9]+$",
+					"presentable": false,
+					"primaryKey": true,
+					"required": true,
+					"system": true,
+					"type": "text"
+				},
+				{
+					"cascadeDelete": false,
+					"collectionId": "pbc_3037694218",
+					"hidden": false,
+					"id": "relation3879679654",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "bucket",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"cascadeDelete": true,
+					"collectionId": "_pb_users_auth_",
+					"hidden": false,
+					"id": "relation2375276105",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "user",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text2963537958",
+					"max": 7,
+					"min": 7,
+					"name": "period",
+					"pattern": "^\\d{4}-\\d{2}$",
+					"presentable": false,
+					"primaryKey": false,
+					"required": true,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"hidden": false,
+					"id": "number1549226087",
+					"max": null,
+					"min": 0,
+					"name": "events",
+					"onlyInt": true,
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "number"
+				},
+				{
+					"hidden": false,
+					"id": "autodate2990389176",
+					"name": "created",
+					"onCreate": true,
+					"onUpdate": false,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				},
+				{
+					"hidden": false,
+					"id": "autodate3332085495",
+					"name": "updated",
+					"onCreate": true,
+					"onUpdate": true,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				}
+			],
+			"id": "pbc_2914360721",
+			"indexes": [
+				"CREATE UNIQUE INDEX ` + "`" + `idx_Jm4cUq8Xw2` + "`" + ` ON ` + "`" + `bucket_usage` + "`" + ` (` + "`" + `bucket` + "`" + `, ` + "`" + `period` + "`" + `) WHERE ` + "`" + `bucket` + "`" + ` != ''",
+				"CREATE INDEX ` + "`" + `idx_R2wYkP6nTe` + "`" + ` ON ` + "`" + `bucket_usage` + "`" + ` (` + "`" + `user` + "`" + `, ` + "`" + `period` + "`" + `)"
+			],
+			"listRule": "@request.auth.id = user.id",
+			"name": "bucket_usage",
+			"system": false,
+			"type": "base",
+			"updateRule": null,
+			"viewRule": "@request.auth.id = user.id"
+		}`
+
+		limitsData := `{
+			"createRule": null,
+			"deleteRule": null,
+			"fields": [
+				{
+					"autogeneratePattern": "[a-z0-9]{15}",
+					"hidden": false,
+					"id": "text3208210256",
+					"max": 15,
+					"min": 15,
+					"name": "id",
+					"pattern": "^[a-z0-9]+$",
+					"presentable": false,
+					"primaryKey": true,
+					"required": true,
+					"system": true,
+					"type": "text"
+				},
+				{
+					"cascadeDelete": true,
+					"collectionId": "_pb_users_auth_",
+					"hidden": false,
+					"id": "relation2375276105",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "user",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"hidden": false,
+					"id": "number2411376734",
+					"max": null,
+					"min": 0,
+					"name": "rate_limit",
+					"onlyInt": false,
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "number"
+				},
+				{
+					"hidden": false,
+					"id": "number3394564406",
+					"max": null,
+					"min": 0,
+					"name": "rate_burst",
+					"onlyInt": true,
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "number"
+				},
+				{
+					"hidden": false,
+					"id": "number4232720006",
+					"max": null,
+					"min": 0,
+					"name": "monthly_quota",
+					"onlyInt": true,
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "number"
+				},
+				{
+					"hidden": false,
+					"id": "autodate2990389176",
+					"name": "created",
+					"onCreate": true,
+					"onUpdate": false,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				},
+				{
+					"hidden": false,
+					"id": "autodate3332085495",
+					"name": "updated",
+					"onCreate": true,
+					"onUpdate": true,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				}
+			],
+			"id": "pbc_1780342185",
+			"indexes": [
+				"CREATE UNIQUE INDEX ` + "`" + `idx_Vb9sLq3dNh` + "`" + ` ON ` + "`" + `user_limits` + "`" + ` (` + "`" + `user` + "`" + `)"
+			],
+			"listRule": null,
+			"name": "user_limits",
+			"system": false,
+			"type": "base",
+			"updateRule": null,
+			"viewRule": null
+		}`
+
+		for _, data := range []string{usageData, limitsData} {
+			collection := &core.Collection{}
+			if err := json.Unmarshal([]byte(data), &collection); err != nil {
+				return err
+			}
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+
+		buckets, err := app.FindCollectionByNameOrId("pbc_3037694218")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := buckets.Fields.AddMarshaledJSONAt(19, []byte(`{
+			"hidden": false,
+			"id": "number2411376734",
+			"max": null,
+			"min": 0,
+			"name": "rate_limit",
+			"onlyInt": false,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := buckets.Fields.AddMarshaledJSONAt(20, []byte(`{
+			"hidden": false,
+			"id": "number3394564406",
+			"max": null,
+			"min": 0,
+			"name": "rate_burst",
+			"onlyInt": true,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := buckets.Fields.AddMarshaledJSONAt(21, []byte(`{
+			"hidden": false,
+			"id": "number4232720006",
+			"max": null,
+			"min": 0,
+			"name": "monthly_quota",
+			"onlyInt": true,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(buckets)
+	}, func(app core.App) error {
+		for _, id := range []string{"pbc_2914360721", "pbc_1780342185"} {
+			collection, err := app.FindCollectionByNameOrId(id)
+			if err != nil {
+				return err
+			}
+
+			if err := app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		buckets, err := app.FindCollectionByNameOrId("pbc_3037694218")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		buckets.Fields.RemoveById("number2411376734")
+
+		// remove field
+		buckets.Fields.RemoveById("number3394564406")
+
+		// remove field
+		buckets.Fields.RemoveById("number4232720006")
+
+		return app.Save(buckets)
+	})
+}
@@ -0,0 +1,321 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		sourcesData := `{
+			"createRule": "@request.auth.id = bucket.user.id",
+			"deleteRule": "@request.auth.id = bucket.user.id",
+			"fields": [
+				{
+					"autogeneratePattern": "[a-z0-9]{15}",
+					"hidden": false,
+					"id": "text3208210256",
+					"max": 15,
+					"min": 15,
+					"name": "id",
+					"pattern": "^[a-z0-9]+$",
+					"presentable": false,
+					"primaryKey": true,
+					"required": true,
+					"system": true,
+					"type": "text"
+				},
+				{
+					"cascadeDelete": true,
+					"collectionId": "pbc_3037694218",
+					"hidden": false,
+					"id": "relation3879679654",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "bucket",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text1579384326",
+					"max": 0,
+					"min": 0,
+					"name": "name",
+					"pattern": "",
+					"presentable": true,
+					"primaryKey": false,
+					"required": false,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"hidden": false,
+					"id": "select2363381545",
+					"maxSelect": 1,
+					"name": "type",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "select",
+					"values": [
+						"json",
+						"feed"
+					]
+				},
+				{
+					"exceptDomains": [],
+					"hidden": false,
+					"id": "url4101391790",
+					"name": "url",
+					"onlyDomains": [],
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "url"
+				},
+				{
+					"hidden": true,
+					"id": "json1250371951",
+					"maxSize": 0,
+					"name": "headers",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "json"
+				},
+				{
+					"hidden": false,
+					"id": "number2155046657",
+					"max": 1440,
+					"min": 1,
+					"name": "interval",
+					"onlyInt": true,
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "number"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text2902376914",
+					"max": 0,
+					"min": 0,
+					"name": "items_path",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": false,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text3618217561",
+					"max": 0,
+					"min": 0,
+					"name": "item_key",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": false,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"hidden": false,
+					"id": "bool1358543748",
+					"name": "enabled",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "bool"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": true,
+					"id": "text3427756394",
+					"max": 0,
+					"min": 0,
+					"name": "etag",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": false,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": true,
+					"id": "text1046843839",
+					"max": 0,
+					"min": 0,
+					"name": "last_modified",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": false,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"hidden": false,
+					"id": "date2617474632",
+					"max": "",
+					"min": "",
+					"name": "last_polled",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "date"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text3051925876",
+					"max": 0,
+					"min": 0,
+					"name": "last_error",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": false,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"hidden": false,
+					"id": "autodate2990389176",
+					"name": "created",
+					"onCreate": true,
+					"onUpdate": false,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				},
+				{
+					"hidden": false,
+					"id": "autodate3332085495",
+					"name": "updated",
+					"onCreate": true,
+					"onUpdate": true,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				}
+			],
+			"id": "pbc_2001081480",
+			"indexes": [
+				"CREATE INDEX ` + "`" + `idx_Pq7nWz2kLs` + "`" + ` ON ` + "`" + `bucket_sources` + "`" + ` (` + "`" + `bucket` + "`" + `)"
+			],
+			"listRule": "@request.auth.id = bucket.user.id",
+			"name": "bucket_sources",
+			"system": false,
+			"type": "base",
+			"updateRule": "@request.auth.id = bucket.user.id",
+			"viewRule": "@request.auth.id = bucket.user.id"
+		}`
+
+		itemsData := `{
+			"createRule": null,
+			"deleteRule": null,
+			"fields": [
+				{
+					"autogeneratePattern": "[a-z0-9]{15}",
+					"hidden": false,
+					"id": "text3208210256",
+					"max": 15,
+					"min": 15,
+					"name": "id",
+					"pattern": "^[a-z0-9]+$",
+					"presentable": false,
+					"primaryKey": true,
+					"required": true,
+					"system": true,
+					"type": "text"
+				},
+				{
+					"cascadeDelete": true,
+					"collectionId": "pbc_2001081480",
+					"hidden": false,
+					"id": "relation1602912115",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "source",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text2324736937",
+					"max": 0,
+					"min": 0,
+					"name": "key",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": true,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"hidden": false,
+					"id": "autodate2990389176",
+					"name": "created",
+					"onCreate": true,
+					"onUpdate": false,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				}
+			],
+			"id": "pbc_3874913760",
+			"indexes": [
+				"CREATE UNIQUE INDEX ` + "`" + `idx_Hs3vTq8mYd` + "`" + ` ON ` + "`" + `bucket_source_items` + "`" + ` (` + "`" + `source` + "`" + `, ` + "`" + `key` + "`" + `)"
+			],
+			"listRule": null,
+			"name": "bucket_source_items",
+			"system": false,
+			"type": "base",
+			"updateRule": null,
+			"viewRule": null
+		}`
+
+		for _, data := range []string{sourcesData, itemsData} {
+			collection := &core.Collection{}
+			if err := json.Unmarshal([]byte(data), &collection); err != nil {
+				return err
+			}
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		for _, id := range []string{"pbc_3874913760", "pbc_2001081480"} {
+			collection, err := app.FindCollectionByNameOrId(id)
+			if err != nil {
+				return err
+			}
+
+			if err := app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
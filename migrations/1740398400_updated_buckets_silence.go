@@ -0,0 +1,292 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		incidentsData := `{
+			"createRule": null,
+			"deleteRule": null,
+			"fields": [
+				{
+					"autogeneratePattern": "[a-z0-9]{15}",
+					"hidden": false,
+					"id": "text3208210256",
+					"max": 15,
+					"min": 15,
+					"name": "id",
+					"pattern": "^[a-z0-9]+$",
+					"presentable": false,
+					"primaryKey": true,
+					"required": true,
+					"system": true,
+					"type": "text"
+				},
+				{
+					"cascadeDelete": true,
+					"collectionId": "pbc_3037694218",
+					"hidden": false,
+					"id": "relation3879679654",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "bucket",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"hidden": false,
+					"id": "select2363381545",
+					"maxSelect": 1,
+					"name": "kind",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "select",
+					"values": [
+						"silence"
+					]
+				},
+				{
+					"hidden": false,
+					"id": "date1345189255",
+					"max": "",
+					"min": "",
+					"name": "started",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "date"
+				},
+				{
+					"hidden": false,
+					"id": "date2046582618",
+					"max": "",
+					"min": "",
+					"name": "resolved",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "date"
+				},
+				{
+					"hidden": false,
+					"id": "json3532433484",
+					"maxSize": 0,
+					"name": "details",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "json"
+				},
+				{
+					"hidden": false,
+					"id": "autodate2990389176",
+					"name": "created",
+					"onCreate": true,
+					"onUpdate": false,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				},
+				{
+					"hidden": false,
+					"id": "autodate3332085495",
+					"name": "updated",
+					"onCreate": true,
+					"onUpdate": true,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				}
+			],
+			"id": "pbc_2466471794",
+			"indexes": [
+				"CREATE INDEX ` + "`" + `idx_Lm8qZt4vCe` + "`" + ` ON ` + "`" + `bucket_incidents` + "`" + ` (` + "`" + `bucket` + "`" + `, ` + "`" + `started` + "`" + `)"
+			],
+			"listRule": "@request.auth.id = bucket.user.id",
+			"name": "bucket_incidents",
+			"system": false,
+			"type": "base",
+			"updateRule": null,
+			"viewRule": "@request.auth.id = bucket.user.id"
+		}`
+
+		incidents := &core.Collection{}
+		if err := json.Unmarshal([]byte(incidentsData), &incidents); err != nil {
+			return err
+		}
+
+		if err := app.Save(incidents); err != nil {
+			return err
+		}
+
+		logs, err := app.FindCollectionByNameOrId("pbc_4043953918")
+		if err != nil {
+			return err
+		}
+
+		// Silence and volume checks look up the latest events of a bucket.
+		logs.AddIndex("idx_Gx6bRn2sWk", false, "`bucket`, `created`", "")
+
+		if err := app.Save(logs); err != nil {
+			return err
+		}
+
+		buckets, err := app.FindCollectionByNameOrId("pbc_3037694218")
+		if err != nil {
+			return err
+		}
+
+		// The silence state is only ever set by the monitor.
+		buckets.UpdateRule = types.Pointer("@request.auth.id = user.id && @request.body.silent:isset = false && @request.body.silent_since:isset = false")
+
+		// add field
+		if err := buckets.Fields.AddMarshaledJSONAt(23, []byte(`{
+			"hidden": false,
+			"id": "number1825624105",
+			"max": null,
+			"min": 0,
+			"name": "silence_after",
+			"onlyInt": true,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := buckets.Fields.AddMarshaledJSONAt(24, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text1926839214",
+			"max": 100,
+			"min": 0,
+			"name": "silence_cron",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := buckets.Fields.AddMarshaledJSONAt(25, []byte(`{
+			"exceptDomains": [],
+			"hidden": false,
+			"id": "url2703245127",
+			"name": "alert_webhook_url",
+			"onlyDomains": [],
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "url"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := buckets.Fields.AddMarshaledJSONAt(26, []byte(`{
+			"exceptDomains": [],
+			"hidden": false,
+			"id": "email3460936313",
+			"name": "alert_email",
+			"onlyDomains": [],
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "email"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := buckets.Fields.AddMarshaledJSONAt(27, []byte(`{
+			"hidden": false,
+			"id": "bool1616408829",
+			"name": "silent",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "bool"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := buckets.Fields.AddMarshaledJSONAt(28, []byte(`{
+			"hidden": false,
+			"id": "date3795843174",
+			"max": "",
+			"min": "",
+			"name": "silent_since",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "date"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(buckets)
+	}, func(app core.App) error {
+		incidents, err := app.FindCollectionByNameOrId("pbc_2466471794")
+		if err != nil {
+			return err
+		}
+
+		if err := app.Delete(incidents); err != nil {
+			return err
+		}
+
+		logs, err := app.FindCollectionByNameOrId("pbc_4043953918")
+		if err != nil {
+			return err
+		}
+
+		logs.RemoveIndex("idx_Gx6bRn2sWk")
+
+		if err := app.Save(logs); err != nil {
+			return err
+		}
+
+		buckets, err := app.FindCollectionByNameOrId("pbc_3037694218")
+		if err != nil {
+			return err
+		}
+
+		buckets.UpdateRule = types.Pointer("@request.auth.id = user.id")
+
+		// remove field
+		buckets.Fields.RemoveById("number1825624105")
+
+		// remove field
+		buckets.Fields.RemoveById("text1926839214")
+
+		// remove field
+		buckets.Fields.RemoveById("url2703245127")
+
+		// remove field
+		buckets.Fields.RemoveById("email3460936313")
+
+		// remove field
+		buckets.Fields.RemoveById("bool1616408829")
+
+		// remove field
+		buckets.Fields.RemoveById("date3795843174")
+
+		return app.Save(buckets)
+	})
+}
@@ -0,0 +1,136 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		incidents, err := app.FindCollectionByNameOrId("pbc_2466471794")
+		if err != nil {
+			return err
+		}
+
+		// update field
+		if err := incidents.Fields.AddMarshaledJSONAt(2, []byte(`{
+			"hidden": false,
+			"id": "select2363381545",
+			"maxSelect": 1,
+			"name": "kind",
+			"presentable": false,
+			"required": true,
+			"system": false,
+			"type": "select",
+			"values": [
+				"silence",
+				"volume_spike",
+				"failure_rate"
+			]
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := incidents.Fields.AddMarshaledJSONAt(3, []byte(`{
+			"cascadeDelete": true,
+			"collectionId": "pbc_2718762157",
+			"hidden": false,
+			"id": "relation1942071834",
+			"maxSelect": 1,
+			"minSelect": 0,
+			"name": "forward_setting",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "relation"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := app.Save(incidents); err != nil {
+			return err
+		}
+
+		buckets, err := app.FindCollectionByNameOrId("pbc_3037694218")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := buckets.Fields.AddMarshaledJSONAt(29, []byte(`{
+			"hidden": false,
+			"id": "number2843716390",
+			"max": null,
+			"min": 0,
+			"name": "volume_alert_factor",
+			"onlyInt": false,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := buckets.Fields.AddMarshaledJSONAt(30, []byte(`{
+			"hidden": false,
+			"id": "number1503920475",
+			"max": 1,
+			"min": 0,
+			"name": "failure_alert_rate",
+			"onlyInt": false,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(buckets)
+	}, func(app core.App) error {
+		incidents, err := app.FindCollectionByNameOrId("pbc_2466471794")
+		if err != nil {
+			return err
+		}
+
+		// update field
+		if err := incidents.Fields.AddMarshaledJSONAt(2, []byte(`{
+			"hidden": false,
+			"id": "select2363381545",
+			"maxSelect": 1,
+			"name": "kind",
+			"presentable": false,
+			"required": true,
+			"system": false,
+			"type": "select",
+			"values": [
+				"silence"
+			]
+		}`)); err != nil {
+			return err
+		}
+
+		// remove field
+		incidents.Fields.RemoveById("relation1942071834")
+
+		if err := app.Save(incidents); err != nil {
+			return err
+		}
+
+		buckets, err := app.FindCollectionByNameOrId("pbc_3037694218")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		buckets.Fields.RemoveById("number2843716390")
+
+		// remove field
+		buckets.Fields.RemoveById("number1503920475")
+
+		return app.Save(buckets)
+	})
+}
@@ -0,0 +1,273 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		jsonData := `{
+			"createRule": "@request.auth.id = user.id && (bucket = \"\" || bucket.user.id = @request.auth.id) && @request.body.last_status:isset = false && @request.body.last_error:isset = false && @request.body.last_delivered:isset = false",
+			"deleteRule": "@request.auth.id = user.id",
+			"fields": [
+				{
+					"autogeneratePattern": "[a-z0-9]{15}",
+					"hidden": false,
+					"id": "text3208210256",
+					"max": 15,
+					"min": 15,
+					"name": "id",
+					"pattern": "^[a-z0-9]+$",
+					"presentable": false,
+					"primaryKey": true,
+					"required": true,
+					"system": true,
+					"type": "text"
+				},
+				{
+					"cascadeDelete": true,
+					"collectionId": "_pb_users_auth_",
+					"hidden": false,
+					"id": "relation2375276105",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "user",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"cascadeDelete": true,
+					"collectionId": "pbc_3037694218",
+					"hidden": false,
+					"id": "relation3879679654",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "bucket",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text1579384326",
+					"max": 100,
+					"min": 0,
+					"name": "name",
+					"pattern": "",
+					"presentable": true,
+					"primaryKey": false,
+					"required": true,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"exceptDomains": [],
+					"hidden": false,
+					"id": "url4101391790",
+					"name": "url",
+					"onlyDomains": [],
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "url"
+				},
+				{
+					"hidden": false,
+					"id": "select2400845887",
+					"maxSelect": 11,
+					"name": "events",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "select",
+					"values": [
+						"bucket.created",
+						"bucket.deleted",
+						"delivery.failed",
+						"quota.exceeded",
+						"schema.drift",
+						"bucket.silent",
+						"bucket.recovered",
+						"bucket.volume_spike",
+						"bucket.volume_normal",
+						"forward.failing",
+						"forward.recovered"
+					]
+				},
+				{
+					"autogeneratePattern": "[a-zA-Z0-9]{40}",
+					"hidden": false,
+					"id": "text2979484034",
+					"max": 100,
+					"min": 20,
+					"name": "secret",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": false,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"hidden": false,
+					"id": "bool1260321794",
+					"name": "enabled",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "bool"
+				},
+				{
+					"hidden": false,
+					"id": "number3015245236",
+					"max": null,
+					"min": null,
+					"name": "last_status",
+					"onlyInt": true,
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "number"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text1574812785",
+					"max": 0,
+					"min": 0,
+					"name": "last_error",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": false,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"hidden": false,
+					"id": "date2138572395",
+					"max": "",
+					"min": "",
+					"name": "last_delivered",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "date"
+				},
+				{
+					"hidden": false,
+					"id": "autodate2990389176",
+					"name": "created",
+					"onCreate": true,
+					"onUpdate": false,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				},
+				{
+					"hidden": false,
+					"id": "autodate3332085495",
+					"name": "updated",
+					"onCreate": true,
+					"onUpdate": true,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				}
+			],
+			"id": "pbc_1570829342",
+			"indexes": [
+				"CREATE INDEX ` + "`" + `idx_Qw3nVb7pLs` + "`" + ` ON ` + "`" + `meta_webhooks` + "`" + ` (` + "`" + `user` + "`" + `)"
+			],
+			"listRule": "@request.auth.id = user.id",
+			"name": "meta_webhooks",
+			"system": false,
+			"type": "base",
+			"updateRule": "@request.auth.id = user.id && @request.body.user:isset = false && (bucket = \"\" || bucket.user.id = @request.auth.id) && @request.body.last_status:isset = false && @request.body.last_error:isset = false && @request.body.last_delivered:isset = false",
+			"viewRule": "@request.auth.id = user.id"
+		}`
+
+		collection := &core.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		buckets, err := app.FindCollectionByNameOrId("pbc_3037694218")
+		if err != nil {
+			return err
+		}
+
+		// Buckets can receive the meta-webhooks of another Splay.
+		// update field
+		if err := buckets.Fields.AddMarshaledJSONAt(6, []byte(`{
+			"hidden": false,
+			"id": "select2462348188",
+			"maxSelect": 1,
+			"name": "provider",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "select",
+			"values": [
+				"github",
+				"stripe",
+				"shopify",
+				"twilio",
+				"slack",
+				"splay"
+			]
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(buckets)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_1570829342")
+		if err != nil {
+			return err
+		}
+
+		if err := app.Delete(collection); err != nil {
+			return err
+		}
+
+		buckets, err := app.FindCollectionByNameOrId("pbc_3037694218")
+		if err != nil {
+			return err
+		}
+
+		// update field
+		if err := buckets.Fields.AddMarshaledJSONAt(6, []byte(`{
+			"hidden": false,
+			"id": "select2462348188",
+			"maxSelect": 1,
+			"name": "provider",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "select",
+			"values": [
+				"github",
+				"stripe",
+				"shopify",
+				"twilio",
+				"slack"
+			]
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(buckets)
+	})
+}
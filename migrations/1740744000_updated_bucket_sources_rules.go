@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		sources, err := app.FindCollectionByNameOrId("pbc_2001081480")
+		if err != nil {
+			return err
+		}
+
+		// The poll state is only ever set by the poller.
+		rule := "@request.auth.id = bucket.user.id && @request.body.etag:isset = false && @request.body.last_modified:isset = false && @request.body.last_polled:isset = false && @request.body.last_error:isset = false"
+		sources.CreateRule = types.Pointer(rule)
+		sources.UpdateRule = types.Pointer(rule)
+
+		return app.Save(sources)
+	}, func(app core.App) error {
+		sources, err := app.FindCollectionByNameOrId("pbc_2001081480")
+		if err != nil {
+			return err
+		}
+
+		sources.CreateRule = types.Pointer("@request.auth.id = bucket.user.id")
+		sources.UpdateRule = types.Pointer("@request.auth.id = bucket.user.id")
+
+		return app.Save(sources)
+	})
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		buckets, err := app.FindCollectionByNameOrId("pbc_3037694218")
+		if err != nil {
+			return err
+		}
+
+		// The silence state is only ever set by the monitor, a new bucket cannot start out silenced either.
+		buckets.CreateRule = types.Pointer("@request.auth.id = user.id && @request.body.silent:isset = false && @request.body.silent_since:isset = false")
+
+		return app.Save(buckets)
+	}, func(app core.App) error {
+		buckets, err := app.FindCollectionByNameOrId("pbc_3037694218")
+		if err != nil {
+			return err
+		}
+
+		buckets.CreateRule = types.Pointer("@request.auth.id = user.id")
+
+		return app.Save(buckets)
+	})
+}
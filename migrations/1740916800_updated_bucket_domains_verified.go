@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		domains, err := app.FindCollectionByNameOrId("pbc_1426857374")
+		if err != nil {
+			return err
+		}
+
+		// Only a verified claim owns a domain, pending claims of other users must not block it.
+		domains.RemoveIndex("idx_R2kdmQ7vXa")
+		domains.AddIndex("idx_R2kdmQ7vXa", true, "`domain`", "`verified` = TRUE")
+		domains.AddIndex("idx_Pw3nVc8kDy", false, "`domain`", "")
+
+		return app.Save(domains)
+	}, func(app core.App) error {
+		domains, err := app.FindCollectionByNameOrId("pbc_1426857374")
+		if err != nil {
+			return err
+		}
+
+		domains.RemoveIndex("idx_Pw3nVc8kDy")
+		domains.RemoveIndex("idx_R2kdmQ7vXa")
+		domains.AddIndex("idx_R2kdmQ7vXa", true, "`domain`", "")
+
+		return app.Save(domains)
+	})
+}
@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// migration runs a registered migration, the collections it changes are built in the test since
+// the collection snapshots cannot be decoded with the JSON v2 encoding the tests run with.
+func migration(t *testing.T, app core.App, file string) {
+	t.Helper()
+
+	for _, item := range core.AppMigrations.Items() {
+		if item.File == file {
+			if err := item.Up(app); err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+	}
+
+	t.Fatalf("missing migration %s", file)
+}
+
+func TestBucketDomainClaims(t *testing.T) {
+	app := core.NewBaseApp(core.BaseAppConfig{DataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := app.RunSystemMigrations(); err != nil {
+		t.Fatal(err)
+	}
+
+	domains := core.NewBaseCollection("bucket_domains", "pbc_1426857374")
+	domains.Fields.Add(&core.TextField{Name: "domain"}, &core.BoolField{Name: "verified"})
+	domains.AddIndex("idx_R2kdmQ7vXa", true, "`domain`", "")
+	if err := app.Save(domains); err != nil {
+		t.Fatal(err)
+	}
+
+	migration(t, app, "1740916800_updated_bucket_domains_verified.go")
+
+	claim := func(verified bool) error {
+		record := core.NewRecord(domains)
+		record.Set("domain", "hooks.example.com")
+		record.Set("verified", verified)
+		return app.Save(record)
+	}
+
+	// A squatter's pending claim does not keep the owner of the domain from claiming it.
+	if err := claim(false); err != nil {
+		t.Fatalf("first pending claim: %v", err)
+	}
+	if err := claim(false); err != nil {
+		t.Fatalf("second pending claim: %v", err)
+	}
+
+	if err := claim(true); err != nil {
+		t.Fatalf("verified claim: %v", err)
+	}
+	if err := claim(true); err == nil {
+		t.Fatal("second verified claim was saved")
+	}
+}
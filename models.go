@@ -0,0 +1,145 @@
+package main
+
+import (
+	"splay/pkg/schema"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+type BucketReceiveLog struct {
+	ID           string        `json:"id,omitempty" db:"id"`
+	Bucket       string        `json:"bucket,omitempty" db:"bucket"`
+	Body         types.JSONRaw `json:"body,omitempty" db:"body"`
+	BodyFile     string        `json:"body_file,omitempty" db:"body_file"`
+	BodySize     int64         `json:"body_size,omitempty" db:"body_size"`
+	Files        types.JSONRaw `json:"files,omitempty" db:"files"`
+	Attachments  types.JSONRaw `json:"attachments,omitempty" db:"attachments"`
+	Headers      types.JSONRaw `json:"headers,omitempty" db:"headers"`
+	IP           string        `json:"ip,omitempty" db:"ip"`
+	EventType    string        `json:"event_type,omitempty" db:"event_type"`
+	DeliveryID   string        `json:"delivery_id,omitempty" db:"delivery_id"`
+	SchemaStatus string        `json:"schema_status,omitempty" db:"schema_status"`
+	SchemaErrors types.JSONRaw `json:"schema_errors,omitempty" db:"schema_errors"`
+	Created      string        `json:"created,omitempty" db:"created"`
+	Updated      string        `json:"updated,omitempty" db:"updated"`
+}
+
+type BucketForwardLog struct {
+	ID               string    `json:"id,omitempty" db:"id"`
+	Bucket           string    `json:"bucket,omitempty" db:"bucket"`
+	BucketReceiveLog string    `json:"bucket_receive_log,omitempty" db:"bucket_receive_log"`
+	DestinationURL   string    `json:"destination_url,omitempty" db:"destination_url"`
+	Headers          string    `json:"headers,omitempty" db:"headers"`
+	Body             string    `json:"body,omitempty" db:"body"`
+	StatusCode       int       `json:"status_code,omitempty" db:"status_code"`
+	Created          time.Time `json:"created,omitempty" db:"created"`
+	Updated          time.Time `json:"updated,omitempty" db:"updated"`
+}
+
+type Bucket struct {
+	ID              string        `json:"id,omitempty" db:"id"`
+	Slug            string        `json:"slug,omitempty" db:"slug"`
+	Name            string        `json:"name,omitempty" db:"name"`
+	Description     string        `json:"description,omitempty" db:"description"`
+	UserID          string        `json:"user_id,omitempty" db:"user"`
+	Provider        string        `json:"provider,omitempty" db:"provider"`
+	ProviderSecret  string        `json:"-" db:"provider_secret"`
+	Schema          types.JSONRaw `json:"schema,omitempty" db:"schema"`
+	SchemaMode      string        `json:"schema_mode,omitempty" db:"schema_mode"`
+	DriftWebhookURL string        `json:"drift_webhook_url,omitempty" db:"drift_webhook_url"`
+	DriftEmail      string        `json:"drift_email,omitempty" db:"drift_email"`
+	RedactionRules  types.JSONRaw `json:"redaction_rules,omitempty" db:"redaction_rules"`
+	ForwardOriginal bool          `json:"forward_original,omitempty" db:"forward_original"`
+	MaxBodySize     int64         `json:"max_body_size,omitempty" db:"max_body_size"`
+	// AttachmentTypes are the media types multipart files may have, empty allows any.
+	AttachmentTypes   types.JSONRaw `json:"attachment_types,omitempty" db:"attachment_types"`
+	MaxAttachmentSize int64         `json:"max_attachment_size,omitempty" db:"max_attachment_size"`
+	// IPAllowlist and IPDenylist hold addresses, CIDR ranges or provider ranges like "provider:github".
+	IPAllowlist types.JSONRaw `json:"ip_allowlist,omitempty" db:"ip_allowlist"`
+	IPDenylist  types.JSONRaw `json:"ip_denylist,omitempty" db:"ip_denylist"`
+	// RateLimit is in requests per second, it and MonthlyQuota fall back to the configured defaults when zero
+	// and can only be lower than them.
+	RateLimit    float64 `json:"rate_limit,omitempty" db:"rate_limit"`
+	RateBurst    int     `json:"rate_burst,omitempty" db:"rate_burst"`
+	MonthlyQuota int64   `json:"monthly_quota,omitempty" db:"monthly_quota"`
+	// AcceptEmail lets the bucket receive events by email on the smtp server.
+	AcceptEmail bool `json:"accept_email,omitempty" db:"accept_email"`
+	// SilenceAfter in minutes and SilenceCron windows are the cadence the bucket is expected to receive events at.
+	SilenceAfter    int            `json:"silence_after,omitempty" db:"silence_after"`
+	SilenceCron     string         `json:"silence_cron,omitempty" db:"silence_cron"`
+	AlertWebhookURL string         `json:"alert_webhook_url,omitempty" db:"alert_webhook_url"`
+	AlertEmail      string         `json:"alert_email,omitempty" db:"alert_email"`
+	Silent          bool           `json:"silent,omitempty" db:"silent"`
+	SilentSince     types.DateTime `json:"silent_since" db:"silent_since"`
+	// VolumeAlertFactor alerts when a window holds that many times the usual events, FailureAlertRate when
+	// the share of failed deliveries to a forward setting reaches it. Zero disables either.
+	VolumeAlertFactor float64 `json:"volume_alert_factor,omitempty" db:"volume_alert_factor"`
+	FailureAlertRate  float64 `json:"failure_alert_rate,omitempty" db:"failure_alert_rate"`
+}
+
+// UserLimits are the ingest limits of a user across all of their buckets, set by superusers.
+type UserLimits struct {
+	RateLimit    float64 `json:"rate_limit" db:"rate_limit"`
+	RateBurst    int     `json:"rate_burst" db:"rate_burst"`
+	MonthlyQuota int64   `json:"monthly_quota" db:"monthly_quota"`
+}
+
+// Usage is the ingest usage of a bucket or user in a quota period.
+type Usage struct {
+	Bucket       string  `json:"bucket,omitempty"`
+	Slug         string  `json:"slug,omitempty"`
+	Events       int64   `json:"events"`
+	MonthlyQuota int64   `json:"monthly_quota"`
+	RateLimit    float64 `json:"rate_limit"`
+	RateBurst    int     `json:"rate_burst"`
+}
+
+// Attachment describes a multipart file stored in the files field of a receive log.
+type Attachment struct {
+	Field       string `json:"field"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	File        string `json:"file"`
+}
+
+type BucketSchema struct {
+	ID        string        `json:"id,omitempty" db:"id"`
+	Bucket    string        `json:"bucket,omitempty" db:"bucket"`
+	EventType string        `json:"event_type,omitempty" db:"event_type"`
+	Version   int           `json:"version,omitempty" db:"version"`
+	Shape     types.JSONRaw `json:"shape,omitempty" db:"shape"`
+}
+
+type SchemaDrift struct {
+	BucketID  string       `json:"bucket_id"`
+	EventType string       `json:"event_type"`
+	Version   int          `json:"version"`
+	Drift     schema.Drift `json:"drift"`
+}
+
+type ForwardSetting struct {
+	ID              string `json:"id,omitempty" db:"id"`
+	Name            string `json:"name,omitempty" db:"name"`
+	URL             string `json:"url,omitempty" db:"url"`
+	BucketID        string `json:"bucket_id,omitempty" db:"bucket"`
+	ContentEncoding string `json:"content_encoding,omitempty" db:"content_encoding"`
+}
+
+// BucketSource is a URL polled on a schedule, every new item becomes a receive log of the bucket.
+type BucketSource struct {
+	ID        string        `json:"id,omitempty" db:"id"`
+	BucketID  string        `json:"bucket_id,omitempty" db:"bucket"`
+	Name      string        `json:"name,omitempty" db:"name"`
+	Type      string        `json:"type,omitempty" db:"type"`
+	URL       string        `json:"url,omitempty" db:"url"`
+	Headers   types.JSONRaw `json:"-" db:"headers"`
+	Interval  int           `json:"interval,omitempty" db:"interval"`
+	ItemsPath string        `json:"items_path,omitempty" db:"items_path"`
+	ItemKey   string        `json:"item_key,omitempty" db:"item_key"`
+	// ETag and LastModified are the validators of the last fetched response, sent back as conditional headers.
+	ETag         string         `json:"-" db:"etag"`
+	LastModified string         `json:"-" db:"last_modified"`
+	LastPolled   types.DateTime `json:"last_polled" db:"last_polled"`
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/subscriptions"
+)
+
+type Notification struct {
+	UserID   string
+	BucketID string
+}
+
+func (f Notification) ID() string {
+	return f.UserID + "/" + f.BucketID
+}
+
+func (f Notification) Subscription() string {
+	return "users/" + f.UserID + "/buckets/" + f.BucketID + "/logs"
+}
+
+type User struct {
+}
+
+// LogSummary is a new receive log as pushed to realtime subscribers, bodies and headers are fetched on demand.
+type LogSummary struct {
+	ID           string `json:"id"`
+	EventType    string `json:"event_type,omitempty"`
+	DeliveryID   string `json:"delivery_id,omitempty"`
+	SchemaStatus string `json:"schema_status,omitempty"`
+	BodySize     int64  `json:"body_size"`
+	IP           string `json:"ip,omitempty"`
+	Created      string `json:"created"`
+}
+
+// ForwardSummary is the outcome of forwarding a receive log to a destination.
+type ForwardSummary struct {
+	ID               string `json:"id"`
+	BucketReceiveLog string `json:"bucket_receive_log"`
+	DestinationURL   string `json:"destination_url"`
+	StatusCode       int    `json:"status_code"`
+	Created          string `json:"created"`
+}
+
+// LogsMessage is sent on "users/<user>/buckets/<bucket>/logs" with everything that landed since the last one.
+type LogsMessage struct {
+	Logs     []LogSummary     `json:"logs"`
+	Forwards []ForwardSummary `json:"forwards"`
+}
+
+// LogFeed buffers log summaries per bucket while the notification of the bucket waits in the queue, so
+// every realtime message carries all logs coalesced within notificationTTL. Watchers of a bucket are
+// woken whenever logs land.
+type LogFeed struct {
+	mu       sync.Mutex
+	messages map[string]*LogsMessage
+	watchers map[string]map[chan struct{}]struct{}
+}
+
+func NewLogFeed() *LogFeed {
+	return &LogFeed{
+		messages: map[string]*LogsMessage{},
+		watchers: map[string]map[chan struct{}]struct{}{},
+	}
+}
+
+// Watch returns a channel that receives a value after logs of a bucket landed, and a function to stop watching.
+// Wakeups coalesce while the watcher is busy.
+func (f *LogFeed) Watch(bucketID string) (<-chan struct{}, func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	if f.watchers[bucketID] == nil {
+		f.watchers[bucketID] = map[chan struct{}]struct{}{}
+	}
+	f.watchers[bucketID][ch] = struct{}{}
+
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		delete(f.watchers[bucketID], ch)
+		if len(f.watchers[bucketID]) == 0 {
+			delete(f.watchers, bucketID)
+		}
+	}
+}
+
+// wake signals the watchers of a bucket, the lock must be held.
+func (f *LogFeed) wake(bucketID string) {
+	for ch := range f.watchers[bucketID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (f *LogFeed) message(bucketID string) *LogsMessage {
+	m, ok := f.messages[bucketID]
+	if !ok {
+		m = &LogsMessage{Logs: []LogSummary{}, Forwards: []ForwardSummary{}}
+		f.messages[bucketID] = m
+	}
+
+	return m
+}
+
+// AddLogs buffers the summaries of new receive logs of a bucket.
+func (f *LogFeed) AddLogs(bucketID string, brls []BucketReceiveLog) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m := f.message(bucketID)
+	for _, brl := range brls {
+		m.Logs = append(m.Logs, LogSummary{
+			ID:           brl.ID,
+			EventType:    brl.EventType,
+			DeliveryID:   brl.DeliveryID,
+			SchemaStatus: brl.SchemaStatus,
+			BodySize:     brl.BodySize,
+			IP:           brl.IP,
+			Created:      brl.Created,
+		})
+	}
+	f.wake(bucketID)
+}
+
+// AddForward buffers the outcome of a forward of a bucket.
+func (f *LogFeed) AddForward(bucketID string, forward ForwardSummary) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m := f.message(bucketID)
+	m.Forwards = append(m.Forwards, forward)
+	f.wake(bucketID)
+}
+
+// Take removes and returns the buffered summaries of a bucket, false when there are none.
+func (f *LogFeed) Take(bucketID string) (LogsMessage, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m, ok := f.messages[bucketID]
+	if !ok {
+		return LogsMessage{}, false
+	}
+	delete(f.messages, bucketID)
+
+	return *m, true
+}
+
+// Broadcast sends a realtime message to the clients of a user subscribed to subscription.
+func Broadcast(app *App, userID, subscription string, data []byte) {
+	for _, client := range app.SubscriptionsBroker().Clients() {
+		user, ok := client.Get(apis.RealtimeClientAuthKey).(*core.Record)
+		if !ok || user.Id != userID || !client.HasSubscription(subscription) {
+			continue
+		}
+
+		client.Send(subscriptions.Message{
+			Name: subscription,
+			Data: data,
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package anomaly
+
+import (
+	"sync"
+	"time"
+)
+
+// Kinds of anomalies, they double as incident kinds.
+const (
+	VolumeSpike = "volume_spike"
+	FailureRate = "failure_rate"
+)
+
+// Key identifies a series, the ingest volume of a bucket or the deliveries of one of its forward settings.
+type Key struct {
+	Bucket  string
+	Forward string
+}
+
+// Thresholds configure when a series is anomalous, zero values disable a check.
+type Thresholds struct {
+	// Factor flags a window holding Factor times the moving average of events.
+	Factor float64
+	// FailureRate flags a window whose share of failed events reaches it.
+	FailureRate float64
+}
+
+// Anomaly is a series entering or leaving an anomalous state when a window closes.
+type Anomaly struct {
+	Key
+	Kind     string
+	Resolved bool
+	Events   int64
+	Failures int64
+	Baseline float64
+	Rate     float64
+}
+
+type series struct {
+	events   int64
+	failures int64
+	baseline float64
+	windows  int
+	active   map[string]bool
+}
+
+// Detector keeps rolling counters per series and compares every closed window against its baseline.
+type Detector struct {
+	// Smoothing is the weight of the latest window in the exponential moving average.
+	Smoothing float64
+	// MinEvents is the least a window must hold before it is flagged, so quiet series stay silent.
+	MinEvents int64
+	// Warmup is how many windows are averaged before volume spikes are flagged.
+	Warmup int
+
+	mu     sync.Mutex
+	series map[Key]*series
+	rolled time.Time
+}
+
+func New(smoothing float64, minEvents int64, warmup int) *Detector {
+	return &Detector{
+		Smoothing: smoothing,
+		MinEvents: minEvents,
+		Warmup:    warmup,
+		series:    map[Key]*series{},
+	}
+}
+
+// Add counts events of a series in the current window, failures being the share of them that failed.
+func (d *Detector) Add(key Key, events, failures int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.series[key]
+	if !ok {
+		s = &series{active: map[string]bool{}}
+		d.series[key] = s
+	}
+
+	s.events += int64(events)
+	s.failures += int64(failures)
+}
+
+// Due reports whether the current window is at least every long, the first call starts the window.
+func (d *Detector) Due(now time.Time, every time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.rolled.IsZero() {
+		d.rolled = now
+		return false
+	}
+
+	return now.Sub(d.rolled) >= every
+}
+
+// Roll closes the current window of every series and returns the series whose state changed.
+// Series without thresholds are dropped, spikes are kept out of the baseline so they do not hide themselves.
+func (d *Detector) Roll(now time.Time, thresholds func(Key) Thresholds) []Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.rolled = now
+	anomalies := []Anomaly{}
+	for key, s := range d.series {
+		t := thresholds(key)
+		if t.Factor <= 0 && t.FailureRate <= 0 {
+			delete(d.series, key)
+			continue
+		}
+
+		if key.Forward == "" {
+			spike := t.Factor > 0 && s.windows >= d.Warmup && s.events >= d.MinEvents &&
+				float64(s.events) >= t.Factor*max(s.baseline, 1)
+			if a, changed := s.transition(key, VolumeSpike, spike); changed {
+				anomalies = append(anomalies, a)
+			}
+
+			if !spike {
+				if s.windows == 0 {
+					s.baseline = float64(s.events)
+				} else {
+					s.baseline += d.Smoothing * (float64(s.events) - s.baseline)
+				}
+				s.windows++
+			}
+		} else {
+			rate := 0.0
+			if s.events > 0 {
+				rate = float64(s.failures) / float64(s.events)
+			}
+
+			failing := t.FailureRate > 0 && s.events >= d.MinEvents && rate >= t.FailureRate
+			if a, changed := s.transition(key, FailureRate, failing); changed {
+				anomalies = append(anomalies, a)
+			}
+		}
+
+		s.events, s.failures = 0, 0
+	}
+
+	return anomalies
+}
+
+func (s *series) transition(key Key, kind string, anomalous bool) (Anomaly, bool) {
+	if anomalous == s.active[kind] {
+		return Anomaly{}, false
+	}
+	s.active[kind] = anomalous
+
+	rate := 0.0
+	if s.events > 0 {
+		rate = float64(s.failures) / float64(s.events)
+	}
+
+	return Anomaly{
+		Key:      key,
+		Kind:     kind,
+		Resolved: !anomalous,
+		Events:   s.events,
+		Failures: s.failures,
+		Baseline: s.baseline,
+		Rate:     rate,
+	}, true
+}
@@ -0,0 +1,173 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDue(t *testing.T) {
+	d := New(0.5, 1, 0)
+	start := time.Date(2025, 2, 3, 10, 0, 0, 0, time.UTC)
+
+	if d.Due(start.Add(time.Hour), time.Minute) {
+		t.Fatal("Due() of the first call = true, want false")
+	}
+
+	tests := []struct {
+		after time.Duration
+		want  bool
+	}{
+		{0, false},
+		{59 * time.Second, false},
+		{time.Minute, true},
+		{time.Hour, true},
+	}
+	for _, tt := range tests {
+		if got := d.Due(start.Add(time.Hour+tt.after), time.Minute); got != tt.want {
+			t.Errorf("Due(+%s) = %v, want %v", tt.after, got, tt.want)
+		}
+	}
+
+	d.Roll(start.Add(2*time.Hour), func(Key) Thresholds { return Thresholds{} })
+	if d.Due(start.Add(2*time.Hour+30*time.Second), time.Minute) {
+		t.Fatal("Due() right after Roll() = true, want false")
+	}
+}
+
+// window adds the events of every series and rolls a window, returning the anomalies keyed by kind.
+func window(d *Detector, now *time.Time, t Thresholds, counts map[Key][2]int) map[string]Anomaly {
+	for key, c := range counts {
+		d.Add(key, c[0], c[1])
+	}
+
+	*now = now.Add(time.Minute)
+	got := map[string]Anomaly{}
+	for _, a := range d.Roll(*now, func(Key) Thresholds { return t }) {
+		got[a.Bucket+"/"+a.Forward+"/"+a.Kind] = a
+	}
+	return got
+}
+
+func TestVolumeSpike(t *testing.T) {
+	d := New(0.5, 10, 2)
+	now := time.Date(2025, 2, 3, 10, 0, 0, 0, time.UTC)
+	th := Thresholds{Factor: 3}
+	key := Key{Bucket: "b1"}
+	name := "b1//" + VolumeSpike
+
+	steps := []struct {
+		events   int
+		spike    bool
+		resolved bool
+		baseline float64
+	}{
+		// Warmup windows are never flagged, however large.
+		{events: 10, baseline: 10},
+		{events: 100, baseline: 55},
+		{events: 40, baseline: 47.5},
+		// Spikes stay out of the baseline.
+		{events: 150, spike: true, baseline: 47.5},
+		{events: 200, baseline: 47.5},
+		{events: 50, resolved: true, baseline: 48.75},
+		{events: 60, baseline: 54.375},
+	}
+
+	for i, step := range steps {
+		got := window(d, &now, th, map[Key][2]int{key: {step.events, 0}})
+
+		a, changed := got[name]
+		switch {
+		case step.spike && (!changed || a.Resolved || a.Events != int64(step.events)):
+			t.Errorf("window %d: Roll() = %v, want a spike of %d events", i, got, step.events)
+		case step.resolved && (!changed || !a.Resolved):
+			t.Errorf("window %d: Roll() = %v, want a resolved spike", i, got)
+		case !step.spike && !step.resolved && changed:
+			t.Errorf("window %d: Roll() = %v, want no change", i, got)
+		}
+
+		if b := d.series[key].baseline; b != step.baseline {
+			t.Errorf("window %d: baseline = %v, want %v", i, b, step.baseline)
+		}
+	}
+}
+
+func TestVolumeSpikeMinEvents(t *testing.T) {
+	d := New(0.5, 10, 0)
+	now := time.Date(2025, 2, 3, 10, 0, 0, 0, time.UTC)
+	th := Thresholds{Factor: 2}
+	key := Key{Bucket: "b1"}
+
+	window(d, &now, th, map[Key][2]int{key: {1, 0}})
+	if got := window(d, &now, th, map[Key][2]int{key: {9, 0}}); len(got) != 0 {
+		t.Fatalf("Roll() below MinEvents = %v, want none", got)
+	}
+
+	if got := window(d, &now, th, map[Key][2]int{key: {100, 0}}); len(got) != 1 {
+		t.Fatalf("Roll() = %v, want a spike", got)
+	}
+}
+
+func TestFailureRate(t *testing.T) {
+	d := New(0.5, 4, 0)
+	now := time.Date(2025, 2, 3, 10, 0, 0, 0, time.UTC)
+	th := Thresholds{FailureRate: 0.5}
+	key := Key{Bucket: "b1", Forward: "f1"}
+	name := "b1/f1/" + FailureRate
+
+	steps := []struct {
+		events   int
+		failures int
+		failing  bool
+		resolved bool
+	}{
+		{events: 10, failures: 4},
+		// Too few events to judge the rate.
+		{events: 3, failures: 3},
+		{events: 10, failures: 5, failing: true},
+		{events: 10, failures: 9},
+		// An idle window resolves the failures.
+		{events: 0, failures: 0, resolved: true},
+	}
+
+	for i, step := range steps {
+		got := window(d, &now, th, map[Key][2]int{key: {step.events, step.failures}})
+
+		a, changed := got[name]
+		switch {
+		case step.failing && (!changed || a.Resolved || a.Rate != float64(step.failures)/float64(step.events)):
+			t.Errorf("window %d: Roll() = %v, want failures at %d/%d", i, got, step.failures, step.events)
+		case step.resolved && (!changed || !a.Resolved):
+			t.Errorf("window %d: Roll() = %v, want resolved failures", i, got)
+		case !step.failing && !step.resolved && changed:
+			t.Errorf("window %d: Roll() = %v, want no change", i, got)
+		}
+	}
+}
+
+func TestRollDropsSeries(t *testing.T) {
+	d := New(0.5, 1, 1)
+	now := time.Date(2025, 2, 3, 10, 0, 0, 0, time.UTC)
+	kept, dropped := Key{Bucket: "b1"}, Key{Bucket: "b2"}
+
+	d.Add(kept, 5, 0)
+	d.Add(dropped, 5, 0)
+	d.Roll(now, func(key Key) Thresholds {
+		if key == kept {
+			return Thresholds{Factor: 2}
+		}
+		return Thresholds{}
+	})
+
+	if _, ok := d.series[dropped]; ok {
+		t.Error("Roll() kept a series without thresholds")
+	}
+
+	s, ok := d.series[kept]
+	if !ok {
+		t.Fatal("Roll() dropped a series with thresholds")
+	}
+
+	if s.events != 0 || s.windows != 1 {
+		t.Errorf("Roll() left events = %d, windows = %d, want 0, 1", s.events, s.windows)
+	}
+}
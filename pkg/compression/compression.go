@@ -0,0 +1,277 @@
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	Identity = "identity"
+	Gzip     = "gzip"
+	Deflate  = "deflate"
+	Brotli   = "br"
+	Zstd     = "zstd"
+
+	// Prefix marks a compressed stored value, the version allows changing the scheme later.
+	Prefix = "zstd:v1:"
+
+	// MinSize is the smallest value worth compressing for storage.
+	MinSize = 1024
+)
+
+// Encodings lists the content codings accepted on ingest and when forwarding.
+var Encodings = []string{Gzip, Deflate, Brotli, Zstd}
+
+var (
+	ErrUnsupportedEncoding = errors.New("Unsupported content encoding")
+	ErrTooLarge            = errors.New("Decompressed body exceeds the size limit")
+	ErrTooCompressed       = errors.New("Decompressed body exceeds the compression ratio limit")
+	ErrCorrupt             = errors.New("Invalid compressed body")
+	ErrInvalidValue        = errors.New("Invalid compressed value")
+)
+
+// Limits guard decoding against decompression bombs, zero disables a limit.
+type Limits struct {
+	MaxSize  int64
+	MaxRatio int64
+}
+
+// Parse splits a Content-Encoding header into codings in the order they were applied.
+func Parse(header string) ([]string, error) {
+	codings := []string{}
+	for _, coding := range strings.Split(header, ",") {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		switch {
+		case coding == "" || coding == Identity:
+		case coding == "x-gzip":
+			codings = append(codings, Gzip)
+		case slices.Contains(Encodings, coding):
+			codings = append(codings, coding)
+		default:
+			return nil, errors.Join(ErrUnsupportedEncoding, errors.New(coding))
+		}
+	}
+
+	return codings, nil
+}
+
+// Decode reverses every coding of a Content-Encoding header.
+func Decode(header string, body []byte, limits Limits) ([]byte, error) {
+	r, err := NewDecoder(header, bytes.NewReader(body), limits)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// NewDecoder returns a reader reversing every coding of a Content-Encoding header while the body is
+// read. Reads fail with ErrTooLarge or ErrTooCompressed as soon as a coding crosses a limit, the ratio
+// is measured against the encoded bytes the coding consumed so far.
+func NewDecoder(header string, body io.Reader, limits Limits) (io.ReadCloser, error) {
+	codings, err := Parse(header)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &decoder{Reader: body}
+	for _, coding := range slices.Backward(codings) {
+		in := &countingReader{r: d.Reader}
+		r, err := NewReader(coding, in)
+		if err != nil {
+			d.Close()
+			return nil, errors.Join(ErrCorrupt, err)
+		}
+
+		d.closers = append(d.closers, r)
+		d.Reader = &limitedReader{r: r, in: in, limits: limits}
+	}
+
+	return d, nil
+}
+
+type decoder struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (d *decoder) Close() error {
+	errs := []error{}
+	for _, c := range slices.Backward(d.closers) {
+		errs = append(errs, c.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// limitedReader enforces the limits on the output of a single coding.
+type limitedReader struct {
+	r      io.Reader
+	in     *countingReader
+	limits Limits
+	out    int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.out += int64(n)
+
+	if l.limits.MaxSize > 0 && l.out > l.limits.MaxSize {
+		return 0, ErrTooLarge
+	}
+
+	if l.limits.MaxRatio > 0 && l.out > l.in.n*l.limits.MaxRatio {
+		return 0, ErrTooCompressed
+	}
+
+	if err != nil && err != io.EOF {
+		return n, errors.Join(ErrCorrupt, err)
+	}
+
+	return n, err
+}
+
+// NewReader returns a decompressing reader for a single coding.
+func NewReader(coding string, r io.Reader) (io.ReadCloser, error) {
+	switch coding {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Deflate:
+		// Deflate is zlib wrapped per RFC 9110, but plenty of senders use raw deflate.
+		buffered := bufio.NewReader(r)
+		if header, err := buffered.Peek(2); err == nil && isZlibHeader(header) {
+			return zlib.NewReader(buffered)
+		}
+		return flate.NewReader(buffered), nil
+	case Brotli:
+		return io.NopCloser(brotli.NewReader(r)), nil
+	case Zstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return nil, ErrUnsupportedEncoding
+	}
+}
+
+// NewWriter returns a compressing writer for a single coding, closing it flushes the stream.
+func NewWriter(coding string, w io.Writer) (io.WriteCloser, error) {
+	switch coding {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Deflate:
+		return zlib.NewWriter(w), nil
+	case Brotli:
+		return brotli.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, ErrUnsupportedEncoding
+	}
+}
+
+// Encode compresses a body with a single coding.
+func Encode(coding string, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := NewWriter(coding, &buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = w.Write(body); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// CompressJSON compresses a raw JSON document into a JSON string, so it still fits a JSON column.
+// Documents that are small or do not shrink are returned as is.
+func CompressJSON(raw []byte) ([]byte, error) {
+	if len(raw) < MinSize || IsCompressedJSON(raw) {
+		return raw, nil
+	}
+
+	compressed, err := Encode(Zstd, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := json.Marshal(Prefix + base64.RawStdEncoding.EncodeToString(compressed))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(value) >= len(raw) {
+		return raw, nil
+	}
+
+	return value, nil
+}
+
+// DecompressJSON reverses CompressJSON, raw JSON that is not compressed is returned as is.
+func DecompressJSON(raw []byte) ([]byte, error) {
+	if !IsCompressedJSON(raw) {
+		return raw, nil
+	}
+
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, errors.Join(ErrInvalidValue, err)
+	}
+
+	compressed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, Prefix))
+	if err != nil {
+		return nil, errors.Join(ErrInvalidValue, err)
+	}
+
+	r, err := NewReader(Zstd, bytes.NewReader(compressed))
+	if err != nil {
+		return nil, errors.Join(ErrInvalidValue, err)
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// IsCompressedJSON reports whether a raw JSON document holds a compressed value.
+func IsCompressedJSON(raw []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(raw), []byte(`"`+Prefix))
+}
+
+// isZlibHeader checks the CMF and FLG bytes of RFC 1950.
+func isZlibHeader(b []byte) bool {
+	return b[0]&0x0f == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
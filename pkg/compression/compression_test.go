@@ -0,0 +1,215 @@
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func encode(t *testing.T, coding string, body []byte) []byte {
+	t.Helper()
+
+	encoded, err := Encode(coding, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return encoded
+}
+
+// random returns incompressible data, encoded it stays about as large as it is.
+func random(t *testing.T, n int) []byte {
+	t.Helper()
+
+	raw := make([]byte, n)
+	if _, err := rand.Read(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	return []byte(base64.StdEncoding.EncodeToString(raw))
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+		err    error
+	}{
+		{header: "", want: []string{}},
+		{header: "identity", want: []string{}},
+		{header: "gzip", want: []string{Gzip}},
+		{header: "X-Gzip", want: []string{Gzip}},
+		{header: "deflate, br", want: []string{Deflate, Brotli}},
+		{header: " zstd ,identity", want: []string{Zstd}},
+		{header: "compress", err: ErrUnsupportedEncoding},
+		{header: "gzip, lzma", err: ErrUnsupportedEncoding},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, err := Parse(tt.header)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.err)
+			}
+
+			if err == nil && !slices.Equal(got, tt.want) {
+				t.Fatalf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	body := []byte(strings.Repeat(`{"event":"delivered"}`, 50))
+
+	var raw bytes.Buffer
+	w, err := flate.NewWriter(&raw, flate.DefaultCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(body)
+	w.Close()
+
+	tests := []struct {
+		name    string
+		header  string
+		encoded []byte
+	}{
+		{name: "identity", header: "", encoded: body},
+		{name: "gzip", header: "gzip", encoded: encode(t, Gzip, body)},
+		{name: "zlib deflate", header: "deflate", encoded: encode(t, Deflate, body)},
+		{name: "raw deflate", header: "deflate", encoded: raw.Bytes()},
+		{name: "brotli", header: "br", encoded: encode(t, Brotli, body)},
+		{name: "zstd", header: "zstd", encoded: encode(t, Zstd, body)},
+		{name: "stacked", header: "gzip, zstd", encoded: encode(t, Zstd, encode(t, Gzip, body))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.header, tt.encoded, Limits{MaxSize: int64(len(body)), MaxRatio: 100})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(got, body) {
+				t.Fatalf("Decode() = %q, want %q", got, body)
+			}
+		})
+	}
+}
+
+func TestDecodeBombs(t *testing.T) {
+	// A few kilobytes of compressed zeros expand to 64 MiB.
+	zeros := make([]byte, 64<<20)
+	incompressible := random(t, 64<<10)
+
+	tests := []struct {
+		name    string
+		header  string
+		encoded []byte
+		limits  Limits
+		want    error
+	}{
+		{name: "gzip ratio", header: "gzip", encoded: encode(t, Gzip, zeros), limits: Limits{MaxRatio: 100}, want: ErrTooCompressed},
+		{name: "deflate ratio", header: "deflate", encoded: encode(t, Deflate, zeros), limits: Limits{MaxRatio: 100}, want: ErrTooCompressed},
+		{name: "brotli ratio", header: "br", encoded: encode(t, Brotli, zeros), limits: Limits{MaxRatio: 100}, want: ErrTooCompressed},
+		{name: "zstd ratio", header: "zstd", encoded: encode(t, Zstd, zeros), limits: Limits{MaxRatio: 100}, want: ErrTooCompressed},
+		{name: "nested gzip ratio", header: "gzip, gzip", encoded: encode(t, Gzip, encode(t, Gzip, zeros)), limits: Limits{MaxRatio: 100}, want: ErrTooCompressed},
+		{name: "size", header: "gzip", encoded: encode(t, Gzip, incompressible), limits: Limits{MaxSize: 1 << 10}, want: ErrTooLarge},
+		{name: "size without ratio", header: "zstd", encoded: encode(t, Zstd, zeros), limits: Limits{MaxSize: 1 << 20}, want: ErrTooLarge},
+		{name: "within limits", header: "gzip", encoded: encode(t, Gzip, incompressible), limits: Limits{MaxSize: int64(len(incompressible)), MaxRatio: 2}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewDecoder(tt.header, bytes.NewReader(tt.encoded), tt.limits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			// Limits are enforced while reading, a bomb never expands into memory.
+			n, err := io.Copy(io.Discard, r)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("NewDecoder() read %d bytes, error = %v, want %v", n, err, tt.want)
+			}
+
+			if tt.limits.MaxSize > 0 && n > tt.limits.MaxSize {
+				t.Fatalf("NewDecoder() read %d bytes past the %d limit", n, tt.limits.MaxSize)
+			}
+		})
+	}
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	body := random(t, 4<<10)
+	truncated := encode(t, Gzip, body)
+	truncated = truncated[:len(truncated)/2]
+
+	tests := []struct {
+		name    string
+		header  string
+		encoded []byte
+	}{
+		{name: "not gzip", header: "gzip", encoded: []byte("plain text")},
+		{name: "truncated gzip", header: "gzip", encoded: truncated},
+		{name: "not zstd", header: "zstd", encoded: []byte("plain text")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.header, tt.encoded, Limits{}); !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("Decode() = %v, want %v", err, ErrCorrupt)
+			}
+		})
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		raw        []byte
+		compressed bool
+	}{
+		{name: "small", raw: []byte(`{"a":1}`), compressed: false},
+		{name: "repetitive", raw: []byte(`[` + strings.Repeat(`{"event":"delivered"},`, 100) + `{}]`), compressed: true},
+		{name: "incompressible", raw: []byte(`"` + string(random(t, 4<<10)) + `"`), compressed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := CompressJSON(tt.raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if IsCompressedJSON(value) != tt.compressed {
+				t.Fatalf("IsCompressedJSON(CompressJSON()) = %v, want %v", !tt.compressed, tt.compressed)
+			}
+
+			again, err := CompressJSON(value)
+			if err != nil || !bytes.Equal(again, value) {
+				t.Fatalf("CompressJSON() compressed a compressed value again")
+			}
+
+			got, err := DecompressJSON(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(got, tt.raw) {
+				t.Fatalf("DecompressJSON() = %s, want %s", got, tt.raw)
+			}
+		})
+	}
+
+	if _, err := DecompressJSON([]byte(`"` + Prefix + `!!!"`)); !errors.Is(err, ErrInvalidValue) {
+		t.Fatalf("DecompressJSON() of a bad value = %v, want %v", err, ErrInvalidValue)
+	}
+}
@@ -0,0 +1,172 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+const (
+	KeySize = 32
+
+	// Prefix marks an encrypted value, the version allows changing the scheme later.
+	Prefix = "enc:v1:"
+)
+
+var (
+	ErrInvalidKey        = errors.New("Encryption key must be 32 bytes encoded as base64 or hex")
+	ErrInvalidCiphertext = errors.New("Invalid ciphertext")
+	ErrDecrypting        = errors.New("Error decrypting value")
+)
+
+// ParseKey decodes a 32 byte key from base64 or hex.
+func ParseKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if key, err := base64.StdEncoding.DecodeString(s); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+
+	if key, err := hex.DecodeString(s); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+
+	return nil, ErrInvalidKey
+}
+
+// NewKey returns a random 32 byte key.
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// DeriveKey derives an independent key for a purpose from a key, so one secret can key several uses.
+func DeriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+
+	return mac.Sum(nil)
+}
+
+// EncodeKey encodes a key the way ParseKey expects it.
+func EncodeKey(key []byte) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// Wrap encrypts a data key with the master key.
+func Wrap(master, dataKey []byte) (string, error) {
+	return Encrypt(master, nil, dataKey)
+}
+
+// Unwrap decrypts a data key wrapped with the master key.
+func Unwrap(master []byte, wrapped string) ([]byte, error) {
+	key, err := Decrypt(master, nil, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+
+	return key, nil
+}
+
+// Encrypt seals plaintext with AES-256-GCM, aad binds the ciphertext to its owner.
+func Encrypt(key, aad, plaintext []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, aad)
+
+	return Prefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt.
+func Decrypt(key, aad []byte, value string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(value, Prefix)
+	if !ok {
+		return nil, ErrInvalidCiphertext
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidCiphertext, err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+	if err != nil {
+		return nil, errors.Join(ErrDecrypting, err)
+	}
+
+	return plaintext, nil
+}
+
+// EncryptJSON encrypts a raw JSON document into a JSON string, so it still fits a JSON column.
+func EncryptJSON(key, aad, raw []byte) ([]byte, error) {
+	value, err := Encrypt(key, aad, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(value)
+}
+
+// DecryptJSON reverses EncryptJSON, raw JSON that is not encrypted is returned as is.
+func DecryptJSON(key, aad, raw []byte) ([]byte, error) {
+	if !IsEncryptedJSON(raw) {
+		return raw, nil
+	}
+
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, errors.Join(ErrInvalidCiphertext, err)
+	}
+
+	return Decrypt(key, aad, value)
+}
+
+// IsEncryptedJSON reports whether a raw JSON document holds an encrypted value.
+func IsEncryptedJSON(raw []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(raw), []byte(`"`+Prefix))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,230 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newKey(t *testing.T) []byte {
+	t.Helper()
+
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func TestParseKey(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, KeySize)
+
+	tests := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{name: "base64", input: base64.StdEncoding.EncodeToString(key), want: nil},
+		{name: "hex", input: hex.EncodeToString(key), want: nil},
+		{name: "surrounding spaces", input: " " + EncodeKey(key) + "\n", want: nil},
+		{name: "too short", input: base64.StdEncoding.EncodeToString(key[:16]), want: ErrInvalidKey},
+		{name: "garbage", input: "not a key", want: ErrInvalidKey},
+		{name: "empty", input: "", want: ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseKey(tt.input)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ParseKey() error = %v, want %v", err, tt.want)
+			}
+
+			if err == nil && !bytes.Equal(got, key) {
+				t.Fatalf("ParseKey() = %x, want %x", got, key)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := newKey(t)
+
+	tests := []struct {
+		name      string
+		aad       []byte
+		plaintext []byte
+	}{
+		{name: "json", aad: []byte("bucket1"), plaintext: []byte(`{"a":1}`)},
+		{name: "empty", aad: []byte("bucket1"), plaintext: []byte{}},
+		{name: "no aad", aad: nil, plaintext: []byte("data key")},
+		{name: "binary", aad: []byte("bucket1"), plaintext: []byte{0, 1, 2, 255}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := Encrypt(key, tt.aad, tt.plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.HasPrefix(sealed, Prefix) {
+				t.Fatalf("Encrypt() = %q, want the %q prefix", sealed, Prefix)
+			}
+
+			again, err := Encrypt(key, tt.aad, tt.plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if sealed == again {
+				t.Fatal("Encrypt() reused a nonce")
+			}
+
+			opened, err := Decrypt(key, tt.aad, sealed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(opened, tt.plaintext) {
+				t.Fatalf("Decrypt() = %q, want %q", opened, tt.plaintext)
+			}
+		})
+	}
+}
+
+func TestTamper(t *testing.T) {
+	key := newKey(t)
+	aad := []byte("bucket1")
+
+	sealed, err := Encrypt(key, aad, []byte(`{"secret":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(sealed, Prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flip := func(i int) string {
+		tampered := bytes.Clone(raw)
+		tampered[i] ^= 1
+		return Prefix + base64.RawStdEncoding.EncodeToString(tampered)
+	}
+
+	tests := []struct {
+		name  string
+		key   []byte
+		aad   []byte
+		value string
+		want  error
+	}{
+		{name: "flipped nonce", key: key, aad: aad, value: flip(0), want: ErrDecrypting},
+		{name: "flipped ciphertext", key: key, aad: aad, value: flip(len(raw) / 2), want: ErrDecrypting},
+		{name: "flipped tag", key: key, aad: aad, value: flip(len(raw) - 1), want: ErrDecrypting},
+		{name: "other owner", key: key, aad: []byte("bucket2"), value: sealed, want: ErrDecrypting},
+		{name: "other key", key: newKey(t), aad: aad, value: sealed, want: ErrDecrypting},
+		{name: "truncated", key: key, aad: aad, value: Prefix + base64.RawStdEncoding.EncodeToString(raw[:4]), want: ErrInvalidCiphertext},
+		{name: "missing prefix", key: key, aad: aad, value: strings.TrimPrefix(sealed, Prefix), want: ErrInvalidCiphertext},
+		{name: "bad encoding", key: key, aad: aad, value: Prefix + "!!!", want: ErrInvalidCiphertext},
+		{name: "short key", key: key[:16], aad: aad, value: sealed, want: ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decrypt(tt.key, tt.aad, tt.value); !errors.Is(err, tt.want) {
+				t.Fatalf("Decrypt() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSON(t *testing.T) {
+	key := newKey(t)
+	aad := []byte("bucket1")
+	raw := []byte(`{"a":[1,2,3]}`)
+
+	encrypted, err := EncryptJSON(key, aad, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsEncryptedJSON(encrypted) {
+		t.Fatalf("IsEncryptedJSON(%s) = false", encrypted)
+	}
+
+	if IsEncryptedJSON(raw) {
+		t.Fatalf("IsEncryptedJSON(%s) = true", raw)
+	}
+
+	decrypted, err := DecryptJSON(key, aad, encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decrypted, raw) {
+		t.Fatalf("DecryptJSON() = %s, want %s", decrypted, raw)
+	}
+
+	// Plaintext written before encryption was enabled passes through.
+	passthrough, err := DecryptJSON(key, aad, raw)
+	if err != nil || !bytes.Equal(passthrough, raw) {
+		t.Fatalf("DecryptJSON(plaintext) = %s, %v, want %s", passthrough, err, raw)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	master, dataKey := newKey(t), newKey(t)
+
+	wrapped, err := Wrap(master, dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unwrapped, err := Unwrap(master, wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(unwrapped, dataKey) {
+		t.Fatalf("Unwrap() = %x, want %x", unwrapped, dataKey)
+	}
+
+	if _, err = Unwrap(newKey(t), wrapped); !errors.Is(err, ErrDecrypting) {
+		t.Fatalf("Unwrap() with another master key = %v, want %v", err, ErrDecrypting)
+	}
+
+	short, err := Encrypt(master, nil, dataKey[:16])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = Unwrap(master, short); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("Unwrap() of a short key = %v, want %v", err, ErrInvalidKey)
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	key := newKey(t)
+
+	first, second := DeriveKey(key, "redaction"), DeriveKey(key, "redaction")
+	if !bytes.Equal(first, second) {
+		t.Fatal("DeriveKey() is not deterministic")
+	}
+
+	if len(first) != KeySize {
+		t.Fatalf("len(DeriveKey()) = %d, want %d", len(first), KeySize)
+	}
+
+	if bytes.Equal(first, DeriveKey(key, "bucket1")) {
+		t.Fatal("DeriveKey() returned the same key for different purposes")
+	}
+
+	if bytes.Equal(first, DeriveKey(newKey(t), "redaction")) {
+		t.Fatal("DeriveKey() returned the same key for different keys")
+	}
+}
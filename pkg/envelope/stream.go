@@ -0,0 +1,203 @@
+package envelope
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// StreamPrefix marks a stream encrypted by NewWriter, such streams are binary unlike values of Encrypt.
+	StreamPrefix = "enc:s1:"
+
+	chunkSize       = 64 << 10
+	noncePrefixSize = 7
+)
+
+// Streams are cut into chunks sealed with AES-256-GCM under nonces made of a random prefix, the chunk
+// counter and a flag marking the last chunk, so chunks cannot be reordered, dropped or truncated.
+type streamNonce struct {
+	prefix  [noncePrefixSize]byte
+	counter uint32
+}
+
+func (n *streamNonce) next(last bool) ([]byte, error) {
+	if n.counter == ^uint32(0) {
+		return nil, ErrInvalidCiphertext
+	}
+
+	nonce := make([]byte, 0, noncePrefixSize+5)
+	nonce = append(nonce, n.prefix[:]...)
+	nonce = binary.BigEndian.AppendUint32(nonce, n.counter)
+	if last {
+		nonce = append(nonce, 1)
+	} else {
+		nonce = append(nonce, 0)
+	}
+	n.counter++
+
+	return nonce, nil
+}
+
+type streamWriter struct {
+	w      io.Writer
+	gcm    cipher.AEAD
+	aad    []byte
+	nonce  streamNonce
+	buf    []byte
+	closed bool
+}
+
+// NewWriter returns a writer encrypting everything written to it into w, Close seals the last chunk
+// and must be called for the stream to be readable.
+func NewWriter(w io.Writer, key, aad []byte) (io.WriteCloser, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sw := &streamWriter{w: w, gcm: gcm, aad: aad, buf: make([]byte, 0, chunkSize)}
+	if _, err = rand.Read(sw.nonce.prefix[:]); err != nil {
+		return nil, err
+	}
+
+	if _, err = io.WriteString(w, StreamPrefix); err != nil {
+		return nil, err
+	}
+
+	if _, err = w.Write(sw.nonce.prefix[:]); err != nil {
+		return nil, err
+	}
+
+	return sw, nil
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	if sw.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data arrives, the last chunk is sealed by Close.
+		if len(sw.buf) == chunkSize {
+			if err := sw.seal(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(sw.buf[len(sw.buf):chunkSize], p)
+		sw.buf = sw.buf[:len(sw.buf)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+func (sw *streamWriter) Close() error {
+	if sw.closed {
+		return nil
+	}
+	sw.closed = true
+
+	return sw.seal(true)
+}
+
+func (sw *streamWriter) seal(last bool) error {
+	nonce, err := sw.nonce.next(last)
+	if err != nil {
+		return err
+	}
+
+	if _, err = sw.w.Write(sw.gcm.Seal(nil, nonce, sw.buf, sw.aad)); err != nil {
+		return err
+	}
+	sw.buf = sw.buf[:0]
+
+	return nil
+}
+
+type streamReader struct {
+	r     *bufio.Reader
+	gcm   cipher.AEAD
+	aad   []byte
+	nonce streamNonce
+	chunk []byte
+	plain []byte
+	done  bool
+}
+
+// NewReader decrypts a stream written by NewWriter. Chunks are authenticated before they are returned,
+// reading a tampered or truncated stream fails with ErrDecrypting or ErrInvalidCiphertext.
+func NewReader(r io.Reader, key, aad []byte) (io.Reader, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sr := &streamReader{r: bufio.NewReader(r), gcm: gcm, aad: aad, chunk: make([]byte, chunkSize+gcm.Overhead())}
+
+	header := make([]byte, len(StreamPrefix)+noncePrefixSize)
+	if _, err = io.ReadFull(sr.r, header); err != nil || string(header[:len(StreamPrefix)]) != StreamPrefix {
+		return nil, ErrInvalidCiphertext
+	}
+	copy(sr.nonce.prefix[:], header[len(StreamPrefix):])
+
+	return sr, nil
+}
+
+func (sr *streamReader) Read(p []byte) (int, error) {
+	for len(sr.plain) == 0 {
+		if sr.done {
+			return 0, io.EOF
+		}
+
+		if err := sr.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, sr.plain)
+	sr.plain = sr.plain[n:]
+
+	return n, nil
+}
+
+func (sr *streamReader) open() error {
+	n, err := io.ReadFull(sr.r, sr.chunk)
+	switch {
+	case errors.Is(err, io.EOF):
+		// Every stream ends with a sealed last chunk, even an empty one.
+		return ErrInvalidCiphertext
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		sr.done = true
+	case err != nil:
+		return err
+	default:
+		if _, err := sr.r.Peek(1); errors.Is(err, io.EOF) {
+			sr.done = true
+		}
+	}
+
+	nonce, err := sr.nonce.next(sr.done)
+	if err != nil {
+		return err
+	}
+
+	plain, err := sr.gcm.Open(sr.chunk[:0], nonce, sr.chunk[:n], sr.aad)
+	if err != nil {
+		return errors.Join(ErrDecrypting, err)
+	}
+	sr.plain = plain
+
+	return nil
+}
+
+// IsStream reports whether data starts like a stream written by NewWriter.
+func IsStream(head []byte) bool {
+	return len(head) >= len(StreamPrefix) && string(head[:len(StreamPrefix)]) == StreamPrefix
+}
@@ -0,0 +1,125 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func seal(t *testing.T, key, aad, plaintext []byte) []byte {
+	t.Helper()
+
+	var sealed bytes.Buffer
+	w, err := NewWriter(&sealed, key, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = w.Write(plaintext); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return sealed.Bytes()
+}
+
+func open(key, aad, sealed []byte) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(sealed), key, aad)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	key := newKey(t)
+	aad := []byte("bucket1")
+
+	large := make([]byte, 3*chunkSize+17)
+	if _, err := rand.Read(large); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		plaintext []byte
+	}{
+		{name: "empty", plaintext: []byte{}},
+		{name: "small", plaintext: []byte(`{"a":1}`)},
+		{name: "exact chunk", plaintext: large[:chunkSize]},
+		{name: "several chunks", plaintext: large},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed := seal(t, key, aad, tt.plaintext)
+			if !IsStream(sealed) {
+				t.Fatalf("IsStream() = false for %q", sealed[:len(StreamPrefix)])
+			}
+
+			opened, err := open(key, aad, sealed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(opened, tt.plaintext) {
+				t.Fatalf("NewReader() read %d bytes, want %d", len(opened), len(tt.plaintext))
+			}
+		})
+	}
+}
+
+func TestStreamTamper(t *testing.T) {
+	key := newKey(t)
+	aad := []byte("bucket1")
+
+	plaintext := bytes.Repeat([]byte("x"), 2*chunkSize+5)
+	sealed := seal(t, key, aad, plaintext)
+	header := len(StreamPrefix) + noncePrefixSize
+	chunk := chunkSize + 16
+
+	flip := func(i int) []byte {
+		tampered := bytes.Clone(sealed)
+		tampered[i] ^= 1
+		return tampered
+	}
+
+	// Swapping the first two full chunks keeps every chunk intact but out of order.
+	swapped := bytes.Clone(sealed)
+	copy(swapped[header:], sealed[header+chunk:header+2*chunk])
+	copy(swapped[header+chunk:], sealed[header:header+chunk])
+
+	tests := []struct {
+		name   string
+		key    []byte
+		aad    []byte
+		sealed []byte
+		want   error
+	}{
+		{name: "flipped nonce prefix", key: key, aad: aad, sealed: flip(len(StreamPrefix)), want: ErrDecrypting},
+		{name: "flipped first chunk", key: key, aad: aad, sealed: flip(header + 10), want: ErrDecrypting},
+		{name: "flipped last chunk", key: key, aad: aad, sealed: flip(len(sealed) - 1), want: ErrDecrypting},
+		{name: "reordered chunks", key: key, aad: aad, sealed: swapped, want: ErrDecrypting},
+		{name: "truncated to full chunks", key: key, aad: aad, sealed: sealed[:header+2*chunk], want: ErrDecrypting},
+		{name: "truncated inside a chunk", key: key, aad: aad, sealed: sealed[:header+chunk+100], want: ErrDecrypting},
+		{name: "header only", key: key, aad: aad, sealed: sealed[:header], want: ErrInvalidCiphertext},
+		{name: "missing prefix", key: key, aad: aad, sealed: sealed[len(StreamPrefix):], want: ErrInvalidCiphertext},
+		{name: "other owner", key: key, aad: []byte("bucket2"), sealed: sealed, want: ErrDecrypting},
+		{name: "other key", key: newKey(t), aad: aad, sealed: sealed, want: ErrDecrypting},
+		{name: "short key", key: key[:16], aad: aad, sealed: sealed, want: ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := open(tt.key, tt.aad, tt.sealed); !errors.Is(err, tt.want) {
+				t.Fatalf("NewReader() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
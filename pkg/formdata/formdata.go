@@ -0,0 +1,279 @@
+package formdata
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const defaultContentType = "application/octet-stream"
+
+// quoteEscaper escapes quoted parameters the way multipart.Writer.CreateFormFile does.
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+var (
+	ErrNotMultipart    = errors.New("Request is not multipart/form-data")
+	ErrNotURLEncoded   = errors.New("Request is not application/x-www-form-urlencoded")
+	ErrInvalidForm     = errors.New("Invalid multipart form")
+	ErrFileTooLarge    = errors.New("Uploaded file exceeds the size limit")
+	ErrTooManyFiles    = errors.New("Too many uploaded files")
+	ErrFileTypeRefused = errors.New("Uploaded file type is not allowed")
+)
+
+// Limits restrict the files of a form, zero values disable a limit.
+type Limits struct {
+	MaxFileSize int64
+	MaxFiles    int
+	// Types are allowed media types, "image/*" style wildcards match a whole top level type.
+	Types []string
+}
+
+// File is an uploaded file of a form.
+type File struct {
+	Field       string
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Form is a parsed multipart/form-data or application/x-www-form-urlencoded body. Fields hold a
+// string per field, or a list of strings when a field is repeated, so they can be stored like a JSON body.
+type Form struct {
+	Boundary string
+	Fields   map[string]any
+	Files    []File
+	// Values are the fields of an url encoded form, nil for multipart forms.
+	Values url.Values
+}
+
+// Boundary returns the boundary of a multipart/form-data content type.
+func Boundary(contentType string) (string, bool) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return "", false
+	}
+
+	return params["boundary"], true
+}
+
+// IsURLEncoded reports whether a content type is application/x-www-form-urlencoded.
+func IsURLEncoded(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/x-www-form-urlencoded"
+}
+
+// ParseURLEncoded reads an application/x-www-form-urlencoded body, such forms carry no files.
+func ParseURLEncoded(contentType string, body []byte) (*Form, error) {
+	if !IsURLEncoded(contentType) {
+		return nil, ErrNotURLEncoded
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, errors.Join(ErrInvalidForm, err)
+	}
+
+	form := &Form{Fields: map[string]any{}, Values: values}
+	for name, list := range values {
+		for _, value := range list {
+			form.add(name, value)
+		}
+	}
+
+	return form, nil
+}
+
+// Encode writes fields back as an application/x-www-form-urlencoded body, sorted by key.
+func Encode(fields map[string]any) []byte {
+	values := url.Values{}
+	for key, field := range fields {
+		list, ok := field.([]any)
+		if !ok {
+			list = []any{field}
+		}
+
+		for _, value := range list {
+			if s, ok := value.(string); ok {
+				values.Add(key, s)
+			}
+		}
+	}
+
+	return []byte(values.Encode())
+}
+
+// Parse reads a multipart/form-data body.
+func Parse(contentType string, body io.Reader, limits Limits) (*Form, error) {
+	boundary, ok := Boundary(contentType)
+	if !ok {
+		return nil, ErrNotMultipart
+	}
+
+	form := &Form{Boundary: boundary, Fields: map[string]any{}}
+	r := multipart.NewReader(body, boundary)
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			return form, nil
+		}
+		if err != nil {
+			return nil, errors.Join(ErrInvalidForm, err)
+		}
+
+		name := part.FormName()
+		if name == "" {
+			continue
+		}
+
+		if part.FileName() == "" {
+			value, err := io.ReadAll(part)
+			if err != nil {
+				return nil, errors.Join(ErrInvalidForm, err)
+			}
+			form.add(name, string(value))
+			continue
+		}
+
+		if limits.MaxFiles > 0 && len(form.Files) >= limits.MaxFiles {
+			return nil, ErrTooManyFiles
+		}
+
+		contentType := part.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = defaultContentType
+		}
+
+		if !Allowed(limits.Types, contentType) {
+			return nil, errors.Join(ErrFileTypeRefused, errors.New(contentType))
+		}
+
+		reader := io.Reader(part)
+		if limits.MaxFileSize > 0 {
+			reader = io.LimitReader(part, limits.MaxFileSize+1)
+		}
+
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, errors.Join(ErrInvalidForm, err)
+		}
+
+		if limits.MaxFileSize > 0 && int64(len(data)) > limits.MaxFileSize {
+			return nil, ErrFileTooLarge
+		}
+
+		form.Files = append(form.Files, File{
+			Field:       name,
+			Filename:    path.Base(part.FileName()),
+			ContentType: contentType,
+			Data:        data,
+		})
+	}
+}
+
+func (f *Form) add(name, value string) {
+	switch existing := f.Fields[name].(type) {
+	case nil:
+		f.Fields[name] = value
+	case []any:
+		f.Fields[name] = append(existing, value)
+	default:
+		f.Fields[name] = []any{existing, value}
+	}
+}
+
+// Allowed reports whether a content type matches one of the allowed types, an empty list allows all.
+func Allowed(types []string, contentType string) bool {
+	if len(types) == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, allowed := range types {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == mediaType || allowed == "*/*" {
+			return true
+		}
+
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Opener opens the content of a stored file when the form is rebuilt.
+type Opener func() (io.ReadCloser, error)
+
+// Part is a file to write when rebuilding a form.
+type Part struct {
+	Field       string
+	Filename    string
+	ContentType string
+	Open        Opener
+}
+
+// Write rebuilds a form with the given boundary, fields first in key order and then the files.
+func Write(w io.Writer, boundary string, fields map[string]any, keys []string, files []Part) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		values, ok := fields[key].([]any)
+		if !ok {
+			values = []any{fields[key]}
+		}
+
+		for _, value := range values {
+			s, ok := value.(string)
+			if !ok {
+				continue
+			}
+
+			if err := mw.WriteField(key, s); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, file := range files {
+		if err := writeFile(mw, file); err != nil {
+			return err
+		}
+	}
+
+	return mw.Close()
+}
+
+func writeFile(mw *multipart.Writer, file Part) error {
+	r, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoteEscaper.Replace(file.Field), quoteEscaper.Replace(file.Filename)))
+	header.Set("Content-Type", file.ContentType)
+
+	pw, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(pw, r)
+
+	return err
+}
@@ -0,0 +1,248 @@
+package formdata
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testFile struct {
+	field, filename, contentType, data string
+}
+
+// multipartBody builds a form with the fields in order and then the files.
+func multipartBody(t *testing.T, fields [][2]string, files []testFile) (string, []byte) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, f := range fields {
+		if err := mw.WriteField(f[0], f[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, f := range files {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="`+f.field+`"; filename="`+f.filename+`"`)
+		if f.contentType != "" {
+			header.Set("Content-Type", f.contentType)
+		}
+
+		w, err := mw.CreatePart(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = io.WriteString(w, f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return mw.FormDataContentType(), buf.Bytes()
+}
+
+func TestParse(t *testing.T) {
+	png := testFile{"logo", "logo.png", "image/png", "png data"}
+	pdf := testFile{"doc", "../../etc/report.pdf", "application/pdf", "pdf data"}
+
+	tests := []struct {
+		name   string
+		fields [][2]string
+		files  []testFile
+		limits Limits
+		want   map[string]any
+		names  []string
+		err    error
+	}{
+		{
+			name:   "fields",
+			fields: [][2]string{{"a", "1"}, {"b", "2"}, {"a", "3"}},
+			want:   map[string]any{"a": []any{"1", "3"}, "b": "2"},
+		},
+		{
+			name:   "files without limits",
+			fields: [][2]string{{"a", "1"}},
+			files:  []testFile{png, pdf},
+			want:   map[string]any{"a": "1"},
+			names:  []string{"logo.png", "report.pdf"},
+		},
+		{
+			name:   "file at the size limit",
+			files:  []testFile{png},
+			limits: Limits{MaxFileSize: int64(len(png.data))},
+			want:   map[string]any{},
+			names:  []string{"logo.png"},
+		},
+		{
+			name:   "file over the size limit",
+			files:  []testFile{png},
+			limits: Limits{MaxFileSize: int64(len(png.data)) - 1},
+			err:    ErrFileTooLarge,
+		},
+		{
+			name:   "files at the count limit",
+			files:  []testFile{png, pdf},
+			limits: Limits{MaxFiles: 2},
+			want:   map[string]any{},
+			names:  []string{"logo.png", "report.pdf"},
+		},
+		{
+			name:   "files over the count limit",
+			files:  []testFile{png, pdf},
+			limits: Limits{MaxFiles: 1},
+			err:    ErrTooManyFiles,
+		},
+		{
+			name:   "allowed type by wildcard",
+			files:  []testFile{png},
+			limits: Limits{Types: []string{"image/*"}},
+			want:   map[string]any{},
+			names:  []string{"logo.png"},
+		},
+		{
+			name:   "refused type",
+			files:  []testFile{png, pdf},
+			limits: Limits{Types: []string{"image/*"}},
+			err:    ErrFileTypeRefused,
+		},
+		{
+			name:   "missing content type is octet-stream",
+			files:  []testFile{{"blob", "blob.bin", "", "x"}},
+			limits: Limits{Types: []string{"image/png"}},
+			err:    ErrFileTypeRefused,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType, body := multipartBody(t, tt.fields, tt.files)
+			form, err := Parse(contentType, bytes.NewReader(body), tt.limits)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(form.Fields, tt.want) {
+				t.Fatalf("Parse() fields = %v, want %v", form.Fields, tt.want)
+			}
+
+			names := []string{}
+			for _, f := range form.Files {
+				names = append(names, f.Filename)
+			}
+			if len(tt.names) > 0 && !reflect.DeepEqual(names, tt.names) {
+				t.Fatalf("Parse() files = %v, want %v", names, tt.names)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		err         error
+	}{
+		{"json", "application/json", "{}", ErrNotMultipart},
+		{"missing boundary", "multipart/form-data", "", ErrNotMultipart},
+		{"truncated", "multipart/form-data; boundary=xyz", "--xyz\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\nvalue", ErrInvalidForm},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.contentType, strings.NewReader(tt.body), Limits{}); !errors.Is(err, tt.err) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		types       []string
+		contentType string
+		want        bool
+	}{
+		{nil, "application/pdf", true},
+		{[]string{"application/pdf"}, "application/pdf", true},
+		{[]string{" Application/PDF "}, "application/pdf; name=x.pdf", true},
+		{[]string{"image/*"}, "image/png", true},
+		{[]string{"image/*"}, "imagex/png", false},
+		{[]string{"*/*"}, "text/plain", true},
+		{[]string{"image/png"}, "image/jpeg", false},
+		{[]string{"image/png"}, "not a type", false},
+	}
+
+	for _, tt := range tests {
+		if got := Allowed(tt.types, tt.contentType); got != tt.want {
+			t.Errorf("Allowed(%v, %q) = %v, want %v", tt.types, tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestURLEncoded(t *testing.T) {
+	const contentType = "application/x-www-form-urlencoded; charset=utf-8"
+	form, err := ParseURLEncoded(contentType, []byte("b=2&a=1&a=%2B3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{"a": []any{"1", "+3"}, "b": "2"}
+	if !reflect.DeepEqual(form.Fields, want) {
+		t.Fatalf("ParseURLEncoded() fields = %v, want %v", form.Fields, want)
+	}
+
+	if got := string(Encode(form.Fields)); got != "a=1&a=%2B3&b=2" {
+		t.Fatalf("Encode() = %q", got)
+	}
+
+	if _, err = ParseURLEncoded("application/json", nil); !errors.Is(err, ErrNotURLEncoded) {
+		t.Fatalf("ParseURLEncoded() error = %v, want %v", err, ErrNotURLEncoded)
+	}
+
+	if _, err = ParseURLEncoded(contentType, []byte("a=%zz")); !errors.Is(err, ErrInvalidForm) {
+		t.Fatalf("ParseURLEncoded() error = %v, want %v", err, ErrInvalidForm)
+	}
+}
+
+// A rebuilt form keeps the original boundary, so the Content-Type header of the request still describes it.
+func TestWriteReusesBoundary(t *testing.T) {
+	contentType, body := multipartBody(t, [][2]string{{"a", "1"}, {"a", "2"}, {"b", "3"}}, []testFile{{"logo", `lo"go.png`, "image/png", "png data"}})
+	form, err := Parse(contentType, bytes.NewReader(body), Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := []Part{}
+	for _, f := range form.Files {
+		parts = append(parts, Part{Field: f.Field, Filename: f.Filename, ContentType: f.ContentType, Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(f.Data)), nil
+		}})
+	}
+
+	var rebuilt bytes.Buffer
+	if err = Write(&rebuilt, form.Boundary, form.Fields, []string{"a", "b"}, parts); err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := Parse(contentType, &rebuilt, Limits{})
+	if err != nil {
+		t.Fatalf("Parse() of the rebuilt form with the original content type: %v", err)
+	}
+
+	if !reflect.DeepEqual(again.Fields, form.Fields) || !reflect.DeepEqual(again.Files, form.Files) {
+		t.Fatalf("rebuilt form = %+v, want %+v", again, form)
+	}
+}
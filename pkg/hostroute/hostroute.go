@@ -0,0 +1,85 @@
+package hostroute
+
+import (
+	"context"
+	"errors"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	// ChallengePrefix is the label under which the verification TXT record of a domain lives.
+	ChallengePrefix = "_splay-challenge."
+	// ValuePrefix starts the value of a verification TXT record.
+	ValuePrefix = "splay-verification="
+)
+
+var (
+	ErrInvalidDomain = errors.New("Invalid domain name")
+	ErrNotVerified   = errors.New("Verification TXT record not found")
+)
+
+// domainPattern matches a lower case host name of at least two labels.
+var domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Normalize lower cases a Host header and strips its port and trailing dot.
+func Normalize(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+// ParseDomain normalizes a custom domain and checks it is a plain host name.
+func ParseDomain(domain string) (string, error) {
+	domain = Normalize(domain)
+	if len(domain) > 253 || !domainPattern.MatchString(domain) {
+		return "", errors.Join(ErrInvalidDomain, errors.New(domain))
+	}
+
+	return domain, nil
+}
+
+// Subdomain returns the single label in front of the base domain, like "orders" for
+// "orders.hooks.example.com" with base "hooks.example.com".
+func Subdomain(host, base string) (string, bool) {
+	base = Normalize(base)
+	if base == "" {
+		return "", false
+	}
+
+	label, ok := strings.CutSuffix(Normalize(host), "."+base)
+	if !ok || label == "" || strings.Contains(label, ".") {
+		return "", false
+	}
+
+	return label, true
+}
+
+// Record returns the name and value of the TXT record proving control of a domain.
+func Record(domain, token string) (string, string) {
+	return ChallengePrefix + domain, ValuePrefix + token
+}
+
+// Resolver looks up TXT records, *net.Resolver satisfies it.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Verify checks that the verification TXT record of a domain carries the token.
+func Verify(ctx context.Context, resolver Resolver, domain, token string) error {
+	name, value := Record(domain, token)
+	records, err := resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return errors.Join(ErrNotVerified, err)
+	}
+
+	if !slices.Contains(records, value) {
+		return ErrNotVerified
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package hostroute
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"Hooks.Example.COM", "hooks.example.com"},
+		{"hooks.example.com:8443", "hooks.example.com"},
+		{"hooks.example.com.", "hooks.example.com"},
+		{" hooks.example.com ", "hooks.example.com"},
+		{"[::1]:80", "::1"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.host); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestParseDomain(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   string
+		err    error
+	}{
+		{domain: "Hooks.Example.com.", want: "hooks.example.com"},
+		{domain: "a-b.example.co", want: "a-b.example.co"},
+		{domain: "xn--bcher-kva.example", want: "xn--bcher-kva.example"},
+		{domain: "localhost", err: ErrInvalidDomain},
+		{domain: "203.0.113.7", err: ErrInvalidDomain},
+		{domain: "-bad.example.com", err: ErrInvalidDomain},
+		{domain: "bad-.example.com", err: ErrInvalidDomain},
+		{domain: "under_score.example.com", err: ErrInvalidDomain},
+		{domain: "*.example.com", err: ErrInvalidDomain},
+		{domain: "https://example.com", err: ErrInvalidDomain},
+		{domain: strings.Repeat("a", 64) + ".example.com", err: ErrInvalidDomain},
+		{domain: strings.Repeat("abcdefghi.", 26) + "com", err: ErrInvalidDomain},
+		{domain: "", err: ErrInvalidDomain},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			got, err := ParseDomain(tt.domain)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ParseDomain() error = %v, want %v", err, tt.err)
+			}
+
+			if got != tt.want {
+				t.Fatalf("ParseDomain() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubdomain(t *testing.T) {
+	tests := []struct {
+		host  string
+		base  string
+		label string
+		ok    bool
+	}{
+		{"orders.hooks.example.com", "hooks.example.com", "orders", true},
+		{"Orders.Hooks.Example.com:443", "hooks.example.com.", "orders", true},
+		{"a.orders.hooks.example.com", "hooks.example.com", "", false},
+		{"hooks.example.com", "hooks.example.com", "", false},
+		{".hooks.example.com", "hooks.example.com", "", false},
+		{"ordershooks.example.com", "hooks.example.com", "", false},
+		{"orders.example.org", "hooks.example.com", "", false},
+		{"orders.hooks.example.com", "", "", false},
+	}
+
+	for _, tt := range tests {
+		label, ok := Subdomain(tt.host, tt.base)
+		if label != tt.label || ok != tt.ok {
+			t.Errorf("Subdomain(%q, %q) = %q, %v, want %q, %v", tt.host, tt.base, label, ok, tt.label, tt.ok)
+		}
+	}
+}
+
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	records, ok := r[name]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+
+	return records, nil
+}
+
+func TestVerify(t *testing.T) {
+	name, value := Record("hooks.example.com", "tok123")
+	if name != "_splay-challenge.hooks.example.com" || value != "splay-verification=tok123" {
+		t.Fatalf("Record() = %q, %q", name, value)
+	}
+
+	tests := []struct {
+		name     string
+		resolver fakeResolver
+		token    string
+		err      error
+	}{
+		{"record present", fakeResolver{name: {"v=spf1 -all", value}}, "tok123", nil},
+		{"other token", fakeResolver{name: {value}}, "tok456", ErrNotVerified},
+		{"value prefix only", fakeResolver{name: {"tok123"}}, "tok123", ErrNotVerified},
+		{"lookup fails", fakeResolver{}, "tok123", ErrNotVerified},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(context.Background(), tt.resolver, "hooks.example.com", tt.token); !errors.Is(err, tt.err) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
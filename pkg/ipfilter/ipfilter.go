@@ -0,0 +1,325 @@
+package ipfilter
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// ProviderPrefix marks a list entry that refers to the published ranges of a provider, like "provider:github".
+const ProviderPrefix = "provider:"
+
+// Forwarding headers a trusted proxy may record the client address in.
+const (
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderForwarded     = "Forwarded"
+)
+
+var (
+	ErrInvalidPrefix   = errors.New("Invalid IP address or CIDR range")
+	ErrUnknownProvider = errors.New("Unknown provider IP ranges")
+	ErrInvalidRanges   = errors.New("Invalid provider IP ranges file")
+	ErrNoClientIP      = errors.New("Could not resolve client IP")
+	ErrUnknownHeader   = errors.New("Unknown forwarding header, must be X-Forwarded-For or Forwarded")
+	ErrNonPublicAddr   = errors.New("Refusing to connect to a non public address")
+)
+
+// nonPublic are the ranges not covered by the netip predicates that still do not reach the internet.
+var nonPublic = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// Ranges are the published IP ranges of providers, by provider name.
+type Ranges map[string][]netip.Prefix
+
+// LoadRanges reads a JSON file mapping provider names to lists of CIDR ranges.
+func LoadRanges(path string) (Ranges, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidRanges, err)
+	}
+
+	doc := map[string][]string{}
+	if err = json.Unmarshal(raw, &doc); err != nil {
+		return nil, errors.Join(ErrInvalidRanges, err)
+	}
+
+	ranges := Ranges{}
+	for name, entries := range doc {
+		prefixes, err := ParsePrefixes(entries)
+		if err != nil {
+			return nil, errors.Join(ErrInvalidRanges, err)
+		}
+		ranges[strings.ToLower(name)] = prefixes
+	}
+
+	return ranges, nil
+}
+
+// ParsePrefix parses a CIDR range or a single address.
+func ParsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, errors.Join(ErrInvalidPrefix, err)
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, errors.Join(ErrInvalidPrefix, err)
+	}
+	addr = addr.Unmap()
+
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// ParsePrefixes parses a list of CIDR ranges or addresses, empty entries are skipped.
+func ParsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		prefix, err := ParsePrefix(entry)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	return prefixes, nil
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return slices.ContainsFunc(prefixes, func(p netip.Prefix) bool { return p.Contains(addr) })
+}
+
+// List is a compiled pair of allow and deny lists.
+type List struct {
+	Allow []netip.Prefix
+	Deny  []netip.Prefix
+}
+
+// NewList compiles allow and deny entries, provider entries expand to the provider ranges.
+func NewList(allow, deny []string, ranges Ranges) (*List, error) {
+	l := &List{}
+	var err error
+	if l.Allow, err = expand(allow, ranges); err != nil {
+		return nil, err
+	}
+
+	if l.Deny, err = expand(deny, ranges); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func expand(entries []string, ranges Ranges) ([]netip.Prefix, error) {
+	prefixes := []netip.Prefix{}
+	for _, entry := range entries {
+		name, ok := strings.CutPrefix(strings.TrimSpace(entry), ProviderPrefix)
+		if !ok {
+			parsed, err := ParsePrefixes([]string{entry})
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, parsed...)
+			continue
+		}
+
+		provider, ok := ranges[strings.ToLower(name)]
+		if !ok {
+			return nil, errors.Join(ErrUnknownProvider, errors.New(name))
+		}
+		prefixes = append(prefixes, provider...)
+	}
+
+	return prefixes, nil
+}
+
+// Empty reports whether the list lets every address through.
+func (l *List) Empty() bool {
+	return len(l.Allow) == 0 && len(l.Deny) == 0
+}
+
+// Allowed reports whether an address may pass, a deny match wins over an allow match and
+// a non empty allow list refuses everything it does not contain.
+func (l *List) Allowed(addr netip.Addr) bool {
+	if contains(l.Deny, addr) {
+		return false
+	}
+
+	return len(l.Allow) == 0 || contains(l.Allow, addr)
+}
+
+// ParseHeader returns the canonical name of a forwarding header, X-Forwarded-For when empty.
+func ParseHeader(name string) (string, error) {
+	switch header := http.CanonicalHeaderKey(strings.TrimSpace(name)); header {
+	case "":
+		return HeaderXForwardedFor, nil
+	case HeaderXForwardedFor, HeaderForwarded:
+		return header, nil
+	default:
+		return "", errors.Join(ErrUnknownHeader, errors.New(name))
+	}
+}
+
+// Resolver finds the client address of a request, trusting forwarding headers only when
+// they were added by one of the trusted proxies.
+type Resolver struct {
+	Trusted []netip.Prefix
+	// Header is the forwarding header the trusted proxies set, X-Forwarded-For when empty. Other
+	// forwarding headers are passed through by the proxies as the client sent them and are ignored.
+	Header string
+}
+
+// ClientIP walks the forwarding chain from the nearest hop and returns the first address
+// that is not a trusted proxy.
+func (res *Resolver) ClientIP(r *http.Request) (netip.Addr, error) {
+	remote, err := remoteAddr(r)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	if !contains(res.Trusted, remote) {
+		return remote, nil
+	}
+
+	var hops []string
+	if res.Header == HeaderForwarded {
+		hops = forwardedHops(r.Header.Values(HeaderForwarded))
+	} else {
+		hops = xForwardedForHops(r.Header.Values(HeaderXForwardedFor))
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			// An unparsable hop was written by an untrusted party, stop at the last known one.
+			break
+		}
+
+		client = addr.Unmap()
+		if !contains(res.Trusted, client) {
+			break
+		}
+	}
+
+	return client, nil
+}
+
+// FromProxy reports whether a request was sent by one of the trusted proxies, only then are
+// headers like X-Forwarded-Proto believed.
+func (res *Resolver) FromProxy(r *http.Request) bool {
+	remote, err := remoteAddr(r)
+	if err != nil {
+		return false
+	}
+
+	return contains(res.Trusted, remote)
+}
+
+func remoteAddr(r *http.Request) (netip.Addr, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	remote, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, errors.Join(ErrNoClientIP, err)
+	}
+
+	return remote.Unmap(), nil
+}
+
+func xForwardedForHops(values []string) []string {
+	hops := []string{}
+	for _, value := range values {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+
+	return hops
+}
+
+// forwardedHops extracts the for= addresses of RFC 7239 Forwarded headers.
+func forwardedHops(values []string) []string {
+	hops := []string{}
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			hop := ""
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hop = forwardedNode(val)
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+
+	return hops
+}
+
+// forwardedNode strips the quotes, brackets and port of a Forwarded node like "[2001:db8::1]:4711".
+func forwardedNode(node string) string {
+	node = strings.Trim(node, `"`)
+	if strings.HasPrefix(node, "[") {
+		if end := strings.Index(node, "]"); end > 0 {
+			return node[1:end]
+		}
+	}
+
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return host
+	}
+
+	return node
+}
+
+// Public reports whether addr is reachable on the internet, loopback, private, link-local,
+// unspecified and multicast addresses are not.
+func Public(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	return addr.IsValid() &&
+		!addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!addr.IsUnspecified() &&
+		!contains(nonPublic, addr)
+}
+
+// DialControl is a net.Dialer Control refusing connections to non public addresses. It runs on
+// the resolved address of every connection, so DNS names and redirects are covered too.
+func DialControl(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return errors.Join(ErrNonPublicAddr, err)
+	}
+
+	if !Public(addrPort.Addr()) {
+		return ErrNonPublicAddr
+	}
+
+	return nil
+}
@@ -0,0 +1,289 @@
+package ipfilter
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testRanges = Ranges{
+	"github": {netip.MustParsePrefix("192.30.252.0/22"), netip.MustParsePrefix("2a0a:a440::/29")},
+}
+
+func TestParsePrefix(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		err   error
+	}{
+		{input: "10.0.0.0/8", want: "10.0.0.0/8"},
+		{input: "10.1.2.3/8", want: "10.0.0.0/8"},
+		{input: " 203.0.113.7 ", want: "203.0.113.7/32"},
+		{input: "::ffff:203.0.113.7", want: "203.0.113.7/32"},
+		{input: "2001:db8::/32", want: "2001:db8::/32"},
+		{input: "2001:db8::1", want: "2001:db8::1/128"},
+		{input: "10.0.0.0/33", err: ErrInvalidPrefix},
+		{input: "example.com", err: ErrInvalidPrefix},
+		{input: "", err: ErrInvalidPrefix},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParsePrefix(tt.input)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ParsePrefix() error = %v, want %v", err, tt.err)
+			}
+
+			if err == nil && got.String() != tt.want {
+				t.Fatalf("ParsePrefix() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		name  string
+		allow []string
+		deny  []string
+		addr  string
+		want  bool
+	}{
+		{name: "empty lists", addr: "203.0.113.7", want: true},
+		{name: "allowed range", allow: []string{"10.0.0.0/8"}, addr: "10.20.30.40", want: true},
+		{name: "outside allowed range", allow: []string{"10.0.0.0/8"}, addr: "11.0.0.1", want: false},
+		{name: "allowed address", allow: []string{"203.0.113.7"}, addr: "203.0.113.7", want: true},
+		{name: "next to allowed address", allow: []string{"203.0.113.7"}, addr: "203.0.113.8", want: false},
+		{name: "denied range", deny: []string{"10.0.0.0/8"}, addr: "10.0.0.1", want: false},
+		{name: "outside denied range", deny: []string{"10.0.0.0/8"}, addr: "192.168.0.1", want: true},
+		{name: "deny wins over allow", allow: []string{"10.0.0.0/8"}, deny: []string{"10.0.0.0/24"}, addr: "10.0.0.5", want: false},
+		{name: "allow around deny", allow: []string{"10.0.0.0/8"}, deny: []string{"10.0.0.0/24"}, addr: "10.0.1.5", want: true},
+		{name: "mapped ipv4", allow: []string{"10.0.0.0/8"}, addr: "::ffff:10.0.0.1", want: true},
+		{name: "ipv6 range", allow: []string{"2001:db8::/32"}, addr: "2001:db8::1", want: true},
+		{name: "ipv4 against ipv6 range", allow: []string{"2001:db8::/32"}, addr: "10.0.0.1", want: false},
+		{name: "provider ranges", allow: []string{"provider:GitHub"}, addr: "192.30.253.1", want: true},
+		{name: "outside provider ranges", allow: []string{"provider:github"}, addr: "192.30.0.1", want: false},
+		{name: "provider ipv6 ranges", allow: []string{"provider:github"}, addr: "2a0a:a440::1", want: true},
+		{name: "denied provider", deny: []string{"provider:github"}, addr: "192.30.252.10", want: false},
+		{name: "blank entries", allow: []string{"", " "}, addr: "203.0.113.7", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := NewList(tt.allow, tt.deny, testRanges)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := l.Allowed(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Fatalf("Allowed(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewListErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		allow []string
+		deny  []string
+		want  error
+	}{
+		{name: "invalid allow", allow: []string{"10.0.0.0/99"}, want: ErrInvalidPrefix},
+		{name: "invalid deny", deny: []string{"not an ip"}, want: ErrInvalidPrefix},
+		{name: "unknown provider", allow: []string{"provider:gitlab"}, want: ErrUnknownProvider},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewList(tt.allow, tt.deny, testRanges); !errors.Is(err, tt.want) {
+				t.Fatalf("NewList() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRanges(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		want    error
+	}{
+		{name: "valid", content: `{"GitHub": ["192.30.252.0/22", "2a0a:a440::/29"]}`, want: nil},
+		{name: "invalid range", content: `{"github": ["192.30.252.0/99"]}`, want: ErrInvalidRanges},
+		{name: "invalid json", content: `["192.30.252.0/22"]`, want: ErrInvalidRanges},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			ranges, err := LoadRanges(path)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("LoadRanges() error = %v, want %v", err, tt.want)
+			}
+
+			if err == nil && len(ranges["github"]) != 2 {
+				t.Fatalf("LoadRanges() = %v, want two github ranges", ranges)
+			}
+		})
+	}
+
+	if _, err := LoadRanges(filepath.Join(dir, "missing.json")); !errors.Is(err, ErrInvalidRanges) {
+		t.Fatalf("LoadRanges() of a missing file = %v, want %v", err, ErrInvalidRanges)
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		err   error
+	}{
+		{input: "", want: HeaderXForwardedFor},
+		{input: "x-forwarded-for", want: HeaderXForwardedFor},
+		{input: " Forwarded ", want: HeaderForwarded},
+		{input: "X-Real-IP", err: ErrUnknownHeader},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseHeader(tt.input)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("ParseHeader(%q) = %q, %v, want %q, %v", tt.input, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	xff := &Resolver{Trusted: trusted, Header: HeaderXForwardedFor}
+	forwarded := &Resolver{Trusted: trusted, Header: HeaderForwarded}
+
+	tests := []struct {
+		name   string
+		res    *Resolver
+		remote string
+		header http.Header
+		want   string
+		proxy  bool
+	}{
+		{name: "direct", res: xff, remote: "203.0.113.7:4711", want: "203.0.113.7"},
+		{name: "untrusted forwarding ignored", res: xff, remote: "203.0.113.7:4711", header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}, want: "203.0.113.7"},
+		{name: "trusted proxy", res: xff, remote: "10.0.0.1:4711", header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}, want: "198.51.100.1", proxy: true},
+		{name: "spoofed hop before client", res: xff, remote: "10.0.0.1:4711", header: http.Header{"X-Forwarded-For": {"1.2.3.4, 198.51.100.1"}}, want: "198.51.100.1", proxy: true},
+		{name: "chain of proxies", res: xff, remote: "10.0.0.1:4711", header: http.Header{"X-Forwarded-For": {"198.51.100.1, 10.0.0.2", "10.0.0.3"}}, want: "198.51.100.1", proxy: true},
+		{name: "garbage hop", res: xff, remote: "10.0.0.1:4711", header: http.Header{"X-Forwarded-For": {"198.51.100.1, unknown"}}, want: "10.0.0.1", proxy: true},
+		{name: "forwarded header", res: forwarded, remote: "10.0.0.1:4711", header: http.Header{"Forwarded": {`for=198.51.100.1;proto=https`}}, want: "198.51.100.1", proxy: true},
+		{name: "forwarded ipv6 with port", res: forwarded, remote: "10.0.0.1:4711", header: http.Header{"Forwarded": {`for="[2001:db8::1]:4711"`}}, want: "2001:db8::1", proxy: true},
+		{name: "spoofed forwarded behind an xff proxy", res: xff, remote: "10.0.0.1:4711", header: http.Header{"Forwarded": {"for=192.0.2.1"}, "X-Forwarded-For": {"198.51.100.2"}}, want: "198.51.100.2", proxy: true},
+		{name: "forwarded only behind an xff proxy", res: xff, remote: "10.0.0.1:4711", header: http.Header{"Forwarded": {"for=192.0.2.1"}}, want: "10.0.0.1", proxy: true},
+		{name: "spoofed xff behind a forwarded proxy", res: forwarded, remote: "10.0.0.1:4711", header: http.Header{"Forwarded": {"for=198.51.100.1"}, "X-Forwarded-For": {"192.0.2.1"}}, want: "198.51.100.1", proxy: true},
+		{name: "forwarded chain", res: forwarded, remote: "10.0.0.1:4711", header: http.Header{"Forwarded": {"for=192.0.2.1, for=198.51.100.1", "for=10.0.0.2"}}, want: "198.51.100.1", proxy: true},
+		{name: "trusted proxy without header", res: xff, remote: "10.0.0.1:4711", want: "10.0.0.1", proxy: true},
+		{name: "mapped remote", res: xff, remote: "[::ffff:10.0.0.1]:4711", header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}, want: "198.51.100.1", proxy: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{RemoteAddr: tt.remote, Header: tt.header}
+			if r.Header == nil {
+				r.Header = http.Header{}
+			}
+
+			got, err := tt.res.ClientIP(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.String() != tt.want {
+				t.Fatalf("ClientIP() = %s, want %s", got, tt.want)
+			}
+
+			if tt.res.FromProxy(r) != tt.proxy {
+				t.Fatalf("FromProxy() = %v, want %v", !tt.proxy, tt.proxy)
+			}
+		})
+	}
+
+	if _, err := xff.ClientIP(&http.Request{RemoteAddr: "pipe"}); !errors.Is(err, ErrNoClientIP) {
+		t.Fatalf("ClientIP() without an address = %v, want %v", err, ErrNoClientIP)
+	}
+}
+
+func TestPublic(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"203.0.113.7", true},
+		{"2001:db8::1", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"0.1.2.3", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:203.0.113.7", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := Public(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Fatalf("Public(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDialControl(t *testing.T) {
+	tests := []struct {
+		address string
+		err     error
+	}{
+		{"203.0.113.7:443", nil},
+		{"[2001:db8::1]:80", nil},
+		{"127.0.0.1:80", ErrNonPublicAddr},
+		{"[::1]:80", ErrNonPublicAddr},
+		{"169.254.169.254:80", ErrNonPublicAddr},
+		{"localhost:80", ErrNonPublicAddr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			if err := DialControl("tcp", tt.address, nil); !errors.Is(err, tt.err) {
+				t.Fatalf("DialControl(%s) error = %v, want %v", tt.address, err, tt.err)
+			}
+		})
+	}
+
+	// The check runs after name resolution, a name pointing to a local address is refused too.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: (&net.Dialer{Control: DialControl}).DialContext,
+	}}
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	if _, err := client.Get(url); !errors.Is(err, ErrNonPublicAddr) {
+		t.Fatalf("Get(%s) error = %v, want %v", url, err, ErrNonPublicAddr)
+	}
+}
@@ -0,0 +1,256 @@
+package mailparse
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"splay/pkg/formdata"
+)
+
+// maxDepth bounds the nesting of multipart bodies.
+const maxDepth = 16
+
+var (
+	ErrInvalidMessage = errors.New("Invalid email message")
+	ErrTooDeep        = errors.New("Email message is nested too deeply")
+)
+
+// Address is a parsed mailbox, like "Jane <jane@example.com>".
+type Address struct {
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address"`
+}
+
+// Message is a parsed email, files hold the attachments and inline parts that are not the text or html body.
+type Message struct {
+	From      []Address           `json:"from"`
+	To        []Address           `json:"to"`
+	Cc        []Address           `json:"cc,omitempty"`
+	ReplyTo   []Address           `json:"reply_to,omitempty"`
+	Subject   string              `json:"subject"`
+	Date      string              `json:"date,omitempty"`
+	MessageID string              `json:"message_id,omitempty"`
+	InReplyTo string              `json:"in_reply_to,omitempty"`
+	Text      string              `json:"text"`
+	HTML      string              `json:"html"`
+	Headers   map[string][]string `json:"headers"`
+
+	Files []formdata.File `json:"-"`
+}
+
+var decoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// Parse reads a raw RFC 5322 message, attachments are checked against the limits like form files.
+func Parse(raw []byte, limits formdata.Limits) (*Message, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, errors.Join(ErrInvalidMessage, err)
+	}
+
+	msg := &Message{
+		From:      addresses(m.Header, "From"),
+		To:        addresses(m.Header, "To"),
+		Cc:        addresses(m.Header, "Cc"),
+		ReplyTo:   addresses(m.Header, "Reply-To"),
+		Subject:   decodeHeader(m.Header.Get("Subject")),
+		MessageID: strings.Trim(m.Header.Get("Message-Id"), "<> "),
+		InReplyTo: strings.Trim(m.Header.Get("In-Reply-To"), "<> "),
+		Headers:   map[string][]string{},
+	}
+
+	if date, err := m.Header.Date(); err == nil {
+		msg.Date = date.UTC().Format("2006-01-02T15:04:05Z")
+	}
+
+	for key, values := range m.Header {
+		for _, value := range values {
+			msg.Headers[key] = append(msg.Headers[key], decodeHeader(value))
+		}
+	}
+
+	p := &parser{msg: msg, limits: limits}
+	if err = p.part(textproto.MIMEHeader(m.Header), m.Body, 0); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func addresses(header mail.Header, key string) []Address {
+	list, err := header.AddressList(key)
+	if err != nil {
+		return []Address{}
+	}
+
+	out := make([]Address, 0, len(list))
+	for _, a := range list {
+		out = append(out, Address{Name: a.Name, Address: strings.ToLower(a.Address)})
+	}
+
+	return out
+}
+
+func decodeHeader(value string) string {
+	decoded, err := decoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+
+	return decoded
+}
+
+type parser struct {
+	msg    *Message
+	limits formdata.Limits
+}
+
+func (p *parser) part(header textproto.MIMEHeader, body io.Reader, depth int) error {
+	if depth > maxDepth {
+		return ErrTooDeep
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		r := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := r.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return errors.Join(ErrInvalidMessage, err)
+			}
+
+			if err = p.part(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(transferDecoder(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return errors.Join(ErrInvalidMessage, err)
+	}
+
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := dispositionParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+
+	isBody := disposition != "attachment" && filename == ""
+	switch {
+	case isBody && mediaType == "text/plain" && p.msg.Text == "":
+		p.msg.Text = toUTF8(data, params["charset"])
+		return nil
+	case isBody && mediaType == "text/html" && p.msg.HTML == "":
+		p.msg.HTML = toUTF8(data, params["charset"])
+		return nil
+	}
+
+	return p.file(mediaType, decodeHeader(filename), data)
+}
+
+func (p *parser) file(contentType, filename string, data []byte) error {
+	if p.limits.MaxFiles > 0 && len(p.msg.Files) >= p.limits.MaxFiles {
+		return formdata.ErrTooManyFiles
+	}
+
+	if !formdata.Allowed(p.limits.Types, contentType) {
+		return errors.Join(formdata.ErrFileTypeRefused, errors.New(contentType))
+	}
+
+	if p.limits.MaxFileSize > 0 && int64(len(data)) > p.limits.MaxFileSize {
+		return formdata.ErrFileTooLarge
+	}
+
+	if filename == "" {
+		filename = "part"
+		if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+			filename += exts[0]
+		}
+	}
+
+	p.msg.Files = append(p.msg.Files, formdata.File{
+		Field:       "attachment",
+		Filename:    path.Base(filename),
+		ContentType: contentType,
+		Data:        data,
+	})
+
+	return nil
+}
+
+func transferDecoder(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &whitespaceStripper{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
+
+// whitespaceStripper drops the line breaks base64 bodies are wrapped with.
+type whitespaceStripper struct {
+	r io.Reader
+}
+
+func (w *whitespaceStripper) Read(p []byte) (int, error) {
+	for {
+		n, err := w.r.Read(p)
+		kept := 0
+		for _, b := range p[:n] {
+			if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+				p[kept] = b
+				kept++
+			}
+		}
+
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+// toUTF8 converts Latin-1 text, UTF-8 and ASCII are kept and other charsets are passed through as is.
+func toUTF8(data []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "windows-1252":
+		if utf8.Valid(data) {
+			return string(data)
+		}
+
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	default:
+		return string(data)
+	}
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.NewReader(toUTF8(data, charset)), nil
+}
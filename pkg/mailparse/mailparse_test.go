@@ -0,0 +1,152 @@
+package mailparse
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"splay/pkg/formdata"
+)
+
+func message(lines ...string) []byte {
+	return []byte(strings.Join(lines, "\r\n"))
+}
+
+var multipartMessage = message(
+	"From: =?UTF-8?Q?J=C3=BCrgen?= <Juergen@Example.com>",
+	"To: hooks@splay.dev, Other <other@example.com>",
+	"Subject: =?UTF-8?B?T3JkZXIg4pyU?=",
+	"Date: Mon, 03 Feb 2025 10:04:05 +0100",
+	"Message-ID: <abc@example.com>",
+	"MIME-Version: 1.0",
+	`Content-Type: multipart/mixed; boundary="outer"`,
+	"",
+	"--outer",
+	`Content-Type: multipart/alternative; boundary="inner"`,
+	"",
+	"--inner",
+	"Content-Type: text/plain; charset=iso-8859-1",
+	"Content-Transfer-Encoding: quoted-printable",
+	"",
+	"Gr=FC=DFe",
+	"--inner",
+	"Content-Type: text/html",
+	"",
+	"<p>hi</p>",
+	"--inner--",
+	"--outer",
+	`Content-Type: application/pdf; name="report.pdf"`,
+	"Content-Disposition: attachment; filename=\"../report.pdf\"",
+	"Content-Transfer-Encoding: base64",
+	"",
+	"cGRm",
+	"ZGF0YQ==",
+	"--outer",
+	"Content-Type: image/png",
+	"Content-Disposition: inline",
+	"Content-Transfer-Encoding: base64",
+	"",
+	"cG5n",
+	"--outer--",
+	"",
+)
+
+func TestParse(t *testing.T) {
+	msg, err := Parse(multipartMessage, formdata.Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []struct {
+		field, got, want string
+	}{
+		{"from name", msg.From[0].Name, "Jürgen"},
+		{"from address", msg.From[0].Address, "juergen@example.com"},
+		{"second to", msg.To[1].Address, "other@example.com"},
+		{"subject", msg.Subject, "Order ✔"},
+		{"date", msg.Date, "2025-02-03T09:04:05Z"},
+		{"message id", msg.MessageID, "abc@example.com"},
+		{"text", msg.Text, "Grüße"},
+		{"html", msg.HTML, "<p>hi</p>"},
+		{"subject header", msg.Headers["Subject"][0], "Order ✔"},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %q, want %q", c.field, c.got, c.want)
+		}
+	}
+
+	if len(msg.Files) != 2 {
+		t.Fatalf("files = %d, want 2", len(msg.Files))
+	}
+
+	if f := msg.Files[0]; f.Filename != "report.pdf" || f.ContentType != "application/pdf" || string(f.Data) != "pdfdata" {
+		t.Errorf("attachment = %s %s %q", f.Filename, f.ContentType, f.Data)
+	}
+
+	// Inline parts without a name are kept as files named after their type.
+	if f := msg.Files[1]; f.Filename != "part.png" || string(f.Data) != "png" {
+		t.Errorf("inline part = %s %q", f.Filename, f.Data)
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits formdata.Limits
+		err    error
+	}{
+		{"no limits", formdata.Limits{}, nil},
+		{"within limits", formdata.Limits{MaxFiles: 2, MaxFileSize: 7, Types: []string{"application/pdf", "image/*"}}, nil},
+		{"too many files", formdata.Limits{MaxFiles: 1}, formdata.ErrTooManyFiles},
+		{"file too large", formdata.Limits{MaxFileSize: 6}, formdata.ErrFileTooLarge},
+		{"type refused", formdata.Limits{Types: []string{"application/pdf"}}, formdata.ErrFileTypeRefused},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(multipartMessage, tt.limits); !errors.Is(err, tt.err) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParsePlain(t *testing.T) {
+	msg, err := Parse(message("From: a@example.com", "Subject: plain", "", "hello", ""), formdata.Limits{MaxFiles: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Text != "hello\r\n" || msg.HTML != "" || len(msg.Files) != 0 || len(msg.To) != 0 {
+		t.Fatalf("Parse() = %+v", msg)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	// Every level opens a multipart body holding the next one.
+	nested := []string{"From: a@example.com"}
+	for i := range maxDepth + 2 {
+		boundary := "b" + strings.Repeat("x", i)
+		nested = append(nested, `Content-Type: multipart/mixed; boundary="`+boundary+`"`, "", "--"+boundary)
+	}
+	nested = append(nested, "Content-Type: text/plain", "", "deep")
+
+	tests := []struct {
+		name string
+		raw  []byte
+		err  error
+	}{
+		{"not a message", []byte("no header separator"), ErrInvalidMessage},
+		{"multipart without parts", message("Content-Type: multipart/mixed; boundary=x", "", "no boundary in sight"), ErrInvalidMessage},
+		{"nested too deeply", message(nested...), ErrTooDeep},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.raw, formdata.Limits{}); !errors.Is(err, tt.err) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
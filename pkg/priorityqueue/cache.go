@@ -0,0 +1,195 @@
+package priorityqueue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Reason tells why an entry left a cache.
+type Reason int
+
+const (
+	// Expired entries outlived their TTL.
+	Expired Reason = iota
+	// Evicted entries made room for a new one in a full cache, the ones closest to expiry go first.
+	Evicted
+)
+
+// CacheStats are counters of a cache since it was created.
+type CacheStats struct {
+	Size        int    `json:"size"`
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+}
+
+type entry[V any] struct {
+	key   string
+	value V
+}
+
+func (e entry[V]) ID() string {
+	return e.key
+}
+
+// Cache is a bounded set of entries expiring after a per entry TTL, like delivery ids seen for
+// dedupe or replay protection. Expired entries are dropped when they are looked up, when room
+// is needed, or as they expire while Run is running.
+type Cache[V any] struct {
+	// OnExpire is called for every entry that expired or was evicted, outside of the cache lock.
+	OnExpire func(key string, value V, reason Reason)
+
+	mu       sync.Mutex
+	queue    *ThreadSafeQueue[entry[V]]
+	capacity int
+
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+}
+
+// NewCache returns a cache of at most capacity entries, zero or less is unbounded.
+func NewCache[V any](capacity int) *Cache[V] {
+	return &Cache[V]{
+		queue:    NewPriorityQueue[entry[V]](),
+		capacity: capacity,
+	}
+}
+
+// Get returns the value of a live entry.
+func (c *Cache[V]) Get(key string) (V, bool) {
+	e, deadline, ok := c.queue.Lookup(key)
+	if ok && time.Now().Before(deadline) {
+		c.hits.Add(1)
+		return e.value, true
+	}
+
+	if ok {
+		c.expire(key)
+	}
+	c.misses.Add(1)
+
+	var zero V
+	return zero, false
+}
+
+// Set stores an entry for ttl, replacing the value and TTL of an entry with the same key.
+func (c *Cache[V]) Set(key string, value V, ttl time.Duration) {
+	c.mu.Lock()
+	evicted := c.set(key, value, ttl)
+	c.mu.Unlock()
+
+	c.removed(evicted)
+}
+
+// Add stores an entry for ttl unless a live entry with the same key exists, and reports whether it did.
+// It is the check and mark step of dedupe and replay protection.
+func (c *Cache[V]) Add(key string, value V, ttl time.Duration) bool {
+	c.mu.Lock()
+	_, deadline, ok := c.queue.Lookup(key)
+	if ok && time.Now().Before(deadline) {
+		c.mu.Unlock()
+		return false
+	}
+
+	evicted := c.set(key, value, ttl)
+	c.mu.Unlock()
+
+	c.removed(evicted)
+	return true
+}
+
+// set stores an entry and returns the entries removed to make room, the lock must be held.
+func (c *Cache[V]) set(key string, value V, ttl time.Duration) []*Item[entry[V]] {
+	var evicted []*Item[entry[V]]
+	if _, _, exists := c.queue.Lookup(key); !exists && c.capacity > 0 {
+		evicted = c.queue.TrimTo(c.capacity - 1)
+	}
+
+	c.queue.Set(entry[V]{key: key, value: value}, ttl)
+
+	return evicted
+}
+
+// Delete removes an entry without calling OnExpire and reports whether there was one.
+func (c *Cache[V]) Delete(key string) bool {
+	return c.queue.Remove(key)
+}
+
+// Len returns the number of entries, expired ones not yet dropped included.
+func (c *Cache[V]) Len() int {
+	return c.queue.Len()
+}
+
+// Stats returns the size and counters of the cache.
+func (c *Cache[V]) Stats() CacheStats {
+	return CacheStats{
+		Size:        c.queue.Len(),
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Evictions:   c.evictions.Load(),
+		Expirations: c.expirations.Load(),
+	}
+}
+
+// Run drops entries as they expire, calling OnExpire right away, until ctx is done.
+func (c *Cache[V]) Run(ctx context.Context) error {
+	for {
+		e, err := c.queue.Next(ctx)
+		if err != nil {
+			return err
+		}
+
+		c.expirations.Add(1)
+		if c.OnExpire != nil {
+			c.OnExpire(e.key, e.value, Expired)
+		}
+	}
+}
+
+// expire drops an entry found expired by Get. The deadline is checked again under the lock, as a
+// Set or Add may have renewed the entry in between.
+func (c *Cache[V]) expire(key string) {
+	c.mu.Lock()
+	e, deadline, ok := c.queue.Lookup(key)
+	if !ok || time.Now().Before(deadline) {
+		c.mu.Unlock()
+		return
+	}
+	removed := c.queue.Remove(key)
+	c.mu.Unlock()
+
+	if !removed {
+		return
+	}
+
+	c.expirations.Add(1)
+	if c.OnExpire != nil {
+		c.OnExpire(key, e.value, Expired)
+	}
+}
+
+// removed reports entries trimmed to make room, the ones already past their TTL count as expired.
+func (c *Cache[V]) removed(items []*Item[entry[V]]) {
+	now := time.Now()
+	for _, item := range items {
+		reason := Evicted
+		if !now.Before(item.priority) {
+			reason = Expired
+		}
+
+		if reason == Expired {
+			c.expirations.Add(1)
+		} else {
+			c.evictions.Add(1)
+		}
+
+		if c.OnExpire != nil {
+			c.OnExpire(item.Value.key, item.Value.value, reason)
+		}
+	}
+}
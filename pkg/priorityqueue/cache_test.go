@@ -0,0 +1,191 @@
+package priorityqueue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type expiry struct {
+	key    string
+	reason Reason
+}
+
+func recorder(c *Cache[int]) func() []expiry {
+	var mu sync.Mutex
+	got := []expiry{}
+	c.OnExpire = func(key string, _ int, reason Reason) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, expiry{key: key, reason: reason})
+	}
+
+	return func() []expiry {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]expiry{}, got...)
+	}
+}
+
+func TestCacheGetSet(t *testing.T) {
+	c := NewCache[int](0)
+	expired := recorder(c)
+
+	c.Set("a", 1, time.Hour)
+	c.Set("gone", 2, -time.Second)
+
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) = %d, %v, want 1, true", v, ok)
+	}
+
+	if _, ok := c.Get("gone"); ok {
+		t.Fatal("Get() returned an expired entry")
+	}
+
+	if _, ok := c.Get("missing"); ok {
+		t.Fatal("Get() returned a missing entry")
+	}
+
+	c.Set("a", 3, time.Hour)
+	if v, _ := c.Get("a"); v != 3 {
+		t.Fatalf("Get(a) after Set() = %d, want 3", v)
+	}
+
+	if got := expired(); len(got) != 1 || got[0] != (expiry{key: "gone", reason: Expired}) {
+		t.Fatalf("OnExpire calls = %v, want gone expired", got)
+	}
+
+	stats := c.Stats()
+	if stats.Size != 1 || stats.Hits != 2 || stats.Misses != 2 || stats.Expirations != 1 || stats.Evictions != 0 {
+		t.Fatalf("Stats() = %+v", stats)
+	}
+
+	if !c.Delete("a") || c.Delete("a") || c.Len() != 0 {
+		t.Fatal("Delete() reported the wrong entries")
+	}
+
+	if len(expired()) != 1 {
+		t.Fatal("Delete() called OnExpire")
+	}
+}
+
+func TestCacheAdd(t *testing.T) {
+	c := NewCache[int](0)
+
+	if !c.Add("a", 1, time.Hour) {
+		t.Fatal("Add() of a new key refused")
+	}
+
+	if c.Add("a", 2, time.Hour) {
+		t.Fatal("Add() of a live key accepted")
+	}
+
+	if v, _ := c.Get("a"); v != 1 {
+		t.Fatalf("Get(a) after a refused Add() = %d, want 1", v)
+	}
+
+	c.Set("b", 1, -time.Second)
+	if !c.Add("b", 2, time.Hour) {
+		t.Fatal("Add() over an expired key refused")
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := NewCache[int](3)
+	expired := recorder(c)
+
+	c.Set("stale", 0, -time.Second)
+	c.Set("soon", 1, time.Minute)
+	c.Set("late", 2, time.Hour)
+
+	// Replacing a key never evicts.
+	c.Set("late", 3, 2*time.Hour)
+	if len(expired()) != 0 {
+		t.Fatalf("replacing a key removed %v", expired())
+	}
+
+	c.Set("new", 4, time.Hour)
+	c.Set("newer", 5, time.Hour)
+
+	want := []expiry{{key: "stale", reason: Expired}, {key: "soon", reason: Evicted}}
+	if got := expired(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("OnExpire calls = %v, want %v", got, want)
+	}
+
+	if c.Len() != 3 {
+		t.Fatalf("Len() = %d, want the capacity", c.Len())
+	}
+
+	if stats := c.Stats(); stats.Evictions != 1 || stats.Expirations != 1 {
+		t.Fatalf("Stats() = %+v, want one eviction and one expiration", stats)
+	}
+}
+
+func TestCacheRun(t *testing.T) {
+	c := NewCache[int](0)
+	expired := recorder(c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+
+	c.Set("a", 1, 10*time.Millisecond)
+	c.Set("b", 2, time.Hour)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(expired()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if got := expired(); len(got) != 1 || got[0].key != "a" {
+		t.Fatalf("OnExpire calls = %v, want a", got)
+	}
+
+	if c.Len() != 1 {
+		t.Fatalf("Len() = %d, want the live entry", c.Len())
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Run() = %v, want %v", err, context.Canceled)
+	}
+}
+
+// TestCacheExpireRace renews entries while they are being expired, a renewed entry must never be
+// dropped or reported as expired. It is meant to run with -race.
+func TestCacheExpireRace(t *testing.T) {
+	c := NewCache[int](0)
+	expired := recorder(c)
+
+	const keys = 200
+	for i := range keys {
+		c.Set(fmt.Sprint(i), 0, -time.Second)
+	}
+
+	var wg sync.WaitGroup
+	for i := range keys {
+		key := fmt.Sprint(i)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			c.Get(key)
+		}()
+		go func() {
+			defer wg.Done()
+			c.Set(key, 1, time.Hour)
+		}()
+	}
+	wg.Wait()
+
+	for i := range keys {
+		if v, ok := c.Get(fmt.Sprint(i)); !ok || v != 1 {
+			t.Fatalf("Get(%d) = %d, %v, the renewed entry was dropped", i, v, ok)
+		}
+	}
+
+	if n := len(expired()); n > keys {
+		t.Fatalf("OnExpire called %d times for %d keys", n, keys)
+	}
+}
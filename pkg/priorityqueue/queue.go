@@ -2,6 +2,7 @@ package priorityqueue
 
 import (
 	"container/heap"
+	"context"
 	"iter"
 	"sync"
 	"time"
@@ -14,6 +15,11 @@ type Item[T any] struct {
 	index    int       // The index of the item in the heap.
 }
 
+// Deadline returns the time the item is due at.
+func (i *Item[T]) Deadline() time.Time {
+	return i.priority
+}
+
 // A PriorityQueue implements heap.Interface and holds Items.
 type PriorityQueue[T any] []*Item[T]
 
@@ -47,10 +53,13 @@ func (pq *PriorityQueue[T]) Pop() any {
 	return item
 }
 
+// ThreadSafeQueue holds at most one item per ID, ordered by the time each item is due at.
 type ThreadSafeQueue[T Identifier] struct {
 	pq    *PriorityQueue[T]
-	mu    sync.RWMutex
-	cache sync.Map
+	mu    sync.Mutex
+	items map[string]*Item[T]
+	// changed is closed and replaced whenever the queue changes, waking every consumer in Next.
+	changed chan struct{}
 }
 
 type Identifier interface {
@@ -60,15 +69,26 @@ type Identifier interface {
 func NewPriorityQueue[T Identifier]() *ThreadSafeQueue[T] {
 	pq := &PriorityQueue[T]{}
 	heap.Init(pq)
-	return &ThreadSafeQueue[T]{pq, sync.RWMutex{}, sync.Map{}}
+	return &ThreadSafeQueue[T]{
+		pq:      pq,
+		items:   map[string]*Item[T]{},
+		changed: make(chan struct{}),
+	}
 }
 
-func (q *ThreadSafeQueue[T]) Push(t T, ttl time.Duration) {
+// notify wakes the consumers waiting in Next, the lock must be held.
+func (q *ThreadSafeQueue[T]) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// Push adds t due after ttl, unless an item with the same ID is queued already, and reports whether it did.
+func (q *ThreadSafeQueue[T]) Push(t T, ttl time.Duration) bool {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	if _, ok := q.cache.Load(t.ID()); ok {
-		return
+	if _, ok := q.items[t.ID()]; ok {
+		return false
 	}
 
 	i := &Item[T]{
@@ -77,60 +97,218 @@ func (q *ThreadSafeQueue[T]) Push(t T, ttl time.Duration) {
 	}
 
 	heap.Push(q.pq, i)
-	q.cache.Store(t.ID(), struct{}{})
+	q.items[t.ID()] = i
+	q.notify()
+
+	return true
+}
+
+// Set queues t due after ttl, replacing the value and deadline of a queued item with the same ID.
+// It reports whether it replaced one.
+func (q *ThreadSafeQueue[T]) Set(t T, ttl time.Duration) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if i, ok := q.items[t.ID()]; ok {
+		i.Value = t
+		i.priority = time.Now().Add(ttl)
+		heap.Fix(q.pq, i.index)
+		q.notify()
+		return true
+	}
+
+	i := &Item[T]{
+		Value:    t,
+		priority: time.Now().Add(ttl),
+	}
+
+	heap.Push(q.pq, i)
+	q.items[t.ID()] = i
+	q.notify()
+
+	return false
+}
+
+// Lookup returns the value and deadline of the queued item with the ID.
+func (q *ThreadSafeQueue[T]) Lookup(id string) (T, time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i, ok := q.items[id]
+	if !ok {
+		var zero T
+		return zero, time.Time{}, false
+	}
+
+	return i.Value, i.priority, true
+}
+
+// Update replaces the value of the queued item with the ID of t and keeps its deadline.
+// It reports whether such an item was queued.
+func (q *ThreadSafeQueue[T]) Update(t T) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i, ok := q.items[t.ID()]
+	if !ok {
+		return false
+	}
+	i.Value = t
+
+	return true
+}
+
+// Remove drops the queued item with the ID and reports whether there was one.
+func (q *ThreadSafeQueue[T]) Remove(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i, ok := q.items[id]
+	if !ok {
+		return false
+	}
+
+	heap.Remove(q.pq, i.index)
+	delete(q.items, id)
+	q.notify()
+
+	return true
+}
+
+// Extend moves the deadline of the queued item with the ID by d, a negative d brings it forward.
+// It reports whether such an item was queued.
+func (q *ThreadSafeQueue[T]) Extend(id string, d time.Duration) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i, ok := q.items[id]
+	if !ok {
+		return false
+	}
+
+	i.priority = i.priority.Add(d)
+	heap.Fix(q.pq, i.index)
+	q.notify()
+
+	return true
 }
 
 func (q *ThreadSafeQueue[T]) Pop() *Item[T] {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	if q.Len() == 0 {
+	return q.pop()
+}
+
+// pop removes the earliest item, the lock must be held.
+func (q *ThreadSafeQueue[T]) pop() *Item[T] {
+	if q.pq.Len() == 0 {
 		return nil
 	}
 
 	value := heap.Pop(q.pq).(*Item[T])
-	q.cache.Delete(value.Value.ID())
+	delete(q.items, value.Value.ID())
 
 	return value
 }
 
+// TrimTo removes the earliest items until at most size are left and returns them, earliest first.
+func (q *ThreadSafeQueue[T]) TrimTo(size int) []*Item[T] {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	trimmed := []*Item[T]{}
+	for q.pq.Len() > max(size, 0) {
+		trimmed = append(trimmed, q.pop())
+	}
+
+	if len(trimmed) > 0 {
+		q.notify()
+	}
+
+	return trimmed
+}
+
 func (q *ThreadSafeQueue[T]) Len() int {
-	q.mu.RLock()
-	defer q.mu.RUnlock()
+	q.mu.Lock()
+	defer q.mu.Unlock()
 
 	return q.pq.Len()
 }
 
+// Peek returns a copy of the earliest item without removing it, the queued item may change meanwhile.
 func (q *ThreadSafeQueue[T]) Peek() *Item[T] {
-	q.mu.RLock()
-	defer q.mu.RUnlock()
+	q.mu.Lock()
+	defer q.mu.Unlock()
 
-	if q.Len() == 0 {
+	if q.pq.Len() == 0 {
 		return nil
 	}
 
-	return (*q.pq)[0]
+	item := *(*q.pq)[0]
+	return &item
 }
 
-func (q *ThreadSafeQueue[T]) Items() iter.Seq[T] {
-	q.mu.Lock()
-	defer q.mu.Unlock()
+// Next blocks until the earliest item is due and removes it. It wakes up early when an item is pushed,
+// removed or moved, and returns the error of ctx once it is done.
+func (q *ThreadSafeQueue[T]) Next(ctx context.Context) (T, error) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
 
-	time := time.Now()
+	for {
+		q.mu.Lock()
+		changed := q.changed
+		wait := time.Duration(-1)
+		if q.pq.Len() > 0 {
+			wait = time.Until((*q.pq)[0].priority)
+			if wait <= 0 {
+				item := q.pop()
+				q.mu.Unlock()
+				return item.Value, nil
+			}
+		}
+		q.mu.Unlock()
 
-	return func(yield func(T) bool) {
-		for item := q.Peek(); item != nil; item = q.Peek() {
-			if item.priority.After(time) {
-				break
+		// Drain a fired timer before reusing it.
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
 			}
+		}
+
+		var due <-chan time.Time
+		if wait > 0 {
+			timer.Reset(wait)
+			due = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		case <-changed:
+		case <-due:
+		}
+	}
+}
 
-			item := q.Pop()
-			if item == nil {
-				break
+// Items yields and removes every item that is due now, earliest first.
+func (q *ThreadSafeQueue[T]) Items() iter.Seq[T] {
+	now := time.Now()
+
+	return func(yield func(T) bool) {
+		for {
+			q.mu.Lock()
+			if q.pq.Len() == 0 || (*q.pq)[0].priority.After(now) {
+				q.mu.Unlock()
+				return
 			}
+			item := q.pop()
+			q.mu.Unlock()
 
 			if !yield(item.Value) {
-				break
+				return
 			}
 		}
 	}
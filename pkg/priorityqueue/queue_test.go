@@ -0,0 +1,256 @@
+package priorityqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+type job struct {
+	id   string
+	data int
+}
+
+func (j job) ID() string {
+	return j.id
+}
+
+func ids(q *ThreadSafeQueue[job]) []string {
+	got := []string{}
+	for j := range q.Items() {
+		got = append(got, j.id)
+	}
+
+	return got
+}
+
+func TestQueueOrder(t *testing.T) {
+	q := NewPriorityQueue[job]()
+	q.Push(job{id: "c"}, -time.Second)
+	q.Push(job{id: "a"}, -3*time.Second)
+	q.Push(job{id: "b"}, -2*time.Second)
+	q.Push(job{id: "later"}, time.Hour)
+
+	if got := q.Peek(); got == nil || got.Value.id != "a" {
+		t.Fatalf("Peek() = %v, want a", got)
+	}
+
+	if got, want := ids(q), []string{"a", "b", "c"}; !slices.Equal(got, want) {
+		t.Fatalf("Items() = %v, want %v", got, want)
+	}
+
+	if q.Len() != 1 {
+		t.Fatalf("Len() = %d, want the item that is not due", q.Len())
+	}
+}
+
+func TestQueueOperations(t *testing.T) {
+	q := NewPriorityQueue[job]()
+
+	if !q.Push(job{id: "a", data: 1}, -time.Second) {
+		t.Fatal("Push() of a new id refused")
+	}
+
+	if q.Push(job{id: "a", data: 2}, -2*time.Second) {
+		t.Fatal("Push() of a queued id accepted")
+	}
+
+	if v, _, _ := q.Lookup("a"); v.data != 1 {
+		t.Fatalf("Lookup() after a refused Push() = %d, want 1", v.data)
+	}
+
+	if !q.Update(job{id: "a", data: 3}) || q.Update(job{id: "missing"}) {
+		t.Fatal("Update() reported the wrong items")
+	}
+
+	if q.Set(job{id: "b", data: 4}, -2*time.Second) {
+		t.Fatal("Set() of a new id reported a replacement")
+	}
+
+	// b is due first until a is brought forward past it.
+	if !q.Extend("a", -2*time.Second) || q.Extend("missing", time.Second) {
+		t.Fatal("Extend() reported the wrong items")
+	}
+
+	if got := q.Peek(); got.Value.id != "a" || got.Value.data != 3 {
+		t.Fatalf("Peek() = %+v, want a with data 3", got.Value)
+	}
+
+	if !q.Set(job{id: "a", data: 5}, time.Hour) {
+		t.Fatal("Set() of a queued id did not report a replacement")
+	}
+
+	if got := q.Pop(); got.Value.id != "b" {
+		t.Fatalf("Pop() = %s, want b", got.Value.id)
+	}
+
+	if !q.Remove("a") || q.Remove("a") {
+		t.Fatal("Remove() reported the wrong items")
+	}
+
+	if q.Pop() != nil || q.Peek() != nil || q.Len() != 0 {
+		t.Fatal("queue is not empty")
+	}
+}
+
+func TestQueueTrimTo(t *testing.T) {
+	q := NewPriorityQueue[job]()
+	for i := range 5 {
+		q.Push(job{id: fmt.Sprint(i)}, time.Duration(i)*time.Minute)
+	}
+
+	trimmed := q.TrimTo(2)
+	got := []string{}
+	for _, item := range trimmed {
+		got = append(got, item.Value.id)
+	}
+
+	if want := []string{"0", "1", "2"}; !slices.Equal(got, want) {
+		t.Fatalf("TrimTo() = %v, want %v", got, want)
+	}
+
+	if _, _, ok := q.Lookup("0"); ok || q.Len() != 2 {
+		t.Fatal("TrimTo() left trimmed items behind")
+	}
+
+	if len(q.TrimTo(-1)) != 2 || q.Len() != 0 {
+		t.Fatal("TrimTo() below zero did not empty the queue")
+	}
+}
+
+func TestQueueNext(t *testing.T) {
+	q := NewPriorityQueue[job]()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	got := make(chan string)
+	go func() {
+		j, err := q.Next(ctx)
+		if err != nil {
+			close(got)
+			return
+		}
+		got <- j.id
+	}()
+
+	// The waiting consumer wakes up for an item pushed after it started waiting.
+	time.Sleep(10 * time.Millisecond)
+	q.Push(job{id: "late"}, time.Hour)
+	q.Push(job{id: "soon"}, 20*time.Millisecond)
+
+	if id := <-got; id != "soon" {
+		t.Fatalf("Next() = %q, want soon", id)
+	}
+
+	canceled, stop := context.WithCancel(context.Background())
+	stop()
+	if _, err := q.Next(canceled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Next() on a canceled context = %v, want %v", err, context.Canceled)
+	}
+}
+
+// TestQueueConcurrent hammers the queue from producers, consumers and readers at once, it is meant
+// to run with -race. Every item must be consumed exactly once.
+func TestQueueConcurrent(t *testing.T) {
+	const producers, consumers, perProducer = 8, 8, 500
+
+	q := NewPriorityQueue[job]()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	seen := map[string]int{}
+	done := make(chan struct{})
+
+	var consumed sync.WaitGroup
+	consumed.Add(producers * perProducer)
+
+	var workers sync.WaitGroup
+	for range consumers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				j, err := q.Next(ctx)
+				if err != nil {
+					return
+				}
+
+				mu.Lock()
+				seen[j.id]++
+				mu.Unlock()
+				consumed.Done()
+			}
+		}()
+	}
+
+	// Readers only look, they must not take items away from the consumers.
+	for range 4 {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				if item := q.Peek(); item != nil {
+					q.Lookup(item.Value.id)
+					_ = item.Deadline()
+				}
+				q.Len()
+				q.Update(job{id: "0-0", data: -1})
+				q.Extend("1-1", 0)
+			}
+		}()
+	}
+
+	var produced sync.WaitGroup
+	for p := range producers {
+		produced.Add(1)
+		go func() {
+			defer produced.Done()
+			for i := range perProducer {
+				id := fmt.Sprintf("%d-%d", p, i)
+				if i%2 == 0 {
+					q.Push(job{id: id, data: i}, time.Duration(i%7)*time.Millisecond)
+				} else {
+					q.Set(job{id: id, data: i}, time.Duration(i%5)*time.Millisecond)
+				}
+			}
+		}()
+	}
+
+	produced.Wait()
+	waited := make(chan struct{})
+	go func() {
+		consumed.Wait()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+	case <-ctx.Done():
+		t.Fatalf("consumers stalled with %d items queued", q.Len())
+	}
+
+	close(done)
+	cancel()
+	workers.Wait()
+
+	if len(seen) != producers*perProducer {
+		t.Fatalf("consumed %d distinct items, want %d", len(seen), producers*perProducer)
+	}
+
+	for id, n := range seen {
+		if n != 1 {
+			t.Fatalf("item %s consumed %d times", id, n)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package priorityqueue
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// SchedulerStats are counters of a scheduler since it was created.
+type SchedulerStats struct {
+	Pending   int    `json:"pending"`
+	Scheduled uint64 `json:"scheduled"`
+	Debounced uint64 `json:"debounced"`
+	Canceled  uint64 `json:"canceled"`
+	Ran       uint64 `json:"ran"`
+}
+
+// Scheduler runs jobs once their delay passed, at most one job per ID is pending. It covers delayed
+// retries and debouncing: Schedule keeps the first deadline of a job, Reschedule moves it to the last.
+type Scheduler[T Identifier] struct {
+	queue *ThreadSafeQueue[T]
+
+	scheduled atomic.Uint64
+	debounced atomic.Uint64
+	canceled  atomic.Uint64
+	ran       atomic.Uint64
+}
+
+func NewScheduler[T Identifier]() *Scheduler[T] {
+	return &Scheduler[T]{queue: NewPriorityQueue[T]()}
+}
+
+// Schedule runs job after delay unless a job with the same ID is pending, and reports whether it was scheduled.
+func (s *Scheduler[T]) Schedule(job T, delay time.Duration) bool {
+	if !s.queue.Push(job, delay) {
+		s.debounced.Add(1)
+		return false
+	}
+
+	s.scheduled.Add(1)
+	return true
+}
+
+// Reschedule runs job after delay, replacing a pending job with the same ID and its deadline.
+func (s *Scheduler[T]) Reschedule(job T, delay time.Duration) {
+	if s.queue.Set(job, delay) {
+		s.debounced.Add(1)
+	} else {
+		s.scheduled.Add(1)
+	}
+}
+
+// Cancel drops the pending job with the ID and reports whether there was one.
+func (s *Scheduler[T]) Cancel(id string) bool {
+	if !s.queue.Remove(id) {
+		return false
+	}
+
+	s.canceled.Add(1)
+	return true
+}
+
+// Pending returns the job with the ID and when it runs.
+func (s *Scheduler[T]) Pending(id string) (T, time.Time, bool) {
+	return s.queue.Lookup(id)
+}
+
+// Len returns the number of pending jobs.
+func (s *Scheduler[T]) Len() int {
+	return s.queue.Len()
+}
+
+// Stats returns the pending jobs and counters of the scheduler.
+func (s *Scheduler[T]) Stats() SchedulerStats {
+	return SchedulerStats{
+		Pending:   s.queue.Len(),
+		Scheduled: s.scheduled.Load(),
+		Debounced: s.debounced.Load(),
+		Canceled:  s.canceled.Load(),
+		Ran:       s.ran.Load(),
+	}
+}
+
+// Run calls fn with every job as it becomes due, one at a time, until ctx is done. Several Run
+// loops on one scheduler share its jobs.
+func (s *Scheduler[T]) Run(ctx context.Context, fn func(job T)) error {
+	for {
+		job, err := s.queue.Next(ctx)
+		if err != nil {
+			return err
+		}
+
+		s.ran.Add(1)
+		fn(job)
+	}
+}
@@ -0,0 +1,95 @@
+package priorityqueue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSchedulerDebounce(t *testing.T) {
+	s := NewScheduler[job]()
+
+	if !s.Schedule(job{id: "a", data: 1}, time.Hour) {
+		t.Fatal("Schedule() of a new job refused")
+	}
+
+	_, first, _ := s.Pending("a")
+
+	// Schedule keeps the first deadline and value.
+	if s.Schedule(job{id: "a", data: 2}, 2*time.Hour) {
+		t.Fatal("Schedule() of a pending job accepted")
+	}
+
+	if j, at, _ := s.Pending("a"); j.data != 1 || !at.Equal(first) {
+		t.Fatalf("Pending() after Schedule() = %d at %s, want 1 at %s", j.data, at, first)
+	}
+
+	// Reschedule moves it to the last.
+	s.Reschedule(job{id: "a", data: 3}, 2*time.Hour)
+	if j, at, _ := s.Pending("a"); j.data != 3 || !at.After(first) {
+		t.Fatalf("Pending() after Reschedule() = %d at %s, want 3 after %s", j.data, at, first)
+	}
+
+	s.Reschedule(job{id: "b"}, time.Hour)
+
+	if !s.Cancel("b") || s.Cancel("b") {
+		t.Fatal("Cancel() reported the wrong jobs")
+	}
+
+	want := SchedulerStats{Pending: 1, Scheduled: 2, Debounced: 2, Canceled: 1}
+	if got := s.Stats(); got != want {
+		t.Fatalf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSchedulerRun(t *testing.T) {
+	s := NewScheduler[job]()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	ran := []string{}
+	all := make(chan struct{})
+
+	s.Schedule(job{id: "second"}, 40*time.Millisecond)
+	s.Schedule(job{id: "first"}, 10*time.Millisecond)
+	s.Schedule(job{id: "canceled"}, 20*time.Millisecond)
+	s.Cancel("canceled")
+
+	// Two loops share the jobs, each job runs once.
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Run(ctx, func(j job) {
+				mu.Lock()
+				defer mu.Unlock()
+				ran = append(ran, j.id)
+				if len(ran) == 2 {
+					close(all)
+				}
+			})
+		}()
+	}
+
+	select {
+	case <-all:
+	case <-ctx.Done():
+		t.Fatal("jobs did not run")
+	}
+
+	// Give a wrongly scheduled job the chance to run before stopping.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	if len(ran) != 2 || ran[0] != "first" || ran[1] != "second" {
+		t.Fatalf("ran %v, want [first second]", ran)
+	}
+
+	if s.Stats().Ran != 2 || s.Len() != 0 {
+		t.Fatalf("Stats() = %+v, want two runs and nothing pending", s.Stats())
+	}
+}
@@ -0,0 +1,46 @@
+package providers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+const (
+	gitHubSignatureHeader = "X-Hub-Signature-256"
+	gitHubSignaturePrefix = "sha256="
+	gitHubPingEvent       = "ping"
+)
+
+// GitHub verifies X-Hub-Signature-256 and answers ping events without forwarding them.
+var GitHub = Provider{
+	Name:       "github",
+	Label:      "GitHub",
+	EventType:  Source{Header: "X-GitHub-Event"},
+	DeliveryID: Source{Header: "X-GitHub-Delivery"},
+	verify: func(p Provider, secret string, r *Request) error {
+		signature, ok := strings.CutPrefix(r.Header.Get(gitHubSignatureHeader), gitHubSignaturePrefix)
+		if !ok || signature == "" {
+			return ErrMissingSignature
+		}
+
+		actual, err := hex.DecodeString(signature)
+		if err != nil {
+			return ErrInvalidSignature
+		}
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(r.Body)
+
+		return equal(mac.Sum(nil), actual)
+	},
+	handshake: func(r *Request) *Handshake {
+		if r.Header.Get("X-GitHub-Event") != gitHubPingEvent {
+			return nil
+		}
+
+		return &Handshake{Status: http.StatusOK, Body: map[string]string{"success": "true", "event": gitHubPingEvent}}
+	},
+}
@@ -0,0 +1,184 @@
+package providers
+
+import (
+	"crypto/hmac"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownProvider     = errors.New("Unknown provider")
+	ErrMissingSecret       = errors.New("Provider secret is not configured")
+	ErrMissingSignature    = errors.New("Request signature is missing")
+	ErrInvalidSignature    = errors.New("Request signature is invalid")
+	ErrMissingTimestamp    = errors.New("Request timestamp is missing")
+	ErrTimestampOutOfRange = errors.New("Request timestamp is outside of the allowed tolerance")
+)
+
+// Request is the provider agnostic view of an incoming webhook.
+type Request struct {
+	URL    string         // Full URL the provider sent the request to.
+	Header http.Header    // Request headers as received.
+	Body   []byte         // Raw request body, signatures are computed over it.
+	JSON   map[string]any // Decoded request body.
+	Form   url.Values     // Fields of an url encoded body, nil for other bodies.
+	Now    time.Time      // Time used for timestamp tolerance checks.
+}
+
+// Source describes where a value lives on a request, a header takes precedence over body fields.
+type Source struct {
+	Header string   // Header name holding the value.
+	Fields []string // Dot separated body paths, the first non empty one wins.
+}
+
+// Extract returns the value described by the source or an empty string.
+func (s Source) Extract(r *Request) string {
+	if s.Header != "" {
+		if v := r.Header.Get(s.Header); v != "" {
+			return v
+		}
+	}
+
+	for _, field := range s.Fields {
+		if v := Lookup(r.JSON, field); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// Handshake is a response the provider expects instead of the regular receive flow.
+type Handshake struct {
+	Status int
+	Body   any
+}
+
+// Provider bundles everything needed to accept webhooks from a well-known sender.
+type Provider struct {
+	Name               string
+	Label              string
+	EventType          Source
+	DeliveryID         Source
+	TimestampTolerance time.Duration
+	verify             func(p Provider, secret string, r *Request) error
+	handshake          func(r *Request) *Handshake
+}
+
+// Verify checks the request signature with the bucket secret.
+func (p Provider) Verify(secret string, r *Request) error {
+	if p.verify == nil {
+		return nil
+	}
+
+	if secret == "" {
+		return ErrMissingSecret
+	}
+
+	return p.verify(p, secret, r)
+}
+
+// Handshake returns the response for provider handshakes (url verification, pings) or nil.
+func (p Provider) Handshake(r *Request) *Handshake {
+	if p.handshake == nil {
+		return nil
+	}
+
+	return p.handshake(r)
+}
+
+var registry = map[string]Provider{}
+
+// Register adds a provider to the registry, replacing any provider with the same name.
+func Register(p Provider) {
+	registry[p.Name] = p
+}
+
+// Get returns the provider registered under name.
+func Get(name string) (Provider, error) {
+	p, ok := registry[name]
+	if !ok {
+		return Provider{}, ErrUnknownProvider
+	}
+
+	return p, nil
+}
+
+// Names returns the sorted names of all registered providers.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+func init() {
+	Register(GitHub)
+	Register(Stripe)
+	Register(Shopify)
+	Register(Twilio)
+	Register(Slack)
+	Register(Splay)
+}
+
+// Lookup walks a dot separated path through decoded JSON and returns the value as a string.
+func Lookup(body map[string]any, path string) string {
+	var current any = body
+	for _, key := range strings.Split(path, ".") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return ""
+		}
+
+		current = m[key]
+	}
+
+	switch v := current.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
+
+func checkTimestamp(p Provider, raw string, now time.Time) error {
+	if raw == "" {
+		return ErrMissingTimestamp
+	}
+
+	seconds, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return errors.Join(ErrMissingTimestamp, err)
+	}
+
+	if p.TimestampTolerance <= 0 {
+		return nil
+	}
+
+	diff := now.Sub(time.Unix(seconds, 0))
+	if diff < -p.TimestampTolerance || diff > p.TimestampTolerance {
+		return ErrTimestampOutOfRange
+	}
+
+	return nil
+}
+
+func equal(expected, actual []byte) error {
+	if !hmac.Equal(expected, actual) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
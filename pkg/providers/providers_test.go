@@ -0,0 +1,212 @@
+package providers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+var vectorTime = time.Unix(1700000000, 0)
+
+type vector struct {
+	name     string
+	provider Provider
+	secret   string
+	url      string
+	header   http.Header
+	body     string
+	form     url.Values
+}
+
+func (v vector) request() *Request {
+	return &Request{URL: v.url, Header: v.header, Body: []byte(v.body), Form: v.form, Now: vectorTime}
+}
+
+// The GitHub and Twilio form vectors are the examples of the provider documentation, the others
+// were signed with an independent HMAC implementation.
+var vectors = []vector{
+	{
+		name:     "github",
+		provider: GitHub,
+		secret:   "It's a Secret to Everybody",
+		header:   http.Header{"X-Hub-Signature-256": {"sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"}},
+		body:     "Hello, World!",
+	},
+	{
+		name:     "stripe",
+		provider: Stripe,
+		secret:   "whsec_test",
+		header:   http.Header{"Stripe-Signature": {"t=1700000000,v1=a3f7d2647ca8af4e7ebbd79c4f9380dbd98ee11b35cf0485b700ca327380e947"}},
+		body:     `{"id":"evt_1","type":"charge.succeeded"}`,
+	},
+	{
+		name:     "shopify",
+		provider: Shopify,
+		secret:   "shpss_test",
+		header:   http.Header{"X-Shopify-Hmac-Sha256": {"vRSdXjXJV7B05JijVC88t1r8qnGWjEthBj2mCZ02BfM="}},
+		body:     `{"id":820982911946154500}`,
+	},
+	{
+		name:     "twilio form",
+		provider: Twilio,
+		secret:   "12345",
+		url:      "https://mycompany.com/myapp.php?foo=1&bar=2",
+		header:   http.Header{"X-Twilio-Signature": {"0/KCTR6DLpKmkAf8muzZqo1nDgQ="}},
+		body:     "CallSid=CA1234567890ABCDE&Caller=%2B12349013030&Digits=1234&From=%2B12349013030&To=%2B18005551212",
+		form: url.Values{
+			"CallSid": {"CA1234567890ABCDE"},
+			"Caller":  {"+12349013030"},
+			"Digits":  {"1234"},
+			"From":    {"+12349013030"},
+			"To":      {"+18005551212"},
+		},
+	},
+	{
+		name:     "twilio json",
+		provider: Twilio,
+		secret:   "12345",
+		url:      "https://example.com/buckets/sms?bodySHA256=30bb3dea266a0b9c207d42b64678797d6f85d919bb6df3eab010eb84b5d026b9",
+		header:   http.Header{"X-Twilio-Signature": {"LEmzfybFMlHXGYaBsB9peUziYYY="}},
+		body:     `{"type":"message.delivered"}`,
+	},
+	{
+		name:     "slack",
+		provider: Slack,
+		secret:   "slack_test",
+		header: http.Header{
+			"X-Slack-Signature":         {"v0=df408eb179c1197b3f0a45dfa3ddefdf4f15eace36fac50fcd1d6af3480763ef"},
+			"X-Slack-Request-Timestamp": {"1700000000"},
+		},
+		body: "command=%2Fdeploy&text=production",
+	},
+	{
+		name:     "splay",
+		provider: Splay,
+		secret:   "splay_test",
+		header:   http.Header{"X-Splay-Signature": {"t=1700000000,v1=6b746c7852f1f6f4c253c85e7987f2a36a187cbecde3517a9e2e591cd73b869c"}},
+		body:     `{"type":"delivery.failed"}`,
+	},
+}
+
+func TestVerifyVectors(t *testing.T) {
+	for _, v := range vectors {
+		t.Run(v.name, func(t *testing.T) {
+			if err := v.provider.Verify(v.secret, v.request()); err != nil {
+				t.Fatalf("Verify() = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	for _, v := range vectors {
+		t.Run(v.name, func(t *testing.T) {
+			tests := []struct {
+				name   string
+				secret string
+				change func(r *Request)
+				want   error
+			}{
+				{name: "wrong secret", secret: v.secret + "x", want: ErrInvalidSignature},
+				{name: "missing secret", secret: "", want: ErrMissingSecret},
+				{name: "missing signature", secret: v.secret, change: func(r *Request) { r.Header = http.Header{} }, want: ErrMissingSignature},
+				{
+					name:   "tampered body",
+					secret: v.secret,
+					change: func(r *Request) {
+						r.Body = append(r.Body, ' ')
+						if r.Form != nil {
+							r.Form = url.Values{"Digits": {"0000"}}
+						}
+					},
+					want: ErrInvalidSignature,
+				},
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					r := v.request()
+					r.Header = r.Header.Clone()
+					if tt.change != nil {
+						tt.change(r)
+					}
+
+					if err := v.provider.Verify(tt.secret, r); !errors.Is(err, tt.want) {
+						t.Fatalf("Verify() = %v, want %v", err, tt.want)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestVerifyTimestampTolerance(t *testing.T) {
+	for _, v := range vectors {
+		if v.provider.TimestampTolerance == 0 {
+			continue
+		}
+
+		t.Run(v.name, func(t *testing.T) {
+			tests := []struct {
+				name string
+				now  time.Time
+				want error
+			}{
+				{name: "within tolerance", now: vectorTime.Add(v.provider.TimestampTolerance), want: nil},
+				{name: "too old", now: vectorTime.Add(v.provider.TimestampTolerance + time.Second), want: ErrTimestampOutOfRange},
+				{name: "from the future", now: vectorTime.Add(-v.provider.TimestampTolerance - time.Second), want: ErrTimestampOutOfRange},
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					r := v.request()
+					r.Now = tt.now
+
+					if err := v.provider.Verify(v.secret, r); !errors.Is(err, tt.want) {
+						t.Fatalf("Verify() = %v, want %v", err, tt.want)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestSplaySignature(t *testing.T) {
+	body := []byte(`{"type":"delivery.failed"}`)
+	header := SplaySignature("splay_test", vectorTime, body)
+
+	r := &Request{Header: http.Header{SplaySignatureHeader: {header}}, Body: body, Now: vectorTime}
+	if err := Splay.Verify("splay_test", r); err != nil {
+		t.Fatalf("Verify(SplaySignature()) = %v, want nil", err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	body := map[string]any{
+		"type":  "event_callback",
+		"event": map[string]any{"type": "message", "ts": 1531420618.0, "hidden": true},
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "type", want: "event_callback"},
+		{path: "event.type", want: "message"},
+		{path: "event.ts", want: "1531420618"},
+		{path: "event.hidden", want: "true"},
+		{path: "event", want: ""},
+		{path: "missing.type", want: ""},
+		{path: "type.nested", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := Lookup(body, tt.path); got != tt.want {
+				t.Fatalf("Lookup(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package providers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+const shopifySignatureHeader = "X-Shopify-Hmac-Sha256"
+
+// Shopify verifies the base64 encoded X-Shopify-Hmac-Sha256 header.
+var Shopify = Provider{
+	Name:       "shopify",
+	Label:      "Shopify",
+	EventType:  Source{Header: "X-Shopify-Topic"},
+	DeliveryID: Source{Header: "X-Shopify-Webhook-Id"},
+	verify: func(p Provider, secret string, r *Request) error {
+		signature := r.Header.Get(shopifySignatureHeader)
+		if signature == "" {
+			return ErrMissingSignature
+		}
+
+		actual, err := base64.StdEncoding.DecodeString(signature)
+		if err != nil {
+			return ErrInvalidSignature
+		}
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(r.Body)
+
+		return equal(mac.Sum(nil), actual)
+	},
+}
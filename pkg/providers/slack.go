@@ -0,0 +1,56 @@
+package providers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	slackSignatureHeader = "X-Slack-Signature"
+	slackTimestampHeader = "X-Slack-Request-Timestamp"
+	slackSignaturePrefix = "v0="
+	slackTolerance       = 5 * time.Minute
+	slackURLVerification = "url_verification"
+)
+
+// Slack verifies the v0 signing secret scheme and answers url_verification challenges.
+var Slack = Provider{
+	Name:               "slack",
+	Label:              "Slack",
+	EventType:          Source{Fields: []string{"event.type", "type"}},
+	DeliveryID:         Source{Fields: []string{"event_id"}},
+	TimestampTolerance: slackTolerance,
+	verify: func(p Provider, secret string, r *Request) error {
+		signature, ok := strings.CutPrefix(r.Header.Get(slackSignatureHeader), slackSignaturePrefix)
+		if !ok || signature == "" {
+			return ErrMissingSignature
+		}
+
+		actual, err := hex.DecodeString(signature)
+		if err != nil {
+			return ErrInvalidSignature
+		}
+
+		timestamp := r.Header.Get(slackTimestampHeader)
+		if err := checkTimestamp(p, timestamp, r.Now); err != nil {
+			return err
+		}
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("v0:" + timestamp + ":"))
+		mac.Write(r.Body)
+
+		return equal(mac.Sum(nil), actual)
+	},
+	handshake: func(r *Request) *Handshake {
+		if Lookup(r.JSON, "type") != slackURLVerification {
+			return nil
+		}
+
+		return &Handshake{Status: http.StatusOK, Body: map[string]string{"challenge": Lookup(r.JSON, "challenge")}}
+	},
+}
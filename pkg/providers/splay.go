@@ -0,0 +1,74 @@
+package providers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SplayEventHeader     = "X-Splay-Event"
+	SplayDeliveryHeader  = "X-Splay-Delivery"
+	SplaySignatureHeader = "X-Splay-Signature"
+	splayTolerance       = 5 * time.Minute
+)
+
+// Splay verifies the meta-webhooks Splay sends about itself, so one bucket can receive the events of
+// another Splay. They are signed like Stripe events over "{t}.{body}".
+var Splay = Provider{
+	Name:               "splay",
+	Label:              "Splay",
+	EventType:          Source{Header: SplayEventHeader, Fields: []string{"type"}},
+	DeliveryID:         Source{Header: SplayDeliveryHeader, Fields: []string{"id"}},
+	TimestampTolerance: splayTolerance,
+	verify: func(p Provider, secret string, r *Request) error {
+		header := r.Header.Get(SplaySignatureHeader)
+		if header == "" {
+			return ErrMissingSignature
+		}
+
+		var timestamp string
+		var signature []byte
+		for _, part := range strings.Split(header, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+			if !ok {
+				continue
+			}
+
+			switch key {
+			case "t":
+				timestamp = value
+			case "v1":
+				signature, _ = hex.DecodeString(value)
+			}
+		}
+
+		if len(signature) == 0 {
+			return ErrMissingSignature
+		}
+
+		if err := checkTimestamp(p, timestamp, r.Now); err != nil {
+			return err
+		}
+
+		return equal(splayMAC(secret, timestamp, r.Body), signature)
+	},
+}
+
+// SplaySignature returns the signature header value for a body sent at t.
+func SplaySignature(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(splayMAC(secret, timestamp, body))
+}
+
+func splayMAC(secret, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return mac.Sum(nil)
+}
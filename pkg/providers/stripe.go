@@ -0,0 +1,69 @@
+package providers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+const (
+	stripeSignatureHeader = "Stripe-Signature"
+	stripeTolerance       = 5 * time.Minute
+)
+
+// Stripe verifies the v1 scheme of the Stripe-Signature header, signed over "{t}.{body}".
+var Stripe = Provider{
+	Name:               "stripe",
+	Label:              "Stripe",
+	EventType:          Source{Fields: []string{"type"}},
+	DeliveryID:         Source{Fields: []string{"id"}},
+	TimestampTolerance: stripeTolerance,
+	verify: func(p Provider, secret string, r *Request) error {
+		header := r.Header.Get(stripeSignatureHeader)
+		if header == "" {
+			return ErrMissingSignature
+		}
+
+		var timestamp string
+		signatures := [][]byte{}
+		for _, part := range strings.Split(header, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+			if !ok {
+				continue
+			}
+
+			switch key {
+			case "t":
+				timestamp = value
+			case "v1":
+				if sig, err := hex.DecodeString(value); err == nil {
+					signatures = append(signatures, sig)
+				}
+			}
+		}
+
+		if len(signatures) == 0 {
+			return ErrMissingSignature
+		}
+
+		if err := checkTimestamp(p, timestamp, r.Now); err != nil {
+			return err
+		}
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(r.Body)
+		expected := mac.Sum(nil)
+
+		// Stripe sends several v1 signatures while a secret is being rolled.
+		for _, sig := range signatures {
+			if equal(expected, sig) == nil {
+				return nil
+			}
+		}
+
+		return ErrInvalidSignature
+	},
+}
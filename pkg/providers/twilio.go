@@ -0,0 +1,71 @@
+package providers
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const (
+	twilioSignatureHeader = "X-Twilio-Signature"
+	twilioBodyHashParam   = "bodySHA256"
+)
+
+// Twilio verifies X-Twilio-Signature. Form requests sign the full URL followed by every field
+// name and value in name order, JSON requests sign the URL alone and carry the hex SHA-256
+// of the body in the bodySHA256 query parameter.
+var Twilio = Provider{
+	Name:       "twilio",
+	Label:      "Twilio",
+	EventType:  Source{Fields: []string{"type", "EventType"}},
+	DeliveryID: Source{Header: "I-Twilio-Idempotency-Token", Fields: []string{"id"}},
+	verify: func(p Provider, secret string, r *Request) error {
+		signature := r.Header.Get(twilioSignatureHeader)
+		if signature == "" {
+			return ErrMissingSignature
+		}
+
+		actual, err := base64.StdEncoding.DecodeString(signature)
+		if err != nil {
+			return ErrInvalidSignature
+		}
+
+		mac := hmac.New(sha1.New, []byte(secret))
+		mac.Write([]byte(r.URL))
+
+		if r.Form != nil {
+			names := slices.Sorted(maps.Keys(r.Form))
+			for _, name := range names {
+				values := slices.Sorted(slices.Values(r.Form[name]))
+				for _, value := range values {
+					mac.Write([]byte(name + value))
+				}
+			}
+
+			return equal(mac.Sum(nil), actual)
+		}
+
+		u, err := url.Parse(r.URL)
+		if err != nil {
+			return ErrInvalidSignature
+		}
+
+		bodyHash := u.Query().Get(twilioBodyHashParam)
+		if bodyHash == "" {
+			return ErrMissingSignature
+		}
+
+		sum := sha256.Sum256(r.Body)
+		if !strings.EqualFold(hex.EncodeToString(sum[:]), bodyHash) {
+			return ErrInvalidSignature
+		}
+
+		return equal(mac.Sum(nil), actual)
+	},
+}
@@ -0,0 +1,248 @@
+package pull
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Formats a polled source can be read as.
+const (
+	JSON = "json"
+	Feed = "feed"
+)
+
+var (
+	ErrUnknownFormat = errors.New("Unknown source format")
+	ErrInvalidJSON   = errors.New("Invalid JSON document")
+	ErrInvalidFeed   = errors.New("Invalid RSS or Atom feed")
+	ErrNoItems       = errors.New("Items path does not point at a list")
+)
+
+// Items extracts the items of a polled document. JSON documents are walked along a dot separated
+// path to a list, an object at the end of the path is a single item. Feeds are read as RSS or Atom.
+func Items(format string, body []byte, path string) ([]map[string]any, error) {
+	switch format {
+	case JSON, "":
+		var doc any
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return nil, errors.Join(ErrInvalidJSON, err)
+		}
+
+		return jsonItems(doc, path)
+	case Feed:
+		return feedItems(body)
+	default:
+		return nil, errors.Join(ErrUnknownFormat, errors.New(format))
+	}
+}
+
+func jsonItems(doc any, path string) ([]map[string]any, error) {
+	current, ok := Lookup(doc, path)
+	if !ok {
+		return nil, ErrNoItems
+	}
+
+	switch v := current.(type) {
+	case map[string]any:
+		return []map[string]any{v}, nil
+	case []any:
+		items := make([]map[string]any, 0, len(v))
+		for _, element := range v {
+			// Scalars are wrapped so every item is stored as an object.
+			item, ok := element.(map[string]any)
+			if !ok {
+				item = map[string]any{"value": element}
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, ErrNoItems
+	}
+}
+
+// Lookup walks a dot separated path of object keys and list indexes, an empty path is the document itself.
+func Lookup(doc any, path string) (any, bool) {
+	if path = strings.Trim(path, ". "); path == "" {
+		return doc, true
+	}
+
+	current := doc
+	for _, key := range strings.Split(path, ".") {
+		switch v := current.(type) {
+		case map[string]any:
+			next, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			current = v[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+// Key identifies an item for deduplication by the value at path, items without one are keyed by
+// a hash of their content.
+func Key(item map[string]any, path string) string {
+	if value, ok := Lookup(item, path); ok && path != "" {
+		switch v := value.(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+
+	// Map keys are marshalled sorted, so equal items hash the same.
+	raw, _ := json.Marshal(item)
+	sum := sha256.Sum256(raw)
+
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+type rssDocument struct {
+	Items []struct {
+		Title       string   `xml:"title"`
+		Link        string   `xml:"link"`
+		GUID        string   `xml:"guid"`
+		PubDate     string   `xml:"pubDate"`
+		Description string   `xml:"description"`
+		Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+		Author      string   `xml:"author"`
+		Categories  []string `xml:"category"`
+	} `xml:"channel>item"`
+}
+
+type atomDocument struct {
+	Entries []struct {
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		ID        string `xml:"id"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+		Summary   string `xml:"summary"`
+		Content   string `xml:"content"`
+		Author    string `xml:"author>name"`
+	} `xml:"entry"`
+}
+
+// feedItems reads RSS 2.0 items or Atom entries into objects with the same keys, the id falls back
+// to the link when a feed has no guids.
+func feedItems(body []byte) ([]map[string]any, error) {
+	root, err := rootElement(body)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidFeed, err)
+	}
+
+	items := []map[string]any{}
+	switch root {
+	case "rss":
+		doc := rssDocument{}
+		if err := newDecoder(body).Decode(&doc); err != nil {
+			return nil, errors.Join(ErrInvalidFeed, err)
+		}
+
+		for _, item := range doc.Items {
+			categories := make([]any, 0, len(item.Categories))
+			for _, c := range item.Categories {
+				categories = append(categories, c)
+			}
+
+			items = append(items, map[string]any{
+				"id":         first(item.GUID, item.Link, item.Title),
+				"title":      item.Title,
+				"link":       item.Link,
+				"published":  item.PubDate,
+				"summary":    item.Description,
+				"content":    item.Content,
+				"author":     item.Author,
+				"categories": categories,
+			})
+		}
+	case "feed":
+		doc := atomDocument{}
+		if err := newDecoder(body).Decode(&doc); err != nil {
+			return nil, errors.Join(ErrInvalidFeed, err)
+		}
+
+		for _, entry := range doc.Entries {
+			link := ""
+			for _, l := range entry.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					link = l.Href
+					break
+				}
+			}
+
+			items = append(items, map[string]any{
+				"id":        first(entry.ID, link, entry.Title),
+				"title":     entry.Title,
+				"link":      link,
+				"published": first(entry.Published, entry.Updated),
+				"updated":   entry.Updated,
+				"summary":   entry.Summary,
+				"content":   entry.Content,
+				"author":    entry.Author,
+			})
+		}
+	default:
+		return nil, errors.Join(ErrInvalidFeed, errors.New(root))
+	}
+
+	return items, nil
+}
+
+func rootElement(body []byte) (string, error) {
+	decoder := newDecoder(body)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+// newDecoder reads feeds in any declared charset as is, most non UTF-8 feeds only differ in rare characters.
+func newDecoder(body []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	return decoder
+}
+
+func first(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,229 @@
+package pull
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestItemsJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		path string
+		want []map[string]any
+		err  error
+	}{
+		{
+			name: "top level list",
+			body: `[{"id": 1}, {"id": 2}]`,
+			want: []map[string]any{{"id": 1.0}, {"id": 2.0}},
+		},
+		{
+			name: "nested list",
+			body: `{"data": {"orders": [{"id": "a"}]}}`,
+			path: "data.orders",
+			want: []map[string]any{{"id": "a"}},
+		},
+		{
+			name: "object is a single item",
+			body: `{"data": {"id": "a"}}`,
+			path: ".data.",
+			want: []map[string]any{{"id": "a"}},
+		},
+		{
+			name: "scalars are wrapped",
+			body: `{"ids": [1, "b", null]}`,
+			path: "ids",
+			want: []map[string]any{{"value": 1.0}, {"value": "b"}, {"value": nil}},
+		},
+		{
+			name: "list index in the path",
+			body: `{"pages": [{"items": [{"id": 1}]}]}`,
+			path: "pages.0.items",
+			want: []map[string]any{{"id": 1.0}},
+		},
+		{name: "missing path", body: `{"data": []}`, path: "items", err: ErrNoItems},
+		{name: "path to a scalar", body: `{"count": 3}`, path: "count", err: ErrNoItems},
+		{name: "invalid json", body: `{"data": `, err: ErrInvalidJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Items(JSON, []byte(tt.body), tt.path)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Items() error = %v, want %v", err, tt.err)
+			}
+
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Items() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Items("csv", []byte(""), ""); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("Items() error = %v, want %v", err, ErrUnknownFormat)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	doc := map[string]any{"a": map[string]any{"b": []any{"x", map[string]any{"c": 1.0}}}}
+
+	tests := []struct {
+		path string
+		want any
+		ok   bool
+	}{
+		{"a.b.0", "x", true},
+		{"a.b.1.c", 1.0, true},
+		{"a.b.2", nil, false},
+		{"a.b.-1", nil, false},
+		{"a.b.first", nil, false},
+		{"a.missing", nil, false},
+		{"a.b.0.deeper", nil, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := Lookup(doc, tt.path)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Lookup(%q) = %v, %v, want %v, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	if got, ok := Lookup(doc, " "); !ok || !reflect.DeepEqual(got, doc) {
+		t.Errorf("Lookup() of an empty path = %v, %v, want the document", got, ok)
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		name string
+		item map[string]any
+		path string
+		want string
+	}{
+		{"string id", map[string]any{"id": "ord_1"}, "id", "ord_1"},
+		{"numeric id", map[string]any{"id": 12345678901.0}, "id", "12345678901"},
+		{"nested id", map[string]any{"meta": map[string]any{"id": "x"}}, "meta.id", "x"},
+	}
+
+	for _, tt := range tests {
+		if got := Key(tt.item, tt.path); got != tt.want {
+			t.Errorf("%s: Key() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// Items without a usable key are identified by their content, whatever the key order.
+	a := Key(map[string]any{"x": 1.0, "y": "b", "id": ""}, "id")
+	b := Key(map[string]any{"id": "", "y": "b", "x": 1.0}, "id")
+	c := Key(map[string]any{"x": 2.0, "y": "b", "id": ""}, "id")
+	if !strings.HasPrefix(a, "sha256:") || a != b || a == c {
+		t.Errorf("content keys = %q, %q, %q", a, b, c)
+	}
+
+	if Key(map[string]any{"id": "x"}, "") != Key(map[string]any{"id": "x"}, "missing") {
+		t.Error("an empty path does not key by content")
+	}
+}
+
+const rssFeed = `<?xml version="1.0" encoding="ISO-8859-1"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/">
+<channel>
+	<title>Releases</title>
+	<item>
+		<title>v1.2</title>
+		<link>https://example.com/v1.2</link>
+		<guid>release-1.2</guid>
+		<pubDate>Mon, 03 Feb 2025 10:00:00 GMT</pubDate>
+		<description>Fixes</description>
+		<content:encoded><![CDATA[<p>Fixes</p>]]></content:encoded>
+		<category>go</category>
+		<category>release</category>
+	</item>
+	<item>
+		<title>v1.1</title>
+		<link>https://example.com/v1.1</link>
+	</item>
+</channel>
+</rss>`
+
+const atomFeed = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<title>Status</title>
+	<entry>
+		<title>Outage</title>
+		<link rel="self" href="https://example.com/api/1"/>
+		<link href="https://example.com/incidents/1"/>
+		<id>urn:incident:1</id>
+		<updated>2025-02-03T10:00:00Z</updated>
+		<summary>Down</summary>
+		<author><name>Ops</name></author>
+	</entry>
+	<entry>
+		<title>Recovered</title>
+		<link rel="alternate" href="https://example.com/incidents/2"/>
+		<published>2025-02-04T10:00:00Z</published>
+	</entry>
+</feed>`
+
+func TestItemsFeed(t *testing.T) {
+	items, err := Items(Feed, []byte(rssFeed), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []map[string]any{
+		{
+			"id": "release-1.2", "title": "v1.2", "link": "https://example.com/v1.2",
+			"published": "Mon, 03 Feb 2025 10:00:00 GMT", "summary": "Fixes", "content": "<p>Fixes</p>",
+			"author": "", "categories": []any{"go", "release"},
+		},
+		{
+			"id": "https://example.com/v1.1", "title": "v1.1", "link": "https://example.com/v1.1",
+			"published": "", "summary": "", "content": "", "author": "", "categories": []any{},
+		},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Fatalf("Items() of rss = %v, want %v", items, want)
+	}
+
+	if items, err = Items(Feed, []byte(atomFeed), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	want = []map[string]any{
+		{
+			"id": "urn:incident:1", "title": "Outage", "link": "https://example.com/incidents/1",
+			"published": "2025-02-03T10:00:00Z", "updated": "2025-02-03T10:00:00Z", "summary": "Down",
+			"content": "", "author": "Ops",
+		},
+		{
+			"id": "https://example.com/incidents/2", "title": "Recovered", "link": "https://example.com/incidents/2",
+			"published": "2025-02-04T10:00:00Z", "updated": "", "summary": "", "content": "", "author": "",
+		},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Fatalf("Items() of atom = %v, want %v", items, want)
+	}
+}
+
+func TestItemsFeedErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"not xml", `{"items": []}`},
+		{"other root", `<html><body></body></html>`},
+		{"truncated", `<rss><channel><item><title>x`},
+		{"empty", ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Items(Feed, []byte(tt.body), ""); !errors.Is(err, ErrInvalidFeed) {
+				t.Fatalf("Items() error = %v, want %v", err, ErrInvalidFeed)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// idleAfter is how long an unused limiter is kept before it is swept.
+const idleAfter = 10 * time.Minute
+
+// Never is the wait returned for a reservation that can never be granted, n over the burst of a limit.
+const Never = time.Duration(math.MaxInt64)
+
+// Limit is a request rate with a burst, a zero rate disables the limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l Limit) Enabled() bool {
+	return l.Rate > 0
+}
+
+type entry struct {
+	limiter *rate.Limiter
+	limit   Limit
+	seen    time.Time
+}
+
+// Limiters keeps a token bucket per key, like a bucket or a user id.
+type Limiters struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+	swept   time.Time
+}
+
+func New() *Limiters {
+	return &Limiters{entries: map[string]*entry{}}
+}
+
+// Reservation holds tokens taken from one or more limiters.
+type Reservation struct {
+	reservations []*rate.Reservation
+}
+
+// Cancel gives the tokens back, used when a later check refuses the request.
+func (r *Reservation) Cancel() {
+	r.cancelAt(time.Now())
+}
+
+func (r *Reservation) cancelAt(now time.Time) {
+	for _, res := range r.reservations {
+		res.CancelAt(now)
+	}
+}
+
+// Reserve takes a token from every enabled limit, keyed in the same order. When one of them
+// is exhausted nothing is taken and the time to wait before retrying is returned.
+func (l *Limiters) Reserve(now time.Time, keys []string, limits []Limit) (*Reservation, time.Duration) {
+	return l.ReserveN(now, keys, limits, 1)
+}
+
+// ReserveN is like Reserve but takes n tokens from every enabled limit, like one per event of a
+// batch. A limit never gives out more than its burst at once, n over the burst waits Never.
+func (l *Limiters) ReserveN(now time.Time, keys []string, limits []Limit, n int) (*Reservation, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	r := &Reservation{}
+	for i, key := range keys {
+		limit := limits[i]
+		if !limit.Enabled() {
+			continue
+		}
+
+		limiter := l.limiter(now, key, limit)
+		res := limiter.ReserveN(now, max(n, 1))
+		if !res.OK() {
+			r.cancelAt(now)
+			return nil, Never
+		}
+
+		if delay := res.DelayFrom(now); delay > 0 {
+			res.CancelAt(now)
+			r.cancelAt(now)
+			return nil, delay
+		}
+
+		r.reservations = append(r.reservations, res)
+	}
+
+	return r, 0
+}
+
+func (l *Limiters) limiter(now time.Time, key string, limit Limit) *rate.Limiter {
+	burst := max(limit.Burst, 1)
+
+	e, ok := l.entries[key]
+	if !ok {
+		e = &entry{limiter: rate.NewLimiter(rate.Limit(limit.Rate), burst), limit: limit}
+		l.entries[key] = e
+	} else if e.limit != limit {
+		// Limits changed on the bucket or user, keep the tokens but apply the new rate.
+		e.limiter.SetLimitAt(now, rate.Limit(limit.Rate))
+		e.limiter.SetBurstAt(now, burst)
+		e.limit = limit
+	}
+	e.seen = now
+
+	return e.limiter
+}
+
+func (l *Limiters) sweep(now time.Time) {
+	if now.Sub(l.swept) < idleAfter {
+		return
+	}
+	l.swept = now
+
+	for key, e := range l.entries {
+		if now.Sub(e.seen) > idleAfter {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// Period returns the monthly quota period of a time, like "2025-02".
+func Period(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// NextPeriod returns the start of the quota period following the one of t.
+func NextPeriod(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// RetryAfter renders a wait as the whole seconds of a Retry-After header.
+func RetryAfter(d time.Duration) int {
+	return max(int(math.Ceil(d.Seconds())), 1)
+}
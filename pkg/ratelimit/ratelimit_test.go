@@ -0,0 +1,208 @@
+package ratelimit
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2025, 2, 14, 12, 0, 0, 0, time.UTC)
+
+func TestReserve(t *testing.T) {
+	l := New()
+	keys := []string{"bucket:b1", "user:u1"}
+	limits := []Limit{{Rate: 1, Burst: 2}, {Rate: 10, Burst: 10}}
+
+	for i := range 2 {
+		if r, wait := l.Reserve(start, keys, limits); r == nil {
+			t.Fatalf("Reserve() #%d refused, wait %s", i, wait)
+		}
+	}
+
+	r, wait := l.Reserve(start, keys, limits)
+	if r != nil {
+		t.Fatal("Reserve() past the burst was allowed")
+	}
+
+	if wait != time.Second {
+		t.Fatalf("Reserve() wait = %s, want %s", wait, time.Second)
+	}
+
+	if r, _ := l.Reserve(start.Add(time.Second), keys, limits); r == nil {
+		t.Fatal("Reserve() after the refill was refused")
+	}
+}
+
+func TestReserveN(t *testing.T) {
+	l := New()
+	keys := []string{"bucket:b1"}
+	limits := []Limit{{Rate: 1, Burst: 10}}
+
+	if r, _ := l.ReserveN(start, keys, limits, 8); r == nil {
+		t.Fatal("ReserveN() within the burst refused")
+	}
+
+	r, wait := l.ReserveN(start, keys, limits, 5)
+	if r != nil {
+		t.Fatal("ReserveN() past the remaining tokens was allowed")
+	}
+
+	if wait != 3*time.Second {
+		t.Fatalf("ReserveN() wait = %s, want %s", wait, 3*time.Second)
+	}
+
+	// A batch takes a token per event.
+	later := start.Add(time.Hour)
+	if r, _ := l.ReserveN(later, keys, limits, 10); r == nil {
+		t.Fatal("ReserveN() of the whole burst refused")
+	}
+
+	if _, wait := l.Reserve(later, keys, limits); wait != time.Second {
+		t.Fatalf("Reserve() after a ReserveN() of the whole burst wait = %s, want %s", wait, time.Second)
+	}
+
+	// A batch larger than the burst can never be granted, nothing is taken.
+	if r, wait := l.ReserveN(start.Add(2*time.Hour), keys, limits, 11); r != nil || wait != Never {
+		t.Fatalf("ReserveN() over the burst = %v, %s, want refused forever", r, wait)
+	}
+
+	if r, _ := l.ReserveN(start.Add(2*time.Hour), keys, limits, 10); r == nil {
+		t.Fatal("ReserveN() after a ReserveN() over the burst refused")
+	}
+}
+
+func TestReserveTakesNothingWhenRefused(t *testing.T) {
+	l := New()
+	limits := []Limit{{Rate: 100, Burst: 100}, {Rate: 1, Burst: 1}}
+
+	if r, _ := l.Reserve(start, []string{"bucket:b1", "user:u1"}, limits); r == nil {
+		t.Fatal("first Reserve() refused")
+	}
+
+	// The user limit is exhausted, the bucket must not lose tokens to refused requests.
+	for range 50 {
+		if r, _ := l.Reserve(start, []string{"bucket:b2", "user:u1"}, limits); r != nil {
+			t.Fatal("Reserve() over the user limit was allowed")
+		}
+	}
+
+	for i := range 100 {
+		if r, _ := l.Reserve(start, []string{"bucket:b2"}, limits[:1]); r == nil {
+			t.Fatalf("Reserve() #%d on the bucket was refused, refused requests took its tokens", i)
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	l := New()
+	keys := []string{"bucket:b1"}
+	limits := []Limit{{Rate: 1, Burst: 1}}
+
+	r, _ := l.Reserve(start, keys, limits)
+	if r == nil {
+		t.Fatal("Reserve() refused")
+	}
+	r.cancelAt(start)
+
+	if r, _ := l.Reserve(start, keys, limits); r == nil {
+		t.Fatal("Reserve() after Cancel() refused, the token was not given back")
+	}
+}
+
+func TestDisabledAndZeroBurst(t *testing.T) {
+	l := New()
+
+	for range 1000 {
+		if r, _ := l.Reserve(start, []string{"bucket:b1"}, []Limit{{}}); r == nil {
+			t.Fatal("Reserve() refused under a disabled limit")
+		}
+	}
+
+	// A zero burst still lets a single request through.
+	if r, _ := l.Reserve(start, []string{"bucket:b2"}, []Limit{{Rate: 1}}); r == nil {
+		t.Fatal("Reserve() refused under a zero burst")
+	}
+}
+
+func TestLimitChange(t *testing.T) {
+	l := New()
+	keys := []string{"bucket:b1"}
+
+	if r, _ := l.Reserve(start, keys, []Limit{{Rate: 1, Burst: 1}}); r == nil {
+		t.Fatal("Reserve() refused")
+	}
+
+	if r, _ := l.Reserve(start, keys, []Limit{{Rate: 1, Burst: 1}}); r != nil {
+		t.Fatal("Reserve() past the burst was allowed")
+	}
+
+	// Raising the limit keeps the tokens of the existing limiter but refills it at the new rate.
+	raised := []Limit{{Rate: 10, Burst: 1}}
+	if r, _ := l.Reserve(start.Add(100*time.Millisecond), keys, raised); r != nil {
+		t.Fatal("Reserve() right after raising the limit was allowed")
+	}
+
+	if r, _ := l.Reserve(start.Add(200*time.Millisecond), keys, raised); r == nil {
+		t.Fatal("Reserve() under the raised limit refused")
+	}
+}
+
+func TestSweep(t *testing.T) {
+	l := New()
+	l.Reserve(start, []string{"bucket:old"}, []Limit{{Rate: 1, Burst: 1}})
+	l.Reserve(start.Add(idleAfter), []string{"bucket:new"}, []Limit{{Rate: 1, Burst: 1}})
+	l.Reserve(start.Add(2*idleAfter), []string{"bucket:new"}, []Limit{{Rate: 1, Burst: 1}})
+
+	if _, ok := l.entries["bucket:old"]; ok {
+		t.Fatal("idle limiter was not swept")
+	}
+
+	if _, ok := l.entries["bucket:new"]; !ok {
+		t.Fatal("active limiter was swept")
+	}
+}
+
+func TestPeriod(t *testing.T) {
+	tests := []struct {
+		at     time.Time
+		period string
+		next   time.Time
+	}{
+		{at: start, period: "2025-02", next: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{at: time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC), period: "2025-12", next: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{at: time.Date(2025, 3, 1, 0, 30, 0, 0, time.FixedZone("CET", 3600)), period: "2025-02", next: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.at.String(), func(t *testing.T) {
+			if got := Period(tt.at); got != tt.period {
+				t.Fatalf("Period() = %s, want %s", got, tt.period)
+			}
+
+			if got := NextPeriod(tt.at); !got.Equal(tt.next) {
+				t.Fatalf("NextPeriod() = %s, want %s", got, tt.next)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want int
+	}{
+		{wait: 0, want: 1},
+		{wait: 10 * time.Millisecond, want: 1},
+		{wait: 1500 * time.Millisecond, want: 2},
+		{wait: time.Minute, want: 60},
+		{wait: time.Duration(math.MaxInt64), want: int(math.Ceil(time.Duration(math.MaxInt64).Seconds()))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wait.String(), func(t *testing.T) {
+			if got := RetryAfter(tt.wait); got != tt.want {
+				t.Fatalf("RetryAfter(%s) = %d, want %d", tt.wait, got, tt.want)
+			}
+		})
+	}
+}
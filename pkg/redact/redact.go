@@ -0,0 +1,362 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	Mask = "[REDACTED]"
+
+	wildcard    = "*"
+	arraySuffix = "[]"
+	hashPrefix  = "hmac-sha256:"
+)
+
+// Kind is what a rule matches on.
+type Kind string
+
+const (
+	KindPath    Kind = "path"    // A dot separated JSON path, "*" matches any key and a "[]" suffix any array element.
+	KindHeader  Kind = "header"  // A header name, matched case insensitively.
+	KindPattern Kind = "pattern" // A regular expression or builtin pattern name applied to every string value.
+)
+
+// Mode is what happens to a matched value.
+type Mode string
+
+const (
+	ModeMask Mode = "mask" // Replace the value (or the matched text for patterns) with [REDACTED].
+	ModeHash Mode = "hash" // Replace the value with a keyed hash so equal values stay correlatable.
+	ModeDrop Mode = "drop" // Remove the field or header entirely.
+)
+
+var (
+	ErrInvalidKind    = errors.New("Invalid redaction rule kind")
+	ErrInvalidMode    = errors.New("Invalid redaction rule mode")
+	ErrInvalidTarget  = errors.New("Invalid redaction rule target")
+	ErrInvalidPattern = errors.New("Invalid redaction rule pattern")
+	ErrMissingKey     = errors.New("Hash redaction requires a redaction key")
+)
+
+// Builtin patterns usable by name as the target of a pattern rule.
+var Builtin = map[string]*regexp.Regexp{
+	"email": regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	"card":  regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+	"jwt":   regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`),
+}
+
+// Rule is a single redaction rule as stored on a bucket.
+type Rule struct {
+	Kind   Kind   `json:"kind"`
+	Target string `json:"target"`
+	Mode   Mode   `json:"mode"`
+}
+
+type pattern struct {
+	re   *regexp.Regexp
+	card bool
+	mode Mode
+}
+
+type path struct {
+	segments []string
+	mode     Mode
+}
+
+// Redactor applies a compiled set of rules to bodies and headers.
+type Redactor struct {
+	key      []byte
+	paths    []path
+	headers  map[string]Mode
+	patterns []pattern
+}
+
+// New compiles rules, key is used for the keyed hashes of the hash mode which is refused without one.
+func New(rules []Rule, key []byte) (*Redactor, error) {
+	r := &Redactor{key: key, headers: map[string]Mode{}}
+	for _, rule := range rules {
+		switch rule.Mode {
+		case ModeMask, ModeDrop:
+		case ModeHash:
+			if len(key) == 0 {
+				return nil, ErrMissingKey
+			}
+		default:
+			return nil, ErrInvalidMode
+		}
+
+		target := strings.TrimSpace(rule.Target)
+		if target == "" {
+			return nil, ErrInvalidTarget
+		}
+
+		switch rule.Kind {
+		case KindPath:
+			r.paths = append(r.paths, path{segments: strings.Split(target, "."), mode: rule.Mode})
+		case KindHeader:
+			r.headers[http.CanonicalHeaderKey(target)] = rule.Mode
+		case KindPattern:
+			if re, ok := Builtin[target]; ok {
+				r.patterns = append(r.patterns, pattern{re: re, card: target == "card", mode: rule.Mode})
+				continue
+			}
+
+			re, err := regexp.Compile(target)
+			if err != nil {
+				return nil, errors.Join(ErrInvalidPattern, err)
+			}
+			r.patterns = append(r.patterns, pattern{re: re, mode: rule.Mode})
+		default:
+			return nil, ErrInvalidKind
+		}
+	}
+
+	return r, nil
+}
+
+// Empty reports whether the redactor has no rules.
+func (r *Redactor) Empty() bool {
+	return len(r.paths) == 0 && len(r.headers) == 0 && len(r.patterns) == 0
+}
+
+// Body returns a redacted deep copy of a decoded JSON body.
+func (r *Redactor) Body(body map[string]any) map[string]any {
+	out, _ := copyValue(body).(map[string]any)
+	for _, p := range r.paths {
+		r.applyPath(out, p.segments, p.mode)
+	}
+
+	if len(r.patterns) > 0 {
+		v, _ := r.applyPatterns(out)
+		out, _ = v.(map[string]any)
+	}
+
+	return out
+}
+
+// Headers returns a redacted copy of the headers.
+func (r *Redactor) Headers(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for name, values := range h {
+		mode, ok := r.headers[http.CanonicalHeaderKey(name)]
+		if ok && mode == ModeDrop {
+			continue
+		}
+
+		redacted := make([]string, 0, len(values))
+		for _, value := range values {
+			if ok {
+				redacted = append(redacted, r.replace(value, mode))
+				continue
+			}
+
+			if v, keep := r.applyPatterns(value); keep {
+				redacted = append(redacted, v.(string))
+			}
+		}
+
+		if len(redacted) > 0 {
+			out[name] = redacted
+		}
+	}
+
+	return out
+}
+
+func (r *Redactor) applyPath(v any, segments []string, mode Mode) {
+	obj, ok := v.(map[string]any)
+	if !ok || len(segments) == 0 {
+		return
+	}
+
+	segment, depth := segments[0], 0
+	for trimmed, ok := strings.CutSuffix(segment, arraySuffix); ok; trimmed, ok = strings.CutSuffix(segment, arraySuffix) {
+		segment = trimmed
+		depth++
+	}
+
+	for key, child := range obj {
+		if segment != wildcard && segment != key {
+			continue
+		}
+
+		if len(segments) == 1 {
+			switch {
+			case depth > 0:
+				// A path ending on array elements redacts each element in place.
+				obj[key] = r.replaceElements(child, depth, mode)
+			case mode == ModeDrop:
+				delete(obj, key)
+			default:
+				obj[key] = r.replaceValue(child, mode)
+			}
+			continue
+		}
+
+		for _, elem := range elements(child, depth) {
+			r.applyPath(elem, segments[1:], mode)
+		}
+	}
+}
+
+func elements(v any, depth int) []any {
+	current := []any{v}
+	for range depth {
+		next := []any{}
+		for _, c := range current {
+			if arr, ok := c.([]any); ok {
+				next = append(next, arr...)
+			}
+		}
+		current = next
+	}
+
+	return current
+}
+
+func (r *Redactor) replaceElements(v any, depth int, mode Mode) any {
+	arr, ok := v.([]any)
+	if !ok {
+		return v
+	}
+
+	out := make([]any, 0, len(arr))
+	for _, elem := range arr {
+		if depth > 1 {
+			out = append(out, r.replaceElements(elem, depth-1, mode))
+			continue
+		}
+
+		if mode != ModeDrop {
+			out = append(out, r.replaceValue(elem, mode))
+		}
+	}
+
+	return out
+}
+
+// applyPatterns walks a value and redacts pattern matches in strings, the bool is false
+// when the value must be dropped.
+func (r *Redactor) applyPatterns(v any) (any, bool) {
+	switch t := v.(type) {
+	case map[string]any:
+		for key, child := range t {
+			redacted, keep := r.applyPatterns(child)
+			if !keep {
+				delete(t, key)
+				continue
+			}
+			t[key] = redacted
+		}
+		return t, true
+	case []any:
+		out := make([]any, 0, len(t))
+		for _, child := range t {
+			if redacted, keep := r.applyPatterns(child); keep {
+				out = append(out, redacted)
+			}
+		}
+		return out, true
+	case string:
+		for _, p := range r.patterns {
+			matched := false
+			t = p.re.ReplaceAllStringFunc(t, func(match string) string {
+				if p.card && !luhn(match) {
+					return match
+				}
+
+				matched = true
+				return r.replace(match, p.mode)
+			})
+
+			if matched && p.mode == ModeDrop {
+				return nil, false
+			}
+		}
+		return t, true
+	default:
+		return v, true
+	}
+}
+
+func (r *Redactor) replaceValue(v any, mode Mode) any {
+	if mode != ModeHash {
+		return Mask
+	}
+
+	switch v.(type) {
+	case map[string]any, []any:
+		return Mask
+	default:
+		return r.hash(fmt.Sprint(v))
+	}
+}
+
+func (r *Redactor) replace(s string, mode Mode) string {
+	switch mode {
+	case ModeHash:
+		return r.hash(s)
+	case ModeDrop:
+		return ""
+	default:
+		return Mask
+	}
+}
+
+func (r *Redactor) hash(s string) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(s))
+
+	return hashPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func copyValue(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for key, child := range t {
+			out[key] = copyValue(child)
+		}
+		return out
+	case []any:
+		out := make([]any, len(t))
+		for i, child := range t {
+			out[i] = copyValue(child)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// luhn filters card pattern matches that are merely long numbers.
+func luhn(s string) bool {
+	sum, double, digits := 0, false, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+
+		sum += d
+		double = !double
+		digits++
+	}
+
+	return digits >= 13 && sum%10 == 0
+}
@@ -0,0 +1,208 @@
+package redact
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func decode(t *testing.T, raw string) map[string]any {
+	t.Helper()
+
+	body := map[string]any{}
+	if err := json.Unmarshal([]byte(raw), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	return body
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+		key   []byte
+		want  error
+	}{
+		{name: "no rules", rules: nil, want: nil},
+		{name: "mask path", rules: []Rule{{Kind: KindPath, Target: "card", Mode: ModeMask}}, want: nil},
+		{name: "hash with key", rules: []Rule{{Kind: KindHeader, Target: "authorization", Mode: ModeHash}}, key: testKey, want: nil},
+		{name: "hash without key", rules: []Rule{{Kind: KindHeader, Target: "authorization", Mode: ModeHash}}, want: ErrMissingKey},
+		{name: "unknown mode", rules: []Rule{{Kind: KindPath, Target: "card", Mode: "erase"}}, want: ErrInvalidMode},
+		{name: "unknown kind", rules: []Rule{{Kind: "query", Target: "card", Mode: ModeMask}}, want: ErrInvalidKind},
+		{name: "blank target", rules: []Rule{{Kind: KindPath, Target: " ", Mode: ModeMask}}, want: ErrInvalidTarget},
+		{name: "invalid pattern", rules: []Rule{{Kind: KindPattern, Target: "([a-z", Mode: ModeMask}}, want: ErrInvalidPattern},
+		{name: "builtin pattern", rules: []Rule{{Kind: KindPattern, Target: "email", Mode: ModeDrop}}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.rules, tt.key); !errors.Is(err, tt.want) {
+				t.Fatalf("New() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBody(t *testing.T) {
+	body := `{
+		"user": {"email": "ada@example.com", "name": "Ada"},
+		"cards": [{"number": "4242 4242 4242 4242"}, {"number": "4000 0000 0000 0002"}],
+		"tags": [["a", "b"], ["c"]],
+		"note": "call ada@example.com about order 1234567890123",
+		"token": "eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.sig"
+	}`
+
+	tests := []struct {
+		name  string
+		rules []Rule
+		want  string
+	}{
+		{
+			name:  "mask path",
+			rules: []Rule{{Kind: KindPath, Target: "user.email", Mode: ModeMask}},
+			want:  `{"user": {"email": "[REDACTED]", "name": "Ada"}}`,
+		},
+		{
+			name:  "drop path",
+			rules: []Rule{{Kind: KindPath, Target: "user.email", Mode: ModeDrop}},
+			want:  `{"user": {"name": "Ada"}}`,
+		},
+		{
+			name:  "wildcard",
+			rules: []Rule{{Kind: KindPath, Target: "user.*", Mode: ModeMask}},
+			want:  `{"user": {"email": "[REDACTED]", "name": "[REDACTED]"}}`,
+		},
+		{
+			name:  "array elements",
+			rules: []Rule{{Kind: KindPath, Target: "cards[].number", Mode: ModeMask}},
+			want:  `{"cards": [{"number": "[REDACTED]"}, {"number": "[REDACTED]"}]}`,
+		},
+		{
+			name:  "nested array elements dropped",
+			rules: []Rule{{Kind: KindPath, Target: "tags[][]", Mode: ModeDrop}},
+			want:  `{"tags": [[], []]}`,
+		},
+		{
+			name:  "email pattern",
+			rules: []Rule{{Kind: KindPattern, Target: "email", Mode: ModeMask}},
+			want:  `{"user": {"email": "[REDACTED]", "name": "Ada"}, "note": "call [REDACTED] about order 1234567890123"}`,
+		},
+		{
+			name:  "card pattern skips numbers failing luhn",
+			rules: []Rule{{Kind: KindPattern, Target: "card", Mode: ModeMask}},
+			want:  `{"cards": [{"number": "[REDACTED]"}, {"number": "[REDACTED]"}], "note": "call ada@example.com about order 1234567890123"}`,
+		},
+		{
+			name:  "jwt pattern drops the value",
+			rules: []Rule{{Kind: KindPattern, Target: "jwt", Mode: ModeDrop}},
+			want:  `{"token": null}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(tt.rules, testKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			original := decode(t, body)
+			got := r.Body(original)
+
+			// Only compare the keys the case is about, a null marks a key that must be gone.
+			for key, want := range decode(t, tt.want) {
+				value, ok := got[key]
+				if want == nil {
+					if ok {
+						t.Fatalf("Body()[%q] = %v, want it dropped", key, value)
+					}
+					continue
+				}
+
+				if !reflect.DeepEqual(value, want) {
+					t.Fatalf("Body()[%q] = %v, want %v", key, value, want)
+				}
+			}
+
+			if !reflect.DeepEqual(original, decode(t, body)) {
+				t.Fatal("Body() modified its input")
+			}
+		})
+	}
+}
+
+func TestHash(t *testing.T) {
+	rules := []Rule{{Kind: KindPath, Target: "email", Mode: ModeHash}}
+	body := map[string]any{"email": "ada@example.com"}
+
+	r, err := New(rules, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := r.Body(body)["email"].(string), r.Body(body)["email"].(string)
+	if !strings.HasPrefix(first, hashPrefix) {
+		t.Fatalf("hash %q lacks the %q prefix", first, hashPrefix)
+	}
+
+	if first != second {
+		t.Fatalf("hashes of equal values differ: %q != %q", first, second)
+	}
+
+	other, err := New(rules, []byte("another key for another bucket.."))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := other.Body(body)["email"]; got == first {
+		t.Fatalf("hashes under different keys are equal: %q", got)
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	header := http.Header{
+		"Authorization": {"Bearer secret"},
+		"Cookie":        {"session=1"},
+		"X-Contact":     {"ada@example.com"},
+		"Content-Type":  {"application/json"},
+	}
+
+	r, err := New([]Rule{
+		{Kind: KindHeader, Target: "authorization", Mode: ModeHash},
+		{Kind: KindHeader, Target: "cookie", Mode: ModeDrop},
+		{Kind: KindPattern, Target: "email", Mode: ModeMask},
+	}, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := r.Headers(header)
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Authorization", want: r.hash("Bearer secret")},
+		{name: "Cookie", want: ""},
+		{name: "X-Contact", want: Mask},
+		{name: "Content-Type", want: "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if value := got.Get(tt.name); value != tt.want {
+				t.Fatalf("Headers().Get(%q) = %q, want %q", tt.name, value, tt.want)
+			}
+		})
+	}
+
+	if header.Get("Authorization") != "Bearer secret" {
+		t.Fatal("Headers() modified its input")
+	}
+}
@@ -0,0 +1,100 @@
+package schedule
+
+import (
+	"bytes"
+	"errors"
+	"text/template"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/cron"
+)
+
+// horizon bounds the search for the next or previous run of a schedule, like "0 0 30 2 *" that never runs.
+const horizon = 366 * 24 * time.Hour
+
+var (
+	ErrInvalidExpression = errors.New("Invalid cron expression")
+	ErrInvalidTemplate   = errors.New("Invalid payload template")
+)
+
+// Parse checks a cron expression the way the PocketBase scheduler reads it, macros like "@hourly" included.
+func Parse(expr string) (*cron.Schedule, error) {
+	s, err := cron.NewSchedule(expr)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidExpression, err)
+	}
+
+	return s, nil
+}
+
+// Next returns the first minute after t the schedule runs at, in the location of t.
+func Next(s *cron.Schedule, t time.Time) (time.Time, bool) {
+	next := t.Truncate(time.Minute).Add(time.Minute)
+	for end := t.Add(horizon); next.Before(end); next = next.Add(time.Minute) {
+		if s.IsDue(cron.NewMoment(next)) {
+			return next, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// Prev returns the last minute before t the schedule ran at, in the location of t.
+func Prev(s *cron.Schedule, t time.Time) (time.Time, bool) {
+	prev := t.Truncate(time.Minute).Add(-time.Minute)
+	for end := t.Add(-horizon); prev.After(end); prev = prev.Add(-time.Minute) {
+		if s.IsDue(cron.NewMoment(prev)) {
+			return prev, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// Tick is the data payload templates are rendered with.
+type Tick struct {
+	Now          time.Time
+	ScheduleID   string
+	ScheduleName string
+	Bucket       string
+}
+
+// Render executes every string of a decoded JSON payload as a text/template, so a payload like
+// {"at": "{{.Now.Unix}}"} stays valid JSON whatever the rendered values contain.
+func Render(payload any, tick Tick) (any, error) {
+	switch v := payload.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			rendered, err := Render(value, tick)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = rendered
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(v))
+		for i, value := range v {
+			rendered, err := Render(value, tick)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	case string:
+		t, err := template.New("payload").Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, errors.Join(ErrInvalidTemplate, err)
+		}
+
+		var buf bytes.Buffer
+		if err = t.Execute(&buf, tick); err != nil {
+			return nil, errors.Join(ErrInvalidTemplate, err)
+		}
+		return buf.String(), nil
+	default:
+		return v, nil
+	}
+}
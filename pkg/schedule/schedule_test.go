@@ -0,0 +1,148 @@
+package schedule
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr string
+		ok   bool
+	}{
+		{"*/5 * * * *", true},
+		{"0 9 * * 1-5", true},
+		{"@hourly", true},
+		{"@daily", true},
+		{"", false},
+		{"* * * *", false},
+		{"61 * * * *", false},
+		{"@sometimes", false},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.expr)
+		if tt.ok && err != nil {
+			t.Errorf("Parse(%q) error = %v", tt.expr, err)
+		}
+
+		if !tt.ok && !errors.Is(err, ErrInvalidExpression) {
+			t.Errorf("Parse(%q) error = %v, want %v", tt.expr, err, ErrInvalidExpression)
+		}
+	}
+}
+
+func TestNextPrev(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		expr string
+		now  string
+		next string
+		prev string
+	}{
+		{"*/15 * * * *", "2025-02-03T10:07:30Z", "2025-02-03T10:15:00Z", "2025-02-03T10:00:00Z"},
+		// A schedule due right now runs next a full period later.
+		{"*/15 * * * *", "2025-02-03T10:15:00Z", "2025-02-03T10:30:00Z", "2025-02-03T10:00:00Z"},
+		{"0 9 * * 1-5", "2025-02-07T12:00:00Z", "2025-02-10T09:00:00Z", "2025-02-07T09:00:00Z"},
+		{"@daily", "2025-12-31T23:59:59Z", "2026-01-01T00:00:00Z", "2025-12-31T00:00:00Z"},
+		{"0 0 29 2 *", "2025-02-03T10:00:00Z", "", "2024-02-29T00:00:00Z"},
+		{"0 0 30 2 *", "2025-02-03T10:00:00Z", "", ""},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		next, ok := Next(s, at(tt.now))
+		if ok != (tt.next != "") || ok && !next.Equal(at(tt.next)) {
+			t.Errorf("Next(%q, %s) = %v, %v, want %q", tt.expr, tt.now, next, ok, tt.next)
+		}
+
+		prev, ok := Prev(s, at(tt.now))
+		if ok != (tt.prev != "") || ok && !prev.Equal(at(tt.prev)) {
+			t.Errorf("Prev(%q, %s) = %v, %v, want %q", tt.expr, tt.now, prev, ok, tt.prev)
+		}
+	}
+}
+
+func TestNextLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	s, err := Parse("0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, ok := Next(s, time.Date(2025, 2, 3, 8, 0, 0, 0, loc))
+	if want := time.Date(2025, 2, 3, 9, 0, 0, 0, loc); !ok || !next.Equal(want) {
+		t.Fatalf("Next() = %v, %v, want %v", next, ok, want)
+	}
+}
+
+func TestRender(t *testing.T) {
+	tick := Tick{
+		Now:          time.Date(2025, 2, 3, 10, 0, 0, 0, time.UTC),
+		ScheduleID:   "sch1",
+		ScheduleName: "nightly",
+		Bucket:       "orders",
+	}
+
+	payload := map[string]any{
+		"at":     "{{.Now.Unix}}",
+		"name":   `{{.ScheduleName}} "run"`,
+		"count":  3.0,
+		"active": true,
+		"none":   nil,
+		"tags":   []any{"{{.Bucket}}", "static", map[string]any{"id": "{{.ScheduleID}}"}},
+	}
+
+	got, err := Render(payload, tick)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{
+		"at":     "1738576800",
+		"name":   `nightly "run"`,
+		"count":  3.0,
+		"active": true,
+		"none":   nil,
+		"tags":   []any{"orders", "static", map[string]any{"id": "sch1"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Render() = %v, want %v", got, want)
+	}
+
+	if payload["at"] != "{{.Now.Unix}}" {
+		t.Fatalf("Render() changed the payload to %v", payload)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload any
+	}{
+		{"unclosed action", map[string]any{"at": "{{.Now"}},
+		{"unknown field", map[string]any{"at": "{{.Missing}}"}},
+		{"nested in a list", []any{"ok", map[string]any{"at": "{{end}}"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Render(tt.payload, Tick{}); !errors.Is(err, ErrInvalidTemplate) {
+				t.Fatalf("Render() error = %v, want %v", err, ErrInvalidTemplate)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package schema
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+const arraySuffix = "[]"
+
+// Field is the learned shape of a single JSON path.
+type Field struct {
+	Types []string `json:"types"`
+	Seen  int      `json:"seen"`
+}
+
+// Shape is a flattened view of every payload observed for a bucket and event type.
+type Shape struct {
+	Samples int               `json:"samples"`
+	Fields  map[string]*Field `json:"fields"`
+}
+
+// Retype is a path whose type was never observed before.
+type Retype struct {
+	Path string   `json:"path"`
+	From []string `json:"from"`
+	To   string   `json:"to"`
+}
+
+// Drift lists the differences between a payload and a learned shape.
+type Drift struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Retyped []Retype `json:"retyped,omitempty"`
+}
+
+func (d Drift) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Retyped) == 0
+}
+
+func NewShape() *Shape {
+	return &Shape{Fields: map[string]*Field{}}
+}
+
+// Flatten maps every path of a decoded JSON value to its type, array elements use a "[]" suffix.
+func Flatten(v any) map[string]string {
+	fields := map[string]string{}
+	flatten(fields, "", v)
+	return fields
+}
+
+func flatten(fields map[string]string, path string, v any) {
+	if path != "" {
+		fields[path] = typeOf(v)
+	}
+
+	switch t := v.(type) {
+	case map[string]any:
+		for key, child := range t {
+			if path == "" {
+				flatten(fields, key, child)
+				continue
+			}
+			flatten(fields, path+"."+key, child)
+		}
+	case []any:
+		for _, child := range t {
+			flatten(fields, path+arraySuffix, child)
+		}
+	}
+}
+
+func typeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	default:
+		return "number"
+	}
+}
+
+// Observe merges a flattened payload into the shape.
+func (s *Shape) Observe(fields map[string]string) {
+	s.Samples++
+	for path, typ := range fields {
+		f, ok := s.Fields[path]
+		if !ok {
+			f = &Field{}
+			s.Fields[path] = f
+		}
+
+		f.Seen++
+		if !slices.Contains(f.Types, typ) {
+			f.Types = append(f.Types, typ)
+			slices.Sort(f.Types)
+		}
+	}
+}
+
+// Diff compares a flattened payload with the shape. A field only counts as removed when it
+// was present in every one of at least minSamples previous payloads.
+func (s *Shape) Diff(fields map[string]string, minSamples int) Drift {
+	drift := Drift{}
+	for _, path := range slices.Sorted(maps.Keys(fields)) {
+		typ := fields[path]
+		f, ok := s.Fields[path]
+		if !ok {
+			drift.Added = append(drift.Added, path)
+			continue
+		}
+
+		if !slices.Contains(f.Types, typ) {
+			drift.Retyped = append(drift.Retyped, Retype{Path: path, From: f.Types, To: typ})
+		}
+	}
+
+	if s.Samples < minSamples {
+		return drift
+	}
+
+	for _, path := range slices.Sorted(maps.Keys(s.Fields)) {
+		if _, ok := fields[path]; ok || s.Fields[path].Seen < s.Samples {
+			continue
+		}
+
+		// Arrays may legitimately be empty, a missing element type is not a removal.
+		if strings.HasSuffix(path, arraySuffix) {
+			continue
+		}
+
+		// Children of a removed or retyped parent are implied, only report the parent.
+		if parent, ok := parentPath(path); ok {
+			if _, present := fields[parent]; !present || fields[parent] != "object" && fields[parent] != "array" {
+				continue
+			}
+		}
+
+		drift.Removed = append(drift.Removed, path)
+	}
+
+	return drift
+}
+
+func parentPath(path string) (string, bool) {
+	if trimmed, ok := strings.CutSuffix(path, arraySuffix); ok {
+		return trimmed, true
+	}
+
+	i := strings.LastIndex(path, ".")
+	if i < 0 {
+		return "", false
+	}
+
+	return path[:i], true
+}
+
+type node struct {
+	types    []string
+	required bool
+	props    map[string]*node
+	items    *node
+}
+
+// JSONSchema renders the shape as a draft 2020-12 schema, fields seen in every sample are required.
+func (s *Shape) JSONSchema() map[string]any {
+	root := &node{types: []string{"object"}, props: map[string]*node{}}
+	for _, path := range slices.Sorted(maps.Keys(s.Fields)) {
+		f := s.Fields[path]
+		n := root
+		for _, token := range strings.Split(path, ".") {
+			key, depth := token, 0
+			for trimmed, ok := strings.CutSuffix(key, arraySuffix); ok; trimmed, ok = strings.CutSuffix(key, arraySuffix) {
+				key = trimmed
+				depth++
+			}
+
+			if n.props == nil {
+				n.props = map[string]*node{}
+			}
+			child, ok := n.props[key]
+			if !ok {
+				child = &node{}
+				n.props[key] = child
+			}
+			n = child
+
+			for range depth {
+				if n.items == nil {
+					n.items = &node{}
+				}
+				n = n.items
+			}
+		}
+
+		n.types = f.Types
+		n.required = f.Seen == s.Samples
+	}
+
+	doc := render(root)
+	doc["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+
+	return doc
+}
+
+func render(n *node) map[string]any {
+	doc := map[string]any{}
+	switch len(n.types) {
+	case 0:
+	case 1:
+		doc["type"] = n.types[0]
+	default:
+		doc["type"] = n.types
+	}
+
+	if len(n.props) > 0 {
+		props := map[string]any{}
+		required := []string{}
+		for _, key := range slices.Sorted(maps.Keys(n.props)) {
+			child := n.props[key]
+			props[key] = render(child)
+			if child.required {
+				required = append(required, key)
+			}
+		}
+
+		doc["properties"] = props
+		if len(required) > 0 {
+			doc["required"] = required
+		}
+	}
+
+	if n.items != nil {
+		doc["items"] = render(n.items)
+	}
+
+	return doc
+}
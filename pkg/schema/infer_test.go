@@ -0,0 +1,198 @@
+package schema
+
+import (
+	"encoding/json"
+	"maps"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decode(t *testing.T, payload string) map[string]string {
+	t.Helper()
+
+	var v any
+	if err := json.Unmarshal([]byte(payload), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	return Flatten(v)
+}
+
+func learn(t *testing.T, payloads ...string) *Shape {
+	t.Helper()
+
+	s := NewShape()
+	for _, payload := range payloads {
+		s.Observe(decode(t, payload))
+	}
+
+	return s
+}
+
+func TestFlatten(t *testing.T) {
+	got := decode(t, `{"id": "a", "n": 1, "ok": true, "none": null, "user": {"name": "x"}, "tags": ["a"], "grid": [[1]], "items": [{"sku": "a"}, {"sku": "b", "qty": 2}]}`)
+	want := map[string]string{
+		"id":          "string",
+		"n":           "number",
+		"ok":          "boolean",
+		"none":        "null",
+		"user":        "object",
+		"user.name":   "string",
+		"tags":        "array",
+		"tags[]":      "string",
+		"grid":        "array",
+		"grid[]":      "array",
+		"grid[][]":    "number",
+		"items":       "array",
+		"items[]":     "object",
+		"items[].sku": "string",
+		"items[].qty": "number",
+	}
+
+	if !maps.Equal(got, want) {
+		t.Fatalf("Flatten() = %v, want %v", got, want)
+	}
+
+	if got := decode(t, `"text"`); len(got) != 0 {
+		t.Fatalf("Flatten() of a scalar = %v, want no paths", got)
+	}
+}
+
+func TestObserve(t *testing.T) {
+	s := learn(t, `{"id": "a", "n": 1}`, `{"id": 2}`, `{"id": "c"}`)
+
+	if s.Samples != 3 {
+		t.Fatalf("Samples = %d, want 3", s.Samples)
+	}
+
+	if f := s.Fields["id"]; f.Seen != 3 || !reflect.DeepEqual(f.Types, []string{"number", "string"}) {
+		t.Fatalf("Fields[id] = %+v, want seen 3 as number and string", f)
+	}
+
+	if f := s.Fields["n"]; f.Seen != 1 {
+		t.Fatalf("Fields[n] = %+v, want seen once", f)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	base := []string{
+		`{"id": "a", "amount": 1, "customer": {"email": "x", "name": "y"}, "tags": ["a"], "note": "n"}`,
+		`{"id": "b", "amount": 2, "customer": {"email": "x", "name": "y"}, "tags": []}`,
+		`{"id": "c", "amount": 3, "customer": {"email": "x", "name": "y"}, "tags": ["b"]}`,
+	}
+
+	tests := []struct {
+		name       string
+		payload    string
+		minSamples int
+		want       Drift
+	}{
+		{
+			name:       "same shape",
+			payload:    `{"id": "d", "amount": 4, "customer": {"email": "x", "name": "y"}, "tags": ["c"]}`,
+			minSamples: 3,
+		},
+		{
+			name:       "added field",
+			payload:    `{"id": "d", "amount": 4, "currency": "eur", "customer": {"email": "x", "name": "y", "phone": "1"}, "tags": []}`,
+			minSamples: 3,
+			want:       Drift{Added: []string{"currency", "customer.phone"}},
+		},
+		{
+			name:       "retyped field",
+			payload:    `{"id": 4, "amount": "4", "customer": {"email": "x", "name": "y"}, "tags": []}`,
+			minSamples: 3,
+			want: Drift{Retyped: []Retype{
+				{Path: "amount", From: []string{"number"}, To: "string"},
+				{Path: "id", From: []string{"string"}, To: "number"},
+			}},
+		},
+		{
+			name:       "removed field",
+			payload:    `{"id": "d", "customer": {"email": "x"}, "tags": []}`,
+			minSamples: 3,
+			want:       Drift{Removed: []string{"amount", "customer.name"}},
+		},
+		{
+			name:       "too few samples to remove",
+			payload:    `{"id": "d", "customer": {"email": "x"}, "tags": []}`,
+			minSamples: 4,
+		},
+		{
+			name:       "removed parent",
+			payload:    `{"id": "d", "amount": 4, "tags": []}`,
+			minSamples: 3,
+			want:       Drift{Removed: []string{"customer"}},
+		},
+		{
+			name:       "retyped parent",
+			payload:    `{"id": "d", "amount": 4, "customer": "cus_1", "tags": []}`,
+			minSamples: 3,
+			want:       Drift{Retyped: []Retype{{Path: "customer", From: []string{"object"}, To: "string"}}},
+		},
+		{
+			name:       "empty array",
+			payload:    `{"id": "d", "amount": 4, "customer": {"email": "x", "name": "y"}, "tags": []}`,
+			minSamples: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := learn(t, base...)
+			got := s.Diff(decode(t, tt.payload), tt.minSamples)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Diff() = %+v, want %+v", got, tt.want)
+			}
+
+			if got.Empty() != tt.want.Empty() {
+				t.Fatalf("Empty() = %v, want %v", got.Empty(), tt.want.Empty())
+			}
+		})
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	payloads := []string{
+		`{"id": "a", "amount": 1, "items": [{"sku": "a", "qty": 1}], "grid": [[1]]}`,
+		`{"id": 2, "items": [{"sku": "b"}], "grid": []}`,
+	}
+	s := learn(t, payloads...)
+
+	got, err := json.Marshal(s.JSONSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"$schema":"https://json-schema.org/draft/2020-12/schema","properties":{` +
+		`"amount":{"type":"number"},` +
+		`"grid":{"items":{"items":{"type":"number"},"type":"array"},"type":"array"},` +
+		`"id":{"type":["number","string"]},` +
+		`"items":{"items":{"properties":{"qty":{"type":"number"},"sku":{"type":"string"}},"required":["sku"],"type":"object"},"type":"array"}` +
+		`},"required":["grid","id","items"],"type":"object"}`
+	if string(got) != want {
+		t.Fatalf("JSONSchema() =\n%s\nwant\n%s", got, want)
+	}
+
+	// The inferred schema accepts the payloads it was learned from.
+	v := NewValidator()
+	for _, payload := range payloads {
+		report, err := v.Validate(got, strings.NewReader(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !report.Valid {
+			t.Fatalf("Validate(%s) against the inferred schema = %+v", payload, report.Errors)
+		}
+	}
+
+	report, err := v.Validate(got, strings.NewReader(`{"id": "c", "grid": []}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid {
+		t.Fatal("Validate() accepted a payload without required fields")
+	}
+}
@@ -0,0 +1,159 @@
+package schema
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+)
+
+const resourceURL = "splay://bucket/schema.json"
+
+// Mode decides what happens to a payload that fails validation.
+type Mode string
+
+const (
+	ModeReject Mode = "reject" // Respond with 422 and do not store the payload.
+	ModeFlag   Mode = "flag"   // Store and forward the payload, keeping the validation errors.
+	ModeHold   Mode = "hold"   // Store the payload with its validation errors but do not forward it.
+)
+
+var (
+	ErrCompilingSchema = errors.New("Error compiling json schema")
+	ErrDecodingPayload = errors.New("Error decoding payload for validation")
+)
+
+// Error is a single failed assertion of a validation report. It never holds values of the payload,
+// only where they are and what they failed, reports are stored next to redacted bodies.
+type Error struct {
+	InstanceLocation string `json:"instance_location"`
+	KeywordLocation  string `json:"keyword_location"`
+	Message          string `json:"message"`
+}
+
+// Report is the result of validating a payload against a bucket schema.
+type Report struct {
+	Valid  bool    `json:"valid"`
+	Errors []Error `json:"errors,omitempty"`
+}
+
+// Validator compiles draft 2020-12 schemas and caches them by content.
+type Validator struct {
+	cache sync.Map
+}
+
+func NewValidator() *Validator {
+	return &Validator{}
+}
+
+// Compile compiles a schema document, reusing a previous compilation of the same document.
+func (v *Validator) Compile(doc []byte) (*jsonschema.Schema, error) {
+	sum := sha256.Sum256(doc)
+	key := hex.EncodeToString(sum[:])
+	if s, ok := v.cache.Load(key); ok {
+		return s.(*jsonschema.Schema), nil
+	}
+
+	parsed, err := jsonschema.UnmarshalJSON(bytes.NewReader(doc))
+	if err != nil {
+		return nil, errors.Join(ErrCompilingSchema, err)
+	}
+
+	c := jsonschema.NewCompiler()
+	c.DefaultDraft(jsonschema.Draft2020)
+	// Schemas are user supplied, never let them reach the filesystem or network.
+	c.UseLoader(jsonschema.SchemeURLLoader{})
+	if err = c.AddResource(resourceURL, parsed); err != nil {
+		return nil, errors.Join(ErrCompilingSchema, err)
+	}
+
+	s, err := c.Compile(resourceURL)
+	if err != nil {
+		return nil, errors.Join(ErrCompilingSchema, err)
+	}
+
+	v.cache.Store(key, s)
+
+	return s, nil
+}
+
+// Validate validates a raw JSON payload against a schema document.
+func (v *Validator) Validate(doc []byte, payload io.Reader) (*Report, error) {
+	s, err := v.Compile(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, err := jsonschema.UnmarshalJSON(payload)
+	if err != nil {
+		return nil, errors.Join(ErrDecodingPayload, err)
+	}
+
+	err = s.Validate(instance)
+	if err == nil {
+		return &Report{Valid: true}, nil
+	}
+
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return nil, err
+	}
+
+	report := &Report{Valid: false}
+	for _, unit := range ve.BasicOutput().Errors {
+		if unit.Error == nil {
+			continue
+		}
+
+		report.Errors = append(report.Errors, Error{
+			InstanceLocation: unit.InstanceLocation,
+			KeywordLocation:  unit.KeywordLocation,
+			Message:          message(unit.Error.Kind),
+		})
+	}
+
+	return report, nil
+}
+
+// message describes a failed assertion with the schema side of it only, the messages of the
+// validator quote the offending values.
+func message(k jsonschema.ErrorKind) string {
+	switch k := k.(type) {
+	case *kind.Type:
+		return fmt.Sprintf("got %s, want %s", k.Got, strings.Join(k.Want, " or "))
+	case *kind.Required:
+		return fmt.Sprintf("missing properties %s", strings.Join(k.Missing, ", "))
+	case *kind.DependentRequired:
+		return fmt.Sprintf("missing properties %s", strings.Join(k.Missing, ", "))
+	case *kind.Format:
+		return fmt.Sprintf("not a valid %s", k.Want)
+	case *kind.Pattern:
+		return fmt.Sprintf("does not match pattern %s", k.Want)
+	case *kind.Enum:
+		return "not one of the allowed values"
+	case *kind.Const:
+		return "not the allowed value"
+	case *kind.AdditionalProperties:
+		return "additional properties not allowed"
+	}
+
+	path := k.KeywordPath()
+	if len(path) == 0 {
+		return "invalid"
+	}
+
+	return fmt.Sprintf("%s failed", path[len(path)-1])
+}
+
+// IsEmpty reports whether a stored schema column holds no schema.
+func IsEmpty(doc []byte) bool {
+	trimmed := bytes.TrimSpace(doc)
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null"))
+}
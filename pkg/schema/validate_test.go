@@ -0,0 +1,181 @@
+package schema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const orderSchema = `{
+	"type": "object",
+	"properties": {
+		"id": {"type": "string"},
+		"amount": {"type": "number", "minimum": 0},
+		"items": {"type": "array", "items": {"type": "object", "required": ["sku"]}}
+	},
+	"required": ["id", "amount"]
+}`
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		payload   string
+		valid     bool
+		locations []string
+	}{
+		{name: "valid", payload: `{"id": "o_1", "amount": 12.5, "items": [{"sku": "a"}]}`, valid: true},
+		{name: "extra fields", payload: `{"id": "o_1", "amount": 0, "note": "gift"}`, valid: true},
+		{name: "missing required", payload: `{"id": "o_1"}`, locations: []string{""}},
+		{name: "wrong type", payload: `{"id": 1, "amount": 1}`, locations: []string{"/id"}},
+		{name: "below minimum", payload: `{"id": "o_1", "amount": -1}`, locations: []string{"/amount"}},
+		{name: "nested item", payload: `{"id": "o_1", "amount": 1, "items": [{"sku": "a"}, {}]}`, locations: []string{"/items/1"}},
+		{name: "not an object", payload: `[1, 2]`, locations: []string{""}},
+	}
+
+	v := NewValidator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := v.Validate([]byte(orderSchema), strings.NewReader(tt.payload))
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			if report.Valid != tt.valid {
+				t.Fatalf("Validate() valid = %v, want %v, errors %+v", report.Valid, tt.valid, report.Errors)
+			}
+
+			if tt.valid {
+				if len(report.Errors) != 0 {
+					t.Fatalf("Validate() of a valid payload returned errors %+v", report.Errors)
+				}
+				return
+			}
+
+			for _, location := range tt.locations {
+				found := false
+				for _, e := range report.Errors {
+					found = found || e.InstanceLocation == location && e.KeywordLocation != "" && e.Message != ""
+				}
+				if !found {
+					t.Fatalf("Validate() errors %+v, want one at %q", report.Errors, location)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateLeavesValuesOut(t *testing.T) {
+	const doc = `{
+		"type": "object",
+		"properties": {
+			"email": {"type": "string", "minLength": 20},
+			"token": {"type": "string", "pattern": "^tok_"},
+			"plan": {"enum": ["free", "pro"]},
+			"kind": {"const": "order"},
+			"pin": {"type": "string", "maxLength": 4},
+			"age": {"type": "integer"}
+		},
+		"additionalProperties": false
+	}`
+	const payload = `{"email": "secret-one", "token": "secret-two", "plan": "secret-three", "kind": "secret-four", "pin": "secret-five", "age": "secret-six", "secret-seven": 1}`
+
+	v := NewValidator()
+	report, err := v.Validate([]byte(doc), strings.NewReader(payload))
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	if report.Valid || len(report.Errors) < 6 {
+		t.Fatalf("Validate() errors %+v, want one per property", report.Errors)
+	}
+
+	for _, e := range report.Errors {
+		if strings.Contains(e.Message, "secret") || e.Message == "" {
+			t.Fatalf("Validate() error message %q at %s holds a payload value", e.Message, e.InstanceLocation)
+		}
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		payload string
+		err     error
+	}{
+		{name: "invalid schema json", schema: `{"type": `, payload: `{}`, err: ErrCompilingSchema},
+		{name: "invalid keyword value", schema: `{"type": "integerish"}`, payload: `{}`, err: ErrCompilingSchema},
+		{name: "remote reference", schema: `{"$ref": "https://example.com/schema.json"}`, payload: `{}`, err: ErrCompilingSchema},
+		{name: "file reference", schema: `{"$ref": "file:///etc/passwd"}`, payload: `{}`, err: ErrCompilingSchema},
+		{name: "invalid payload", schema: orderSchema, payload: `{"id": `, err: ErrDecodingPayload},
+	}
+
+	v := NewValidator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := v.Validate([]byte(tt.schema), strings.NewReader(tt.payload))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Validate() error = %v, want %v", err, tt.err)
+			}
+
+			if report != nil {
+				t.Fatalf("Validate() report = %+v, want none", report)
+			}
+		})
+	}
+}
+
+func TestCompileCache(t *testing.T) {
+	v := NewValidator()
+
+	first, err := v.Compile([]byte(orderSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := v.Compile([]byte(orderSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first != second {
+		t.Fatal("Compile() of the same document compiled it again")
+	}
+
+	other, err := v.Compile([]byte(`{"type": "object"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if other == first {
+		t.Fatal("Compile() of another document returned the cached schema")
+	}
+
+	// Failed compilations are not cached.
+	if _, err = v.Compile([]byte(`{"type": 1}`)); err == nil {
+		t.Fatal("Compile() of an invalid document succeeded")
+	}
+	if _, err = v.Compile([]byte(`{"type": 1}`)); !errors.Is(err, ErrCompilingSchema) {
+		t.Fatalf("Compile() of an invalid document again error = %v, want %v", err, ErrCompilingSchema)
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	tests := []struct {
+		doc  string
+		want bool
+	}{
+		{doc: "", want: true},
+		{doc: "  \n", want: true},
+		{doc: "null", want: true},
+		{doc: " null ", want: true},
+		{doc: "{}", want: false},
+		{doc: `{"type": "object"}`, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := IsEmpty([]byte(tt.doc)); got != tt.want {
+			t.Errorf("IsEmpty(%q) = %v, want %v", tt.doc, got, tt.want)
+		}
+	}
+}
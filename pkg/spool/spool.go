@@ -0,0 +1,124 @@
+package spool
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+var ErrClosed = errors.New("Spool is closed")
+
+// Buffer collects a body in memory and spills it to a temporary file once it outgrows the threshold,
+// so large bodies never sit in memory. Readers opened with Open see everything written before and
+// may be used concurrently with each other, but not with writes.
+type Buffer struct {
+	mu        sync.Mutex
+	threshold int64
+	mem       []byte
+	file      *os.File
+	size      int64
+	closed    bool
+}
+
+// New returns an empty buffer keeping up to threshold bytes in memory.
+func New(threshold int64) *Buffer {
+	return &Buffer{threshold: threshold}
+}
+
+// Write appends p, moving the buffer to a temporary file when it grows past the threshold.
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return 0, ErrClosed
+	}
+
+	if b.file == nil && b.size+int64(len(p)) > b.threshold {
+		file, err := os.CreateTemp("", "splay-spool-*")
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err = file.Write(b.mem); err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return 0, err
+		}
+
+		b.file, b.mem = file, nil
+	}
+
+	if b.file != nil {
+		n, err := b.file.Write(p)
+		b.size += int64(n)
+		return n, err
+	}
+
+	b.mem = append(b.mem, p...)
+	b.size += int64(len(p))
+
+	return len(p), nil
+}
+
+// Size returns how many bytes were written.
+func (b *Buffer) Size() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.size
+}
+
+// Open returns a reader over the content, it lets the buffer act as a filesystem.FileReader.
+func (b *Buffer) Open() (io.ReadSeekCloser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	if b.file != nil {
+		return nopCloser{io.NewSectionReader(b.file, 0, b.size)}, nil
+	}
+
+	return nopCloser{bytes.NewReader(b.mem)}, nil
+}
+
+// Bytes returns the content, reading it back into memory when it was spilled.
+func (b *Buffer) Bytes() ([]byte, error) {
+	r, err := b.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// Close releases the buffer and removes its temporary file.
+func (b *Buffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed, b.mem = true, nil
+
+	if b.file == nil {
+		return nil
+	}
+
+	return errors.Join(b.file.Close(), os.Remove(b.file.Name()))
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
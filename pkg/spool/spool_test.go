@@ -0,0 +1,91 @@
+package spool
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestBuffer(t *testing.T) {
+	tests := []struct {
+		name    string
+		writes  []string
+		spilled bool
+	}{
+		{name: "empty", writes: nil, spilled: false},
+		{name: "in memory", writes: []string{"abc", "def"}, spilled: false},
+		{name: "exactly the threshold", writes: []string{"abcd", "efgh"}, spilled: false},
+		{name: "spilled", writes: []string{"abcd", "efgh", "i"}, spilled: true},
+		{name: "large write", writes: []string{"abcdefghijklmnop"}, spilled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New(8)
+
+			want := ""
+			for _, w := range tt.writes {
+				if _, err := io.WriteString(b, w); err != nil {
+					t.Fatal(err)
+				}
+				want += w
+			}
+
+			if b.Size() != int64(len(want)) {
+				t.Fatalf("Size() = %d, want %d", b.Size(), len(want))
+			}
+
+			if (b.file != nil) != tt.spilled {
+				t.Fatalf("spilled = %v, want %v", b.file != nil, tt.spilled)
+			}
+
+			// Every reader starts over at the beginning.
+			for range 2 {
+				r, err := b.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r.Close()
+
+				if string(got) != want {
+					t.Fatalf("Open() read %q, want %q", got, want)
+				}
+			}
+
+			got, err := b.Bytes()
+			if err != nil || !bytes.Equal(got, []byte(want)) {
+				t.Fatalf("Bytes() = %q, %v, want %q", got, err, want)
+			}
+
+			var name string
+			if b.file != nil {
+				name = b.file.Name()
+			}
+
+			if err = b.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if name != "" {
+				if _, err = os.Stat(name); !errors.Is(err, os.ErrNotExist) {
+					t.Fatalf("Close() left %s behind: %v", name, err)
+				}
+			}
+
+			if _, err = b.Open(); !errors.Is(err, ErrClosed) {
+				t.Fatalf("Open() after Close() = %v, want %v", err, ErrClosed)
+			}
+
+			if _, err = b.Write([]byte("x")); !errors.Is(err, ErrClosed) {
+				t.Fatalf("Write() after Close() = %v, want %v", err, ErrClosed)
+			}
+		})
+	}
+}
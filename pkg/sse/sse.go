@@ -0,0 +1,98 @@
+package sse
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxLineSize = 16 << 20
+
+var ErrLineTooLong = errors.New("Event stream line too long")
+
+// Event is one server-sent event, Retry is zero unless the server changed the reconnection delay.
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+// Reader reads the events of a text/event-stream body. Comments and events without data are skipped,
+// the id of the last event read is kept for reconnecting with Last-Event-ID.
+type Reader struct {
+	scanner *bufio.Scanner
+	lastID  string
+	retry   time.Duration
+}
+
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLineSize)
+
+	return &Reader{scanner: scanner}
+}
+
+// LastID returns the id of the last event read.
+func (r *Reader) LastID() string {
+	return r.lastID
+}
+
+// Retry returns the last reconnection delay the server asked for, zero when it did not.
+func (r *Reader) Retry() time.Duration {
+	return r.retry
+}
+
+// Next returns the next event, io.EOF once the stream ended.
+func (r *Reader) Next() (Event, error) {
+	var ev Event
+	var data []string
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		if line == "" {
+			if data == nil {
+				ev = Event{}
+				continue
+			}
+
+			ev.Data = strings.Join(data, "\n")
+			if ev.ID == "" {
+				ev.ID = r.lastID
+			}
+			ev.Retry = r.retry
+
+			return ev, nil
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			ev.ID, r.lastID = value, value
+		case "event":
+			ev.Event = value
+		case "data":
+			data = append(data, value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				r.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return Event{}, ErrLineTooLong
+		}
+		return Event{}, err
+	}
+
+	return Event{}, io.EOF
+}
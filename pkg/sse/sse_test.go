@@ -0,0 +1,127 @@
+package sse
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []Event
+	}{
+		{
+			name:   "single event",
+			stream: "id: 1-0\nevent: receive\ndata: {\"a\":1}\n\n",
+			want:   []Event{{ID: "1-0", Event: "receive", Data: `{"a":1}`}},
+		},
+		{
+			name:   "multi line data",
+			stream: "data: one\ndata: two\n\n",
+			want:   []Event{{Data: "one\ntwo"}},
+		},
+		{
+			name:   "no space after the colon",
+			stream: "id:7\ndata:x\n\n",
+			want:   []Event{{ID: "7", Data: "x"}},
+		},
+		{
+			name:   "comments and keep-alives are skipped",
+			stream: ": keep-alive\n\n: hello\ndata: x\n\n",
+			want:   []Event{{Data: "x"}},
+		},
+		{
+			name:   "events without data are dropped",
+			stream: "event: ping\n\ndata: x\n\n",
+			want:   []Event{{Data: "x"}},
+		},
+		{
+			name:   "id carries over to events without one",
+			stream: "id: 3\ndata: a\n\ndata: b\n\n",
+			want:   []Event{{ID: "3", Data: "a"}, {ID: "3", Data: "b"}},
+		},
+		{
+			name:   "unknown fields are ignored",
+			stream: "foo: bar\ndata: x\n\n",
+			want:   []Event{{Data: "x"}},
+		},
+		{
+			name:   "unterminated event is not dispatched",
+			stream: "data: a\n\ndata: b\n",
+			want:   []Event{{Data: "a"}},
+		},
+		{
+			name:   "retry applies to the events after it",
+			stream: "retry: 3000\n\ndata: x\n\nretry: nope\ndata: y\n\n",
+			want:   []Event{{Data: "x", Retry: 3 * time.Second}, {Data: "y", Retry: 3 * time.Second}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(strings.NewReader(tt.stream))
+			for i, want := range tt.want {
+				got, err := r.Next()
+				if err != nil {
+					t.Fatalf("Next() %d error = %v", i, err)
+				}
+
+				if got != want {
+					t.Fatalf("Next() %d = %+v, want %+v", i, got, want)
+				}
+			}
+
+			if _, err := r.Next(); err != io.EOF {
+				t.Fatalf("Next() after the last event error = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestReaderState(t *testing.T) {
+	r := NewReader(strings.NewReader("retry: 1500\n\nid: 5-2\ndata: x\n\nid: 6-2\nevent: receive\n\n"))
+	if r.Retry() != 0 || r.LastID() != "" {
+		t.Fatalf("Retry(), LastID() before reading = %s, %q", r.Retry(), r.LastID())
+	}
+
+	if _, err := r.Next(); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Retry() != 1500*time.Millisecond || r.LastID() != "5-2" {
+		t.Fatalf("Retry(), LastID() = %s, %q, want 1.5s, 5-2", r.Retry(), r.LastID())
+	}
+
+	// An id without data still moves the last event id, like browsers do.
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("Next() error = %v, want io.EOF", err)
+	}
+
+	if r.LastID() != "6-2" {
+		t.Fatalf("LastID() = %q, want 6-2", r.LastID())
+	}
+}
+
+func TestLineTooLong(t *testing.T) {
+	r := NewReader(strings.NewReader("data: " + strings.Repeat("x", maxLineSize) + "\n\n"))
+	if _, err := r.Next(); !errors.Is(err, ErrLineTooLong) {
+		t.Fatalf("Next() error = %v, want %v", err, ErrLineTooLong)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestReadError(t *testing.T) {
+	r := NewReader(failingReader{})
+	if _, err := r.Next(); err == nil || err == io.EOF {
+		t.Fatalf("Next() error = %v, want the read error", err)
+	}
+}
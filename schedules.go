@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"splay/pkg/priorityqueue"
+	"splay/pkg/schedule"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// BucketSchedule emits its rendered payload into the bucket on every tick of its cron expression.
+type BucketSchedule struct {
+	ID       string        `json:"id,omitempty" db:"id"`
+	BucketID string        `json:"bucket_id,omitempty" db:"bucket"`
+	Name     string        `json:"name,omitempty" db:"name"`
+	Cron     string        `json:"cron,omitempty" db:"cron"`
+	Payload  types.JSONRaw `json:"payload,omitempty" db:"payload"`
+	Enabled  bool          `json:"enabled,omitempty" db:"enabled"`
+}
+
+// ScheduleFromRecord reads a bucket_schedules record.
+func ScheduleFromRecord(record *core.Record) BucketSchedule {
+	return BucketSchedule{
+		ID:       record.Id,
+		BucketID: record.GetString("bucket"),
+		Name:     record.GetString("name"),
+		Cron:     record.GetString("cron"),
+		Payload:  types.JSONRaw(record.GetString("payload")),
+		Enabled:  record.GetBool("enabled"),
+	}
+}
+
+// ScheduleJobID is the id of the cron job of a schedule.
+func ScheduleJobID(id string) string {
+	return "bucketSchedule:" + id
+}
+
+// RegisterSchedules adds a cron job for every enabled schedule.
+func RegisterSchedules(app *App, pq *priorityqueue.Scheduler[Notification]) error {
+	schedules := []BucketSchedule{}
+	err := app.DB().
+		Select(scheduleColumns...).
+		From("bucket_schedules").
+		Where(dbx.HashExp{"enabled": true}).
+		All(&schedules)
+	if err != nil {
+		return errors.Join(ErrFetchingSchedule, err)
+	}
+
+	for _, s := range schedules {
+		RegisterSchedule(app, pq, s)
+	}
+
+	return nil
+}
+
+// RegisterSchedule replaces the cron job of a schedule, disabled schedules are only removed.
+func RegisterSchedule(app *App, pq *priorityqueue.Scheduler[Notification], s BucketSchedule) {
+	app.Cron().Remove(ScheduleJobID(s.ID))
+	if !s.Enabled {
+		return
+	}
+
+	err := app.Cron().Add(ScheduleJobID(s.ID), s.Cron, func() {
+		if err := RunSchedule(app, pq, s.ID, time.Now()); err != nil {
+			app.Logger().Warn("Running bucket schedule failed", "schedule", s.ID, "error", err.Error())
+		}
+	})
+	if err != nil {
+		app.Logger().Warn("Registering bucket schedule failed", "schedule", s.ID, "error", err.Error())
+	}
+}
+
+// SyncSchedule keeps the cron job of a schedule in line with its record.
+func SyncSchedule(app *App, pq *priorityqueue.Scheduler[Notification]) func(e *core.RecordEvent) error {
+	return func(e *core.RecordEvent) error {
+		RegisterSchedule(app, pq, ScheduleFromRecord(e.Record))
+		return e.Next()
+	}
+}
+
+// UnregisterSchedule removes the cron job of a deleted schedule.
+func UnregisterSchedule(app *App) func(e *core.RecordEvent) error {
+	return func(e *core.RecordEvent) error {
+		app.Cron().Remove(ScheduleJobID(e.Record.Id))
+		return e.Next()
+	}
+}
+
+// ValidateBucketSchedule checks the cron expression and that the payload is an object of valid templates.
+func ValidateBucketSchedule(e *core.RecordRequestEvent) error {
+	errs := validation.Errors{}
+	if _, err := schedule.Parse(e.Record.GetString("cron")); err != nil {
+		errs["cron"] = validation.NewError("validation_invalid_cron", err.Error())
+	}
+
+	if _, err := SchedulePayload(types.JSONRaw(e.Record.GetString("payload")), schedule.Tick{Now: time.Now()}); err != nil {
+		errs["payload"] = validation.NewError("validation_invalid_payload", err.Error())
+	}
+
+	if len(errs) > 0 {
+		return e.BadRequestError("invalid schedule", errs)
+	}
+
+	return e.Next()
+}
+
+// EnrichSchedule adds the next run time of enabled schedules as next_run.
+func EnrichSchedule(e *core.RecordEnrichEvent) error {
+	nextRun := ""
+	if s, err := schedule.Parse(e.Record.GetString("cron")); err == nil && e.Record.GetBool("enabled") {
+		if next, ok := schedule.Next(s, time.Now().UTC()); ok {
+			if dt, err := types.ParseDateTime(next); err == nil {
+				nextRun = dt.String()
+			}
+		}
+	}
+
+	e.Record.WithCustomData(true)
+	e.Record.Set("next_run", nextRun)
+
+	return e.Next()
+}
+
+// SchedulePayload renders the payload of a schedule, an empty payload is an empty object.
+func SchedulePayload(raw types.JSONRaw, tick schedule.Tick) (map[string]any, error) {
+	var payload any = map[string]any{}
+	if len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return nil, errors.Join(ErrDecodingBody, err)
+		}
+	}
+
+	if _, ok := payload.(map[string]any); !ok {
+		return nil, ErrPayloadNotObject
+	}
+
+	rendered, err := schedule.Render(payload, tick)
+	if err != nil {
+		return nil, err
+	}
+
+	return rendered.(map[string]any), nil
+}
+
+// RunSchedule emits one tick of a schedule into its bucket and records the outcome on the schedule.
+func RunSchedule(app *App, pq *priorityqueue.Scheduler[Notification], id string, now time.Time) error {
+	err := runSchedule(app, pq, id, now)
+
+	lastError := ""
+	if err != nil {
+		lastError = err.Error()
+	}
+
+	_, updateErr := app.DB().NewQuery(updateBucketSchedule).Bind(dbx.Params{
+		"id":         id,
+		"last_run":   types.NowDateTime().String(),
+		"last_error": lastError,
+	}).Execute()
+
+	return errors.Join(err, updateErr)
+}
+
+func runSchedule(app *App, pq *priorityqueue.Scheduler[Notification], id string, now time.Time) error {
+	s := BucketSchedule{}
+	err := app.DB().
+		Select(scheduleColumns...).
+		From("bucket_schedules").
+		Where(dbx.HashExp{"id": id}).
+		One(&s)
+	if err != nil {
+		return errors.Join(ErrFetchingSchedule, err)
+	}
+
+	bucket := Bucket{}
+	err = app.DB().
+		Select(bucketColumns...).
+		From("buckets").
+		Where(dbx.HashExp{"id": s.BucketID}).
+		One(&bucket)
+	if err != nil {
+		return errors.Join(ErrFetchingBucket, err)
+	}
+
+	userLimits, err := FindUserLimits(app, bucket.UserID)
+	if err != nil {
+		return errors.Join(ErrFetchingUserLimits, err)
+	}
+
+	reserved, err := ReserveUsage(app, bucket, userLimits, now, 1)
+	if err != nil {
+		return err
+	}
+
+	if reserved == 0 {
+		return ErrQuotaExceeded
+	}
+	stored := false
+	defer func() {
+		if !stored {
+			ReleaseUsage(app, bucket, now, reserved)
+		}
+	}()
+
+	body, err := SchedulePayload(s.Payload, schedule.Tick{
+		Now:          now.UTC(),
+		ScheduleID:   s.ID,
+		ScheduleName: s.Name,
+		Bucket:       bucket.Slug,
+	})
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return errors.Join(ErrDecodingBody, err)
+	}
+
+	report, err := ValidateBody(bucket, bytes.NewReader(raw))
+	if err != nil {
+		return errors.Join(ErrValidatingSchema, err)
+	}
+
+	if Rejected(bucket, report) {
+		return ErrPayloadRejected
+	}
+
+	// The tick minute keeps the delivery id stable, so destinations can dedupe a tick that ran twice.
+	ingest, err := PrepareIngest(app, bucket, Received{
+		Body:       body,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Report:     report,
+		Size:       len(raw),
+		EventType:  ScheduleEventType,
+		DeliveryID: s.ID + ":" + now.UTC().Truncate(time.Minute).Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	brls, err := InsertIngests(app.DB(), []*Ingest{ingest})
+	if err != nil {
+		DiscardIngests(app, []*Ingest{ingest})
+		return err
+	}
+	stored = true
+
+	return Deliver(app, pq, nil, bucket, []*Ingest{ingest}, brls, "")
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"splay/pkg/schema"
+	"sync"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ValidateBucketSchema rejects bucket writes carrying a schema that does not compile.
+func ValidateBucketSchema(e *core.RecordRequestEvent) error {
+	doc := []byte(e.Record.GetString("schema"))
+	if schema.IsEmpty(doc) {
+		return e.Next()
+	}
+
+	if _, err := schemas.Compile(doc); err != nil {
+		return e.BadRequestError("invalid json schema", validation.Errors{"schema": validation.NewError("validation_invalid_schema", err.Error())})
+	}
+
+	return e.Next()
+}
+
+// SchemaStatus maps a validation report to the receive log schema_status and schema_errors columns.
+func SchemaStatus(bucket Bucket, report *schema.Report) (string, any) {
+	if report == nil {
+		return NoStatus, nil
+	}
+
+	if report.Valid {
+		return SchemaStatusValid, nil
+	}
+
+	errs, err := json.Marshal(report.Errors)
+	if err != nil {
+		errs = nil
+	}
+
+	if schema.Mode(bucket.SchemaMode) == schema.ModeHold {
+		return SchemaStatusHeld, string(errs)
+	}
+
+	return SchemaStatusFlagged, string(errs)
+}
+
+// LearnSchema folds a received body into the learned schema of the bucket and event type,
+// a new version is recorded and a notification sent whenever the body drifts from it.
+func LearnSchema(app *App, bucket Bucket, eventType string, body map[string]any) error {
+	mu, _ := schemaLocks.LoadOrStore(bucket.ID, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	current := BucketSchema{}
+	err := app.DB().
+		Select("id", "bucket", "event_type", "version", "shape").
+		From("bucket_schemas").
+		Where(dbx.HashExp{"bucket": bucket.ID, "event_type": eventType}).
+		OrderBy("version DESC").
+		Limit(1).
+		One(&current)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return errors.Join(ErrFetchingSchema, err)
+	}
+
+	shape := schema.NewShape()
+	if current.ID != "" {
+		if err = json.Unmarshal(current.Shape, shape); err != nil {
+			return errors.Join(ErrDecodingSchema, err)
+		}
+	}
+
+	fields := schema.Flatten(body)
+	drift := shape.Diff(fields, minDriftSamples)
+	shape.Observe(fields)
+
+	shapeBytes, err := json.Marshal(shape)
+	if err != nil {
+		return errors.Join(ErrSavingSchema, err)
+	}
+
+	jsonSchema, err := json.Marshal(shape.JSONSchema())
+	if err != nil {
+		return errors.Join(ErrSavingSchema, err)
+	}
+
+	updated := time.Now().UTC().Format(time.DateTime)
+	if current.ID != "" && drift.Empty() {
+		_, err = app.DB().NewQuery(updateBucketSchema).Bind(dbx.Params{
+			"id":          current.ID,
+			"shape":       string(shapeBytes),
+			"json_schema": string(jsonSchema),
+			"updated":     updated,
+		}).Execute()
+		if err != nil {
+			return errors.Join(ErrSavingSchema, err)
+		}
+
+		return nil
+	}
+
+	// The first version is the baseline, there is nothing to drift from yet.
+	var driftParam any
+	if current.ID != "" {
+		driftBytes, err := json.Marshal(drift)
+		if err != nil {
+			return errors.Join(ErrSavingSchema, err)
+		}
+		driftParam = string(driftBytes)
+	}
+
+	_, err = app.DB().NewQuery(insertBucketSchema).Bind(dbx.Params{
+		"bucket":      bucket.ID,
+		"event_type":  eventType,
+		"version":     current.Version + 1,
+		"shape":       string(shapeBytes),
+		"json_schema": string(jsonSchema),
+		"drift":       driftParam,
+		"created":     updated,
+		"updated":     updated,
+	}).Execute()
+	if err != nil {
+		return errors.Join(ErrSavingSchema, err)
+	}
+
+	if current.ID == "" {
+		return nil
+	}
+
+	return NotifyDrift(app, bucket, SchemaDrift{
+		BucketID:  bucket.ID,
+		EventType: eventType,
+		Version:   current.Version + 1,
+		Drift:     drift,
+	})
+}
+
+// NotifyDrift sends a drift over realtime and, when configured on the bucket, to a webhook and an email address.
+func NotifyDrift(app *App, bucket Bucket, d SchemaDrift) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return errors.Join(ErrNotifyingDrift, err)
+	}
+
+	Broadcast(app, bucket.UserID, "users/"+bucket.UserID+"/buckets/"+bucket.ID+"/schema", data)
+	Emit(app, bucket.UserID, bucket.ID, MetaSchemaDrift, d)
+
+	subject := fmt.Sprintf("Payload schema drift on bucket %s", bucket.Name)
+	text := fmt.Sprintf("Event type %q of bucket %s drifted to schema version %d:\n\n%s", d.EventType, bucket.Slug, d.Version, data)
+	if err = NotifyChannels(app, bucket.DriftWebhookURL, bucket.DriftEmail, MetaSchemaDrift, subject, text, data); err != nil {
+		return errors.Join(ErrNotifyingDrift, err)
+	}
+
+	return nil
+}
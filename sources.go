@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"splay/pkg/priorityqueue"
+	"splay/pkg/pull"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Due reports whether the source interval has passed since the last poll. Polls run from a
+// minutely cron, the slack keeps a poll that ran a little late from skipping a whole minute.
+func (s BucketSource) Due(now time.Time) bool {
+	interval := time.Duration(cmp.Or(s.Interval, defaultPollInterval)) * time.Minute
+	return s.LastPolled.IsZero() || !now.Before(s.LastPolled.Time().Add(interval-pollSlack))
+}
+
+// ValidateBucketSource checks the request headers of a source are a JSON object of strings.
+func ValidateBucketSource(e *core.RecordRequestEvent) error {
+	if raw := e.Record.GetString("headers"); raw != "" && raw != "null" {
+		headers := map[string]string{}
+		if err := json.Unmarshal([]byte(raw), &headers); err != nil {
+			return e.BadRequestError("invalid headers", validation.Errors{
+				"headers": validation.NewError("validation_invalid_headers", "Headers must be an object of strings."),
+			})
+		}
+	}
+
+	return e.Next()
+}
+
+// PollSources starts a poll for every enabled source that is due, skipping sources still being polled.
+func PollSources(app *App, pq *priorityqueue.Scheduler[Notification]) {
+	sources := []BucketSource{}
+	err := app.DB().
+		Select(sourceColumns...).
+		From("bucket_sources").
+		Where(dbx.HashExp{"enabled": true}).
+		All(&sources)
+	if err != nil {
+		app.Logger().Warn("Fetching bucket sources failed", "error", errors.Join(ErrFetchingSource, err).Error())
+		return
+	}
+
+	now := time.Now()
+	for _, source := range sources {
+		if !source.Due(now) {
+			continue
+		}
+
+		if _, running := polling.LoadOrStore(source.ID, struct{}{}); running {
+			continue
+		}
+
+		go func() {
+			defer polling.Delete(source.ID)
+			if err := PollSource(app, pq, source); err != nil {
+				app.Logger().Warn("Polling bucket source failed", "source", source.ID, "error", err.Error())
+			}
+		}()
+	}
+}
+
+// PollSource fetches a source once and ingests its new items. The validators of the response are only
+// kept when every item was handled, so a failed poll fetches the whole document again.
+func PollSource(app *App, pq *priorityqueue.Scheduler[Notification], source BucketSource) error {
+	bucket := Bucket{}
+	err := app.DB().
+		Select(bucketColumns...).
+		From("buckets").
+		Where(dbx.HashExp{"id": source.BucketID}).
+		One(&bucket)
+	if err != nil {
+		return errors.Join(ErrFetchingBucket, err)
+	}
+
+	etag, lastModified := source.ETag, source.LastModified
+	items, newETag, newLastModified, err := FetchSource(source)
+	if err == nil && items != nil {
+		err = IngestSourceItems(app, pq, bucket, source, items)
+	}
+
+	if err == nil {
+		etag, lastModified = newETag, newLastModified
+	}
+
+	lastError := ""
+	if err != nil {
+		lastError = err.Error()
+	}
+
+	_, updateErr := app.DB().NewQuery(updateBucketSourcePoll).Bind(dbx.Params{
+		"id":            source.ID,
+		"etag":          etag,
+		"last_modified": lastModified,
+		"last_polled":   types.NowDateTime().String(),
+		"last_error":    lastError,
+	}).Execute()
+
+	return errors.Join(err, updateErr)
+}
+
+// FetchSource makes a conditional request for a source and extracts its items, which are nil when
+// the source did not change since the last poll.
+func FetchSource(source BucketSource) ([]map[string]any, string, string, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, source.URL, nil)
+	if err != nil {
+		return nil, "", "", errors.Join(ErrCreatingRequest, err)
+	}
+
+	headers := map[string]string{}
+	if len(source.Headers) > 0 && string(source.Headers) != "null" {
+		if err = json.Unmarshal(source.Headers, &headers); err != nil {
+			return nil, "", "", errors.Join(ErrDecodingHeaders, err)
+		}
+	}
+
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	if source.ETag != "" {
+		req.Header.Set("If-None-Match", source.ETag)
+	}
+
+	if source.LastModified != "" {
+		req.Header.Set("If-Modified-Since", source.LastModified)
+	}
+
+	resp, err := publicClient.Do(req)
+	if err != nil {
+		return nil, "", "", errors.Join(ErrFetchingSource, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, source.ETag, source.LastModified, nil
+	}
+
+	if resp.StatusCode < StatusOkBot || resp.StatusCode >= StatusOkTop {
+		return nil, "", "", errors.Join(ErrFetchingSource, fmt.Errorf("unexpected status code %d", resp.StatusCode))
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, config.MaxBodySize+1))
+	if err != nil {
+		return nil, "", "", errors.Join(ErrFetchingSource, err)
+	}
+
+	if int64(len(body)) > config.MaxBodySize {
+		return nil, "", "", ErrBodyTooLarge
+	}
+
+	items, err := pull.Items(source.Type, body, source.ItemsPath)
+	if err != nil {
+		return nil, "", "", errors.Join(ErrFetchingSource, err)
+	}
+
+	return items, resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"), nil
+}
+
+// IngestSourceItems stores the items of a source that were not seen before. Items refused by the
+// bucket schema are remembered as seen, items over the monthly quota are left for a later poll.
+func IngestSourceItems(app *App, pq *priorityqueue.Scheduler[Notification], bucket Bucket, source BucketSource, items []map[string]any) error {
+	keyPath := cmp.Or(source.ItemKey, defaultItemKey)
+	keys := make([]any, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, pull.Key(item, keyPath))
+	}
+
+	seenKeys := []string{}
+	err := app.DB().
+		Select("key").
+		From("bucket_source_items").
+		Where(dbx.HashExp{"source": source.ID}).
+		AndWhere(dbx.In("key", keys...)).
+		Column(&seenKeys)
+	if err != nil {
+		return errors.Join(ErrFetchingSource, err)
+	}
+
+	seen := map[string]bool{}
+	for _, key := range seenKeys {
+		seen[key] = true
+	}
+
+	userLimits, err := FindUserLimits(app, bucket.UserID)
+	if err != nil {
+		return errors.Join(ErrFetchingUserLimits, err)
+	}
+
+	unseen := map[string]bool{}
+	for _, key := range keys {
+		if !seen[key.(string)] {
+			unseen[key.(string)] = true
+		}
+	}
+
+	// Quota is reserved for every new item up front, items that are not stored are given back.
+	now := time.Now()
+	reserved, err := ReserveUsage(app, bucket, userLimits, now, len(unseen))
+	if err != nil {
+		return err
+	}
+	ingests := []*Ingest{}
+	accepted := 0
+	defer func() {
+		if accepted == 0 {
+			DiscardIngests(app, ingests)
+		}
+		ReleaseUsage(app, bucket, now, reserved-accepted)
+	}()
+
+	handled := []string{}
+	var quotaErr error
+	for i, item := range items {
+		key := keys[i].(string)
+		if seen[key] {
+			continue
+		}
+
+		if len(ingests) >= reserved {
+			quotaErr = ErrQuotaExceeded
+			break
+		}
+
+		seen[key] = true
+		handled = append(handled, key)
+
+		raw, err := json.Marshal(item)
+		if err != nil {
+			return errors.Join(ErrDecodingBody, err)
+		}
+
+		report, err := ValidateBody(bucket, bytes.NewReader(raw))
+		if err != nil {
+			return errors.Join(ErrValidatingSchema, err)
+		}
+
+		if Rejected(bucket, report) {
+			continue
+		}
+
+		ingest, err := PrepareIngest(app, bucket, Received{
+			Body:       item,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Report:     report,
+			Size:       len(raw),
+			DeliveryID: key,
+		})
+		if err != nil {
+			return err
+		}
+		ingests = append(ingests, ingest)
+	}
+
+	brls := []BucketReceiveLog{}
+	err = app.RunInTransaction(func(txApp core.App) error {
+		created := now.UTC().Format(time.DateTime)
+		for _, key := range handled {
+			_, err := txApp.DB().NewQuery(insertBucketSourceItem).Bind(dbx.Params{
+				"source":  source.ID,
+				"key":     key,
+				"created": created,
+			}).Execute()
+			if err != nil {
+				return err
+			}
+		}
+
+		brls, err = InsertIngests(txApp.DB(), ingests)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	accepted = len(ingests)
+
+	if len(ingests) > 0 {
+		if err = Deliver(app, pq, nil, bucket, ingests, brls, ""); err != nil {
+			return err
+		}
+	}
+
+	return quotaErr
+}
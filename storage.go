@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"path"
+	"slices"
+	"splay/pkg/envelope"
+	"splay/pkg/formdata"
+	"splay/pkg/schema"
+	"splay/pkg/spool"
+	"strings"
+	"sync"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// StoreBody encodes a stored body into the body_file of a receive log and returns its storage key.
+func StoreBody(app *App, logID, bucketID string, dataKey []byte, body any) (string, error) {
+	return StoreLogFile(app, logID, bucketID, bodyFileName(), dataKey, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(body)
+	})
+}
+
+// StoreRawBody copies a body as it was received into the body_file of a receive log and returns
+// its storage key.
+func StoreRawBody(app *App, logID, bucketID string, dataKey []byte, raw BodySource) (string, error) {
+	return StoreLogFile(app, logID, bucketID, bodyFileName(), dataKey, func(w io.Writer) error {
+		r, _, err := raw()
+		if err != nil {
+			return errors.Join(ErrReadingBody, err)
+		}
+		defer r.Close()
+
+		_, err = io.Copy(w, r)
+		return err
+	})
+}
+
+func bodyFileName() string {
+	return "body_" + security.RandomStringWithAlphabet(logFileSuffixLength, logFileSuffixAlphabet) + ".json"
+}
+
+// StoreLogFile writes a file of a receive log and returns its storage key. The content is encrypted
+// while write produces it when dataKey is set, and staged in a spool as uploads need to seek.
+func StoreLogFile(app *App, logID, bucketID, name string, dataKey []byte, write func(w io.Writer) error) (string, error) {
+	key, err := LogFileKey(app, logID, name)
+	if err != nil {
+		return "", err
+	}
+
+	staged := spool.New(spoolMemory)
+	defer staged.Close()
+
+	var w io.WriteCloser = nopWriteCloser{staged}
+	if dataKey != nil {
+		if w, err = envelope.NewWriter(staged, dataKey, []byte(bucketID)); err != nil {
+			return "", errors.Join(ErrEncrypting, err)
+		}
+	}
+
+	if err = write(w); err != nil {
+		return "", err
+	}
+
+	if err = w.Close(); err != nil {
+		return "", err
+	}
+
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return "", err
+	}
+	defer fsys.Close()
+
+	file := &filesystem.File{Reader: staged, Name: name, OriginalName: name, Size: staged.Size()}
+	if err = fsys.UploadFile(file, key); err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// LogFileKey returns the storage key of a file of a receive log.
+func LogFileKey(app core.App, logID, name string) (string, error) {
+	collection, err := app.FindCachedCollectionByNameOrId("bucket_receive_logs")
+	if err != nil {
+		return "", err
+	}
+
+	return collection.BaseFilesPath() + "/" + logID + "/" + name, nil
+}
+
+// AttachmentLimits returns the multipart file limits of a bucket.
+func AttachmentLimits(bucket Bucket) formdata.Limits {
+	limits := formdata.Limits{MaxFileSize: config.MaxAttachmentSize, MaxFiles: config.MaxAttachments}
+	if bucket.MaxAttachmentSize > 0 && bucket.MaxAttachmentSize < limits.MaxFileSize {
+		limits.MaxFileSize = bucket.MaxAttachmentSize
+	}
+
+	if !schema.IsEmpty(bucket.AttachmentTypes) {
+		if err := json.Unmarshal(bucket.AttachmentTypes, &limits.Types); err != nil {
+			// A malformed list must not open the bucket to every type.
+			limits.Types = []string{"-"}
+		}
+	}
+
+	return limits
+}
+
+// StoreAttachments writes the files of a multipart request to the files field of a receive log,
+// encrypting them like bodies when the bucket has a data key. Every written file is recorded in staged.
+func StoreAttachments(app *App, staged *StagedFiles, logID, bucketID string, dataKey []byte, files []formdata.File) ([]Attachment, error) {
+	attachments := make([]Attachment, 0, len(files))
+	for _, f := range files {
+		file, err := filesystem.NewFileFromBytes(f.Data, f.Filename)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := StoreLogFile(app, logID, bucketID, file.Name, dataKey, func(w io.Writer) error {
+			_, err := w.Write(f.Data)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		staged.Written(key)
+
+		attachments = append(attachments, Attachment{
+			Field:       f.Field,
+			Filename:    f.Filename,
+			ContentType: f.ContentType,
+			Size:        len(f.Data),
+			File:        file.Name,
+		})
+	}
+
+	return attachments, nil
+}
+
+// OpenLogFile opens a file of a receive log, decrypting it while it is read when it was stored encrypted.
+func OpenLogFile(app *App, logID, bucketID, name string) (io.ReadCloser, error) {
+	key, err := LogFileKey(app, logID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	r, _, err := StorageSource(app, key)()
+	if err != nil {
+		return nil, err
+	}
+
+	buffered := bufio.NewReader(r)
+	peek, _ := buffered.Peek(max(len(envelope.StreamPrefix), len(envelope.Prefix)+1))
+	switch {
+	case envelope.IsStream(peek):
+		if masterKey == nil {
+			r.Close()
+			return nil, ErrMissingMasterKey
+		}
+
+		dataKey, err := BucketDataKey(app, bucketID)
+		if err != nil {
+			r.Close()
+			return nil, errors.Join(ErrDecrypting, err)
+		}
+
+		plaintext, err := envelope.NewReader(buffered, dataKey, []byte(bucketID))
+		if err != nil {
+			r.Close()
+			return nil, errors.Join(ErrDecrypting, err)
+		}
+
+		return &storageReader{ReadCloser: io.NopCloser(plaintext), close: r.Close}, nil
+	case envelope.IsEncryptedJSON(peek):
+		// Files written before streaming encryption are sealed as a whole.
+		defer r.Close()
+		raw, err := io.ReadAll(buffered)
+		if err != nil {
+			return nil, err
+		}
+
+		plaintext, err := DecryptColumn(app, bucketID, raw)
+		if err != nil {
+			return nil, err
+		}
+
+		return io.NopCloser(bytes.NewReader(plaintext)), nil
+	default:
+		return &storageReader{ReadCloser: io.NopCloser(buffered), close: r.Close}, nil
+	}
+}
+
+// LogFileSource streams a file of a receive log, decrypting it on the way.
+func LogFileSource(app *App, logID, bucketID, name string) BodySource {
+	return func() (io.ReadCloser, int64, error) {
+		r, err := OpenLogFile(app, logID, bucketID, name)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return r, -1, nil
+	}
+}
+
+// JSONSource forwards a decoded body, encoding it while it is sent.
+func JSONSource(body any) BodySource {
+	return func() (io.ReadCloser, int64, error) {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(json.NewEncoder(pw).Encode(body))
+		}()
+
+		return pr, -1, nil
+	}
+}
+
+// MultipartSource rebuilds a multipart request from its captured fields and stored files.
+func MultipartSource(app *App, logID, bucketID, boundary string, fields []byte, attachments []Attachment) BodySource {
+	return func() (io.ReadCloser, int64, error) {
+		values := map[string]any{}
+		if err := json.Unmarshal(fields, &values); err != nil {
+			return nil, 0, err
+		}
+
+		parts := make([]formdata.Part, 0, len(attachments))
+		for _, a := range attachments {
+			parts = append(parts, formdata.Part{
+				Field:       a.Field,
+				Filename:    a.Filename,
+				ContentType: a.ContentType,
+				Open: func() (io.ReadCloser, error) {
+					return OpenLogFile(app, logID, bucketID, a.File)
+				},
+			})
+		}
+
+		pr, pw := io.Pipe()
+		go func() {
+			// Reusing the original boundary keeps the forwarded Content-Type header valid.
+			pw.CloseWithError(formdata.Write(pw, boundary, values, slices.Sorted(maps.Keys(values)), parts))
+		}()
+
+		return pr, -1, nil
+	}
+}
+
+// URLEncodedSource rebuilds an url encoded form from its captured fields.
+func URLEncodedSource(fields []byte) BodySource {
+	return func() (io.ReadCloser, int64, error) {
+		values := map[string]any{}
+		if err := json.Unmarshal(fields, &values); err != nil {
+			return nil, 0, err
+		}
+
+		body := formdata.Encode(values)
+
+		return io.NopCloser(bytes.NewReader(body)), int64(len(body)), nil
+	}
+}
+
+// RotateLogFile re-encrypts a body or attachment in file storage with a new data key into newFile,
+// the new file is staged as written and the old one as obsolete.
+func RotateLogFile(app core.App, fsys *filesystem.System, staged *StagedFiles, logID, file, newFile string, oldKey, newKey, aad []byte) error {
+	key, err := LogFileKey(app, logID, file)
+	if err != nil {
+		return err
+	}
+
+	newKeyPath, err := LogFileKey(app, logID, newFile)
+	if err != nil {
+		return err
+	}
+
+	r, err := fsys.GetFile(key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	buffered := bufio.NewReader(r)
+	peek, _ := buffered.Peek(max(len(envelope.StreamPrefix), len(envelope.Prefix)+1))
+
+	plaintext := io.Reader(buffered)
+	switch {
+	case envelope.IsStream(peek), envelope.IsEncryptedJSON(peek):
+		if oldKey == nil {
+			return ErrMissingMasterKey
+		}
+
+		if envelope.IsStream(peek) {
+			if plaintext, err = envelope.NewReader(buffered, oldKey, aad); err != nil {
+				return err
+			}
+			break
+		}
+
+		raw, err := io.ReadAll(buffered)
+		if err != nil {
+			return err
+		}
+
+		if raw, err = envelope.DecryptJSON(oldKey, aad, raw); err != nil {
+			return err
+		}
+		plaintext = bytes.NewReader(raw)
+	}
+
+	rotated := spool.New(spoolMemory)
+	defer rotated.Close()
+
+	w, err := envelope.NewWriter(rotated, newKey, aad)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(w, plaintext); err != nil {
+		return err
+	}
+
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	if err = fsys.UploadFile(&filesystem.File{Reader: rotated, Name: newFile, OriginalName: newFile, Size: rotated.Size()}, newKeyPath); err != nil {
+		return err
+	}
+	staged.Written(newKeyPath)
+	staged.Obsolete(key)
+
+	return nil
+}
+
+// RenameLogFile returns a fresh name for a stored file, replacing the random suffix of its name.
+func RenameLogFile(name string) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if i := strings.LastIndex(base, "_"); i >= 0 && len(base)-i-1 == logFileSuffixLength {
+		base = base[:i]
+	}
+
+	return base + "_" + security.RandomStringWithAlphabet(logFileSuffixLength, logFileSuffixAlphabet) + ext
+}
+
+// StagedFiles tracks the storage side of a transaction, storage cannot roll back with the database.
+// Written files are removed again when the transaction fails, obsolete ones once it committed.
+type StagedFiles struct {
+	mu       sync.Mutex
+	written  []string
+	obsolete []string
+}
+
+// Written records a file uploaded on behalf of the transaction.
+func (s *StagedFiles) Written(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.written = append(s.written, key)
+}
+
+// Obsolete records a file the transaction replaces.
+func (s *StagedFiles) Obsolete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.obsolete = append(s.obsolete, key)
+}
+
+// Rollback deletes the written files, fsys may be nil to open a filesystem.
+func (s *StagedFiles) Rollback(app core.App, fsys *filesystem.System) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delete(app, fsys, s.written)
+	s.written, s.obsolete = nil, nil
+}
+
+// Commit deletes the obsolete files, fsys may be nil to open a filesystem.
+func (s *StagedFiles) Commit(app core.App, fsys *filesystem.System) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delete(app, fsys, s.obsolete)
+	s.written, s.obsolete = nil, nil
+}
+
+// delete removes files on a best effort basis, leftovers are only logged as they hold no live data.
+func (s *StagedFiles) delete(app core.App, fsys *filesystem.System, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	if fsys == nil {
+		var err error
+		if fsys, err = app.NewFilesystem(); err != nil {
+			app.Logger().Warn("Deleting staged files failed", "files", len(keys), "error", err.Error())
+			return
+		}
+		defer fsys.Close()
+	}
+
+	for _, key := range keys {
+		if err := fsys.Delete(key); err != nil {
+			app.Logger().Warn("Deleting staged file failed", "file", key, "error", err.Error())
+		}
+	}
+}
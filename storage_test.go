@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io"
+	"mime/multipart"
+	"splay/pkg/formdata"
+	"strings"
+	"testing"
+)
+
+func TestMultipartSourceReusesBoundary(t *testing.T) {
+	const boundary = "original-boundary-1234"
+	source := MultipartSource(nil, "log", "bucket", boundary, []byte(`{"b": "2", "a": ["1", "3"]}`), nil)
+
+	r, _, err := source()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(body), "--"+boundary+"\r\n") {
+		t.Fatalf("MultipartSource() body starts with %q, want the original boundary", body[:min(len(body), 40)])
+	}
+
+	form, err := formdata.Parse("multipart/form-data; boundary="+boundary, strings.NewReader(string(body)), formdata.Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := form.Fields["a"].([]any); len(got) != 2 || got[0] != "1" || got[1] != "3" || form.Fields["b"] != "2" {
+		t.Fatalf("MultipartSource() fields = %v", form.Fields)
+	}
+
+	// Fields come back in key order.
+	mr := multipart.NewReader(strings.NewReader(string(body)), boundary)
+	part, err := mr.NextPart()
+	if err != nil || part.FormName() != "a" {
+		t.Fatalf("first part = %v, %v, want a", part, err)
+	}
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"splay/pkg/pull"
+	"strconv"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// TailEvent is a receive or forward log as streamed by the tail endpoint, receive events carry the
+// stored body and headers. Bodies over tailBodyLimit are left out, BodyOmitted is set instead.
+type TailEvent struct {
+	Kind             string        `json:"kind"`
+	ID               string        `json:"id"`
+	Bucket           string        `json:"bucket"`
+	BucketReceiveLog string        `json:"bucket_receive_log,omitempty"`
+	EventType        string        `json:"event_type,omitempty"`
+	DeliveryID       string        `json:"delivery_id,omitempty"`
+	SchemaStatus     string        `json:"schema_status,omitempty"`
+	IP               string        `json:"ip,omitempty"`
+	DestinationURL   string        `json:"destination_url,omitempty"`
+	StatusCode       int           `json:"status_code,omitempty"`
+	Headers          types.JSONRaw `json:"headers,omitempty"`
+	Body             types.JSONRaw `json:"body,omitempty"`
+	BodyOmitted      bool          `json:"body_omitted,omitempty"`
+	Created          string        `json:"created"`
+	// Seq is the rowid of the log, the position of the event in its table.
+	Seq int64 `json:"-" db:"seq"`
+
+	bodyFile string
+}
+
+// TailCursor is a position in a tail stream, the rowids of the last receive and forward logs sent.
+// Rowids grow with every insert, created only has second precision and ids are random.
+type TailCursor struct {
+	Receive int64
+	Forward int64
+}
+
+// ParseTailCursor reads a cursor written by String, ok is false for anything else.
+func ParseTailCursor(s string) (TailCursor, bool) {
+	receive, forward, ok := strings.Cut(s, "-")
+	if !ok {
+		return TailCursor{}, false
+	}
+
+	r, err := strconv.ParseInt(receive, 10, 64)
+	if err != nil || r < 0 {
+		return TailCursor{}, false
+	}
+
+	f, err := strconv.ParseInt(forward, 10, 64)
+	if err != nil || f < 0 {
+		return TailCursor{}, false
+	}
+
+	return TailCursor{Receive: r, Forward: f}, true
+}
+
+func (c TailCursor) String() string {
+	return strconv.FormatInt(c.Receive, 10) + "-" + strconv.FormatInt(c.Forward, 10)
+}
+
+// Next returns the cursor past ev.
+func (c TailCursor) Next(ev TailEvent) TailCursor {
+	if ev.Kind == TailForward {
+		c.Forward = ev.Seq
+	} else {
+		c.Receive = ev.Seq
+	}
+
+	return c
+}
+
+// StartTailCursor returns the cursor before the events of a bucket created at or after since.
+func StartTailCursor(app *App, bucketID string, since time.Time) (TailCursor, error) {
+	c := TailCursor{}
+	for table, seq := range map[string]*int64{"bucket_receive_logs": &c.Receive, "bucket_forward_logs": &c.Forward} {
+		err := app.DB().
+			Select("COALESCE(MAX(rowid), 0)").
+			From(table).
+			Where(dbx.HashExp{"bucket": bucketID}).
+			AndWhere(dbx.NewExp("created < {:since}", dbx.Params{"since": since.UTC().Format(time.DateTime)})).
+			Row(seq)
+		if err != nil {
+			return c, errors.Join(ErrFetchingLogs, err)
+		}
+	}
+
+	return c, nil
+}
+
+// TailFilter narrows the events of a tail stream.
+type TailFilter struct {
+	// Kind is "receive" or "forward", empty streams both.
+	Kind string
+	// EventType matches receive logs and the forwards of receive logs of that type.
+	EventType string
+	// Status is a forward status code like "404", a class like "5xx", "ok" or "failed",
+	// or a schema status like "held" for receive logs.
+	Status string
+	// Match holds dot separated body paths and the values they must have, forwards match on the
+	// body of their receive log. Bodies over tailBodyLimit never match.
+	Match map[string]string
+}
+
+var statusPattern = regexp.MustCompile(`^([1-5][0-9][0-9]|[1-5]xx|ok|failed|valid|flagged|held)$`)
+
+// ParseTailFilter reads the kind, event_type, status and repeated match=path=value query parameters.
+func ParseTailFilter(query url.Values) (TailFilter, error) {
+	f := TailFilter{
+		Kind:      query.Get("kind"),
+		EventType: query.Get("event_type"),
+		Status:    strings.ToLower(query.Get("status")),
+		Match:     map[string]string{},
+	}
+
+	if f.Kind != "" && f.Kind != TailReceive && f.Kind != TailForward {
+		return f, validation.Errors{"kind": validation.NewError("validation_invalid_kind", "Must be receive or forward.")}
+	}
+
+	if f.Status != "" && !statusPattern.MatchString(f.Status) {
+		return f, validation.Errors{"status": validation.NewError("validation_invalid_status", "Must be a status code, a class like 5xx, ok, failed or a schema status.")}
+	}
+
+	for _, m := range query["match"] {
+		path, value, ok := strings.Cut(m, "=")
+		if !ok || strings.TrimSpace(path) == "" {
+			return f, validation.Errors{"match": validation.NewError("validation_invalid_match", "Must be path=value.")}
+		}
+		f.Match[strings.TrimSpace(path)] = value
+	}
+
+	return f, nil
+}
+
+// Matches reports whether an event passes the filter, body is the receive body the match paths are read from.
+func (f TailFilter) Matches(ev TailEvent, body []byte) bool {
+	if f.Kind != "" && ev.Kind != f.Kind {
+		return false
+	}
+
+	if f.EventType != "" && ev.EventType != f.EventType {
+		return false
+	}
+
+	if !f.matchesStatus(ev) {
+		return false
+	}
+
+	if len(f.Match) == 0 {
+		return true
+	}
+
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return false
+	}
+
+	for path, want := range f.Match {
+		value, ok := pull.Lookup(doc, path)
+		if !ok {
+			return false
+		}
+
+		got, isString := value.(string)
+		if !isString {
+			raw, _ := json.Marshal(value)
+			got = string(raw)
+		}
+
+		if got != want {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (f TailFilter) matchesStatus(ev TailEvent) bool {
+	switch f.Status {
+	case "":
+		return true
+	case SchemaStatusValid, SchemaStatusFlagged, SchemaStatusHeld:
+		return ev.Kind == TailReceive && ev.SchemaStatus == f.Status
+	}
+
+	if ev.Kind != TailForward {
+		return false
+	}
+
+	ok := ev.StatusCode >= StatusOkBot && ev.StatusCode < StatusOkTop
+	code := strconv.Itoa(ev.StatusCode)
+	switch {
+	case f.Status == "ok":
+		return ok
+	case f.Status == "failed":
+		return !ok
+	case strings.HasSuffix(f.Status, "xx"):
+		return code[0] == f.Status[0]
+	default:
+		return code == f.Status
+	}
+}
+
+// TailEvents returns the receive and forward logs of a bucket past the cursor after, in stream order.
+// Each table is read a page at a time, more is true when a page was full and the events past the
+// last event of that page are left for the next call.
+func TailEvents(app *App, bucketID string, after TailCursor) (events []TailEvent, more bool, err error) {
+	receives := []struct {
+		BucketReceiveLog
+		Seq int64 `db:"seq"`
+	}{}
+	err = app.DB().
+		Select("rowid AS seq", "id", "bucket", "body", "body_file", "headers", "ip", "event_type", "delivery_id", "schema_status", "created").
+		From("bucket_receive_logs").
+		Where(dbx.HashExp{"bucket": bucketID}).
+		AndWhere(dbx.NewExp("rowid > {:seq}", dbx.Params{"seq": after.Receive})).
+		OrderBy("rowid").
+		Limit(tailBatchSize).
+		All(&receives)
+	if err != nil {
+		return nil, false, errors.Join(ErrFetchingLogs, err)
+	}
+
+	forwards := []TailEvent{}
+	err = app.DB().
+		Select("f.rowid AS seq", "f.id", "f.bucket", "f.bucket_receive_log", "f.destination_url", "f.status_code", "f.created", "COALESCE(r.event_type, '') AS event_type").
+		From("bucket_forward_logs f").
+		LeftJoin("bucket_receive_logs r", dbx.NewExp("r.id = f.bucket_receive_log")).
+		Where(dbx.HashExp{"f.bucket": bucketID}).
+		AndWhere(dbx.NewExp("f.rowid > {:seq}", dbx.Params{"seq": after.Forward})).
+		OrderBy("f.rowid").
+		Limit(tailBatchSize).
+		All(&forwards)
+	if err != nil {
+		return nil, false, errors.Join(ErrFetchingLogs, err)
+	}
+
+	received := make([]TailEvent, 0, len(receives))
+	for _, r := range receives {
+		received = append(received, TailEvent{
+			Kind:         TailReceive,
+			ID:           r.ID,
+			Bucket:       r.Bucket,
+			EventType:    r.EventType,
+			DeliveryID:   r.DeliveryID,
+			SchemaStatus: r.SchemaStatus,
+			IP:           r.IP,
+			Headers:      r.Headers,
+			Body:         r.Body,
+			Created:      r.Created,
+			Seq:          r.Seq,
+			bodyFile:     r.BodyFile,
+		})
+	}
+	for i := range forwards {
+		forwards[i].Kind = TailForward
+	}
+
+	events, more = MergeTailEvents(received, forwards, len(receives) == tailBatchSize, len(forwards) == tailBatchSize)
+	return events, more, nil
+}
+
+// MergeTailEvents interleaves pages of receive and forward events by creation second, receives first.
+// Both stay in insertion order so the cursor never moves past an event that was not sent. A full
+// page may be followed by events sorting before the rest of the other page, the merge stops once
+// a full page runs out and more is true.
+func MergeTailEvents(receives, forwards []TailEvent, receivesFull, forwardsFull bool) (events []TailEvent, more bool) {
+	events = make([]TailEvent, 0, len(receives)+len(forwards))
+	i, j := 0, 0
+	for i < len(receives) || j < len(forwards) {
+		if (receivesFull && i == len(receives)) || (forwardsFull && j == len(forwards)) {
+			return events, true
+		}
+
+		if j == len(forwards) || (i < len(receives) && receives[i].Created <= forwards[j].Created) {
+			events = append(events, receives[i])
+			i++
+		} else {
+			events = append(events, forwards[j])
+			j++
+		}
+	}
+
+	return events, receivesFull || forwardsFull
+}
+
+// ReadReceiveBody decodes the stored body of a receive log, from its column or file storage. Bodies
+// over limit bytes are not read and ok is false, a limit of zero reads any body.
+func ReadReceiveBody(app *App, bucketID, logID string, column []byte, file string, limit int64) (body []byte, ok bool, err error) {
+	if file == "" {
+		if body, err = DecodeColumn(app, bucketID, column); err != nil {
+			return nil, false, err
+		}
+
+		if limit > 0 && int64(len(body)) > limit {
+			return nil, false, nil
+		}
+
+		return body, true, nil
+	}
+
+	reader, err := OpenLogFile(app, logID, bucketID, file)
+	if err != nil {
+		return nil, false, errors.Join(ErrOpeningBody, err)
+	}
+	defer reader.Close()
+
+	var r io.Reader = reader
+	if limit > 0 {
+		r = io.LimitReader(reader, limit+1)
+	}
+
+	if body, err = io.ReadAll(r); err != nil {
+		return nil, false, errors.Join(ErrOpeningBody, err)
+	}
+
+	if limit > 0 && int64(len(body)) > limit {
+		return nil, false, nil
+	}
+
+	return body, true, nil
+}
+
+// HandleTail streams the receive and forward logs of a bucket as server-sent events. Streams resume
+// after the Last-Event-ID header or last_event_id parameter.
+func HandleTail(app *App) RequestFunc {
+	return func(e *core.RequestEvent) error {
+		record, err := app.FindRecordById("buckets", e.Request.PathValue("id"))
+		if err != nil {
+			return e.NotFoundError("bucket not found", err)
+		}
+
+		info, err := e.RequestInfo()
+		if err != nil {
+			return e.BadRequestError("", err)
+		}
+
+		if ok, err := app.CanAccessRecord(record, info, record.Collection().ViewRule); !ok || err != nil {
+			return e.NotFoundError("bucket not found", err)
+		}
+
+		filter, err := ParseTailFilter(e.Request.URL.Query())
+		if err != nil {
+			return e.BadRequestError("invalid tail filter", err)
+		}
+
+		// New streams start with the events of the current second.
+		lastID := cmp.Or(e.Request.Header.Get("Last-Event-ID"), e.Request.URL.Query().Get("last_event_id"))
+		cursor, ok := ParseTailCursor(lastID)
+		if !ok {
+			if cursor, err = StartTailCursor(app, record.Id, time.Now()); err != nil {
+				return e.InternalServerError("could not tail bucket", err)
+			}
+		}
+
+		watch, stop := feed.Watch(record.Id)
+		defer stop()
+
+		// Streams of API tokens end at the next keep-alive once the token is revoked or expires.
+		token, byToken := e.Get(apiTokenContextKey).(APIToken)
+
+		rc := http.NewResponseController(e.Response)
+		_ = rc.SetWriteDeadline(time.Time{})
+
+		e.Response.Header().Set("Content-Type", "text/event-stream")
+		e.Response.Header().Set("Cache-Control", "no-cache")
+		e.Response.Header().Set("X-Accel-Buffering", "no")
+		e.Response.WriteHeader(http.StatusOK)
+		fmt.Fprint(e.Response, "retry: 3000\n\n")
+
+		keepAlive := time.NewTicker(tailKeepAlive)
+		defer keepAlive.Stop()
+
+		ctx := e.Request.Context()
+		for {
+			events, more, err := TailEvents(app, record.Id, cursor)
+			if err != nil {
+				app.Logger().Warn("Tailing bucket failed", "bucket", record.Id, "error", err.Error())
+				return nil
+			}
+
+			for _, ev := range events {
+				cursor = cursor.Next(ev)
+				if err = writeTailEvent(app, e.Response, filter, ev, cursor); err != nil {
+					return nil
+				}
+			}
+
+			if err = rc.Flush(); err != nil {
+				return nil
+			}
+
+			// Backlogs are sent page after page without waiting for new events.
+			if more {
+				if ctx.Err() != nil {
+					return nil
+				}
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-watch:
+			case <-keepAlive.C:
+				if byToken {
+					if current, err := FindAPITokenByID(app, token.ID); err != nil || !current.Active(time.Now()) {
+						return nil
+					}
+				}
+
+				if _, err = fmt.Fprint(e.Response, ": keep-alive\n\n"); err != nil {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// writeTailEvent decodes, filters and writes one event with the cursor past it as its id, only
+// write errors are returned.
+func writeTailEvent(app *App, w io.Writer, filter TailFilter, ev TailEvent, cursor TailCursor) error {
+	var body []byte
+	var complete bool
+	var err error
+	switch {
+	case ev.Kind == TailReceive:
+		if body, complete, err = ReadReceiveBody(app, ev.Bucket, ev.ID, ev.Body, ev.bodyFile, tailBodyLimit); err != nil {
+			app.Logger().Warn("Decoding tailed log failed", "id", ev.ID, "error", err.Error())
+			return nil
+		}
+
+		ev.Body, ev.BodyOmitted = body, !complete
+		if ev.Headers, err = DecodeColumn(app, ev.Bucket, ev.Headers); err != nil {
+			app.Logger().Warn("Decoding tailed log failed", "id", ev.ID, "error", err.Error())
+			return nil
+		}
+	case len(filter.Match) > 0:
+		receive := struct {
+			Body     types.JSONRaw `db:"body"`
+			BodyFile string        `db:"body_file"`
+		}{}
+		err = app.DB().
+			Select("body", "body_file").
+			From("bucket_receive_logs").
+			Where(dbx.HashExp{"id": ev.BucketReceiveLog}).
+			One(&receive)
+		if err != nil {
+			return nil
+		}
+
+		if body, _, err = ReadReceiveBody(app, ev.Bucket, ev.BucketReceiveLog, receive.Body, receive.BodyFile, tailBodyLimit); err != nil {
+			return nil
+		}
+	}
+
+	if !filter.Matches(ev, body) {
+		return nil
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return nil
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", cursor, ev.Kind, data)
+	return err
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestParseTailCursor(t *testing.T) {
+	tests := []struct {
+		input string
+		want  TailCursor
+		ok    bool
+	}{
+		{"0-0", TailCursor{}, true},
+		{"12-7", TailCursor{Receive: 12, Forward: 7}, true},
+		{"", TailCursor{}, false},
+		{"12", TailCursor{}, false},
+		{"12-", TailCursor{}, false},
+		{"-1-2", TailCursor{}, false},
+		{"a-1", TailCursor{}, false},
+		{"2025-01-01 10:00:00/receive/abc", TailCursor{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, ok := ParseTailCursor(tt.input)
+			if ok != tt.ok || got != tt.want {
+				t.Fatalf("ParseTailCursor(%q) = %+v, %v, want %+v, %v", tt.input, got, ok, tt.want, tt.ok)
+			}
+
+			if ok && got.String() != tt.input {
+				t.Fatalf("String() = %q, want %q", got.String(), tt.input)
+			}
+		})
+	}
+}
+
+func TestTailCursorNext(t *testing.T) {
+	c := TailCursor{Receive: 3, Forward: 5}
+	c = c.Next(TailEvent{Kind: TailReceive, Seq: 4})
+	c = c.Next(TailEvent{Kind: TailForward, Seq: 9})
+
+	if want := (TailCursor{Receive: 4, Forward: 9}); c != want {
+		t.Fatalf("Next() = %+v, want %+v", c, want)
+	}
+}
+
+func TestMergeTailEvents(t *testing.T) {
+	receive := func(seq int64, created string) TailEvent {
+		return TailEvent{Kind: TailReceive, Seq: seq, Created: created}
+	}
+	forward := func(seq int64, created string) TailEvent {
+		return TailEvent{Kind: TailForward, Seq: seq, Created: created}
+	}
+
+	tests := []struct {
+		name         string
+		receives     []TailEvent
+		forwards     []TailEvent
+		receivesFull bool
+		forwardsFull bool
+		want         []TailEvent
+		more         bool
+	}{
+		{
+			name:     "interleaved by second, receives first",
+			receives: []TailEvent{receive(1, "10:00:00"), receive(2, "10:00:01")},
+			forwards: []TailEvent{forward(1, "10:00:00"), forward(2, "10:00:02")},
+			want:     []TailEvent{receive(1, "10:00:00"), forward(1, "10:00:00"), receive(2, "10:00:01"), forward(2, "10:00:02")},
+		},
+		{
+			// Events of the same second keep their insertion order, the random ids play no part.
+			name:     "same second in insertion order",
+			receives: []TailEvent{{Kind: TailReceive, Seq: 1, ID: "zzz", Created: "10:00:00"}, {Kind: TailReceive, Seq: 2, ID: "aaa", Created: "10:00:00"}},
+			want:     []TailEvent{{Kind: TailReceive, Seq: 1, ID: "zzz", Created: "10:00:00"}, {Kind: TailReceive, Seq: 2, ID: "aaa", Created: "10:00:00"}},
+		},
+		{
+			name:         "full receive page stops the merge",
+			receives:     []TailEvent{receive(1, "10:00:00"), receive(2, "10:00:01")},
+			forwards:     []TailEvent{forward(1, "10:00:01"), forward(2, "10:00:05")},
+			receivesFull: true,
+			want:         []TailEvent{receive(1, "10:00:00"), receive(2, "10:00:01")},
+			more:         true,
+		},
+		{
+			name:         "full forward page stops the merge",
+			receives:     []TailEvent{receive(1, "10:00:03")},
+			forwards:     []TailEvent{forward(1, "10:00:01"), forward(2, "10:00:02")},
+			forwardsFull: true,
+			want:         []TailEvent{forward(1, "10:00:01"), forward(2, "10:00:02")},
+			more:         true,
+		},
+		{
+			name:         "full page taken whole",
+			receives:     []TailEvent{receive(1, "10:00:00")},
+			forwards:     []TailEvent{forward(1, "10:00:01")},
+			forwardsFull: true,
+			want:         []TailEvent{receive(1, "10:00:00"), forward(1, "10:00:01")},
+			more:         true,
+		},
+		{
+			name: "empty",
+			want: []TailEvent{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, more := MergeTailEvents(tt.receives, tt.forwards, tt.receivesFull, tt.forwardsFull)
+			if !slices.Equal(tailKeys(got), tailKeys(tt.want)) || more != tt.more {
+				t.Fatalf("MergeTailEvents() = %+v, %v, want %+v, %v", got, more, tt.want, tt.more)
+			}
+		})
+	}
+}
+
+func tailKeys(events []TailEvent) []string {
+	keys := make([]string, 0, len(events))
+	for _, ev := range events {
+		keys = append(keys, fmt.Sprintf("%s/%d/%s", ev.Kind, ev.Seq, ev.ID))
+	}
+
+	return keys
+}
+
+// Pages read one after the other from the cursor of the previous one cover every event once, even
+// when several events share a second.
+func TestMergeTailEventsPages(t *testing.T) {
+	receives, forwards := []TailEvent{}, []TailEvent{}
+	for seq := int64(1); seq <= 7; seq++ {
+		receives = append(receives, TailEvent{Kind: TailReceive, Seq: seq, Created: "10:00:00"})
+		forwards = append(forwards, TailEvent{Kind: TailForward, Seq: seq, Created: "10:00:00"})
+	}
+
+	page := func(events []TailEvent, after int64) ([]TailEvent, bool) {
+		i, _ := slices.BinarySearchFunc(events, after+1, func(ev TailEvent, seq int64) int { return int(ev.Seq - seq) })
+		events = events[i:]
+		if len(events) >= 3 {
+			return events[:3], true
+		}
+		return events, false
+	}
+
+	cursor, sent := TailCursor{}, 0
+	for range 20 {
+		r, rFull := page(receives, cursor.Receive)
+		f, fFull := page(forwards, cursor.Forward)
+		events, more := MergeTailEvents(r, f, rFull, fFull)
+		for _, ev := range events {
+			next := cursor.Next(ev)
+			if next == cursor {
+				t.Fatalf("event %+v sent twice", ev)
+			}
+			cursor = next
+			sent++
+		}
+		if !more {
+			break
+		}
+	}
+
+	if want := (TailCursor{Receive: 7, Forward: 7}); cursor != want || sent != 14 {
+		t.Fatalf("cursor %+v after %d events, want %+v after 14", cursor, sent, want)
+	}
+}